@@ -0,0 +1,103 @@
+// See usage below
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	buildDiffFrom string
+	buildDiffTo   string
+	buildDiffArch string
+	buildDiffJSON bool
+
+	cmdBuildDiff = &cobra.Command{
+		Use:   "build-diff",
+		Short: "cosa build-diff [--from ID] [--to ID] [--arch ARCH] [--json]",
+		Long: "Show the package, advisory, kernel, artifact size, meta.json and " +
+			"OSTree commit metadata changes between two builds. By default, " +
+			"the latest build is compared with the one before it.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          buildDiff,
+	}
+)
+
+func init() {
+	cmdBuildDiff.Flags().StringVar(&buildDiffFrom, "from", "", "build ID to diff from (default: the build before --to)")
+	cmdBuildDiff.Flags().StringVar(&buildDiffTo, "to", "", "build ID to diff to (default: latest)")
+	cmdBuildDiff.Flags().StringVar(&buildDiffArch, "arch", "", "architecture (default: the current one)")
+	cmdBuildDiff.Flags().BoolVar(&buildDiffJSON, "json", false, "output the diff as JSON")
+}
+
+func runBuildDiff(argv []string) error {
+	cmdBuildDiff.SetArgs(argv)
+	return cmdBuildDiff.Execute()
+}
+
+// resolveDiffBuilds fills in the default builds to diff from builds.json,
+// which lists the newest builds first.
+func resolveDiffBuilds(b *builds.BuildsJSON, arch, from, to string) (string, string, error) {
+	var ids []string
+	for _, build := range b.Builds {
+		for _, a := range build.Arches {
+			if a == arch {
+				ids = append(ids, build.ID)
+				break
+			}
+		}
+	}
+	if to == "" {
+		if len(ids) == 0 {
+			return "", "", builds.ErrNoBuildsFound
+		}
+		to = ids[0]
+	}
+	if from == "" {
+		for i, id := range ids {
+			if id == to && i+1 < len(ids) {
+				from = ids[i+1]
+			}
+		}
+		if from == "" {
+			return "", "", fmt.Errorf("no %s build before %s to diff from", arch, to)
+		}
+	}
+	return from, to, nil
+}
+
+func buildDiff(c *cobra.Command, args []string) error {
+	arch := buildDiffArch
+	if arch == "" {
+		arch = builds.BuilderArch()
+	}
+	from, to := buildDiffFrom, buildDiffTo
+	if from == "" || to == "" {
+		b, err := builds.GetBuilds("builds")
+		if err != nil {
+			return err
+		}
+		if from, to, err = resolveDiffBuilds(b, arch, from, to); err != nil {
+			return err
+		}
+	}
+
+	diff, err := builds.DiffBuildDirs(filepath.Join("builds", from, arch), filepath.Join("builds", to, arch))
+	if err != nil {
+		return err
+	}
+	if buildDiffJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	return diff.WriteText(os.Stdout)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/coreos-assembler/internal/pkg/cmdregistry"
+)
+
+var (
+	kvm     = []cmdregistry.Privilege{cmdregistry.PrivilegeKVM}
+	network = []cmdregistry.Privilege{cmdregistry.PrivilegeNetwork}
+)
+
+// buildCommands are the commands we'd expect to use in the local dev
+// path. They're intentionally listed in frequency order.
+var buildCommands = []cmdregistry.Command{
+	{Name: "init", Short: "Set up the working directory and clone the config repository", Privileges: network},
+	{Name: "fetch", Short: "Fetch and import the latest packages", Privileges: network},
+	{Name: "build", Short: "Build an OCI bootable container", Privileges: kvm},
+	{Name: "osbuild", Short: "Derive disk images for the given platforms from the container", Privileges: kvm},
+	{Name: "run", Short: "Run a CoreOS instance in QEMU with access to a root shell", Privileges: kvm},
+	{Name: "prune", Short: "Remove previous builds"},
+	{Name: "clean", Short: "Delete all build artifacts", Run: runClean},
+	{Name: "list", Short: "List builds available locally"},
+}
+
+var advancedBuildCommands = []cmdregistry.Command{
+	{Name: "buildfetch", Short: "Fetch the bare minimum from external servers to create the next build", Privileges: network},
+	{Name: "buildupload", Short: "Upload a build which can later be partially fetched with buildfetch", Privileges: network},
+	{Name: "import", Short: "Import an OCI image as a build", Privileges: network},
+	{Name: "oc-adm-release", Short: "Publish the build in an OpenShift release payload", Privileges: network},
+	{Name: "push-container", Short: "Push the container image of a build to a registry", Privileges: network},
+}
+
+var buildextendPlatforms = []string{"aliyun", "applehv", "aws", "azure", "digitalocean", "exoscale", "gcp", "hyperv", "ibmcloud", "kubevirt", "live", "metal", "metal4k", "nutanix", "nvidiabluefield", "openstack", "oraclecloud", "qemu", "secex", "virtualbox", "vmware", "vultr"}
+
+var utilityCommands = []cmdregistry.Command{
+	{Name: "aws-replicate", Short: "Replicate the AWS images of a build to other regions", Privileges: network},
+	{Name: "build-diff", Short: "Show the changes between two builds, as text or JSON", Run: runBuildDiff},
+	{Name: "compress", Short: "Compress all images in a build"},
+	{Name: "copy-container", Short: "Copy container images between registries", Privileges: network},
+	{Name: "coreos-prune", Short: "Prune resources as specified in policy.yaml", Privileges: network},
+	{Name: "diff", Short: "Diff the content of two builds"},
+	{Name: "koji-upload", Short: "Import a build into Koji as a content generator", Privileges: network},
+	{Name: "kola", Short: "Run tests with kola", Privileges: kvm},
+	{Name: "meta-fold", Short: "Fold the meta.*.json files of a build into its meta.json", Run: runMetaFold},
+	{Name: "meta-migrate", Short: "Migrate the meta.json of builds to the current schema version", Run: runMetaMigrate},
+	{Name: "provenance", Short: "Write or verify the in-toto SLSA provenance of a build", Run: runProvenance},
+	{Name: "prune-builds", Short: "Remove the local builds a retention policy doesn't keep", Run: runPruneBuilds},
+	{Name: "push-container-manifest", Short: "Push a manifest list of the containers of a build", Privileges: network},
+	{Name: "remote-build-container", Short: "Build a container image on a remote builder", Privileges: network},
+	{Name: "remote-session", Short: "Create and use remote sessions for cosa commands", Local: true, Run: runRemoteSession},
+	{Name: "sbom", Short: "Generate SPDX and CycloneDX SBOMs of a build", Run: runSBOM},
+	{Name: "sign", Short: "Sign a build with RoboSignatory via fedora-messaging", Privileges: network},
+	{Name: "sign-artifacts", Short: "Sign the artifacts of a build with a local key", Run: runSignArtifacts},
+	{Name: "tag", Short: "Operate on the tags in builds.json"},
+	{Name: "timings", Short: "Summarize where the time of the last builds went", Run: runTimings},
+	{Name: "update-variant", Short: "Change the variant of the working directory", Run: runUpdateVariant},
+	{Name: "verify-build", Short: "Verify the artifacts of a build against its meta.json", Run: runVerifyBuild},
+}
+
+var otherCommands = []cmdregistry.Command{
+	{Name: "meta", Short: "Read or edit the meta.json of a build"},
+	{Name: "shell", Short: "Get an interactive shell or run a command in the cosa container"},
+}
+
+// newRegistry returns the registry of the built-in commands and of the
+// scripts discovered in cmdregistry.Dirs().
+func newRegistry() (*cmdregistry.Registry, error) {
+	r := cmdregistry.New()
+	register := func(category cmdregistry.Category, cmds ...cmdregistry.Command) error {
+		for _, cmd := range cmds {
+			cmd.Category = category
+			if err := r.Register(cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var platforms []cmdregistry.Command
+	for _, platform := range buildextendPlatforms {
+		platforms = append(platforms, cmdregistry.Command{
+			Name:       "buildextend-" + platform,
+			Short:      fmt.Sprintf("Build the %s image", platform),
+			Privileges: kvm,
+		})
+	}
+	others := append([]cmdregistry.Command{
+		{Name: "completion", Short: "Print a shell completion script for cosa", Local: true, Run: func(argv []string) error {
+			return runCompletion(r, argv)
+		}},
+		{Name: "help", Short: "Show the help of a command", Local: true, Run: func(argv []string) error {
+			return runHelp(r, argv)
+		}},
+	}, otherCommands...)
+
+	for _, group := range []struct {
+		category cmdregistry.Category
+		cmds     []cmdregistry.Command
+	}{
+		{cmdregistry.CategoryBuild, buildCommands},
+		{cmdregistry.CategoryAdvanced, advancedBuildCommands},
+		{cmdregistry.CategoryPlatform, platforms},
+		{cmdregistry.CategoryUtility, utilityCommands},
+		{cmdregistry.CategoryOther, others},
+	} {
+		if err := register(group.category, group.cmds...); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.Discover(cmdregistry.Dirs()...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// runHelp prints the usage, or the summary of a command followed by its
+// own --help output.
+func runHelp(r *cmdregistry.Registry, argv []string) error {
+	if len(argv) == 0 || argv[0] == "-h" || argv[0] == "--help" {
+		return r.WriteUsage(os.Stdout)
+	}
+	if len(argv) > 1 {
+		return fmt.Errorf("usage: cosa help [CMD]")
+	}
+	cmd, ok := r.Lookup(argv[0])
+	if !ok {
+		return fmt.Errorf("unknown command: %s", argv[0])
+	}
+	cmd.WriteHeader(os.Stdout)
+	if cmd.Name == "help" {
+		return nil
+	}
+	return cmd.Exec([]string{"--help"})
+}
+
+// runCompletion prints the completion script of the shell given in argv.
+func runCompletion(r *cmdregistry.Registry, argv []string) error {
+	usage := fmt.Sprintf("usage: cosa completion %s", strings.Join(cmdregistry.Shells, "|"))
+	if len(argv) == 1 && (argv[0] == "-h" || argv[0] == "--help") {
+		fmt.Println(usage)
+		return nil
+	} else if len(argv) != 1 {
+		return errors.New(usage)
+	}
+	return r.WriteCompletion(os.Stdout, argv[0])
+}
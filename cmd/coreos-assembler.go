@@ -6,26 +6,13 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"sort"
 	"strings"
 	"syscall"
-)
-
-// commands we'd expect to use in the local dev path
-var buildCommands = []string{"init", "fetch", "build", "osbuild", "run", "prune", "clean", "list"}
-var advancedBuildCommands = []string{"import", "buildfetch", "buildupload", "oc-adm-release", "push-container"}
-var buildextendCommands = []string{"aliyun", "applehv", "aws", "azure", "digitalocean", "exoscale", "gcp", "hyperv", "ibmcloud", "kubevirt", "live", "metal", "metal4k", "nutanix", "nvidiabluefield", "openstack", "oraclecloud", "qemu", "secex", "virtualbox", "vmware", "vultr"}
 
-var utilityCommands = []string{"aws-replicate", "coreos-prune", "compress", "copy-container", "diff", "koji-upload", "kola", "push-container-manifest", "remote-build-container", "remote-session", "sign", "tag", "update-variant"}
-var otherCommands = []string{"shell", "meta"}
-
-func init() {
-	// Note buildCommands is intentionally listed in frequency order
-	sort.Strings(advancedBuildCommands)
-	sort.Strings(buildextendCommands)
-	sort.Strings(utilityCommands)
-	sort.Strings(otherCommands)
-}
+	"github.com/coreos/coreos-assembler/internal/pkg/cmdregistry"
+	"github.com/coreos/coreos-assembler/internal/pkg/eventlog"
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
 
 func wrapCommandErr(err error) error {
 	if err == nil {
@@ -37,26 +24,6 @@ func wrapCommandErr(err error) error {
 	return err
 }
 
-func printCommands(title string, cmds []string) {
-	fmt.Printf("%s:\n", title)
-	var prefix string
-	if title == "Platform builds" {
-		prefix = "buildextend-"
-	}
-	for _, cmd := range cmds {
-		fmt.Printf("  %s%s\n", prefix, cmd)
-	}
-}
-
-func printUsage() {
-	fmt.Println("Usage: coreos-assembler CMD ...")
-	printCommands("Build commands", buildCommands)
-	printCommands("Advanced build commands", advancedBuildCommands)
-	printCommands("Platform builds", buildextendCommands)
-	printCommands("Utility commands", utilityCommands)
-	printCommands("Other commands", otherCommands)
-}
-
 func run(argv []string) error {
 	if err := initializeGlobalState(argv); err != nil {
 		return fmt.Errorf("failed to initialize global state: %w", err)
@@ -68,51 +35,56 @@ func run(argv []string) error {
 		argv = argv[1:]
 	}
 
+	registry, err := newRegistry()
+	if err != nil {
+		return err
+	}
 	if cmd == "" || cmd == "--help" {
-		printUsage()
+		if err := registry.WriteUsage(os.Stdout); err != nil {
+			return err
+		}
 		os.Exit(1)
 	}
+	c, ok := registry.Lookup(cmd)
 
 	// if the COREOS_ASSEMBLER_REMOTE_SESSION environment variable is
 	// set then we "intercept" the command here and redirect it to
 	// `cosa remote-session exec`, which will execute the commands
-	// via `podman --remote` on a remote machine.
-	session, ok := os.LookupEnv("COREOS_ASSEMBLER_REMOTE_SESSION")
-	if ok && session != "" && cmd != "remote-session" {
+	// through the backend of the session, e.g. `podman --remote` on a
+	// remote machine. Local commands like `help` and `remote-session`
+	// itself aren't intercepted, while commands which aren't installed
+	// locally are left for the remote to resolve.
+	session, isSet := os.LookupEnv("COREOS_ASSEMBLER_REMOTE_SESSION")
+	if isSet && session != "" && !(ok && c.Local) {
 		argv = append([]string{"exec", "--", cmd}, argv...)
-		cmd = "remote-session"
-	}
-
-	// Manual argument parsing here for now; once we get to "phase 1"
-	// of the Go conversion we can vendor cobra (and other libraries)
-	// at the toplevel.
-	switch cmd {
-	case "clean":
-		return runClean(argv)
-	case "update-variant":
-		return runUpdateVariant(argv)
-	case "remote-session":
 		return runRemoteSession(argv)
 	}
 
-	target := fmt.Sprintf("/usr/lib/coreos-assembler/cmd-%s", cmd)
-	_, err := os.Stat(target)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return fmt.Errorf("unknown command: %s", cmd)
-		}
-		return fmt.Errorf("failed to stat %s: %w", target, err)
+	if !ok {
+		return fmt.Errorf("unknown command: %s", cmd)
 	}
+	log := eventlog.Default()
+	defer log.Close()
+	before := latestBuild()
+	step := log.StartCommand(cmd, argv)
+	err = c.Exec(argv)
+	// Record the build the command created, or the one it extended.
+	build := latestBuild()
+	if build == before && c.Category != cmdregistry.CategoryPlatform && cmd != "osbuild" {
+		build = ""
+	}
+	step.EndBuild(err, build)
+	return err
+}
 
-	c := exec.Command(target, argv...)
-	c.Stdin = os.Stdin
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	if err := c.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to execute cmd-%s: %v\n", cmd, err.Error())
-		return err
+// latestBuild returns the ID of the latest build of the working
+// directory, if any.
+func latestBuild() string {
+	b, err := builds.GetBuilds("builds")
+	if err != nil || len(b.Builds) == 0 {
+		return ""
 	}
-	return nil
+	return b.Builds[0].ID
 }
 
 func initializeGlobalState(argv []string) error {
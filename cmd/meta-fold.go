@@ -0,0 +1,82 @@
+// See usage below
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	metaFoldID   string
+	metaFoldArch string
+	metaFoldKeep bool
+
+	cmdMetaFold = &cobra.Command{
+		Use:   "meta-fold",
+		Short: "cosa meta-fold [--build ID] [--arch ARCH] [--keep]",
+		Long: "Fold the meta.*.json files written by jobs of a build with a " +
+			"delayed meta merge into its meta.json, under the meta.json lock " +
+			"and in the order of their version stamps. A field set to different " +
+			"values takes the value of the newest file. Files of another build, " +
+			"or setting a field differently with the same version stamp, are " +
+			"reported as conflicts, in which case meta.json is left untouched.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          metaFold,
+	}
+)
+
+func init() {
+	cmdMetaFold.Flags().StringVar(&metaFoldID, "build", "", "build ID (default: latest)")
+	cmdMetaFold.Flags().StringVar(&metaFoldArch, "arch", "", "architecture (default: the current one)")
+	cmdMetaFold.Flags().BoolVar(&metaFoldKeep, "keep", false, "keep the meta.*.json files after folding them")
+}
+
+func runMetaFold(argv []string) error {
+	cmdMetaFold.SetArgs(argv)
+	return cmdMetaFold.Execute()
+}
+
+func metaFold(c *cobra.Command, args []string) error {
+	arch := metaFoldArch
+	if arch == "" {
+		arch = builds.BuilderArch()
+	}
+	id := metaFoldID
+	if id == "" {
+		b, err := builds.GetBuilds("builds")
+		if err != nil {
+			return err
+		}
+		for _, build := range b.Builds {
+			for _, a := range build.Arches {
+				if a == arch && id == "" {
+					id = build.ID
+				}
+			}
+		}
+		if id == "" {
+			return builds.ErrNoBuildsFound
+		}
+	}
+
+	dir := filepath.Join("builds", id, arch)
+	res, err := builds.FoldMeta(dir, metaFoldKeep)
+	if err != nil {
+		return err
+	}
+	if len(res.Folded) == 0 {
+		fmt.Printf("No meta.*.json files to fold in %s\n", dir)
+		return nil
+	}
+	for _, name := range res.Folded {
+		fmt.Printf("Folded %s\n", name)
+	}
+	fmt.Printf("Wrote %s\n", filepath.Join(dir, builds.CosaMetaJSON))
+	return nil
+}
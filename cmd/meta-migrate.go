@@ -0,0 +1,107 @@
+// See usage below
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	metaMigrateID     string
+	metaMigrateArch   string
+	metaMigrateAll    bool
+	metaMigrateDryRun bool
+
+	cmdMetaMigrate = &cobra.Command{
+		Use:   "meta-migrate",
+		Short: "cosa meta-migrate [--build ID | --all] [--arch ARCH] [--dry-run]",
+		Long: "Migrate the meta.json of builds to the current schema version " +
+			"and record that version in them, so that archived builds can be " +
+			"read by strict tooling. Builds already at the current version " +
+			"are left untouched. No schema change has needed a migration " +
+			"yet, so for now only the version is recorded.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          metaMigrate,
+	}
+)
+
+func init() {
+	cmdMetaMigrate.Flags().StringVar(&metaMigrateID, "build", "", "build ID (default: latest)")
+	cmdMetaMigrate.Flags().StringVar(&metaMigrateArch, "arch", "", "architecture (default: the current one)")
+	cmdMetaMigrate.Flags().BoolVar(&metaMigrateAll, "all", false, "migrate all the builds of all the architectures")
+	cmdMetaMigrate.Flags().BoolVar(&metaMigrateDryRun, "dry-run", false, "only report the migrations")
+}
+
+func runMetaMigrate(argv []string) error {
+	cmdMetaMigrate.SetArgs(argv)
+	return cmdMetaMigrate.Execute()
+}
+
+func metaMigrate(c *cobra.Command, args []string) error {
+	if metaMigrateAll && metaMigrateID != "" {
+		return fmt.Errorf("--all and --build are mutually exclusive")
+	}
+	arch := metaMigrateArch
+	if arch == "" {
+		arch = builds.BuilderArch()
+	}
+	b, err := builds.GetBuilds("builds")
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	for _, build := range b.Builds {
+		for _, a := range build.Arches {
+			switch {
+			case metaMigrateAll:
+			case a != arch:
+				continue
+			case metaMigrateID == "" && len(paths) > 0:
+				continue
+			case metaMigrateID != "" && metaMigrateID != build.ID:
+				continue
+			}
+			paths = append(paths, filepath.Join("builds", build.ID, a, builds.CosaMetaJSON))
+		}
+	}
+	if len(paths) == 0 {
+		return builds.ErrNoBuildsFound
+	}
+
+	failed := 0
+	for _, path := range paths {
+		res, err := builds.MigrateMetaFile(path, metaMigrateDryRun)
+		switch {
+		case os.IsNotExist(err):
+			// builds.json lists arches which weren't fetched locally
+			continue
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			failed++
+			continue
+		case !res.Changed:
+			fmt.Printf("%s: up to date\n", path)
+			continue
+		}
+		verb := "migrated"
+		if metaMigrateDryRun {
+			verb = "would be migrated"
+		}
+		fmt.Printf("%s: %s from schema version %d\n", path, verb, res.From)
+		for _, m := range res.Applied {
+			fmt.Printf("  %s\n", m)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to migrate %d of %d builds", failed, len(paths))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// See usage below
+package main
+
+import (
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	provenanceID        string
+	provenanceArch      string
+	provenanceKey       string
+	provenanceVerify    bool
+	provenancePublicKey string
+	provenanceJSON      bool
+
+	cmdProvenance = &cobra.Command{
+		Use:   "provenance",
+		Short: "cosa provenance [--build ID] [--arch ARCH] [--key KEY | --verify [--public-key KEY]]",
+		Long: "Write the in-toto SLSA provenance of a build, listing the digests " +
+			"of its artifacts and container images as subjects and the git " +
+			"revisions and base images it was built from as materials, in a " +
+			"DSSE envelope signed with --key if given. The provenance is " +
+			"recorded as the provenance artifact. With --verify, check the " +
+			"build directory and meta.json against the recorded provenance " +
+			"instead, requiring a signature by --public-key if given. " +
+			"Artifacts compressed since are decompressed to be checked, " +
+			"and reported unverified if that isn't possible.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          provenance,
+	}
+)
+
+func init() {
+	cmdProvenance.Flags().StringVar(&provenanceID, "build", "", "build ID (default: latest)")
+	cmdProvenance.Flags().StringVar(&provenanceArch, "arch", "", "architecture (default: the current one)")
+	cmdProvenance.Flags().StringVar(&provenanceKey, "key", "", "unencrypted PEM private key to sign the provenance with")
+	cmdProvenance.Flags().BoolVar(&provenanceVerify, "verify", false, "verify the build against its provenance")
+	cmdProvenance.Flags().StringVar(&provenancePublicKey, "public-key", "", "PEM public key which must have signed the provenance")
+	cmdProvenance.Flags().BoolVar(&provenanceJSON, "json", false, "output the verification as JSON")
+}
+
+func runProvenance(argv []string) error {
+	cmdProvenance.SetArgs(argv)
+	return cmdProvenance.Execute()
+}
+
+func provenance(c *cobra.Command, args []string) error {
+	_, dir, err := builds.ReadBuild("builds", provenanceID, provenanceArch)
+	if err != nil {
+		return err
+	}
+	if provenanceVerify {
+		return verifyProvenance(dir)
+	}
+	if provenancePublicKey != "" {
+		return fmt.Errorf("--public-key requires --verify")
+	}
+
+	var key crypto.Signer
+	if provenanceKey != "" {
+		if key, err = builds.LoadPrivateKey(provenanceKey); err != nil {
+			return err
+		}
+	}
+	path, err := builds.WriteProvenance(dir, key)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", filepath.Join(dir, path))
+	return nil
+}
+
+func verifyProvenance(dir string) error {
+	if provenanceKey != "" {
+		return fmt.Errorf("--key can't be used with --verify; use --public-key")
+	}
+	var key crypto.PublicKey
+	if provenancePublicKey != "" {
+		var err error
+		if key, err = builds.LoadPublicKey(provenancePublicKey); err != nil {
+			return err
+		}
+	}
+	res, err := builds.VerifyProvenance(dir, key)
+	if err != nil {
+		return err
+	}
+
+	if provenanceJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+	} else {
+		if res.KeyID != "" {
+			fmt.Printf("%s is signed by %s\n", res.Path, res.KeyID)
+		}
+		for _, s := range res.Subjects {
+			line := fmt.Sprintf("%-10s %s", s.Status, s.Name)
+			if s.Path != s.Name {
+				line += " as " + s.Path
+			}
+			if s.Error != "" {
+				line += ": " + s.Error
+			}
+			fmt.Println(line)
+		}
+		for _, m := range res.Mismatches {
+			fmt.Printf("%-10s %s\n", "mismatch", m)
+		}
+		for _, u := range res.Unattested {
+			fmt.Printf("%-10s %s\n", "unattested", u)
+		}
+	}
+
+	if res.Failed() {
+		return fmt.Errorf("%s doesn't match its provenance", dir)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// See usage below
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	pruneBuildsKeepLastN   int
+	pruneBuildsMaxAge      string
+	pruneBuildsStream      string
+	pruneBuildsKeepParents bool
+	pruneBuildsBuilds      []string
+	pruneBuildsDryRun      bool
+	pruneBuildsJSON        bool
+
+	cmdPruneBuilds = &cobra.Command{
+		Use:   "prune-builds",
+		Short: "cosa prune-builds [--keep-last-n N] [--max-age AGE] [--build ID]... [--dry-run]",
+		Long: "Delete the local builds which the retention policy doesn't keep, " +
+			"from builds.json and from disk. Tagged builds and the latest build " +
+			"are always kept. A build is kept if it's among the last N untagged " +
+			"builds or younger than the maximum age, e.g. 14d or 36h. The last 3 " +
+			"builds are kept by default, but not when only --max-age is given. With " +
+			"--keep-parents, so are the parents of kept builds. --build prunes " +
+			"the given builds instead. --dry-run prints the plan, the decision " +
+			"and reason for each build, without deleting anything. Unlike " +
+			"cosa prune, the OSTree refs and the pkgcache aren't pruned.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          pruneBuilds,
+	}
+)
+
+func init() {
+	cmdPruneBuilds.Flags().IntVar(&pruneBuildsKeepLastN, "keep-last-n", 3, "number of untagged builds to keep; 0 to not keep builds by count (default 0 with --max-age)")
+	cmdPruneBuilds.Flags().StringVar(&pruneBuildsMaxAge, "max-age", "", "keep the builds younger than this age, in days (e.g. 14d) or as a Go duration")
+	cmdPruneBuilds.Flags().StringVar(&pruneBuildsStream, "stream", "", "only prune the builds of this stream")
+	cmdPruneBuilds.Flags().BoolVar(&pruneBuildsKeepParents, "keep-parents", false, "keep the parents of kept builds")
+	cmdPruneBuilds.Flags().StringArrayVar(&pruneBuildsBuilds, "build", nil, "prune this build explicitly; can be repeated")
+	cmdPruneBuilds.Flags().BoolVar(&pruneBuildsDryRun, "dry-run", false, "only print the plan")
+	cmdPruneBuilds.Flags().BoolVar(&pruneBuildsJSON, "json", false, "print the plan as JSON")
+}
+
+func runPruneBuilds(argv []string) error {
+	cmdPruneBuilds.SetArgs(argv)
+	return cmdPruneBuilds.Execute()
+}
+
+// parseAge parses an age in days, such as 14d, or a Go duration.
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", s)
+	}
+	return d, nil
+}
+
+func pruneBuilds(c *cobra.Command, args []string) error {
+	keepLastN := pruneBuildsKeepLastN
+	if pruneBuildsMaxAge != "" && !c.Flags().Changed("keep-last-n") {
+		// Keep by age alone unless asked for both.
+		keepLastN = 0
+	}
+	policy := builds.PrunePolicy{
+		KeepLastN:   keepLastN,
+		Stream:      pruneBuildsStream,
+		KeepParents: pruneBuildsKeepParents,
+		Builds:      pruneBuildsBuilds,
+	}
+	if pruneBuildsMaxAge != "" {
+		age, err := parseAge(pruneBuildsMaxAge)
+		if err != nil {
+			return err
+		}
+		policy.MaxAge = age
+	}
+
+	h, err := builds.LoadHistory("builds")
+	if err != nil {
+		return err
+	}
+	plan, err := h.PlanPrune(policy)
+	if err != nil {
+		return err
+	}
+	if pruneBuildsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(plan); err != nil {
+			return err
+		}
+	} else if err := plan.Write(os.Stdout); err != nil {
+		return err
+	}
+	if pruneBuildsDryRun {
+		return nil
+	}
+
+	pruned := plan.Pruned()
+	if len(pruned) == 0 {
+		if !pruneBuildsJSON {
+			fmt.Println("No builds to prune")
+		}
+		return nil
+	}
+	if err := h.ExecutePrune(plan); err != nil {
+		return err
+	}
+	if !pruneBuildsJSON {
+		fmt.Printf("Pruned %d builds\n", len(pruned))
+	}
+	return nil
+}
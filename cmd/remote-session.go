@@ -1,25 +1,39 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/internal/pkg/remotesession"
+	"github.com/coreos/coreos-assembler/pkg/builds"
 )
 
 type RemoteSessionOptions struct {
+	CreateBackend    string
+	CreateEngine     string
+	CreateHost       string
 	CreateImage      string
 	CreateExpiration string
 	CreateWorkdir    string
 	CreateEnv        []string
+	CreateNoPull     bool
 	SyncQuiet        bool
+	PullQuiet        bool
+	PushConfigDir    string
+	StatusJSON       bool
 }
 
 var (
 	remoteSessionOpts RemoteSessionOptions
+	remoteSession     *remotesession.Session
 
 	cmdRemoteSession = &cobra.Command{
 		Use:   "remote-session",
@@ -32,7 +46,10 @@ var (
 		Short: "Create a remote session",
 		Long: "Create a remote session. This command will print an ID to " +
 			"STDOUT that should be set in COREOS_ASSEMBLER_REMOTE_SESSION " +
-			"environment variable for later commands to use.",
+			"environment variable for later commands to use. The session " +
+			"is recorded in a session file named after the ID in " +
+			"$COREOS_ASSEMBLER_REMOTE_SESSION_DIR, by default " +
+			"~/.cache/coreos-assembler/remote-sessions.",
 		Args:    cobra.ExactArgs(0),
 		PreRunE: preRunCheckEnv,
 		RunE:    runCreate,
@@ -49,9 +66,12 @@ var (
 	}
 
 	cmdRemoteSessionExec = &cobra.Command{
-		Use:     "exec",
-		Short:   "Execute a cosa command in the remote session",
-		Long:    "Execute a cosa command in the remote session.",
+		Use:   "exec",
+		Short: "Execute a cosa command in the remote session",
+		Long: "Execute a cosa command in the remote session. After a " +
+			"successful build command the builds it added or changed are " +
+			"pulled back into the local builds directory, unless the " +
+			"session was created with --no-pull-builds.",
 		Args:    cobra.MinimumNArgs(1),
 		PreRunE: preRunCheckEnv,
 		RunE:    runExec,
@@ -66,6 +86,39 @@ var (
 		RunE:    runPS,
 	}
 
+	cmdRemoteSessionPull = &cobra.Command{
+		Use:   "pull",
+		Short: "Pull the new and changed builds from the remote",
+		Long: "Pull the builds which the local builds directory lacks and " +
+			"the latest build of each architecture from the remote, then " +
+			"merge its builds.json into the local one, keeping the local " +
+			"builds.",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: preRunCheckEnv,
+		RunE:    runPull,
+	}
+
+	cmdRemoteSessionPushConfig = &cobra.Command{
+		Use:   "push-config",
+		Short: "Push the changes of src/config to the remote",
+		Long: "Push the changes of the local config directory to " +
+			"src/config on the remote, deleting the files which were " +
+			"removed locally.",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: preRunCheckEnv,
+		RunE:    runPushConfig,
+	}
+
+	cmdRemoteSessionStatus = &cobra.Command{
+		Use:   "status",
+		Short: "Compare the builds of the remote to the local ones",
+		Long: "Show the latest build of each architecture on the remote " +
+			"and locally, and the builds only one of them has.",
+		Args:    cobra.ExactArgs(0),
+		PreRunE: preRunCheckEnv,
+		RunE:    runStatus,
+	}
+
 	cmdRemoteSessionSync = &cobra.Command{
 		Use:   "sync",
 		Short: "sync files/directories to/from the remote",
@@ -109,83 +162,80 @@ func envVarError(v string, required bool) error {
 	}
 }
 
-// Function to check requisite environment variables. This is run
-// before each subcommand to perform the checks.
+// Function to check requisite environment variables and load the
+// session. This is run before each subcommand to perform the checks.
 func preRunCheckEnv(c *cobra.Command, args []string) error {
-	// We need to make sure that the CONTAINER_HOST env var
-	// is set for all commands. This is used for `podman --remote`.
-	// We could also check `CONTAINER_SSHKEY` key here but it's not
-	// strictly required (user could be using ssh-agent).
-	if !envVarIsSet("CONTAINER_HOST") {
-		return envVarError("CONTAINER_HOST", true)
-	}
 	// We need to check COREOS_ASSEMBLER_REMOTE_SESSION. For create
 	// we need to make sure it's not set. For all other commands we
 	// need to make sure it is set.
-	remoteSessionVarIsSet := envVarIsSet("COREOS_ASSEMBLER_REMOTE_SESSION")
-	if c.Use == "create" && remoteSessionVarIsSet {
-		return envVarError("COREOS_ASSEMBLER_REMOTE_SESSION", false)
-	} else if c.Use != "create" && !remoteSessionVarIsSet {
-		return envVarError("COREOS_ASSEMBLER_REMOTE_SESSION", true)
+	remoteSessionVarIsSet := envVarIsSet(remotesession.SessionEnv)
+	if c.Use == "create" {
+		if remoteSessionVarIsSet {
+			return envVarError(remotesession.SessionEnv, false)
+		}
+		return nil
+	} else if !remoteSessionVarIsSet {
+		return envVarError(remotesession.SessionEnv, true)
+	}
+
+	var err error
+	remoteSession, err = remotesession.Load(os.Getenv(remotesession.SessionEnv))
+	if err != nil {
+		return err
+	}
+	if err := remoteSession.Check(); err != nil {
+		return err
+	}
+	if c.Use != "destroy" && remoteSession.Expired() {
+		return fmt.Errorf("remote session %s expired at %s; destroy it and create a new one",
+			remoteSession.ID, remoteSession.ExpiresAt.Format(time.RFC3339))
 	}
 	return nil
 }
 
-// Creates a "remote session" on the remote. This just creates a
-// container on the remote and prints to STDOUT the container ID.
-// The user is then expected to store this ID in the
-// COREOS_ASSEMBLER_REMOTE_SESSION environment variable.
+// Creates a "remote session" through the selected backend. This just
+// creates a container and prints to STDOUT the container ID, which is
+// also the name of the session file recording the session. The user is
+// then expected to store this ID in the COREOS_ASSEMBLER_REMOTE_SESSION
+// environment variable.
 func runCreate(c *cobra.Command, args []string) error {
-	podmanargs := []string{"--remote", "run", "--rm", "-d",
-		"--pull=always", "--net=host", "--privileged", "--security-opt=label=disable",
-		"--volume", remoteSessionOpts.CreateWorkdir,
-		"--workdir", remoteSessionOpts.CreateWorkdir,
-		// Mount required volume for buildextend-secex, it will be empty on
-		// non-s390x builders.
-		// See: https://github.com/coreos/coreos-assembler/blob/main/docs/cosa/buildextend-secex.md
-		"--volume=secex-data:/data.secex:ro",
-		"--userns=keep-id:uid=1000,gid=1000",
-		"--device=/dev/kvm", "--device=/dev/fuse", "--tmpfs=/tmp",
-		"--init", "--entrypoint=/usr/bin/sleep"}
-	// Add in any env vars that were specified.
-	for _, env := range remoteSessionOpts.CreateEnv {
-		podmanargs = append(podmanargs, "--env", env)
+	session, err := remotesession.Create(remotesession.CreateOptions{
+		Backend:      remoteSessionOpts.CreateBackend,
+		Engine:       remoteSessionOpts.CreateEngine,
+		Host:         remoteSessionOpts.CreateHost,
+		Image:        remoteSessionOpts.CreateImage,
+		Expiration:   remoteSessionOpts.CreateExpiration,
+		Workdir:      remoteSessionOpts.CreateWorkdir,
+		Env:          remoteSessionOpts.CreateEnv,
+		NoPullBuilds: remoteSessionOpts.CreateNoPull,
+	})
+	if err != nil {
+		return err
 	}
-	podmanargs = append(podmanargs,
-		remoteSessionOpts.CreateImage,
-		remoteSessionOpts.CreateExpiration)
-	cmd := exec.Command("podman", podmanargs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	fmt.Println(session.ID)
+	return nil
 }
 
 // Destroys the "remote session". In reality it just deletes
-// the container referenced by $COREOS_ASSEMBLER_REMOTE_SESSION.
+// the container referenced by $COREOS_ASSEMBLER_REMOTE_SESSION
+// and its session file.
 func runDestroy(c *cobra.Command, args []string) error {
-	session := os.Getenv("COREOS_ASSEMBLER_REMOTE_SESSION")
-	podmanargs := []string{"--remote", "rm", "-f", session}
-	cmd := exec.Command("podman", podmanargs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return remoteSession.Destroy(os.Stdout, os.Stderr)
 }
 
 // Executes a command in the "remote session". Mostly just a
 // `podman --remote exec`.
 func runExec(c *cobra.Command, args []string) error {
-	podmanargs := []string{"--remote", "exec", "-i"}
-	if isatty() {
-		podmanargs = append(podmanargs, "-t")
+	// Build commands pull back the builds they added or changed, found by
+	// comparing the builds before and after they run.
+	var before *remotesession.BuildsSnapshot
+	if remoteSession.PullsBuilds() && remotesession.IsBuildCommand(args[0]) {
+		var err error
+		if before, err = remoteSession.SnapshotBuilds(); err != nil {
+			return err
+		}
 	}
-	session := os.Getenv("COREOS_ASSEMBLER_REMOTE_SESSION")
-	podmanargs = append(podmanargs, session, "cosa")
-	podmanargs = append(podmanargs, args...)
-	cmd := exec.Command("podman", podmanargs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
+	if err := remoteSession.Exec(isatty(), os.Stdin, os.Stdout, os.Stderr, args...); err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			// If the command failed let's exit with the same exitcode
 			// as the remotely executed process.
@@ -194,56 +244,92 @@ func runExec(c *cobra.Command, args []string) error {
 			return err
 		}
 	}
+	if before != nil {
+		return reportPulled(remoteSession.PullChangedBuilds("builds", before, true, os.Stdout, os.Stderr))
+	}
+	return nil
+}
+
+// reportPulled reports which builds were pulled into the local builds
+// directory.
+func reportPulled(pulled []builds.BuildRef, err error) error {
+	if err == builds.ErrNoBuildsFound {
+		fmt.Fprintln(os.Stderr, "No builds on the remote to pull")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, ref := range pulled {
+		fmt.Fprintf(os.Stderr, "Pulled build %s/%s\n", ref.ID, ref.Arch)
+	}
+	return nil
+}
+
+func runPull(c *cobra.Command, args []string) error {
+	return reportPulled(remoteSession.PullBuilds("builds", remoteSessionOpts.PullQuiet, os.Stdout, os.Stderr))
+}
+
+func runPushConfig(c *cobra.Command, args []string) error {
+	return remoteSession.PushConfig(remoteSessionOpts.PushConfigDir, remoteSessionOpts.SyncQuiet, os.Stdout, os.Stderr)
+}
+
+// runStatus prints the latest remote and local build of each
+// architecture, followed by the builds only one side has.
+func runStatus(c *cobra.Command, args []string) error {
+	statuses, err := remoteSession.Status("builds")
+	if err != nil {
+		return err
+	}
+	if remoteSessionOpts.StatusJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+	if len(statuses) == 0 {
+		fmt.Println("No builds locally or on the remote")
+		return nil
+	}
+	none := func(id string) string {
+		if id == "" {
+			return "-"
+		}
+		return id
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ARCH\tLOCAL\tREMOTE")
+	for _, st := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", st.Arch, none(st.Local), none(st.Remote))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		if len(st.RemoteOnly) > 0 {
+			fmt.Printf("%s: only on the remote: %s\n", st.Arch, strings.Join(st.RemoteOnly, " "))
+		}
+		if len(st.LocalOnly) > 0 {
+			fmt.Printf("%s: only local: %s\n", st.Arch, strings.Join(st.LocalOnly, " "))
+		}
+	}
 	return nil
 }
 
-// Executes a `podman --remote ps -a --filter id=<container>`
+// Executes a `podman ps -a --filter id=<container>` through the backend
 // to show the status of the remote running cosa container.
 func runPS(c *cobra.Command, args []string) error {
-	session := os.Getenv("COREOS_ASSEMBLER_REMOTE_SESSION")
-	podmanargs := []string{"--remote", "ps", "-a",
-		fmt.Sprintf("--filter=id=%s", session)}
-	cmd := exec.Command("podman", podmanargs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return remoteSession.PS(os.Stdout, os.Stderr)
 }
 
 // runSync provides an rsync-like interface that allows
 // files to be copied to/from the remote. It uses
-// `podman --remote exec` as the transport for rsync (see [1])
+// `podman exec` through the backend as the transport for rsync (see [1])
 //
 // One of the arguments here must be prepended with a `:`. This
-// argument will represent the path on the remote. This function
-// will substitute `:` with `$COREOS_ASSEMBLER_REMOTE_SESSION:`.
-// That environment var just contains the container ID on the remote.
+// argument will represent the path on the remote.
 //
 // [1] https://github.com/moby/moby/issues/13660
 func runSync(c *cobra.Command, args []string) error {
-	// check arguments. Need one with pre-pended ':'
-	found := 0
-	for index, arg := range args {
-		if strings.HasPrefix(arg, ":") {
-			args[index] = fmt.Sprintf("%s%s",
-				os.Getenv("COREOS_ASSEMBLER_REMOTE_SESSION"), arg)
-			found++
-		}
-	}
-	if found != 1 {
-		return fmt.Errorf("Must pass in a single arg with `:` prepended")
-	}
-	// build command and execute
-	rsyncargs := []string{"-ah", "--no-owner", "--no-group", "--mkpath", "--blocking-io",
-		"--compress", "--rsh", "podman --remote exec -i"}
-	if !remoteSessionOpts.SyncQuiet {
-		rsyncargs = append(rsyncargs, "-v")
-	}
-	rsyncargs = append(rsyncargs, args...)
-	cmd := exec.Command("rsync", rsyncargs...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return remoteSession.Sync(remoteSessionOpts.SyncQuiet, os.Stdout, os.Stderr, args...)
 }
 
 func init() {
@@ -251,9 +337,21 @@ func init() {
 	cmdRemoteSession.AddCommand(cmdRemoteSessionDestroy)
 	cmdRemoteSession.AddCommand(cmdRemoteSessionExec)
 	cmdRemoteSession.AddCommand(cmdRemoteSessionPS)
+	cmdRemoteSession.AddCommand(cmdRemoteSessionPull)
+	cmdRemoteSession.AddCommand(cmdRemoteSessionPushConfig)
+	cmdRemoteSession.AddCommand(cmdRemoteSessionStatus)
 	cmdRemoteSession.AddCommand(cmdRemoteSessionSync)
 
 	// cmdRemoteSessionCreate options
+	cmdRemoteSessionCreate.Flags().StringVarP(
+		&remoteSessionOpts.CreateBackend, "backend", "", remotesession.PodmanRemote,
+		fmt.Sprintf("The backend running the session (%s)", strings.Join(remotesession.Backends(), ", ")))
+	cmdRemoteSessionCreate.Flags().StringVarP(
+		&remoteSessionOpts.CreateEngine, "engine", "", remotesession.DefaultEngine,
+		"The container engine to run the session with")
+	cmdRemoteSessionCreate.Flags().StringVarP(
+		&remoteSessionOpts.CreateHost, "host", "", "",
+		"The [user@]host to run the session on with the ssh backend")
 	cmdRemoteSessionCreate.Flags().StringVarP(
 		&remoteSessionOpts.CreateImage, "image", "",
 		"quay.io/coreos-assembler/coreos-assembler:main",
@@ -267,6 +365,27 @@ func init() {
 	cmdRemoteSessionCreate.Flags().StringArrayVarP(
 		&remoteSessionOpts.CreateEnv, "env", "", []string{},
 		"Environment variables to set inside the container")
+	cmdRemoteSessionCreate.Flags().BoolVarP(
+		&remoteSessionOpts.CreateNoPull, "no-pull-builds", "", false,
+		"Don't pull back the builds after build commands run through exec")
+
+	// cmdRemoteSessionPull options
+	cmdRemoteSessionPull.Flags().BoolVarP(
+		&remoteSessionOpts.PullQuiet, "quiet", "", false,
+		"Make the pull output less verbose")
+
+	// cmdRemoteSessionPushConfig options
+	cmdRemoteSessionPushConfig.Flags().StringVarP(
+		&remoteSessionOpts.PushConfigDir, "config-dir", "", "src/config",
+		"The local config directory to push")
+	cmdRemoteSessionPushConfig.Flags().BoolVarP(
+		&remoteSessionOpts.SyncQuiet, "quiet", "", false,
+		"Make the push output less verbose")
+
+	// cmdRemoteSessionStatus options
+	cmdRemoteSessionStatus.Flags().BoolVarP(
+		&remoteSessionOpts.StatusJSON, "json", "", false,
+		"Output the status as JSON")
 
 	// cmdRemoteSessionSync options
 	cmdRemoteSessionSync.Flags().BoolVarP(
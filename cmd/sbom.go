@@ -0,0 +1,82 @@
+// See usage below
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	sbomID      string
+	sbomArch    string
+	sbomFormats []string
+	sbomStdout  bool
+
+	cmdSBOM = &cobra.Command{
+		Use:   "sbom",
+		Short: "cosa sbom [--build ID] [--arch ARCH] [--format spdx|cyclonedx...]",
+		Long: "Generate SPDX and CycloneDX JSON software bills of materials " +
+			"for a build from the package list of its commitmeta.json and " +
+			"the container images and git revisions of its meta.json. The " +
+			"SBOMs are written to the build directory and recorded as the " +
+			"sbom-spdx and sbom-cyclonedx artifacts, unless --stdout is given.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          sbom,
+	}
+)
+
+func init() {
+	cmdSBOM.Flags().StringVar(&sbomID, "build", "", "build ID (default: latest)")
+	cmdSBOM.Flags().StringVar(&sbomArch, "arch", "", "architecture (default: the current one)")
+	cmdSBOM.Flags().StringSliceVar(&sbomFormats, "format", []string{string(builds.SBOMSPDX), string(builds.SBOMCycloneDX)}, "SBOM formats")
+	cmdSBOM.Flags().BoolVar(&sbomStdout, "stdout", false, "print the SBOM instead of recording it; requires a single --format")
+}
+
+func runSBOM(argv []string) error {
+	cmdSBOM.SetArgs(argv)
+	return cmdSBOM.Execute()
+}
+
+func sbom(c *cobra.Command, args []string) error {
+	var formats []builds.SBOMFormat
+	for _, f := range sbomFormats {
+		formats = append(formats, builds.SBOMFormat(f))
+	}
+
+	_, dir, err := builds.ReadBuild("builds", sbomID, sbomArch)
+	if err != nil {
+		return err
+	}
+
+	if sbomStdout {
+		if len(formats) != 1 {
+			return fmt.Errorf("--stdout requires a single --format")
+		}
+		s, err := builds.ReadBuildSBOM(dir)
+		if err != nil {
+			return err
+		}
+		data, err := s.Marshal(formats[0])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(data))
+		return err
+	}
+
+	paths, err := builds.WriteSBOMs(dir, formats...)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		fmt.Printf("Wrote %s\n", filepath.Join(dir, p))
+	}
+	return nil
+}
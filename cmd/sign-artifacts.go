@@ -0,0 +1,90 @@
+// See usage below
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	signArtifactsID             string
+	signArtifactsArch           string
+	signArtifactsNames          []string
+	signArtifactsKey            string
+	signArtifactsPassphraseFile string
+	signArtifactsSigstoreKey    string
+
+	cmdSignArtifacts = &cobra.Command{
+		Use:   "sign-artifacts",
+		Short: "cosa sign-artifacts (--key KEY | --sigstore-key KEY) [--build ID] [--arch ARCH] [--artifact NAME...]",
+		Long: "Sign the artifacts of a build with a local key, writing detached " +
+			"OpenPGP signatures (--key) or sigstore bundles (--sigstore-key) " +
+			"next to them and recording them in meta.json. By default, all " +
+			"the artifacts present in the build directory are signed. Use " +
+			"cosa verify-build --keyring or --sigstore-key to verify them.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          signArtifacts,
+	}
+)
+
+func init() {
+	cmdSignArtifacts.Flags().StringVar(&signArtifactsID, "build", "", "build ID (default: latest)")
+	cmdSignArtifacts.Flags().StringVar(&signArtifactsArch, "arch", "", "architecture (default: the current one)")
+	cmdSignArtifacts.Flags().StringSliceVar(&signArtifactsNames, "artifact", nil, "artifact to sign (default: all)")
+	cmdSignArtifacts.Flags().StringVar(&signArtifactsKey, "key", "", "OpenPGP secret key to sign with")
+	cmdSignArtifacts.Flags().StringVar(&signArtifactsPassphraseFile, "passphrase-file", "", "file containing the passphrase of the OpenPGP key")
+	cmdSignArtifacts.Flags().StringVar(&signArtifactsSigstoreKey, "sigstore-key", "", "unencrypted PEM private key to sign sigstore bundles with")
+}
+
+func runSignArtifacts(argv []string) error {
+	cmdSignArtifacts.SetArgs(argv)
+	return cmdSignArtifacts.Execute()
+}
+
+func signArtifacts(c *cobra.Command, args []string) error {
+	var signer builds.Signer
+	var err error
+	switch {
+	case signArtifactsKey != "" && signArtifactsSigstoreKey != "":
+		return fmt.Errorf("--key and --sigstore-key are mutually exclusive")
+	case signArtifactsKey != "":
+		var passphrase []byte
+		if signArtifactsPassphraseFile != "" {
+			data, err := os.ReadFile(signArtifactsPassphraseFile)
+			if err != nil {
+				return err
+			}
+			passphrase = []byte(strings.TrimRight(string(data), "\n"))
+		}
+		signer, err = builds.LoadOpenPGPSigner(signArtifactsKey, passphrase)
+	case signArtifactsSigstoreKey != "":
+		signer, err = builds.LoadSigstoreSigner(signArtifactsSigstoreKey)
+	default:
+		return fmt.Errorf("one of --key or --sigstore-key is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	_, dir, err := builds.ReadBuild("builds", signArtifactsID, signArtifactsArch)
+	if err != nil {
+		return err
+	}
+	signed, err := builds.SignBuild(dir, signer, signArtifactsNames...)
+	if err != nil {
+		return err
+	}
+	for _, s := range signed {
+		fmt.Printf("Signed %s: %s\n", s.Name, filepath.Join(dir, s.Signature.Path))
+	}
+	fmt.Printf("Recorded %d signatures by %s in %s\n", len(signed), signer.KeyID(), filepath.Join(dir, builds.CosaMetaJSON))
+	return nil
+}
@@ -0,0 +1,162 @@
+// See usage below
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/internal/pkg/eventlog"
+)
+
+var (
+	timingsCount int
+	timingsRuns  bool
+	timingsLog   string
+	timingsJSON  bool
+
+	cmdTimings = &cobra.Command{
+		Use:   "timings",
+		Short: "cosa timings [-n N] [--runs] [--log PATH] [--json]",
+		Long: "Summarize where the time of the last builds went from the " +
+			"build-event log, which the cosa commands append to in " +
+			"tmp/build-events.jsonl. Each build lists the commands which " +
+			"created or extended it with their scripts and phases, followed " +
+			"by the totals of each step across the builds. --runs summarizes " +
+			"the last cosa invocations instead, whether they built or not.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          timings,
+	}
+)
+
+func init() {
+	cmdTimings.Flags().IntVarP(&timingsCount, "count", "n", 5, "number of builds or runs to summarize; 0 for all")
+	cmdTimings.Flags().BoolVar(&timingsRuns, "runs", false, "summarize the last cosa invocations instead of builds")
+	cmdTimings.Flags().StringVar(&timingsLog, "log", "", fmt.Sprintf("build-event log (default: $%s or %s)", eventlog.LogEnv, eventlog.DefaultLog))
+	cmdTimings.Flags().BoolVar(&timingsJSON, "json", false, "output JSON")
+}
+
+func runTimings(argv []string) error {
+	cmdTimings.SetArgs(argv)
+	return cmdTimings.Execute()
+}
+
+type timingsReport struct {
+	Builds []*eventlog.BuildTiming `json:"builds,omitempty"`
+	Runs   []*eventlog.RunTiming   `json:"runs,omitempty"`
+	Steps  []eventlog.StepStats    `json:"steps"`
+}
+
+func timings(c *cobra.Command, args []string) error {
+	path := timingsLog
+	if path == "" {
+		path = os.Getenv(eventlog.LogEnv)
+	}
+	if path == "" {
+		path = eventlog.DefaultLog
+	}
+	events, err := eventlog.ReadLog(path)
+	if err != nil {
+		return err
+	}
+
+	// Leave out this invocation of cosa timings.
+	var runs []*eventlog.RunTiming
+	for _, run := range eventlog.Runs(events) {
+		if run.Run != os.Getenv(eventlog.RunEnv) {
+			runs = append(runs, run)
+		}
+	}
+
+	var report timingsReport
+	var total float64
+	if timingsRuns {
+		report.Runs = eventlog.LastRuns(runs, timingsCount)
+		for _, run := range report.Runs {
+			total += run.Duration
+		}
+		report.Steps = eventlog.Aggregate(report.Runs)
+	} else {
+		report.Builds = eventlog.LastBuilds(runs, timingsCount)
+		var buildRuns []*eventlog.RunTiming
+		for _, b := range report.Builds {
+			buildRuns = append(buildRuns, b.Runs...)
+			total += b.Duration
+		}
+		report.Steps = eventlog.Aggregate(buildRuns)
+	}
+
+	if timingsJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	if timingsRuns {
+		if len(report.Runs) == 0 {
+			fmt.Printf("No runs in %s\n", path)
+			return nil
+		}
+		for _, run := range report.Runs {
+			printRunTiming(w, run)
+		}
+	} else {
+		if len(report.Builds) == 0 {
+			fmt.Printf("No builds in %s\n", path)
+			return nil
+		}
+		for _, b := range report.Builds {
+			runs := "runs"
+			if len(b.Runs) == 1 {
+				runs = "run"
+			}
+			fmt.Fprintf(w, "Build %s: %s in %d %s\n", b.Build, formatSeconds(b.Duration), len(b.Runs), runs)
+			for _, run := range b.Runs {
+				printRunTiming(w, run)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nSTEP\tCOUNT\tTOTAL\tMEAN\tMAX\t%%\n")
+	for _, st := range report.Steps {
+		var pct float64
+		if total > 0 {
+			pct = 100 * st.Total / total
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%.1f\n", st.Key, st.Count,
+			formatSeconds(st.Total), formatSeconds(st.Mean), formatSeconds(st.Max), pct)
+	}
+	return w.Flush()
+}
+
+func printRunTiming(w *tabwriter.Writer, run *eventlog.RunTiming) {
+	status := "unfinished"
+	if run.ExitStatus != nil {
+		status = fmt.Sprintf("exit %d", *run.ExitStatus)
+	}
+	fmt.Fprintf(w, "  %s\t%s\t%s, %s\n", run.Start.Local().Format(time.DateTime), run.Command, formatSeconds(run.Duration), status)
+	for _, step := range run.Steps {
+		failed := ""
+		if step.Failed {
+			failed = ", failed"
+		}
+		fmt.Fprintf(w, "    \t%s\t%s%s\n", step.Key(), formatSeconds(step.Duration), failed)
+	}
+}
+
+// formatSeconds formats a duration in seconds to the second, or to the
+// tenth of a second under a minute.
+func formatSeconds(secs float64) string {
+	d := time.Duration(secs * float64(time.Second))
+	if d < time.Minute {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
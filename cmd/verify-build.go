@@ -0,0 +1,129 @@
+// See usage below
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+var (
+	verifyBuildID           string
+	verifyBuildArch         string
+	verifyBuildJSON         bool
+	verifyBuildAllowMissing bool
+	verifyBuildKeyring      string
+	verifyBuildSigstoreKey  string
+
+	cmdVerifyBuild = &cobra.Command{
+		Use:   "verify-build",
+		Short: "cosa verify-build [--build ID] [--arch ARCH]",
+		Long: "Verify the sizes and SHA-256 digests of the artifacts of a build " +
+			"against its meta.json, e.g. after buildfetch. Missing artifacts " +
+			"fail the verification unless --allow-missing is given. With " +
+			"--keyring or --sigstore-key, the signatures recorded for the " +
+			"artifacts are verified too, and each artifact present must have " +
+			"a valid signature made with one of the keys.",
+		Args:          cobra.ExactArgs(0),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE:          verifyBuild,
+	}
+)
+
+func init() {
+	cmdVerifyBuild.Flags().StringVar(&verifyBuildID, "build", "", "build ID (default: latest)")
+	cmdVerifyBuild.Flags().StringVar(&verifyBuildArch, "arch", "", "architecture (default: the current one)")
+	cmdVerifyBuild.Flags().BoolVar(&verifyBuildJSON, "json", false, "output the report as JSON")
+	cmdVerifyBuild.Flags().BoolVar(&verifyBuildAllowMissing, "allow-missing", false, "only fail on corrupt artifacts")
+	cmdVerifyBuild.Flags().StringVar(&verifyBuildKeyring, "keyring", "", "OpenPGP keyring to verify signatures with")
+	cmdVerifyBuild.Flags().StringVar(&verifyBuildSigstoreKey, "sigstore-key", "", "PEM public key to verify sigstore bundles with")
+}
+
+func runVerifyBuild(argv []string) error {
+	cmdVerifyBuild.SetArgs(argv)
+	return cmdVerifyBuild.Execute()
+}
+
+func verifyBuild(c *cobra.Command, args []string) error {
+	build, dir, err := builds.ReadBuild("builds", verifyBuildID, verifyBuildArch)
+	if err != nil {
+		return err
+	}
+	report, err := build.Verify(dir)
+	if err != nil {
+		return err
+	}
+	var verifiers []builds.SignatureVerifier
+	if verifyBuildKeyring != "" {
+		v, err := builds.LoadOpenPGPVerifier(verifyBuildKeyring)
+		if err != nil {
+			return err
+		}
+		verifiers = append(verifiers, v)
+	}
+	if verifyBuildSigstoreKey != "" {
+		v, err := builds.LoadSigstoreVerifier(verifyBuildSigstoreKey)
+		if err != nil {
+			return err
+		}
+		verifiers = append(verifiers, v)
+	}
+	if len(verifiers) > 0 {
+		report.Signatures = build.VerifySignatures(dir, verifiers...)
+	}
+
+	failed := 0
+	for _, a := range report.Failed() {
+		if a.Status != builds.ArtifactMissing || !verifyBuildAllowMissing {
+			failed++
+		}
+	}
+	untrusted := builds.UntrustedArtifacts(report.Signatures)
+
+	if verifyBuildJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, a := range report.Artifacts {
+			line := fmt.Sprintf("%-10s %s (%s)", a.Status, a.Name, a.Path)
+			if a.Error != "" {
+				line += ": " + a.Error
+			}
+			fmt.Println(line)
+		}
+		for _, extra := range report.Extra {
+			fmt.Printf("%-10s %s\n", "extra", extra)
+		}
+		for _, s := range report.Signatures {
+			if s.Status == builds.SignatureUnsigned {
+				fmt.Printf("%-10s %s (%s)\n", s.Status, s.Name, s.Path)
+				continue
+			}
+			line := fmt.Sprintf("%-10s %s (%s)", s.Status, s.Name, s.Signature)
+			if s.KeyID != "" {
+				line += " by " + s.KeyID
+			}
+			if s.Error != "" {
+				line += ": " + s.Error
+			}
+			fmt.Println(line)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d artifacts of %s failed verification", failed, len(report.Artifacts), dir)
+	}
+	if len(untrusted) > 0 {
+		return fmt.Errorf("artifacts of %s without a valid signature: %s", dir, strings.Join(untrusted, ", "))
+	}
+	return nil
+}
@@ -20,6 +20,8 @@ import (
 	"os/exec"
 	"strings"
 	"syscall"
+
+	"github.com/coreos/coreos-assembler/internal/pkg/eventlog"
 )
 
 // StrictMode enables http://redsymbol.net/articles/unofficial-bash-strict-mode/
@@ -53,6 +55,8 @@ func NewBashRunner(name, src string, args ...string) (*BashRunner, error) {
 	}
 	cmd.Stdin = os.Stdin
 	cmd.ExtraFiles = append(cmd.ExtraFiles, f)
+	// fd 3 is the script here, not the build-event log.
+	cmd.Env = withoutEnv(os.Environ(), eventlog.FDEnv)
 
 	return &BashRunner{
 		name: name,
@@ -60,12 +64,24 @@ func NewBashRunner(name, src string, args ...string) (*BashRunner, error) {
 	}, nil
 }
 
+func withoutEnv(env []string, key string) []string {
+	var ret []string
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, key+"=") {
+			ret = append(ret, kv)
+		}
+	}
+	return ret
+}
+
 // Exec synchronously spawns the child process, passing stdin/stdout/stderr directly.
 func (r *BashRunner) Exec() error {
 	r.cmd.Stdin = os.Stdin
 	r.cmd.Stdout = os.Stdout
 	r.cmd.Stderr = os.Stderr
+	step := eventlog.Default().StartScript(r.name)
 	err := r.cmd.Run()
+	step.End(err)
 	if err != nil {
 		return fmt.Errorf("failed to execute internal script %s: %w", r.name, err)
 	}
@@ -74,7 +90,9 @@ func (r *BashRunner) Exec() error {
 
 // Run spawns the script, gathering stdout/stderr into a buffer that is displayed only on error.
 func (r *BashRunner) Run() error {
+	step := eventlog.Default().StartScript(r.name)
 	buf, err := r.cmd.CombinedOutput()
+	step.End(err)
 	if err != nil {
 		return fmt.Errorf("failed to execute internal script %s: %w\n%s", r.name, err, buf)
 	}
@@ -0,0 +1,110 @@
+package cmdregistry
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteUsage writes the list of commands by category.
+func (r *Registry) WriteUsage(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Usage: coreos-assembler CMD ...")
+	var category Category
+	for _, cmd := range r.Commands() {
+		if cmd.Hidden() {
+			continue
+		}
+		if cmd.Category != category {
+			category = cmd.Category
+			fmt.Fprintf(tw, "%s:\n", category.Title())
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.Name, cmd.Short)
+	}
+	fmt.Fprintln(tw, "\nRun 'coreos-assembler help CMD' for the help of a command.")
+	return tw.Flush()
+}
+
+// WriteHeader writes the summary of the command which precedes its
+// own help.
+func (c *Command) WriteHeader(w io.Writer) {
+	short := c.Short
+	if short == "" {
+		short = "(no description)"
+	}
+	fmt.Fprintf(w, "%s - %s\n", c.Name, short)
+	if len(c.Privileges) > 0 {
+		var privs []string
+		for _, p := range c.Privileges {
+			privs = append(privs, string(p))
+		}
+		fmt.Fprintf(w, "Requires: %s\n", strings.Join(privs, ", "))
+	}
+	if c.Path != "" {
+		fmt.Fprintf(w, "Implemented by: %s\n", c.Path)
+	}
+	fmt.Fprintln(w)
+}
+
+// Shells are the shells WriteCompletion supports.
+var Shells = []string{"bash", "fish", "zsh"}
+
+// WriteCompletion writes a script completing the command names of the
+// registry for shell. The commands are completed after `cosa` and
+// `cosa help`; their arguments are completed as files.
+func (r *Registry) WriteCompletion(w io.Writer, shell string) error {
+	cmds := r.Commands()
+	switch shell {
+	case "bash":
+		var names []string
+		for _, cmd := range cmds {
+			names = append(names, cmd.Name)
+		}
+		fmt.Fprintf(w, `_cosa() {
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    if [ "${COMP_CWORD}" -eq 1 ] || { [ "${COMP_CWORD}" -eq 2 ] && [ "${COMP_WORDS[1]}" = help ]; }; then
+        mapfile -t COMPREPLY < <(compgen -W "%s" -- "${cur}")
+    fi
+}
+complete -o default -F _cosa cosa coreos-assembler
+`, strings.Join(names, " "))
+	case "zsh":
+		fmt.Fprintln(w, "#compdef cosa coreos-assembler\n\n_cosa() {\n    local -a commands\n    commands=(")
+		for _, cmd := range cmds {
+			desc := strings.ReplaceAll(cmd.Short, ":", `\:`)
+			fmt.Fprintf(w, "        %s\n", shellQuote(cmd.Name+":"+desc))
+		}
+		fmt.Fprint(w, `    )
+    if (( CURRENT == 2 )) || { (( CURRENT == 3 )) && [[ ${words[2]} == help ]] }; then
+        _describe 'command' commands
+    else
+        _files
+    fi
+}
+
+compdef _cosa cosa coreos-assembler
+`)
+	case "fish":
+		for _, prog := range []string{"cosa", "coreos-assembler"} {
+			for _, cmd := range cmds {
+				for _, cond := range []string{"__fish_use_subcommand", "__fish_seen_subcommand_from help"} {
+					fmt.Fprintf(w, "complete -c %s -f -n %s -a %s -d %s\n",
+						prog, fishQuote(cond), fishQuote(cmd.Name), fishQuote(cmd.Short))
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported shell %q; supported are %s", shell, strings.Join(Shells, ", "))
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
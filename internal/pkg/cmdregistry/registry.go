@@ -0,0 +1,290 @@
+// Package cmdregistry implements the registry of the cosa subcommands.
+// Each command declares its name, category, short help and the
+// privileges it needs, and is either implemented in Go or by an external
+// `cmd-<name>` script discovered in a list of directories.
+//
+// External scripts may declare their metadata themselves with comments
+// in their first lines:
+//
+//	# cosa-short: Do something useful
+//	# cosa-category: utility
+//	# cosa-privileges: kvm, network
+//
+// Scripts which aren't registered and don't declare a short help can be
+// run but aren't listed in the usage.
+package cmdregistry
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/coreos-assembler/internal/pkg/eventlog"
+)
+
+// Category groups commands in the usage.
+type Category string
+
+const (
+	CategoryBuild    Category = "build"
+	CategoryAdvanced Category = "advanced"
+	CategoryPlatform Category = "platform"
+	CategoryUtility  Category = "utility"
+	CategoryOther    Category = "other"
+	CategoryExternal Category = "external"
+)
+
+// categories lists the categories in the order of the usage.
+var categories = []struct {
+	category Category
+	title    string
+}{
+	{CategoryBuild, "Build commands"},
+	{CategoryAdvanced, "Advanced build commands"},
+	{CategoryPlatform, "Platform builds"},
+	{CategoryUtility, "Utility commands"},
+	{CategoryOther, "Other commands"},
+	{CategoryExternal, "External commands"},
+}
+
+// Title returns the heading of the category in the usage.
+func (c Category) Title() string {
+	for _, cat := range categories {
+		if cat.category == c {
+			return cat.title
+		}
+	}
+	return string(c)
+}
+
+func (c Category) rank() int {
+	for i, cat := range categories {
+		if cat.category == c {
+			return i
+		}
+	}
+	return len(categories)
+}
+
+// Privilege is something a command needs from the environment it runs in.
+type Privilege string
+
+const (
+	// PrivilegeKVM is needed by commands which run virtual machines.
+	PrivilegeKVM Privilege = "kvm"
+	// PrivilegeNetwork is needed by commands which talk to remote
+	// services.
+	PrivilegeNetwork Privilege = "network"
+)
+
+// Command is a cosa subcommand.
+type Command struct {
+	Name       string
+	Category   Category
+	Short      string
+	Privileges []Privilege
+	// Local commands run on the local host even within a remote session.
+	Local bool
+	// Run implements Go-native commands.
+	Run func(argv []string) error
+	// Path is the script implementing external commands.
+	Path string
+
+	seq int
+}
+
+// Native returns whether the command is implemented in Go.
+func (c *Command) Native() bool {
+	return c.Run != nil
+}
+
+// Hidden returns whether the command is left out of the usage.
+func (c *Command) Hidden() bool {
+	return c.Short == ""
+}
+
+// Exec runs the command with the arguments argv.
+func (c *Command) Exec(argv []string) error {
+	if c.Run != nil {
+		return c.Run(argv)
+	}
+	if c.Path == "" {
+		return fmt.Errorf("command %s isn't installed", c.Name)
+	}
+	cmd := exec.Command(c.Path, argv...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := c.execScript(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to execute cmd-%s: %v\n", c.Name, err.Error())
+		return err
+	}
+	return nil
+}
+
+// execScript runs the script cmd, passing it a pipe on fd 3 to write the
+// phase markers of the build-event log to.
+func (c *Command) execScript(cmd *exec.Cmd) error {
+	log := eventlog.Default()
+	if log == nil {
+		return cmd.Run()
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	cmd.ExtraFiles = []*os.File{w}
+	cmd.Env = append(os.Environ(), eventlog.FDEnv+"=3")
+	if err := cmd.Start(); err != nil {
+		w.Close()
+		return err
+	}
+	w.Close()
+
+	phases := log.NewPhases(c.Name)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = phases.Read(r)
+	}()
+	err = cmd.Wait()
+	// Processes the script left behind may hold the pipe open; don't
+	// wait for them.
+	_ = r.SetReadDeadline(time.Now().Add(time.Second))
+	<-done
+	phases.Finish(err)
+	return err
+}
+
+// Registry holds the known commands.
+type Registry struct {
+	commands map[string]*Command
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{commands: make(map[string]*Command)}
+}
+
+// Register adds a command. Commands which are neither native nor have a
+// script yet get the script of the same name found by Discover.
+func (r *Registry) Register(cmd Command) error {
+	if cmd.Name == "" {
+		return fmt.Errorf("command without a name")
+	}
+	if _, ok := r.commands[cmd.Name]; ok {
+		return fmt.Errorf("command %s registered twice", cmd.Name)
+	}
+	if cmd.Category == "" {
+		cmd.Category = CategoryExternal
+	}
+	cmd.seq = len(r.commands)
+	r.commands[cmd.Name] = &cmd
+	return nil
+}
+
+// Lookup returns the command named name. Registered commands without a
+// script or Go implementation aren't returned.
+func (r *Registry) Lookup(name string) (*Command, bool) {
+	cmd, ok := r.commands[name]
+	if !ok || (cmd.Run == nil && cmd.Path == "") {
+		return nil, false
+	}
+	return cmd, true
+}
+
+// Commands returns the runnable commands ordered as in the usage: by
+// category, then in the order they were registered for build commands,
+// which is listed in frequency order, and by name for the others.
+func (r *Registry) Commands() []*Command {
+	var cmds []*Command
+	for _, cmd := range r.commands {
+		if cmd.Run != nil || cmd.Path != "" {
+			cmds = append(cmds, cmd)
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool {
+		a, b := cmds[i], cmds[j]
+		if a.Category != b.Category {
+			return a.Category.rank() < b.Category.rank()
+		}
+		if a.Category == CategoryBuild {
+			return a.seq < b.seq
+		}
+		return a.Name < b.Name
+	})
+	return cmds
+}
+
+// Discover registers the executable `cmd-*` scripts of the directories
+// dirs. The first script found for a name wins, and native commands
+// can't be overridden. Directories which don't exist are skipped.
+func (r *Registry) Discover(dirs ...string) error {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), "cmd-")
+			if !ok || name == "" {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			// Follow symlinks.
+			fi, err := os.Stat(path)
+			if err != nil || !fi.Mode().IsRegular() || fi.Mode().Perm()&0111 == 0 {
+				continue
+			}
+			if cmd, ok := r.commands[name]; ok {
+				if cmd.Run == nil && cmd.Path == "" {
+					cmd.Path = path
+				}
+				continue
+			}
+			cmd, err := readScriptMetadata(path)
+			if err != nil {
+				return err
+			}
+			cmd.Name = name
+			if cmd.Category == "" && strings.HasPrefix(name, "buildextend-") {
+				cmd.Category = CategoryPlatform
+			}
+			if err := r.Register(cmd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	// SystemDir holds the scripts installed with cosa.
+	SystemDir = "/usr/lib/coreos-assembler"
+	// ProjectDir holds the scripts of the config repository, relative
+	// to the working directory.
+	ProjectDir = "src/config/cosa-commands"
+	// PathEnv lists directories searched for scripts before the others.
+	PathEnv = "COREOS_ASSEMBLER_CMD_PATH"
+)
+
+// Dirs returns the directories searched for scripts in order: those of
+// $COREOS_ASSEMBLER_CMD_PATH, which may override the installed scripts,
+// then SystemDir, then ProjectDir, whose scripts can only add commands.
+func Dirs() []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(os.Getenv(PathEnv)) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return append(dirs, SystemDir, ProjectDir)
+}
@@ -0,0 +1,123 @@
+package cmdregistry
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeScript(t *testing.T, dir, name, content string, mode os.FileMode) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), mode); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func names(cmds []*Command) []string {
+	var names []string
+	for _, cmd := range cmds {
+		names = append(names, cmd.Name)
+	}
+	return names
+}
+
+func TestDiscover(t *testing.T) {
+	override, system, project := t.TempDir(), t.TempDir(), t.TempDir()
+	writeScript(t, system, "cmd-fetch", "#!/bin/sh\n", 0755)
+	writeScript(t, system, "cmd-build", "#!/bin/sh\n", 0755)
+	writeScript(t, system, "cmd-clean", "#!/bin/sh\n", 0755)
+	writeScript(t, system, "cmd-basearch", "#!/bin/sh\n", 0755)
+	writeScript(t, system, "cmdlib.sh", "#!/bin/sh\n", 0755)
+	writeScript(t, system, "cmd-buildextend-foo", "#!/bin/sh\n# cosa-short: Build the foo image\n", 0755)
+	build := writeScript(t, override, "cmd-build", "#!/bin/sh\n", 0755)
+	writeScript(t, project, "cmd-fetch", "#!/bin/sh\n", 0755)
+	writeScript(t, project, "cmd-notexec", "#!/bin/sh\n# cosa-short: Not executable\n", 0644)
+	hello := writeScript(t, project, "cmd-hello", `#!/usr/bin/python3
+# cosa-short: Say hello
+# cosa-category: utility
+# cosa-privileges: kvm, network
+print("hello")
+`, 0755)
+
+	r := New()
+	for _, cmd := range []Command{
+		{Name: "fetch", Category: CategoryBuild, Short: "Fetch"},
+		{Name: "build", Category: CategoryBuild, Short: "Build"},
+		{Name: "clean", Category: CategoryBuild, Short: "Clean", Run: func([]string) error { return nil }},
+		{Name: "list", Category: CategoryBuild, Short: "List"},
+	} {
+		if err := r.Register(cmd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Register(Command{Name: "fetch"}); err == nil {
+		t.Error("expected registering fetch twice to fail")
+	}
+	if err := r.Discover(override, system, filepath.Join(project, "missing"), project); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"fetch", "build", "clean", "buildextend-foo", "hello", "basearch"}
+	if got := names(r.Commands()); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected commands %v, got %v", want, got)
+	}
+	if _, ok := r.Lookup("list"); ok {
+		t.Error("list has no script and shouldn't be runnable")
+	}
+	if cmd, _ := r.Lookup("build"); cmd.Path != build {
+		t.Errorf("expected build to be overridden by %s, got %s", build, cmd.Path)
+	}
+	if cmd, _ := r.Lookup("fetch"); cmd.Path != filepath.Join(system, "cmd-fetch") {
+		t.Errorf("expected fetch from the system dir, got %s", cmd.Path)
+	}
+	if cmd, _ := r.Lookup("clean"); !cmd.Native() || cmd.Path != "" {
+		t.Error("native clean was overridden by a script")
+	}
+	if cmd, _ := r.Lookup("buildextend-foo"); cmd.Category != CategoryPlatform {
+		t.Errorf("expected buildextend-foo to be a platform build, got %s", cmd.Category)
+	}
+	cmd, _ := r.Lookup("hello")
+	wantHello := &Command{Name: "hello", Category: CategoryUtility, Short: "Say hello",
+		Privileges: []Privilege{PrivilegeKVM, PrivilegeNetwork}, Path: hello, seq: cmd.seq}
+	if !reflect.DeepEqual(cmd, wantHello) {
+		t.Errorf("expected %+v, got %+v", wantHello, cmd)
+	}
+	if cmd, _ := r.Lookup("basearch"); !cmd.Hidden() || cmd.Category != CategoryExternal {
+		t.Errorf("expected basearch to be a hidden external command, got %+v", cmd)
+	}
+
+	var usage bytes.Buffer
+	if err := r.WriteUsage(&usage); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(usage.String(), "basearch") || !strings.Contains(usage.String(), "Utility commands:\n  hello") {
+		t.Errorf("unexpected usage:\n%s", usage.String())
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	r := New()
+	if err := r.Register(Command{Name: "tag", Short: "Operate on the tags: it's handy", Run: func([]string) error { return nil }}); err != nil {
+		t.Fatal(err)
+	}
+	for shell, want := range map[string]string{
+		"bash": `compgen -W "tag"`,
+		"zsh":  `'tag:Operate on the tags\: it'\''s handy'`,
+		"fish": `complete -c cosa -f -n '__fish_use_subcommand' -a 'tag' -d 'Operate on the tags: it\'s handy'`,
+	} {
+		var buf bytes.Buffer
+		if err := r.WriteCompletion(&buf, shell); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("%s: expected %q in:\n%s", shell, want, buf.String())
+		}
+	}
+	if err := r.WriteCompletion(&bytes.Buffer{}, "tcsh"); err == nil {
+		t.Error("expected tcsh to be unsupported")
+	}
+}
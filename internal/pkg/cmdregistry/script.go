@@ -0,0 +1,51 @@
+package cmdregistry
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// The metadata comments of a script must be in its first lines.
+const scriptMetadataLines = 30
+
+// readScriptMetadata parses the `# cosa-<key>: <value>` comments of the
+// script at path into the command it implements.
+func readScriptMetadata(path string) (Command, error) {
+	cmd := Command{Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return cmd, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < scriptMetadataLines && scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		comment, ok := strings.CutPrefix(line, "#")
+		if !ok {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(comment), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "cosa-short":
+			cmd.Short = value
+		case "cosa-category":
+			cmd.Category = Category(value)
+		case "cosa-privileges":
+			for _, p := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+				cmd.Privileges = append(cmd.Privileges, Privilege(p))
+			}
+		}
+	}
+	// Scripts may be binaries whose lines are too long for the scanner;
+	// they just don't declare any metadata.
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return cmd, err
+	}
+	return cmd, nil
+}
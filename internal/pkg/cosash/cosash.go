@@ -9,50 +9,132 @@
 // although this is not strictly required.  The Go APIs here call dynamically
 // into the bash process by writing to its stdin, and can receive serialized
 // data back over a pipe on file descriptor 3.
+//
+// Each request is a shell fragment. It replies by writing JSON frames, one
+// per line, to fd 3 with the helpers of protocol.sh: cosash_reply and
+// cosash_reply_string for its result, cosash_error to fail, and
+// cosash_progress to report its progress. A "done" frame ends the request.
+// Other lines written to fd 3 are taken as a plain string reply, and the
+// phase markers cmdlib.sh writes to fd 3 are logged in the build-event log.
+//
+// Canceling the context of a request terminates the shell and the
+// processes it runs; the CosaSh can't be used afterwards.
 package cosash
 
 import (
 	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/coreos/coreos-assembler/internal/pkg/bashexec"
+	"github.com/coreos/coreos-assembler/internal/pkg/eventlog"
 )
 
+//go:embed protocol.sh
+var protocolLib string
+
+// cmdlibPath is the library the shell sources.
+var cmdlibPath = "/usr/lib/coreos-assembler/cmdlib.sh"
+
+// cancelGracePeriod is how long a canceled shell has to exit after
+// SIGTERM before it's killed.
+const cancelGracePeriod = 5 * time.Second
+
+const (
+	frameResult   = "result"
+	frameError    = "error"
+	frameProgress = "progress"
+	frameDone     = "done"
+	// frameLegacy holds a line written to fd 3 which isn't a frame.
+	frameLegacy = "legacy"
+)
+
+// frame is a message of the shell on fd 3.
+type frame struct {
+	Serial  uint64          `json:"serial"`
+	Type    string          `json:"type"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Percent *float64        `json:"percent,omitempty"`
+}
+
+// Error is the error a request failed with, either through cosash_error
+// or because the shell exited.
+type Error struct {
+	Message string `json:"message"`
+	// Status is the exit status of the shell if it exited.
+	Status int `json:"status,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return "cosash: " + e.Message
+}
+
+// Progress is a progress message of a request.
+type Progress struct {
+	Message string
+	// Percent is the percentage done, nil if unknown.
+	Percent *float64
+}
+
 // CosaSh is a companion shell process which accepts commands
 // piped over stdin.
 type CosaSh struct {
 	cmd           *exec.Cmd
 	input         io.WriteCloser
 	preparedBuild bool
-	ackserial     uint64
-	replychan     <-chan (string)
-	errchan       <-chan (error)
+	log           *eventlog.Logger
+
+	// mu serializes the requests.
+	mu     sync.Mutex
+	serial uint64
+	frames <-chan frame
+	// exited is closed when the shell exits, with exitErr.
+	exited  chan struct{}
+	exitErr error
 }
 
-func parseAck(r *bufio.Reader, expected uint64) (string, error) {
-	linebytes, _, err := r.ReadLine()
-	if err != nil {
-		return "", err
-	}
-	line := string(linebytes)
-	parts := strings.SplitN(line, " ", 2)
-	if len(parts) != 2 {
-		return "", fmt.Errorf("invalid reply from cosash: %s", line)
-	}
-	serial, err := strconv.ParseUint(parts[0], 10, 64)
-	if err != nil {
-		return "", fmt.Errorf("invalid reply from cosash: %s", line)
-	}
-	if serial != expected {
-		return "", fmt.Errorf("unexpected ack serial from cosash; expected=%d reply=%d", expected, serial)
+// readFrames parses the lines of in into frames, logging the phase
+// markers with phases, until EOF.
+func readFrames(in io.Reader, phases *eventlog.Phases, frames chan<- frame) {
+	defer close(frames)
+	bufr := bufio.NewReader(in)
+	// partial is the start of a line which a phase marker interrupted.
+	var partial string
+	for {
+		linebytes, err := bufr.ReadString('\n')
+		if err != nil {
+			phases.Finish(nil)
+			return
+		}
+		line := strings.TrimSuffix(linebytes, "\n")
+		if i := strings.Index(line, eventlog.PhaseMarker); i > 0 {
+			partial += line[:i]
+			line = line[i:]
+		}
+		if phases.Handle(line) {
+			continue
+		}
+		line = partial + line
+		partial = ""
+
+		var f frame
+		if !strings.HasPrefix(line, "{") || json.Unmarshal([]byte(line), &f) != nil || f.Type == "" {
+			f = frame{Type: frameLegacy, Message: line}
+		}
+		frames <- f
 	}
-	return parts[1], nil
 }
 
 // NewCosaSh creates a new companion shell process
@@ -60,6 +142,9 @@ func NewCosaSh() (*CosaSh, error) {
 	cmd := exec.Command("/bin/bash")
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Pdeathsig: syscall.SIGTERM,
+		// Put the shell in its own process group so that canceling
+		// a request can signal everything it runs.
+		Setpgid: true,
 	}
 	// This is the channel where we send our commands
 	input, err := cmd.StdinPipe()
@@ -71,6 +156,7 @@ func NewCosaSh() (*CosaSh, error) {
 	// printed.
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), eventlog.FDEnv+"=3")
 
 	cmdin, cmdout, err := os.Pipe()
 	if err != nil {
@@ -82,42 +168,29 @@ func NewCosaSh() (*CosaSh, error) {
 	if err := cmd.Start(); err != nil {
 		return nil, err
 	}
+	cmdout.Close()
 
-	replychan := make(chan string)
-	errchan := make(chan error)
-
+	frames := make(chan frame)
+	log := eventlog.Default()
 	r := &CosaSh{
 		input:         input,
 		cmd:           cmd,
-		replychan:     replychan,
-		errchan:       errchan,
 		preparedBuild: false,
+		log:           log,
+		frames:        frames,
+		exited:        make(chan struct{}),
 	}
 
-	// Send a message when the process exits
-	go func() {
-		errchan <- cmd.Wait()
-	}()
-	// Parse the ack serials into a channel
+	// Record the exit of the process
 	go func() {
-		bufr := bufio.NewReader(cmdin)
-		for {
-			reply, err := parseAck(bufr, r.ackserial)
-			if err != nil {
-				// Don't propagate EOF, since we want the process exit status instead.
-				if err == io.EOF {
-					break
-				}
-				errchan <- err
-				break
-			}
-			r.ackserial += 1
-			replychan <- reply
-		}
+		r.exitErr = cmd.Wait()
+		close(r.exited)
 	}()
+	// Parse the frames into a channel
+	go readFrames(cmdin, log.NewPhases(log.Command()), frames)
 
-	// Initialize the internal library
-	err = r.Process(fmt.Sprintf("%s\n. /usr/lib/coreos-assembler/cmdlib.sh\n", bashexec.StrictMode))
+	// Initialize the protocol and the internal library
+	err = r.Process(fmt.Sprintf("%s\n%s\n. %s\n", bashexec.StrictMode, protocolLib, cmdlibPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to init cosash: %w", err)
 	}
@@ -125,66 +198,216 @@ func NewCosaSh() (*CosaSh, error) {
 	return r, nil
 }
 
-// write sends content to the shell's stdin, synchronously wait for the reply
-func (r *CosaSh) ProcessWithReply(buf string) (string, error) {
-	// Inject code which writes the serial reply prefix
-	cmd := fmt.Sprintf("echo -n \"%d \" >&3\n", r.ackserial)
-	if _, err := io.WriteString(r.input, cmd); err != nil {
-		return "", err
+// Request runs the shell fragment script, unmarshaling its reply into
+// result unless result is nil, and passing its progress messages to
+// progress if not nil. Each request is logged as a script in the
+// build-event log, named after the first line of script.
+func (r *CosaSh) Request(ctx context.Context, script string, result interface{}, progress func(Progress)) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	select {
+	case <-r.exited:
+		return r.exitError(nil)
+	default:
+	}
+
+	step := r.log.StartScript("cosash: " + scriptName(script))
+	defer func() { step.End(err) }()
+
+	serial := r.serial
+	r.serial++
+	if !strings.HasSuffix(script, "\n") {
+		script += "\n"
 	}
-	// Tell the shell to execute the code, which should write the reply to fd 3
-	// which will complete the command.
+	buf := fmt.Sprintf("__cosash_serial=%d\n%s__cosash_done\n", serial, script)
 	if _, err := io.WriteString(r.input, buf); err != nil {
-		return "", err
+		return err
 	}
-	if !strings.HasSuffix(buf, "\n") {
-		if _, err := io.WriteString(r.input, "\n"); err != nil {
-			return "", err
+
+	var reply json.RawMessage
+	var legacy []string
+	var reqErr error
+	// handle processes f and returns whether the request is done.
+	handle := func(f frame) bool {
+		if f.Type == frameLegacy {
+			legacy = append(legacy, f.Message)
+			return false
 		}
+		if f.Serial != serial {
+			return false
+		}
+		switch f.Type {
+		case frameResult:
+			reply = f.Result
+		case frameError:
+			if reqErr == nil && f.Error != nil {
+				reqErr = f.Error
+			}
+		case frameProgress:
+			if progress != nil {
+				progress(Progress{Message: f.Message, Percent: f.Percent})
+			}
+		case frameDone:
+			return true
+		}
+		return false
 	}
 
+	for {
+		select {
+		case f, ok := <-r.frames:
+			if !ok {
+				// fd 3 was closed, the shell is exiting.
+				select {
+				case <-r.exited:
+				case <-ctx.Done():
+					r.kill()
+				}
+				return r.exitError(reqErr)
+			}
+			if handle(f) {
+				if reqErr != nil {
+					return reqErr
+				}
+				return unmarshalReply(reply, legacy, result)
+			}
+		case <-r.exited:
+			// Handle the frames written before exiting, e.g. by
+			// cosash_error.
+			for drained := false; !drained; {
+				select {
+				case f, ok := <-r.frames:
+					drained = !ok
+					if ok {
+						handle(f)
+					}
+				case <-time.After(100 * time.Millisecond):
+					drained = true
+				}
+			}
+			return r.exitError(reqErr)
+		case <-ctx.Done():
+			r.kill()
+			return fmt.Errorf("cosash request canceled: %w", ctx.Err())
+		}
+	}
+}
+
+func unmarshalReply(reply json.RawMessage, legacy []string, result interface{}) error {
+	if result == nil {
+		return nil
+	}
+	if reply != nil {
+		return json.Unmarshal(reply, result)
+	}
+	if legacy == nil {
+		return fmt.Errorf("no reply from cosash")
+	}
+	text := strings.Join(legacy, "\n")
+	if s, ok := result.(*string); ok {
+		*s = text
+		return nil
+	}
+	return json.Unmarshal([]byte(text), result)
+}
+
+// exitError returns the error of a request which ended with the shell,
+// preferring the error reqErr the shell reported.
+func (r *CosaSh) exitError(reqErr error) error {
+	if reqErr != nil {
+		return reqErr
+	}
+	// The status comes from Wait rather than an EXIT trap in the shell,
+	// which cmdlib.sh and the requests are free to replace.
+	var exitErr *exec.ExitError
+	if errors.As(r.exitErr, &exitErr) && exitErr.ExitCode() > 0 {
+		status := exitErr.ExitCode()
+		return &Error{Message: fmt.Sprintf("shell exited with status %d", status), Status: status}
+	}
+	if r.exitErr != nil {
+		return fmt.Errorf("cosash exited: %w", r.exitErr)
+	}
+	return fmt.Errorf("cosash exited unexpectedly")
+}
+
+// kill terminates the shell and the processes it runs, killing them if
+// they don't exit within cancelGracePeriod. The shell leads its own
+// process group, which its children inherit.
+func (r *CosaSh) kill() {
+	pgid := r.cmd.Process.Pid
+	_ = syscall.Kill(-pgid, syscall.SIGTERM)
 	select {
-	case reply := <-r.replychan:
-		return reply, nil
-	case err := <-r.errchan:
-		return "", err
+	case <-r.exited:
+	case <-time.After(cancelGracePeriod):
+		_ = syscall.Kill(-pgid, syscall.SIGKILL)
+		<-r.exited
+	}
+}
+
+// scriptName returns the first non-empty line of the code buf.
+func scriptName(buf string) string {
+	for _, line := range strings.Split(buf, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
 	}
+	return ""
+}
+
+// ProcessWithReply sends content to the shell's stdin, and synchronously
+// waits for the reply, either a string passed to cosash_reply_string or
+// the lines written to fd 3.
+func (r *CosaSh) ProcessWithReply(buf string) (string, error) {
+	var reply string
+	err := r.Request(context.Background(), buf, &reply, nil)
+	return reply, err
 }
 
+// Process runs buf in the shell and waits for it to complete.
 func (sh *CosaSh) Process(buf string) error {
-	buf = fmt.Sprintf("%s\necho OK >&3\n", buf)
-	r, err := sh.ProcessWithReply(buf)
-	if err != nil {
+	return sh.Request(context.Background(), buf, nil, nil)
+}
+
+// Close closes the shell's stdin and waits for it to exit.
+func (sh *CosaSh) Close() error {
+	if err := sh.input.Close(); err != nil {
 		return err
 	}
-	if r != "OK" {
-		return fmt.Errorf("unexpected reply from cosash; expected OK, found %s", r)
-	}
-	return nil
+	<-sh.exited
+	return sh.exitErr
 }
 
 // PrepareBuild prepares for a build, returning the newly allocated build directory
 func (sh *CosaSh) PrepareBuild(artifact_name string) (string, error) {
+	return sh.PrepareBuildContext(context.Background(), artifact_name)
+}
+
+// PrepareBuildContext is PrepareBuild, canceled with ctx.
+func (sh *CosaSh) PrepareBuildContext(ctx context.Context, artifact_name string) (string, error) {
 	if artifact_name != "" {
-		if err := sh.Process(fmt.Sprintf("IMAGE_TYPE=%s", artifact_name)); err != nil {
+		if err := sh.Request(ctx, fmt.Sprintf("IMAGE_TYPE=%s", artifact_name), nil, nil); err != nil {
 			return "", err
 		}
 	}
-	return sh.ProcessWithReply(`prepare_build
-pwd >&3
-`)
+	var builddir string
+	err := sh.Request(ctx, `prepare_build
+cosash_reply_string "$(pwd)"
+`, &builddir, nil)
+	if err == nil {
+		sh.preparedBuild = true
+	}
+	return builddir, err
 }
 
 // HasPrivileges checks if we can use sudo
 func (sh *CosaSh) HasPrivileges() (bool, error) {
-	r, err := sh.ProcessWithReply(`
+	var r bool
+	err := sh.Request(context.Background(), `
 if has_privileges; then
-  echo true >&3
+  cosash_reply true
 else
-  echo false >&3
-fi`)
-	if err != nil {
-		return false, err
-	}
-	return strconv.ParseBool(r)
+  cosash_reply false
+fi`, &r, nil)
+	return r, err
 }
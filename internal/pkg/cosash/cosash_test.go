@@ -0,0 +1,161 @@
+package cosash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newTestCosaSh returns a companion shell sourcing a stand-in for
+// cmdlib.sh.
+func newTestCosaSh(t *testing.T) *CosaSh {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "cmdlib.sh")
+	err := os.WriteFile(lib, []byte(`
+has_privileges() { false; }
+prepare_build() { mkdir -p tmp/build && cd tmp/build; }
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := cmdlibPath
+	cmdlibPath = lib
+	t.Cleanup(func() { cmdlibPath = oldPath })
+	t.Chdir(dir)
+
+	sh, err := NewCosaSh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = sh.Close() })
+	return sh
+}
+
+func TestRequest(t *testing.T) {
+	sh := newTestCosaSh(t)
+	ctx := context.Background()
+
+	var result struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+	var progress []string
+	err := sh.Request(ctx, `
+cosash_progress "starting"
+cosash_progress "half way" 50
+cosash_reply '{"name": "a \"quoted\"\nname", "count": 2}'
+`, &result, func(p Progress) {
+		if p.Percent != nil {
+			progress = append(progress, fmt.Sprintf("%s %g", p.Message, *p.Percent))
+		} else {
+			progress = append(progress, p.Message)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Name != "a \"quoted\"\nname" || result.Count != 2 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if want := []string{"starting", "half way 50"}; !reflect.DeepEqual(progress, want) {
+		t.Errorf("expected progress %v, got %v", want, progress)
+	}
+
+	// State persists across requests, and strings are escaped.
+	if err := sh.Process(`value=$'tab\there "quote" \\ back'`); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := sh.ProcessWithReply(`cosash_reply_string "${value}"`)
+	if err != nil || reply != "tab\there \"quote\" \\ back" {
+		t.Errorf("unexpected reply %q, %v", reply, err)
+	}
+	// So are all the control characters.
+	if err := sh.Process(`value=$'bell\a esc\e[0m\x01\x1f\r\n'`); err != nil {
+		t.Fatal(err)
+	}
+	reply, err = sh.ProcessWithReply(`cosash_reply_string "${value}"`)
+	if err != nil || reply != "bell\a esc\x1b[0m\x01\x1f\r\n" {
+		t.Errorf("unexpected reply %q, %v", reply, err)
+	}
+	if err := sh.Request(ctx, `cosash_error $'bad\x02'`, nil, nil); err == nil || err.Error() != "cosash: bad\x02" {
+		t.Errorf("unexpected error %v", err)
+	}
+	// Plain lines written to fd 3 are still a string reply.
+	if reply, err := sh.ProcessWithReply("echo legacy >&3"); err != nil || reply != "legacy" {
+		t.Errorf("unexpected legacy reply %q, %v", reply, err)
+	}
+
+	var errReq *Error
+	err = sh.Request(ctx, `cosash_error "no such build"`, nil, nil)
+	if !errors.As(err, &errReq) || errReq.Message != "no such build" || errReq.Status != 0 {
+		t.Errorf("expected a request error, got %v", err)
+	}
+	// The shell survives errors reported by cosash_error.
+	priv, err := sh.HasPrivileges()
+	if err != nil || priv {
+		t.Errorf("unexpected privileges %v, %v", priv, err)
+	}
+	dir, err := sh.PrepareBuild("")
+	if err != nil || filepath.Base(dir) != "build" {
+		t.Errorf("unexpected build dir %q, %v", dir, err)
+	}
+}
+
+func TestRequestExit(t *testing.T) {
+	sh := newTestCosaSh(t)
+	var errReq *Error
+	err := sh.Process("false")
+	if !errors.As(err, &errReq) || errReq.Status != 1 {
+		t.Fatalf("expected the shell to exit with 1, got %v", err)
+	}
+	if err := sh.Process("true"); err == nil {
+		t.Error("expected requests to fail after the shell exited")
+	}
+}
+
+func TestRequestExitTrap(t *testing.T) {
+	sh := newTestCosaSh(t)
+	// Requests may install their own EXIT trap, as cmdlib.sh does.
+	var errReq *Error
+	err := sh.Process(`trap 'echo cleanup' EXIT; exit 3`)
+	if !errors.As(err, &errReq) || errReq.Status != 3 || errReq.Message != "shell exited with status 3" {
+		t.Fatalf("expected the shell to exit with 3, got %v", err)
+	}
+}
+
+func TestRequestCancel(t *testing.T) {
+	sh := newTestCosaSh(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	var child int
+	err := sh.Request(ctx, `sleep 30 & cosash_progress "$!"; wait`, nil, func(p Progress) {
+		child, _ = strconv.Atoi(p.Message)
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the request to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cancellation took %s", elapsed)
+	}
+	if child == 0 {
+		t.Fatal("didn't get the PID of the child")
+	}
+	// The child is reaped by init once killed.
+	for i := 0; syscall.Kill(child, 0) == nil; i++ {
+		if i == 50 {
+			t.Fatal("the child of the shell survived the cancellation")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := sh.Process("true"); err == nil {
+		t.Error("expected requests to fail after the cancellation")
+	}
+}
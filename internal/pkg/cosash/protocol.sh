@@ -0,0 +1,56 @@
+# The cosash side of the protocol; see cosash.go. Requests write frames,
+# one JSON object per line, to fd 3. __cosash_serial is set by each
+# request to its serial.
+
+__cosash_json_string() {
+    local s=$1 i hex c u
+    s=${s//\\/\\\\}
+    s=${s//\"/\\\"}
+    s=${s//$'\n'/\\n}
+    s=${s//$'\r'/\\r}
+    s=${s//$'\t'/\\t}
+    # JSON strings can't hold any other control character either.
+    if [[ ${s} == *[[:cntrl:]]* ]]; then
+        for ((i = 1; i < 32; i++)); do
+            printf -v hex '%02x' "${i}"
+            printf -v c "\\x${hex}"
+            printf -v u '\\u%04x' "${i}"
+            s=${s//"${c}"/${u}}
+        done
+    fi
+    printf '"%s"' "${s}"
+}
+
+__cosash_frame() {
+    printf '{"serial":%d,"type":"%s"%s}\n' "${__cosash_serial}" "$1" "${2:-}" >&3
+}
+
+# Reply to the request with the JSON value $1.
+cosash_reply() {
+    __cosash_frame result ",\"result\":$1"
+}
+
+# Reply to the request with the string $1.
+cosash_reply_string() {
+    cosash_reply "$(__cosash_json_string "$1")"
+}
+
+# Fail the request with the message $1. The shell keeps running; the
+# request should return early.
+cosash_error() {
+    __cosash_frame error ",\"error\":{\"message\":$(__cosash_json_string "$1")}"
+}
+
+# Report the progress of the request with the message $1 and optionally
+# the percentage done $2.
+cosash_progress() {
+    local percent=
+    if [ -n "${2:-}" ]; then
+        percent=",\"percent\":$2"
+    fi
+    __cosash_frame progress ",\"message\":$(__cosash_json_string "$1")${percent}"
+}
+
+__cosash_done() {
+    __cosash_frame done
+}
@@ -0,0 +1,228 @@
+// Package eventlog records structured build events, such as the start
+// and end of cosa commands, of the internal scripts they run and of the
+// build phases cmdlib.sh marks, into a JSON-lines file. Each line is one
+// Event; `cosa timings` summarizes them.
+//
+// The events of a top-level cosa invocation and of the cosa commands it
+// runs in turn share a run ID, passed down through $COSA_RUN_ID.
+package eventlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// LogEnv overrides the path of the log.
+	LogEnv = "COSA_EVENT_LOG"
+	// RunEnv holds the ID of the top-level cosa invocation.
+	RunEnv = "COSA_RUN_ID"
+	// FDEnv is set to the file descriptor of the shell scripts which
+	// they write phase markers to.
+	FDEnv = "COSA_EVENT_FD"
+	// DefaultLog is the path of the log relative to the working
+	// directory. Events are only logged by default if tmp/ exists.
+	DefaultLog = "tmp/build-events.jsonl"
+)
+
+// Type is the type of an event.
+type Type string
+
+const (
+	CommandStart Type = "command-start"
+	CommandEnd   Type = "command-end"
+	ScriptStart  Type = "script-start"
+	ScriptEnd    Type = "script-end"
+	PhaseStart   Type = "phase-start"
+	PhaseEnd     Type = "phase-end"
+)
+
+// Event is a line of the log. End events carry the duration of the step
+// since the matching start event.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Run     string    `json:"run"`
+	PID     int       `json:"pid"`
+	Type    Type      `json:"type"`
+	Command string    `json:"command,omitempty"`
+	// Name is the name of the script or of the phase.
+	Name string   `json:"name,omitempty"`
+	Args []string `json:"args,omitempty"`
+	// Build is the build a command created or extended.
+	Build      string  `json:"build,omitempty"`
+	ExitStatus *int    `json:"exit-status,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Duration   float64 `json:"duration,omitempty"`
+}
+
+// Logger appends events to a log. A nil Logger discards them.
+type Logger struct {
+	mu  sync.Mutex
+	f   *os.File
+	run string
+	// command is the top-level command of this process.
+	command string
+}
+
+// Open opens the log at path for appending the events of the run.
+func Open(path, run string) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{f: f, run: run}, nil
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultLogger *Logger
+)
+
+// Default returns the logger configured by the environment: the log is
+// $COSA_EVENT_LOG or DefaultLog, and the run $COSA_RUN_ID or a new ID.
+// Both are exported, so that the cosa commands run by this process log
+// into the same file and run. Default returns nil if there's no log.
+func Default() *Logger {
+	defaultOnce.Do(func() {
+		path := os.Getenv(LogEnv)
+		if path == "" {
+			if fi, err := os.Stat(filepath.Dir(DefaultLog)); err != nil || !fi.IsDir() {
+				return
+			}
+			path = DefaultLog
+		}
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return
+		}
+		run := os.Getenv(RunEnv)
+		if run == "" {
+			run = fmt.Sprintf("%s-%d", time.Now().UTC().Format("20060102T150405Z"), os.Getpid())
+		}
+		l, err := Open(path, run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to open the build-event log: %v\n", err)
+			return
+		}
+		os.Setenv(LogEnv, path)
+		os.Setenv(RunEnv, run)
+		defaultLogger = l
+	})
+	return defaultLogger
+}
+
+// Command returns the top-level command of this process.
+func (l *Logger) Command() string {
+	if l == nil {
+		return ""
+	}
+	return l.command
+}
+
+// Emit appends e to the log, filling in its time, run and PID. Errors
+// are only reported on stderr since the log mustn't fail builds.
+func (l *Logger) Emit(e Event) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Run = l.run
+	e.PID = os.Getpid()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(e)
+	if err == nil {
+		l.mu.Lock()
+		// A single write per line keeps the lines of the processes
+		// appending to the log whole.
+		_, err = l.f.Write(buf.Bytes())
+		l.mu.Unlock()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: failed to log build event: %v\n", err)
+	}
+}
+
+// Close closes the log.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// Step is a command or script being timed.
+type Step struct {
+	l       *Logger
+	typ     Type
+	command string
+	name    string
+	start   time.Time
+}
+
+// StartCommand logs the start of the cosa command with the arguments args.
+// The first command started is the one the scripts are attributed to.
+func (l *Logger) StartCommand(command string, args []string) *Step {
+	if l != nil && l.command == "" {
+		l.command = command
+	}
+	s := &Step{l: l, typ: CommandEnd, command: command, start: time.Now()}
+	l.Emit(Event{Time: s.start, Type: CommandStart, Command: command, Args: args})
+	return s
+}
+
+// StartScript logs the start of the internal script name of the current
+// command.
+func (l *Logger) StartScript(name string) *Step {
+	s := &Step{l: l, typ: ScriptEnd, command: l.Command(), name: name, start: time.Now()}
+	l.Emit(Event{Time: s.start, Type: ScriptStart, Command: s.command, Name: name})
+	return s
+}
+
+// End logs the end of the step with the result err.
+func (s *Step) End(err error) {
+	s.EndBuild(err, "")
+}
+
+// EndBuild logs the end of the step with the result err, and the build
+// the step created if any.
+func (s *Step) EndBuild(err error, build string) {
+	now := time.Now()
+	e := Event{
+		Time:     now,
+		Type:     s.typ,
+		Command:  s.command,
+		Name:     s.name,
+		Build:    build,
+		Duration: now.Sub(s.start).Seconds(),
+	}
+	status := ExitStatus(err)
+	e.ExitStatus = &status
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.l.Emit(e)
+}
+
+// ExitStatus returns the exit status of a process which failed with err.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() >= 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
+}
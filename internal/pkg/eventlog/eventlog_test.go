@@ -0,0 +1,117 @@
+package eventlog
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := Open(path, "run1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := l.StartCommand("build", []string{"--force"})
+	script := l.StartScript("prepare")
+	script.End(nil)
+	phases := l.NewPhases("build")
+	if phases.Handle("not a marker") {
+		t.Error("handled a line which isn't a phase marker")
+	}
+	for _, line := range []string{"\x1ephase-start compose", "\x1ephase-end compose", "\x1ephase-start runvm"} {
+		if !phases.Handle(line) {
+			t.Errorf("didn't handle %q", line)
+		}
+	}
+	failure := errors.New("failed")
+	phases.Finish(failure)
+	cmd.EndBuild(failure, "41.1")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := ReadLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []Type
+	for _, e := range events {
+		if e.Run != "run1" || e.Command != "build" {
+			t.Errorf("unexpected run or command in %+v", e)
+		}
+		types = append(types, e.Type)
+	}
+	wantTypes := []Type{CommandStart, ScriptStart, ScriptEnd, PhaseStart, PhaseEnd, PhaseStart, PhaseEnd, CommandEnd}
+	if !reflect.DeepEqual(types, wantTypes) {
+		t.Fatalf("expected %v, got %v", wantTypes, types)
+	}
+	if last := events[len(events)-1]; *last.ExitStatus != 1 || last.Build != "41.1" || last.Error != "failed" {
+		t.Errorf("unexpected end of command %+v", last)
+	}
+	if runvm := events[6]; runvm.Name != "runvm" || runvm.Error != "failed" {
+		t.Errorf("expected runvm to be ended by Finish, got %+v", runvm)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	t0 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(secs int) time.Time { return t0.Add(time.Duration(secs) * time.Second) }
+	status := func(s int) *int { return &s }
+	events := []Event{
+		{Time: at(0), Run: "a", PID: 1, Type: CommandStart, Command: "fetch"},
+		{Time: at(60), Run: "a", PID: 1, Type: CommandEnd, Command: "fetch", Duration: 60, ExitStatus: status(0)},
+		{Time: at(100), Run: "b", PID: 2, Type: CommandStart, Command: "build"},
+		{Time: at(110), Run: "b", PID: 2, Type: PhaseStart, Command: "build", Name: "compose"},
+		{Time: at(400), Run: "b", PID: 2, Type: PhaseEnd, Command: "build", Name: "compose", Duration: 290},
+		{Time: at(400), Run: "b", PID: 3, Type: CommandStart, Command: "meta"},
+		{Time: at(405), Run: "b", PID: 3, Type: CommandEnd, Command: "meta", Duration: 5, ExitStatus: status(0)},
+		{Time: at(500), Run: "b", PID: 2, Type: CommandEnd, Command: "build", Duration: 400, Build: "41.1", ExitStatus: status(0)},
+		{Time: at(600), Run: "c", PID: 4, Type: CommandStart, Command: "osbuild"},
+		{Time: at(700), Run: "c", PID: 4, Type: ScriptEnd, Command: "osbuild", Name: "qemu", Duration: 90, ExitStatus: status(2)},
+		{Time: at(700), Run: "c", PID: 4, Type: CommandEnd, Command: "osbuild", Duration: 100, Build: "41.1", ExitStatus: status(2)},
+		{Time: at(800), Run: "d", PID: 5, Type: CommandStart, Command: "build"},
+		{Time: at(900), Run: "d", PID: 5, Type: PhaseEnd, Command: "build", Name: "compose", Duration: 50},
+		{Time: at(900), Run: "d", PID: 5, Type: CommandEnd, Command: "build", Duration: 100, Build: "41.2", ExitStatus: status(0)},
+	}
+	runs := Runs(events)
+	if len(runs) != 4 {
+		t.Fatalf("expected 4 runs, got %d", len(runs))
+	}
+	b := runs[1]
+	if b.Command != "build" || b.Duration != 400 || b.Build != "41.1" || len(b.Steps) != 2 {
+		t.Fatalf("unexpected run %+v", b)
+	}
+	if b.Steps[0].Key() != "phase build: compose" || !b.Steps[0].Start.Equal(at(110)) || b.Steps[1].Key() != "command meta" {
+		t.Errorf("unexpected steps %+v", b.Steps)
+	}
+	if !runs[2].Steps[0].Failed {
+		t.Error("expected the qemu script to have failed")
+	}
+
+	if last := LastRuns(runs, 2); len(last) != 2 || last[0].Run != "c" {
+		t.Errorf("unexpected last runs %+v", last)
+	}
+	builds := LastBuilds(runs, 0)
+	if len(builds) != 2 || builds[0].Build != "41.1" || builds[0].Duration != 500 || len(builds[0].Runs) != 2 {
+		t.Fatalf("unexpected builds %+v", builds)
+	}
+	if last := LastBuilds(runs, 1); len(last) != 1 || last[0].Build != "41.2" {
+		t.Errorf("unexpected last build %+v", last)
+	}
+
+	var keys []string
+	for _, st := range Aggregate(runs) {
+		keys = append(keys, st.Key)
+		if st.Key == "phase build: compose" && (st.Count != 2 || st.Total != 340 || st.Mean != 170 || st.Max != 290) {
+			t.Errorf("unexpected compose stats %+v", st)
+		}
+	}
+	want := "phase build: compose,script osbuild: qemu,command meta"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("expected steps %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,77 @@
+package eventlog
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// PhaseMarker prefixes the phase markers which cmdlib.sh's phase_start
+// and phase_end write to $COSA_EVENT_FD, e.g. "\x1ephase-start compose".
+const PhaseMarker = "\x1e"
+
+var errUnterminated = errors.New("phase wasn't ended")
+
+// Phases turns the phase markers of a command into events, computing
+// the durations of the phases.
+type Phases struct {
+	l       *Logger
+	command string
+	started map[string][]time.Time
+}
+
+// NewPhases returns a tracker of the phases of command.
+func (l *Logger) NewPhases(command string) *Phases {
+	return &Phases{l: l, command: command, started: make(map[string][]time.Time)}
+}
+
+// Handle logs the phase marker line and returns whether line was one.
+func (p *Phases) Handle(line string) bool {
+	marker, ok := strings.CutPrefix(line, PhaseMarker)
+	if !ok {
+		return false
+	}
+	typ, name, _ := strings.Cut(strings.TrimSpace(marker), " ")
+	now := time.Now()
+	switch Type(typ) {
+	case PhaseStart:
+		p.started[name] = append(p.started[name], now)
+		p.l.Emit(Event{Time: now, Type: PhaseStart, Command: p.command, Name: name})
+	case PhaseEnd:
+		e := Event{Time: now, Type: PhaseEnd, Command: p.command, Name: name}
+		if starts := p.started[name]; len(starts) > 0 {
+			e.Duration = now.Sub(starts[len(starts)-1]).Seconds()
+			p.started[name] = starts[:len(starts)-1]
+		}
+		p.l.Emit(e)
+	}
+	return true
+}
+
+// Read handles the phase markers read from r until EOF, ignoring other
+// lines.
+func (p *Phases) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.Handle(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Finish ends the phases which were left open, e.g. because the script
+// failed in them, with the error err.
+func (p *Phases) Finish(err error) {
+	now := time.Now()
+	if err == nil {
+		err = errUnterminated
+	}
+	for name, starts := range p.started {
+		for i := len(starts) - 1; i >= 0; i-- {
+			p.l.Emit(Event{Time: now, Type: PhaseEnd, Command: p.command, Name: name,
+				Duration: now.Sub(starts[i]).Seconds(), Error: err.Error()})
+		}
+		delete(p.started, name)
+	}
+}
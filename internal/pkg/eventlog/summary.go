@@ -0,0 +1,195 @@
+package eventlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ReadLog reads the events of the log at path. Lines which can't be
+// parsed, e.g. the last line of a log being written, are skipped.
+func ReadLog(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// StepTiming is a command, script or phase which ended during a run.
+type StepTiming struct {
+	// Type is "command", "script" or "phase".
+	Type     string    `json:"type"`
+	Command  string    `json:"command"`
+	Name     string    `json:"name,omitempty"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	Failed   bool      `json:"failed,omitempty"`
+}
+
+// Key identifies the step across runs.
+func (s StepTiming) Key() string {
+	if s.Type == "command" {
+		return "command " + s.Command
+	}
+	return s.Type + " " + s.Command + ": " + s.Name
+}
+
+// RunTiming is a top-level cosa invocation and the steps it ran.
+type RunTiming struct {
+	Run     string   `json:"run"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Build is the last build the run created.
+	Build      string       `json:"build,omitempty"`
+	Start      time.Time    `json:"start"`
+	Duration   float64      `json:"duration"`
+	ExitStatus *int         `json:"exit-status,omitempty"`
+	Steps      []StepTiming `json:"steps"`
+}
+
+// Runs groups the events by run, in the order the runs started. The
+// command of a run is the first command which started in it.
+func Runs(events []Event) []*RunTiming {
+	var runs []*RunTiming
+	byID := make(map[string]*RunTiming)
+	// The PID of the top-level command of each run.
+	topPID := make(map[string]int)
+	for _, e := range events {
+		run, ok := byID[e.Run]
+		if !ok {
+			run = &RunTiming{Run: e.Run, Start: e.Time}
+			byID[e.Run] = run
+			runs = append(runs, run)
+		}
+		switch e.Type {
+		case CommandStart:
+			if run.Command == "" {
+				run.Command = e.Command
+				run.Args = e.Args
+				run.Start = e.Time
+				topPID[e.Run] = e.PID
+			}
+		case CommandEnd, ScriptEnd, PhaseEnd:
+			if e.Build != "" {
+				run.Build = e.Build
+			}
+			if e.Type == CommandEnd && e.PID == topPID[e.Run] && e.Command == run.Command {
+				run.Duration = e.Duration
+				run.ExitStatus = e.ExitStatus
+				continue
+			}
+			step := StepTiming{
+				Type:     strings.TrimSuffix(string(e.Type), "-end"),
+				Command:  e.Command,
+				Name:     e.Name,
+				Start:    e.Time.Add(-time.Duration(e.Duration * float64(time.Second))),
+				Duration: e.Duration,
+				Failed:   e.Error != "" || (e.ExitStatus != nil && *e.ExitStatus != 0),
+			}
+			run.Steps = append(run.Steps, step)
+		}
+	}
+	for _, run := range runs {
+		sort.SliceStable(run.Steps, func(i, j int) bool {
+			return run.Steps[i].Start.Before(run.Steps[j].Start)
+		})
+	}
+	return runs
+}
+
+// LastRuns returns the last n runs, oldest first. n <= 0 returns all
+// of them.
+func LastRuns(runs []*RunTiming, n int) []*RunTiming {
+	if n > 0 && len(runs) > n {
+		return runs[len(runs)-n:]
+	}
+	return runs
+}
+
+// BuildTiming is a build and the runs which created or extended it.
+type BuildTiming struct {
+	Build    string       `json:"build"`
+	Duration float64      `json:"duration"`
+	Runs     []*RunTiming `json:"runs"`
+}
+
+// LastBuilds returns the last n builds which runs created or extended,
+// oldest first. n <= 0 returns all of them.
+func LastBuilds(runs []*RunTiming, n int) []*BuildTiming {
+	var builds []*BuildTiming
+	byID := make(map[string]*BuildTiming)
+	for _, run := range runs {
+		if run.Build == "" {
+			continue
+		}
+		b, ok := byID[run.Build]
+		if !ok {
+			b = &BuildTiming{Build: run.Build}
+			byID[run.Build] = b
+			builds = append(builds, b)
+		}
+		b.Runs = append(b.Runs, run)
+		b.Duration += run.Duration
+	}
+	if n > 0 && len(builds) > n {
+		return builds[len(builds)-n:]
+	}
+	return builds
+}
+
+// StepStats aggregates the timings of a step across runs.
+type StepStats struct {
+	Key   string  `json:"key"`
+	Count int     `json:"count"`
+	Total float64 `json:"total"`
+	Mean  float64 `json:"mean"`
+	Max   float64 `json:"max"`
+}
+
+// Aggregate returns the statistics of the steps of runs, the longest
+// total first.
+func Aggregate(runs []*RunTiming) []StepStats {
+	byKey := make(map[string]*StepStats)
+	var stats []*StepStats
+	for _, run := range runs {
+		for _, step := range run.Steps {
+			key := step.Key()
+			st, ok := byKey[key]
+			if !ok {
+				st = &StepStats{Key: key}
+				byKey[key] = st
+				stats = append(stats, st)
+			}
+			st.Count++
+			st.Total += step.Duration
+			if step.Duration > st.Max {
+				st.Max = step.Duration
+			}
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Total > stats[j].Total
+	})
+	var ret []StepStats
+	for _, st := range stats {
+		st.Mean = st.Total / float64(st.Count)
+		ret = append(ret, *st)
+	}
+	return ret
+}
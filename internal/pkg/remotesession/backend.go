@@ -0,0 +1,154 @@
+// Package remotesession implements the sessions of `cosa remote-session`:
+// a long running cosa container which commands are executed in and files
+// are synced to, through a pluggable backend. The backends are
+//
+//   - podman-remote: the container runs on $CONTAINER_HOST, through
+//     `podman --remote`
+//   - ssh: the container runs on a host reachable over SSH, through the
+//     container engine of that host
+//   - local: the container runs on this machine; mostly useful for testing
+package remotesession
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Backend runs the container engine of a remote session.
+type Backend interface {
+	// Check reports whether the backend can be used.
+	Check() error
+	// Command returns the command line which runs the container engine
+	// with args, allocating a terminal if tty is set.
+	Command(tty bool, args ...string) []string
+	// RsyncShell returns the rsync --rsh which runs a command in a
+	// container, given its ID as the rsync host.
+	RsyncShell() string
+}
+
+const (
+	// PodmanRemote runs sessions through `podman --remote`.
+	PodmanRemote = "podman-remote"
+	// SSH runs sessions on a host reachable over SSH.
+	SSH = "ssh"
+	// Local runs sessions on this machine.
+	Local = "local"
+
+	// DefaultEngine is the container engine of sessions.
+	DefaultEngine = "podman"
+)
+
+// backends maps the backend names to their constructors.
+var backends = map[string]func(s *Session) (Backend, error){
+	PodmanRemote: newPodmanRemoteBackend,
+	SSH:          newSSHBackend,
+	Local:        newLocalBackend,
+}
+
+// Backends returns the names of the available backends.
+func Backends() []string {
+	var ret []string
+	for name := range backends {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// engine returns the container engine of the session.
+func engine(s *Session) string {
+	if s.Engine == "" {
+		return DefaultEngine
+	}
+	return s.Engine
+}
+
+type podmanRemoteBackend struct {
+	engine string
+}
+
+func newPodmanRemoteBackend(s *Session) (Backend, error) {
+	return &podmanRemoteBackend{engine: engine(s)}, nil
+}
+
+func (b *podmanRemoteBackend) Check() error {
+	// We could also check `CONTAINER_SSHKEY` here but it's not strictly
+	// required (user could be using ssh-agent).
+	if os.Getenv("CONTAINER_HOST") == "" {
+		return fmt.Errorf("The env var CONTAINER_HOST must be defined and non-empty")
+	}
+	return nil
+}
+
+func (b *podmanRemoteBackend) Command(tty bool, args ...string) []string {
+	return append([]string{b.engine, "--remote"}, args...)
+}
+
+func (b *podmanRemoteBackend) RsyncShell() string {
+	return b.engine + " --remote exec -i"
+}
+
+type sshBackend struct {
+	engine string
+	host   string
+}
+
+func newSSHBackend(s *Session) (Backend, error) {
+	if s.Host == "" {
+		return nil, fmt.Errorf("the %s backend requires a host", SSH)
+	}
+	return &sshBackend{engine: engine(s), host: s.Host}, nil
+}
+
+func (b *sshBackend) Check() error {
+	return nil
+}
+
+func (b *sshBackend) Command(tty bool, args ...string) []string {
+	ret := []string{"ssh"}
+	if tty {
+		ret = append(ret, "-t")
+	}
+	// ssh runs the command through the shell of the host, so it has to
+	// be quoted.
+	quoted := []string{shellQuote(b.engine)}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return append(ret, b.host, "--", strings.Join(quoted, " "))
+}
+
+func (b *sshBackend) RsyncShell() string {
+	return fmt.Sprintf("ssh %s -- %s exec -i", b.host, b.engine)
+}
+
+type localBackend struct {
+	engine string
+}
+
+func newLocalBackend(s *Session) (Backend, error) {
+	return &localBackend{engine: engine(s)}, nil
+}
+
+func (b *localBackend) Check() error {
+	return nil
+}
+
+func (b *localBackend) Command(tty bool, args ...string) []string {
+	return append([]string{b.engine}, args...)
+}
+
+func (b *localBackend) RsyncShell() string {
+	return b.engine + " exec -i"
+}
+
+// shellQuote quotes s for POSIX shells, unless it's made of characters
+// which don't need quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+,./:@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,333 @@
+package remotesession
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SessionEnv is the environment variable which holds the ID of the
+	// current session.
+	SessionEnv = "COREOS_ASSEMBLER_REMOTE_SESSION"
+	// SessionDirEnv overrides the directory of the session files.
+	SessionDirEnv = "COREOS_ASSEMBLER_REMOTE_SESSION_DIR"
+)
+
+// Session is a remote session, as persisted in its session file.
+type Session struct {
+	ID         string     `json:"id"`
+	Backend    string     `json:"backend"`
+	Engine     string     `json:"engine,omitempty"`
+	Host       string     `json:"host,omitempty"`
+	Image      string     `json:"image,omitempty"`
+	Workdir    string     `json:"workdir,omitempty"`
+	Env        []string   `json:"env,omitempty"`
+	Expiration string     `json:"expiration,omitempty"`
+	Created    time.Time  `json:"created"`
+	ExpiresAt  *time.Time `json:"expires-at,omitempty"`
+	// NoPullBuilds disables pulling the builds back after exec of build
+	// commands.
+	NoPullBuilds bool `json:"no-pull-builds,omitempty"`
+
+	// legacy is set for sessions without a session file, which were
+	// created by older versions of cosa.
+	legacy bool
+}
+
+// CreateOptions are the parameters of a new session.
+type CreateOptions struct {
+	Backend string
+	Engine  string
+	Host    string
+	Image   string
+	// Expiration is the lifetime of the session, as accepted by
+	// sleep(1), or "infinity".
+	Expiration string
+	Workdir    string
+	Env        []string
+	// NoPullBuilds disables pulling the builds back after exec of build
+	// commands.
+	NoPullBuilds bool
+}
+
+// Dir returns the directory of the session files.
+func Dir() (string, error) {
+	if dir := os.Getenv(SessionDirEnv); dir != "" {
+		return dir, nil
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "coreos-assembler", "remote-sessions"), nil
+}
+
+// Path returns the path of the session file.
+func (s *Session) Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, s.ID+".json"), nil
+}
+
+// Load returns the session of id. Sessions without a session file are
+// assumed to be podman-remote sessions created by older versions of cosa.
+func Load(id string) (*Session, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("invalid remote session ID %q", id)
+	}
+	s := &Session{ID: id}
+	path, err := s.Path()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Session{ID: id, Backend: PodmanRemote, legacy: true}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if s.ID != id {
+		return nil, fmt.Errorf("%s is the session file of %s", path, s.ID)
+	}
+	return s, nil
+}
+
+// Save writes the session file.
+func (s *Session) Save() error {
+	path, err := s.Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Check reports whether the backend of the session can be used.
+func (s *Session) Check() error {
+	b, err := s.backend()
+	if err != nil {
+		return err
+	}
+	return b.Check()
+}
+
+// backend returns the backend of the session.
+func (s *Session) backend() (Backend, error) {
+	newBackend, ok := backends[s.Backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown remote session backend %q (known: %s)", s.Backend, strings.Join(Backends(), ", "))
+	}
+	return newBackend(s)
+}
+
+// Expired reports whether the lifetime of the session has passed, after
+// which its container has exited.
+func (s *Session) Expired() bool {
+	return s.ExpiresAt != nil && time.Now().After(*s.ExpiresAt)
+}
+
+// parseExpiration converts an argument of sleep(1) to a duration, or 0
+// for "infinity".
+func parseExpiration(expiration string) (time.Duration, error) {
+	if expiration == "" || expiration == "infinity" {
+		return 0, nil
+	}
+	unit := time.Second
+	num := expiration
+	switch expiration[len(expiration)-1] {
+	case 's':
+		num = expiration[:len(expiration)-1]
+	case 'm':
+		unit, num = time.Minute, expiration[:len(expiration)-1]
+	case 'h':
+		unit, num = time.Hour, expiration[:len(expiration)-1]
+	case 'd':
+		unit, num = 24*time.Hour, expiration[:len(expiration)-1]
+	}
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid expiration %q", expiration)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// Create starts the container of a new session and writes its session
+// file.
+func Create(opts CreateOptions) (*Session, error) {
+	s := &Session{
+		Backend:      opts.Backend,
+		Engine:       opts.Engine,
+		Host:         opts.Host,
+		Image:        opts.Image,
+		Workdir:      opts.Workdir,
+		Env:          opts.Env,
+		Expiration:   opts.Expiration,
+		Created:      time.Now().UTC(),
+		NoPullBuilds: opts.NoPullBuilds,
+	}
+	lifetime, err := parseExpiration(opts.Expiration)
+	if err != nil {
+		return nil, err
+	}
+	if lifetime > 0 {
+		expiresAt := s.Created.Add(lifetime)
+		s.ExpiresAt = &expiresAt
+	}
+	b, err := s.backend()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.Check(); err != nil {
+		return nil, err
+	}
+
+	args := []string{"run", "--rm", "-d",
+		"--pull=always", "--net=host", "--privileged", "--security-opt=label=disable",
+		"--volume", opts.Workdir,
+		"--workdir", opts.Workdir,
+		// Mount required volume for buildextend-secex, it will be empty on
+		// non-s390x builders.
+		// See: https://github.com/coreos/coreos-assembler/blob/main/docs/cosa/buildextend-secex.md
+		"--volume=secex-data:/data.secex:ro",
+		"--userns=keep-id:uid=1000,gid=1000",
+		"--device=/dev/kvm", "--device=/dev/fuse", "--tmpfs=/tmp",
+		"--init", "--entrypoint=/usr/bin/sleep"}
+	// Add in any env vars that were specified.
+	for _, env := range opts.Env {
+		args = append(args, "--env", env)
+	}
+	expiration := opts.Expiration
+	if expiration == "" {
+		expiration = "infinity"
+	}
+	args = append(args, opts.Image, expiration)
+
+	cmd := command(b.Command(false, args...))
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("creating remote session: %w", err)
+	}
+	lines := strings.Fields(string(out))
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("creating remote session: no container ID in output")
+	}
+	s.ID = lines[len(lines)-1]
+	if err := s.Save(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Exec runs cosa with args in the session.
+func (s *Session) Exec(tty bool, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	b, err := s.backend()
+	if err != nil {
+		return err
+	}
+	execArgs := []string{"exec", "-i"}
+	if tty {
+		execArgs = append(execArgs, "-t")
+	}
+	execArgs = append(execArgs, s.ID, "cosa")
+	cmd := command(b.Command(tty, append(execArgs, args...)...))
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// PS shows the status of the container of the session.
+func (s *Session) PS(stdout, stderr io.Writer) error {
+	b, err := s.backend()
+	if err != nil {
+		return err
+	}
+	cmd := command(b.Command(false, "ps", "-a", fmt.Sprintf("--filter=id=%s", s.ID)))
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// Destroy removes the container of the session, unless it has expired,
+// and its session file.
+func (s *Session) Destroy(stdout, stderr io.Writer) error {
+	b, err := s.backend()
+	if err != nil {
+		return err
+	}
+	if !s.Expired() {
+		cmd := command(b.Command(false, "rm", "-f", s.ID))
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+	}
+	if s.legacy {
+		return nil
+	}
+	path, err := s.Path()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Sync copies files to or from the session with rsync. Exactly one of
+// the args must have a leading ':', which marks the path in the session.
+func (s *Session) Sync(quiet bool, stdout, stderr io.Writer, args ...string) error {
+	b, err := s.backend()
+	if err != nil {
+		return err
+	}
+	args = append([]string(nil), args...)
+	found := 0
+	for index, arg := range args {
+		if strings.HasPrefix(arg, ":") {
+			args[index] = s.ID + arg
+			found++
+		}
+	}
+	if found != 1 {
+		return fmt.Errorf("Must pass in a single arg with `:` prepended")
+	}
+	rsyncargs := []string{"-ah", "--no-owner", "--no-group", "--mkpath", "--blocking-io",
+		"--compress", "--rsh", b.RsyncShell()}
+	if !quiet {
+		rsyncargs = append(rsyncargs, "-v")
+	}
+	cmd := exec.Command("rsync", append(rsyncargs, args...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+func command(argv []string) *exec.Cmd {
+	return exec.Command(argv[0], argv[1:]...)
+}
@@ -0,0 +1,139 @@
+package remotesession
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeEngine writes a container engine which logs its arguments to log
+// and prints a container ID when asked to run one.
+func fakeEngine(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, "log")
+	engine := filepath.Join(dir, "engine")
+	script := "#!/bin/sh\necho \"$@\" >> " + log + "\nif [ \"$1\" = run ]; then echo 0123abcd; fi\n"
+	if err := os.WriteFile(engine, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return engine, log
+}
+
+func TestLocalSession(t *testing.T) {
+	t.Setenv(SessionDirEnv, t.TempDir())
+	engine, log := fakeEngine(t)
+
+	s, err := Create(CreateOptions{
+		Backend:    Local,
+		Engine:     engine,
+		Image:      "quay.io/coreos-assembler/coreos-assembler:main",
+		Expiration: "2h",
+		Workdir:    "/srv",
+		Env:        []string{"FOO=bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != "0123abcd" || s.ExpiresAt == nil || s.ExpiresAt.Sub(s.Created) != 2*time.Hour {
+		t.Errorf("unexpected session: %+v", s)
+	}
+
+	loaded, err := Load(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Backend != Local || loaded.Engine != engine || !reflect.DeepEqual(loaded.Env, s.Env) || loaded.legacy {
+		t.Errorf("unexpected loaded session: %+v", loaded)
+	}
+
+	var out bytes.Buffer
+	if err := loaded.Exec(false, nil, &out, &out, "build", "--force"); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.PS(&out, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := loaded.Destroy(&out, &out); err != nil {
+		t.Fatal(err)
+	}
+	path, err := loaded.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("session file not removed: %v", err)
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("unexpected engine calls: %q", lines)
+	}
+	if !strings.HasPrefix(lines[0], "run ") || !strings.Contains(lines[0], "--env FOO=bar") ||
+		!strings.HasSuffix(lines[0], "quay.io/coreos-assembler/coreos-assembler:main 2h") {
+		t.Errorf("unexpected run: %s", lines[0])
+	}
+	for i, want := range []string{"exec -i 0123abcd cosa build --force", "ps -a --filter=id=0123abcd", "rm -f 0123abcd"} {
+		if lines[i+1] != want {
+			t.Errorf("expected %q, got %q", want, lines[i+1])
+		}
+	}
+}
+
+func TestLoadLegacySession(t *testing.T) {
+	t.Setenv(SessionDirEnv, t.TempDir())
+	s, err := Load("0123abcd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Backend != PodmanRemote || !s.legacy {
+		t.Errorf("unexpected session: %+v", s)
+	}
+	if _, err := Load("../etc/passwd"); err == nil {
+		t.Error("loaded a session with an invalid ID")
+	}
+}
+
+func TestSSHBackend(t *testing.T) {
+	b, err := (&Session{Backend: SSH, Host: "builder@example.com"}).backend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := b.Command(true, "exec", "-i", "-t", "0123abcd", "cosa", "shell", "--", "echo", "it's here")
+	want := []string{"ssh", "-t", "builder@example.com", "--", `podman exec -i -t 0123abcd cosa shell -- echo 'it'\''s here'`}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := b.RsyncShell(); got != "ssh builder@example.com -- podman exec -i" {
+		t.Errorf("unexpected rsync shell %q", got)
+	}
+	if _, err := (&Session{Backend: SSH}).backend(); err == nil {
+		t.Error("created an SSH backend without a host")
+	}
+}
+
+func TestParseExpiration(t *testing.T) {
+	for in, want := range map[string]time.Duration{
+		"infinity": 0,
+		"":         0,
+		"30":       30 * time.Second,
+		"1.5m":     90 * time.Second,
+		"2h":       2 * time.Hour,
+		"1d":       24 * time.Hour,
+	} {
+		got, err := parseExpiration(in)
+		if err != nil || got != want {
+			t.Errorf("%q: expected %v, got %v (%v)", in, want, got, err)
+		}
+	}
+	if _, err := parseExpiration("soon"); err == nil {
+		t.Error("parsed an invalid expiration")
+	}
+}
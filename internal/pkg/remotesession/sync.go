@@ -0,0 +1,400 @@
+package remotesession
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+// notExistCode is the exit code of ReadFile's script for missing files.
+const notExistCode = 100
+
+// buildCommands are the cosa commands which make or change builds, after
+// which exec pulls the builds back.
+var buildCommands = map[string]bool{
+	"build":          true,
+	"buildfetch":     true,
+	"compress":       true,
+	"decompress":     true,
+	"import":         true,
+	"meta-fold":      true,
+	"meta-migrate":   true,
+	"osbuild":        true,
+	"provenance":     true,
+	"sbom":           true,
+	"sign-artifacts": true,
+	"tag":            true,
+}
+
+// IsBuildCommand reports whether the cosa command makes or changes
+// builds.
+func IsBuildCommand(cmd string) bool {
+	return buildCommands[cmd] || strings.HasPrefix(cmd, "buildextend-")
+}
+
+// PullsBuilds reports whether exec should pull the builds back after
+// build commands. Sessions created by older versions of cosa don't.
+func (s *Session) PullsBuilds() bool {
+	return !s.legacy && !s.NoPullBuilds
+}
+
+// Run runs argv in the container of the session.
+func (s *Session) Run(stdin io.Reader, stdout, stderr io.Writer, argv ...string) error {
+	b, err := s.backend()
+	if err != nil {
+		return err
+	}
+	cmd := command(b.Command(false, append([]string{"exec", "-i", s.ID}, argv...)...))
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+// ReadFile returns the contents of a file in the session, relative to
+// its workdir. Missing files give an error wrapping os.ErrNotExist.
+func (s *Session) ReadFile(path string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	script := fmt.Sprintf(`if [ -e "$1" ]; then exec cat -- "$1"; else exit %d; fi`, notExistCode)
+	err := s.Run(nil, &stdout, &stderr, "sh", "-c", script, "sh", path)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == notExistCode {
+		return nil, fmt.Errorf("remote %s: %w", path, os.ErrNotExist)
+	} else if err != nil {
+		return nil, fmt.Errorf("reading remote %s: %w: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// RemoteBuilds returns the builds.json of the session, or
+// builds.ErrNoBuildsFound if it has none.
+func (s *Session) RemoteBuilds() (*builds.BuildsJSON, error) {
+	_, b, err := s.remoteBuilds()
+	return b, err
+}
+
+// remoteBuilds is RemoteBuilds, also returning the builds.json as read.
+func (s *Session) remoteBuilds() ([]byte, *builds.BuildsJSON, error) {
+	data, err := s.ReadFile(filepath.Join("builds", builds.CosaBuildsJSON))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, builds.ErrNoBuildsFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+	b, err := builds.ParseBuilds(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, b, nil
+}
+
+// localBuilds returns the builds.json in dir, or nil if it has none.
+func localBuilds(dir string) (*builds.BuildsJSON, error) {
+	if _, err := os.Stat(filepath.Join(dir, builds.CosaBuildsJSON)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return builds.GetBuilds(dir)
+}
+
+// PullBuilds copies the builds of the session which the builds directory
+// dir lacks, and the latest build of each architecture which may have
+// been changed in place, then merges its builds.json into the local one,
+// keeping the builds only dir has. It returns the builds it copied.
+func (s *Session) PullBuilds(dir string, quiet bool, stdout, stderr io.Writer) ([]builds.BuildRef, error) {
+	remoteData, remote, err := s.remoteBuilds()
+	if err != nil {
+		return nil, err
+	}
+	local, err := localBuilds(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pull []builds.BuildRef
+	seen := make(map[builds.BuildRef]bool)
+	add := func(ref builds.BuildRef) {
+		if !seen[ref] {
+			seen[ref] = true
+			pull = append(pull, ref)
+		}
+	}
+	for _, arch := range remote.Arches() {
+		if id, ok := remote.Latest(arch); ok {
+			add(builds.BuildRef{ID: id, Arch: arch})
+		}
+	}
+	for _, ref := range remote.Missing(local) {
+		add(ref)
+	}
+	// Builds which builds.json lists but which weren't pulled completely.
+	for _, ref := range remote.Missing(nil) {
+		if _, err := os.Stat(filepath.Join(dir, ref.ID, ref.Arch, builds.CosaMetaJSON)); os.IsNotExist(err) {
+			add(ref)
+		}
+	}
+
+	for _, ref := range pull {
+		src := fmt.Sprintf(":builds/%s/%s/", ref.ID, ref.Arch)
+		dst := filepath.Join(dir, ref.ID, ref.Arch) + "/"
+		if err := s.Sync(quiet, stdout, stderr, src, dst); err != nil {
+			return nil, fmt.Errorf("pulling build %s/%s: %w", ref.ID, ref.Arch, err)
+		}
+	}
+	// Merge the builds.json read before pulling last, so that it never
+	// lists builds which weren't pulled.
+	if err := builds.MergeBuildsJSON(dir, remoteData); err != nil {
+		return nil, err
+	}
+	return pull, nil
+}
+
+// BuildsSnapshot is the state of the builds of a session before a
+// command runs, from which PullChangedBuilds finds the builds the
+// command added or changed.
+type BuildsSnapshot struct {
+	listed map[builds.BuildRef]bool
+	// metas are the checksums of the meta.json of the builds.
+	metas map[builds.BuildRef]string
+}
+
+// SnapshotBuilds reads the builds.json of the session and the checksums
+// of the meta.json of its builds. A session without builds gives an
+// empty snapshot.
+func (s *Session) SnapshotBuilds() (*BuildsSnapshot, error) {
+	snap := &BuildsSnapshot{listed: make(map[builds.BuildRef]bool)}
+	_, remote, err := s.remoteBuilds()
+	if err == builds.ErrNoBuildsFound {
+		return snap, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, ref := range remote.Missing(nil) {
+		snap.listed[ref] = true
+	}
+	if snap.metas, err = s.metaChecksums(); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// metaChecksums returns the checksums of the meta.json of the builds of
+// the session, all read by a single command rather than one each.
+func (s *Session) metaChecksums() (map[builds.BuildRef]string, error) {
+	var stdout, stderr bytes.Buffer
+	script := `cd builds 2>/dev/null || exit 0
+for f in */*/meta.json; do
+    if [ -f "$f" ]; then sha256sum -- "$f" || exit 1; fi
+done`
+	if err := s.Run(nil, &stdout, &stderr, "sh", "-c", script); err != nil {
+		return nil, fmt.Errorf("reading remote meta.json checksums: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	ret := make(map[builds.BuildRef]string)
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		parts := strings.Split(fields[1], "/")
+		if len(parts) != 3 {
+			continue
+		}
+		ret[builds.BuildRef{ID: parts[0], Arch: parts[1]}] = fields[0]
+	}
+	return ret, scanner.Err()
+}
+
+// PullChangedBuilds copies the builds of the session which were added,
+// or whose meta.json changed, since before was taken, then merges only
+// those builds into the builds.json of the builds directory dir. Unlike
+// PullBuilds, builds which dir lacks but which didn't change, e.g. ones
+// pruned locally, aren't pulled. It returns the builds it copied.
+func (s *Session) PullChangedBuilds(dir string, before *BuildsSnapshot, quiet bool, stdout, stderr io.Writer) ([]builds.BuildRef, error) {
+	remoteData, remote, err := s.remoteBuilds()
+	if err != nil {
+		return nil, err
+	}
+	metas, err := s.metaChecksums()
+	if err != nil {
+		return nil, err
+	}
+	local, err := localBuilds(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var pull []builds.BuildRef
+	for _, ref := range remote.Missing(nil) {
+		if !before.listed[ref] || metas[ref] != before.metas[ref] {
+			pull = append(pull, ref)
+		}
+	}
+	for _, ref := range pull {
+		src := fmt.Sprintf(":builds/%s/%s/", ref.ID, ref.Arch)
+		dst := filepath.Join(dir, ref.ID, ref.Arch) + "/"
+		if err := s.Sync(quiet, stdout, stderr, src, dst); err != nil {
+			return nil, fmt.Errorf("pulling build %s/%s: %w", ref.ID, ref.Arch, err)
+		}
+	}
+
+	// Tags may only name the builds the local builds.json will list.
+	ids := make(map[string]bool)
+	for _, ref := range pull {
+		ids[ref.ID] = true
+	}
+	if local != nil {
+		for _, b := range local.Builds {
+			ids[b.ID] = true
+		}
+	}
+	merged, err := selectBuilds(remoteData, pull, ids)
+	if err != nil {
+		return nil, err
+	}
+	if err := builds.MergeBuildsJSON(dir, merged); err != nil {
+		return nil, err
+	}
+	return pull, nil
+}
+
+// selectBuilds returns the builds.json data with only the builds of
+// refs, and only the tags of the builds of ids. Fields this package
+// doesn't know about are kept.
+func selectBuilds(data []byte, refs []builds.BuildRef, ids map[string]bool) ([]byte, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing remote builds.json: %w", err)
+	}
+	arches := make(map[string][]string)
+	for _, ref := range refs {
+		arches[ref.ID] = append(arches[ref.ID], ref.Arch)
+	}
+
+	var entries []map[string]json.RawMessage
+	if raw, ok := doc["builds"]; ok {
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, fmt.Errorf("parsing builds of remote builds.json: %w", err)
+		}
+	}
+	selected := []map[string]json.RawMessage{}
+	for _, e := range entries {
+		var id string
+		if err := json.Unmarshal(e["id"], &id); err != nil {
+			return nil, fmt.Errorf("parsing builds of remote builds.json: %w", err)
+		}
+		if a, ok := arches[id]; ok {
+			raw, err := json.Marshal(a)
+			if err != nil {
+				return nil, err
+			}
+			e["arches"] = raw
+			selected = append(selected, e)
+		}
+	}
+	var err error
+	if doc["builds"], err = json.Marshal(selected); err != nil {
+		return nil, err
+	}
+
+	if raw, ok := doc["tags"]; ok {
+		var tags []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &tags); err != nil {
+			return nil, fmt.Errorf("parsing tags of remote builds.json: %w", err)
+		}
+		selectedTags := []map[string]json.RawMessage{}
+		for _, tag := range tags {
+			var target string
+			if err := json.Unmarshal(tag["target"], &target); err != nil {
+				return nil, fmt.Errorf("parsing tags of remote builds.json: %w", err)
+			}
+			if ids[target] {
+				selectedTags = append(selectedTags, tag)
+			}
+		}
+		if doc["tags"], err = json.Marshal(selectedTags); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// PushConfig copies the changes of the config directory dir to
+// src/config in the session, deleting the files which were removed.
+func (s *Session) PushConfig(dir string, quiet bool, stdout, stderr io.Writer) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	return s.Sync(quiet, stdout, stderr, "--delete", strings.TrimSuffix(dir, "/")+"/", ":src/config/")
+}
+
+// ArchStatus compares the builds of an architecture in a local builds
+// directory and in the session.
+type ArchStatus struct {
+	Arch   string `json:"arch"`
+	Local  string `json:"local,omitempty"`
+	Remote string `json:"remote,omitempty"`
+	// RemoteOnly are the builds which weren't pulled, newest first.
+	RemoteOnly []string `json:"remote-only,omitempty"`
+	// LocalOnly are the builds which the session doesn't have.
+	LocalOnly []string `json:"local-only,omitempty"`
+}
+
+// Status compares the builds of the builds directory dir to the ones of
+// the session.
+func (s *Session) Status(dir string) ([]ArchStatus, error) {
+	remote, err := s.RemoteBuilds()
+	if err == builds.ErrNoBuildsFound {
+		remote = &builds.BuildsJSON{}
+	} else if err != nil {
+		return nil, err
+	}
+	local, err := localBuilds(dir)
+	if err != nil {
+		return nil, err
+	}
+	if local == nil {
+		local = &builds.BuildsJSON{}
+	}
+
+	statuses := make(map[string]*ArchStatus)
+	var arches []string
+	get := func(arch string) *ArchStatus {
+		if st, ok := statuses[arch]; ok {
+			return st
+		}
+		st := &ArchStatus{Arch: arch}
+		st.Local, _ = local.Latest(arch)
+		st.Remote, _ = remote.Latest(arch)
+		statuses[arch] = st
+		arches = append(arches, arch)
+		return st
+	}
+	for _, arch := range append(remote.Arches(), local.Arches()...) {
+		get(arch)
+	}
+	for _, ref := range remote.Missing(local) {
+		st := get(ref.Arch)
+		st.RemoteOnly = append(st.RemoteOnly, ref.ID)
+	}
+	for _, ref := range local.Missing(remote) {
+		st := get(ref.Arch)
+		st.LocalOnly = append(st.LocalOnly, ref.ID)
+	}
+
+	sort.Strings(arches)
+	var ret []ArchStatus
+	for _, arch := range arches {
+		ret = append(ret, *statuses[arch])
+	}
+	return ret, nil
+}
@@ -0,0 +1,205 @@
+package remotesession
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/coreos-assembler/pkg/builds"
+)
+
+// loopbackSession returns a local session whose engine runs commands in
+// a directory standing in for the workdir of the container.
+func loopbackSession(t *testing.T) (*Session, string) {
+	dir := t.TempDir()
+	remote := filepath.Join(dir, "remote")
+	engine := filepath.Join(dir, "engine")
+	script := "#!/bin/sh\n[ \"$1\" = exec ] || exit 1\nshift 3\ncd " + remote + " && exec \"$@\"\n"
+	if err := os.MkdirAll(remote, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(engine, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &Session{ID: "0123abcd", Backend: Local, Engine: engine}, remote
+}
+
+func writeBuildsJSON(t *testing.T, dir, content string, refs ...builds.BuildRef) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, builds.CosaBuildsJSON), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range refs {
+		buildDir := filepath.Join(dir, ref.ID, ref.Arch)
+		if err := os.MkdirAll(buildDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(buildDir, builds.CosaMetaJSON), []byte(`{"buildid": "`+ref.ID+`"}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIsBuildCommand(t *testing.T) {
+	for cmd, want := range map[string]bool{"build": true, "buildextend-aws": true, "osbuild": true, "kola": false, "shell": false} {
+		if got := IsBuildCommand(cmd); got != want {
+			t.Errorf("%s: expected %v, got %v", cmd, want, got)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s, remote := loopbackSession(t)
+	local := filepath.Join(t.TempDir(), "builds")
+
+	if _, err := s.ReadFile("builds/builds.json"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a missing file, got %v", err)
+	}
+	if _, err := s.RemoteBuilds(); err != builds.ErrNoBuildsFound {
+		t.Fatalf("expected no builds, got %v", err)
+	}
+
+	writeBuildsJSON(t, filepath.Join(remote, "builds"), `{"builds": [
+		{"id": "41.3", "arches": ["x86_64", "aarch64"]},
+		{"id": "41.2", "arches": ["x86_64"]}]}`)
+	writeBuildsJSON(t, local, `{"builds": [
+		{"id": "41.2", "arches": ["x86_64"]},
+		{"id": "41.1", "arches": ["x86_64"]}]}`)
+
+	statuses, err := s.Status(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ArchStatus{
+		{Arch: "aarch64", Remote: "41.3", RemoteOnly: []string{"41.3"}},
+		{Arch: "x86_64", Local: "41.2", Remote: "41.3", RemoteOnly: []string{"41.3"}, LocalOnly: []string{"41.1"}},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("expected %+v, got %+v", want, statuses)
+	}
+}
+
+func TestPullBuilds(t *testing.T) {
+	if _, err := exec.LookPath("rsync"); err != nil {
+		t.Skip("rsync isn't installed")
+	}
+	s, remote := loopbackSession(t)
+	local := filepath.Join(t.TempDir(), "builds")
+
+	writeBuildsJSON(t, filepath.Join(remote, "builds"), `{"builds": [
+		{"id": "41.3", "arches": ["x86_64"]},
+		{"id": "41.2", "arches": ["x86_64"]},
+		{"id": "41.1", "arches": ["x86_64"]}]}`,
+		builds.BuildRef{ID: "41.3", Arch: "x86_64"}, builds.BuildRef{ID: "41.2", Arch: "x86_64"}, builds.BuildRef{ID: "41.1", Arch: "x86_64"})
+	writeBuildsJSON(t, local, `{"builds": [
+		{"id": "41.1.local", "arches": ["x86_64"]},
+		{"id": "41.1", "arches": ["x86_64"]}]}`,
+		builds.BuildRef{ID: "41.1.local", Arch: "x86_64"}, builds.BuildRef{ID: "41.1", Arch: "x86_64"})
+	// The merged builds.json is ordered by build timestamp.
+	for dir, ts := range map[string]string{
+		filepath.Join(remote, "builds", "41.3"): "2026-01-03T00:00:00Z",
+		filepath.Join(remote, "builds", "41.2"): "2026-01-02T00:00:00Z",
+		filepath.Join(local, "41.1.local"):      "2026-01-01T12:00:00Z",
+	} {
+		meta := `{"buildid": "` + filepath.Base(dir) + `", "coreos-assembler.build-timestamp": "` + ts + `"}`
+		if err := os.WriteFile(filepath.Join(dir, "x86_64", builds.CosaMetaJSON), []byte(meta), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pulled, err := s.PullBuilds(local, true, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []builds.BuildRef{{ID: "41.3", Arch: "x86_64"}, {ID: "41.2", Arch: "x86_64"}}
+	if !reflect.DeepEqual(pulled, want) {
+		t.Errorf("expected %v, got %v", want, pulled)
+	}
+	b, err := builds.GetBuilds(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest, _ := b.Latest("x86_64"); latest != "41.3" {
+		t.Errorf("builds.json wasn't pulled")
+	}
+	wantBuilds := []builds.BuildRef{{ID: "41.3", Arch: "x86_64"}, {ID: "41.2", Arch: "x86_64"}, {ID: "41.1.local", Arch: "x86_64"}, {ID: "41.1", Arch: "x86_64"}}
+	if got := b.Missing(nil); !reflect.DeepEqual(got, wantBuilds) {
+		t.Errorf("expected builds %v, got %v", wantBuilds, got)
+	}
+	if _, err := os.Stat(filepath.Join(local, "41.2", "x86_64", builds.CosaMetaJSON)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPullChangedBuilds(t *testing.T) {
+	if _, err := exec.LookPath("rsync"); err != nil {
+		t.Skip("rsync isn't installed")
+	}
+	s, remote := loopbackSession(t)
+	local := filepath.Join(t.TempDir(), "builds")
+
+	writeBuildsJSON(t, filepath.Join(remote, "builds"), `{"builds": [
+		{"id": "41.2", "arches": ["x86_64"]},
+		{"id": "41.1", "arches": ["x86_64"]}]}`,
+		builds.BuildRef{ID: "41.2", Arch: "x86_64"}, builds.BuildRef{ID: "41.1", Arch: "x86_64"})
+	// 41.2 was pruned locally.
+	writeBuildsJSON(t, local, `{"builds": [
+		{"id": "41.1", "arches": ["x86_64"]}]}`,
+		builds.BuildRef{ID: "41.1", Arch: "x86_64"})
+
+	before, err := s.SnapshotBuilds()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The command adds 41.3 and changes 41.1 in place.
+	writeBuildsJSON(t, filepath.Join(remote, "builds"), `{"builds": [
+		{"id": "41.3", "arches": ["x86_64"]},
+		{"id": "41.2", "arches": ["x86_64"]},
+		{"id": "41.1", "arches": ["x86_64"]}],
+		"tags": [{"name": "new", "created": "2026-01-03T00:00:00Z", "target": "41.3"},
+		{"name": "pruned", "created": "2026-01-02T00:00:00Z", "target": "41.2"}]}`,
+		builds.BuildRef{ID: "41.3", Arch: "x86_64"})
+	meta := `{"buildid": "41.1", "coreos-assembler.build-timestamp": "2026-01-01T00:00:00Z"}`
+	if err := os.WriteFile(filepath.Join(remote, "builds", "41.1", "x86_64", builds.CosaMetaJSON), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	newMeta := `{"buildid": "41.3", "coreos-assembler.build-timestamp": "2026-01-03T00:00:00Z"}`
+	if err := os.WriteFile(filepath.Join(remote, "builds", "41.3", "x86_64", builds.CosaMetaJSON), []byte(newMeta), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pulled, err := s.PullChangedBuilds(local, before, true, io.Discard, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []builds.BuildRef{{ID: "41.3", Arch: "x86_64"}, {ID: "41.1", Arch: "x86_64"}}
+	if !reflect.DeepEqual(pulled, want) {
+		t.Errorf("expected %v, got %v", want, pulled)
+	}
+	b, err := builds.GetBuilds(local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Missing(nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected builds %v, got %v", want, got)
+	}
+	if len(b.Tags) != 1 || b.Tags[0].Name != "new" {
+		t.Errorf("expected only the tag of 41.3, got %+v", b.Tags)
+	}
+	if _, err := os.Stat(filepath.Join(local, "41.2")); !os.IsNotExist(err) {
+		t.Errorf("pruned build was pulled: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(local, "41.1", "x86_64", builds.CosaMetaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != meta {
+		t.Errorf("changed build wasn't pulled: %s", data)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/coreos/coreos-assembler/mantle/kola"
+	"github.com/coreos/coreos-assembler/mantle/kola/history"
+	"github.com/coreos/coreos-assembler/mantle/util"
+)
+
+var (
+	cmdHistory = &cobra.Command{
+		Use:   "history [glob pattern...]",
+		Short: "Report flakiness and duration trends of tests across runs",
+		Long: `Report per test statistics from the results recorded by previous
+kola runs: how often each test failed or flaked (failed and then passed
+when re-run), how long it takes, and the build from which it has been
+failing if it is currently failing.
+
+Results are recorded after each 'kola run' and 'kola run-upgrade' in
+the history file, by default cache/kola-history.jsonl in the
+coreos-assembler working directory.
+`,
+		RunE: runHistory,
+
+		SilenceUsage: true,
+	}
+
+	historyFile     string
+	historyJSON     bool
+	historySince    time.Duration
+	historySort     string
+	historyAllArchs bool
+)
+
+func init() {
+	root.PersistentFlags().StringVar(&historyFile, "history-file", "", "File recording test results across runs (default \"cache/kola-history.jsonl\" in the working directory)")
+
+	root.AddCommand(cmdHistory)
+	cmdHistory.Flags().BoolVar(&historyJSON, "json", false, "format output in JSON")
+	cmdHistory.Flags().DurationVar(&historySince, "since", 0, "only consider runs in the given past duration (e.g. 720h)")
+	cmdHistory.Flags().StringVar(&historySort, "sort", "name", "sort by: name, flakes, failures, duration")
+	cmdHistory.Flags().BoolVar(&historyAllArchs, "all-arches", false, "consider runs on all architectures instead of only --arch")
+}
+
+// historyPath returns the history file to use, or "" if there is none.
+func historyPath() (string, error) {
+	if historyFile != "" {
+		return historyFile, nil
+	}
+	workdir := kola.Options.CosaWorkdir
+	if workdir == "" {
+		isroot, err := util.IsCosaRoot(".")
+		if err != nil {
+			return "", err
+		}
+		if isroot {
+			workdir = "."
+		}
+	}
+	if workdir == "" || workdir == "none" {
+		return "", nil
+	}
+	return filepath.Join(workdir, "cache", "kola-history.jsonl"), nil
+}
+
+// recordHistory appends the results of the run in outputDir to the
+// history file. Failing to do so must not fail the run, so errors are
+// only logged.
+func recordHistory(outputDir string) {
+	path, err := historyPath()
+	if err != nil {
+		plog.Warningf("Not recording test history: %v", err)
+		return
+	}
+	if path == "" {
+		return
+	}
+
+	var buildID string
+	if kola.CosaBuild != nil {
+		buildID = kola.CosaBuild.Meta.BuildID
+	}
+	records, err := history.RecordsFromRun(outputDir, buildID, kola.Options.CosaBuildArch, kolaPlatform, time.Now().UTC())
+	if err != nil {
+		plog.Warningf("Not recording test history: %v", err)
+		return
+	}
+	if err := history.Append(path, records); err != nil {
+		plog.Warningf("Failed to record test history in %s: %v", path, err)
+	}
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return fmt.Errorf("no working directory found; use --history-file or --workdir")
+	}
+	records, err := history.Load(path)
+	if err != nil {
+		return err
+	}
+
+	filter := history.Filter{
+		Patterns: args,
+		Platform: kolaPlatform,
+	}
+	if !historyAllArchs {
+		filter.Arch = kola.Options.CosaBuildArch
+	}
+	if historySince > 0 {
+		filter.Since = time.Now().Add(-historySince)
+	}
+	var selected []history.Record
+	for _, r := range records {
+		match, err := filter.Match(r)
+		if err != nil {
+			return err
+		}
+		if match {
+			selected = append(selected, r)
+		}
+	}
+
+	stats := history.Summarize(selected)
+	switch historySort {
+	case "name":
+	case "flakes":
+		sort.SliceStable(stats, func(i, j int) bool {
+			return stats[i].FlakeRate > stats[j].FlakeRate
+		})
+	case "failures":
+		sort.SliceStable(stats, func(i, j int) bool {
+			return stats[i].FailureRate > stats[j].FailureRate
+		})
+	case "duration":
+		sort.SliceStable(stats, func(i, j int) bool {
+			return stats[i].MeanDuration > stats[j].MeanDuration
+		})
+	default:
+		return fmt.Errorf("unknown sort key %q", historySort)
+	}
+
+	if historyJSON {
+		out, err := json.MarshalIndent(stats, "", "\t")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Test Name\tRuns\tFail%\tFlake%\tMean\tRecent\tLast\tFailing Since")
+	fmt.Fprintln(w, "\t")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%v\t%d\t%.1f\t%.1f\t%v\t%v\t%v\t%v\n", s.Test, s.Runs,
+			100*s.FailureRate, 100*s.FlakeRate,
+			s.MeanDuration.Round(time.Second), s.RecentDuration.Round(time.Second),
+			s.LastResult, s.FirstFailingBuild)
+	}
+	return w.Flush()
+}
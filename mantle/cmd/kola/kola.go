@@ -213,7 +213,14 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 func runRerun(cmd *cobra.Command, args []string) error {
 	var patterns []string
-	data, err := reporters.DeserialiseReport(filepath.Join(kola.Options.CosaWorkdir, "tmp/kola/reports/report.json"))
+	reportDir := filepath.Join(kola.Options.CosaWorkdir, "tmp/kola/reports")
+	data, err := reporters.DeserialiseReport(filepath.Join(reportDir, "report.json"))
+	if os.IsNotExist(err) {
+		// The previous run did not finish; recover what we can from
+		// the events streamed while it was running.
+		plog.Noticef("No report.json found, using the event stream of the interrupted run")
+		data, err = reporters.DeserialiseEvents(filepath.Join(reportDir, "events.jsonl"))
+	}
 	if err != nil {
 		return err
 	}
@@ -280,6 +287,7 @@ func kolaRunPatterns(patterns []string, rerun bool) error {
 	if err := writeProps(); err != nil {
 		return err
 	}
+	recordHistory(outputDir)
 
 	return runErr
 }
@@ -719,6 +727,7 @@ func runRunUpgrade(cmd *cobra.Command, args []string) error {
 	if err := writeProps(); err != nil {
 		return err
 	}
+	recordHistory(outputDir)
 
 	return runErr
 }
@@ -55,7 +55,9 @@ func init() {
 	root.PersistentFlags().StringVarP(&kolaPlatform, "platform", "p", "", "VM platform: "+strings.Join(kolaPlatforms, ", "))
 	root.PersistentFlags().StringVarP(&kola.Options.Distribution, "distro", "b", "", "Distribution: "+strings.Join(kolaDistros, ", "))
 	root.PersistentFlags().StringVarP(&kolaParallelArg, "parallel", "j", "1", "number of tests to run in parallel, or \"auto\" to match CPU count")
-	sv(&kola.TAPFile, "tapfile", "", "file to write TAP results to")
+	sv(&kola.TAPFile, "tapfile", "", "file to copy the TAP report (see --report-format) to")
+	ssv(&kola.ReportFormats, "report-format", []string{"json"}, "Report formats to write to the reports/ output dir: json, junit, tap. Can be specified multiple times.")
+	sv(&kola.EventStream, "event-stream", "", "Also stream test events as JSON lines to this file or to \"fd:N\"")
 	root.PersistentFlags().BoolVarP(&kola.Options.UseWarnExitCode77, "on-warn-failure-exit-77", "", false, "Exit with code 77 if 'warn: true' tests fail")
 	sv(&kola.Options.BaseName, "basename", "kola", "Cluster name prefix")
 	ss("debug-systemd-unit", []string{}, "full-unit-name.service to enable SYSTEMD_LOG_LEVEL=debug on. Can be specified multiple times.")
@@ -162,6 +164,8 @@ func init() {
 	sv(&kola.QEMUOptions.SecureExecutionHostKey, "qemu-secex-hostkey", "", "Path to Secure Execution HKD certificate")
 	// s390x CEX-specific options
 	bv(&kola.QEMUOptions.Cex, "qemu-cex", false, "Attach CEX device to guest")
+	bv(&kola.QEMUOptions.PrivateNetwork, "qemu-private-network", false, "Connect the machines of each test to a private network")
+	bv(&kola.QEMUOptions.SnapshotReuse, "qemu-snapshot-reuse", false, "Boot machines of tests which allow it from a disk snapshot of an identical machine")
 }
 
 // Sync up the command line options if there is dependency
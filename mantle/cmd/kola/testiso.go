@@ -32,7 +32,6 @@ import (
 	"time"
 
 	"github.com/coreos/coreos-assembler/mantle/harness"
-	"github.com/coreos/coreos-assembler/mantle/harness/reporters"
 	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
 	"github.com/coreos/coreos-assembler/mantle/platform/conf"
 	"github.com/coreos/coreos-assembler/mantle/util"
@@ -549,12 +548,19 @@ func runTestIso(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	reporter := reporters.NewJSONReporter("report.json", "testiso", "")
+	reporter, err := kola.NewReporters("testiso", "")
+	if err != nil {
+		return err
+	}
 	defer func() {
 		if reportErr := reporter.Output(reportDir); reportErr != nil && err != nil {
 			err = reportErr
 		}
+		kola.CloseEventStream()
 	}()
+	if err := reporter.Start(reportDir); err != nil {
+		return err
+	}
 
 	baseInst := platform.Install{
 		CosaBuild:  kola.CosaBuild,
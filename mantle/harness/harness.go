@@ -358,6 +358,7 @@ func (c *H) log(s string) {
 	if err := c.logger.Output(3, s); err != nil {
 		c.logger.Fatal(err)
 	}
+	c.reporters.TestLog(c.name, s)
 }
 
 // Log formats its arguments using default formatting, analogous to Println,
@@ -504,6 +505,7 @@ func (t *H) Parallel() {
 	<-t.parent.barrier // Wait for the parent test to complete.
 	t.suite.waitParallel()
 	t.start = time.Now()
+	t.reporters.TestParallel(t.name)
 }
 
 func tRunner(t *H, fn func(t *H)) {
@@ -567,6 +569,9 @@ func tRunner(t *H, fn func(t *H)) {
 	}()
 
 	t.start = time.Now()
+	if t.parent != nil {
+		t.reporters.TestStarted(t.name, t.level > 1)
+	}
 	fn(t)
 	t.finished = true
 
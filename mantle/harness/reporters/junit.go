@@ -0,0 +1,195 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporters
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
+)
+
+// junitReporter writes results in the JUnit XML format understood by
+// Jenkins and most CI dashboards. Each top-level test becomes a
+// <testsuite> holding a <testcase> for itself and one for each of its
+// subtests.
+type junitReporter struct {
+	tests    []*reportedTest
+	result   testresult.TestResult
+	filename string
+
+	// Context variables
+	platform string
+	version  string
+
+	mutex sync.Mutex
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Skipped    int             `xml:"skipped,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name       string          `xml:"name,attr"`
+	Classname  string          `xml:"classname,attr"`
+	Time       string          `xml:"time,attr"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Failure    *junitMessage   `xml:"failure,omitempty"`
+	Skipped    *junitMessage   `xml:"skipped,omitempty"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Content string `xml:",chardata"`
+}
+
+func NewJUnitReporter(filename, platform, version string) *junitReporter {
+	return &junitReporter{
+		platform: platform,
+		version:  version,
+		filename: filename,
+		mutex:    sync.Mutex{},
+	}
+}
+
+func (r *junitReporter) ReportTest(name string, subtests []string, result testresult.TestResult, duration time.Duration, b []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.tests = append(r.tests, &reportedTest{
+		Name:     name,
+		Result:   result,
+		Duration: duration,
+		Output:   string(b),
+	})
+}
+
+func (r *junitReporter) Output(path string) error {
+	f, err := os.Create(filepath.Join(path, r.filename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.write(f)
+}
+
+func (r *junitReporter) SetResult(result testresult.TestResult) {
+	r.result = result
+}
+
+func (r *junitReporter) write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	root := junitTestSuites{Name: r.platform}
+	var total time.Duration
+	for _, t := range buildTestTree(r.tests) {
+		suite := junitTestSuite{
+			Name: t.Name,
+			Time: junitDuration(t.Duration),
+		}
+		if r.platform != "" {
+			suite.Properties = append(suite.Properties, junitProperty{Name: "platform", Value: r.platform})
+		}
+		if r.version != "" {
+			suite.Properties = append(suite.Properties, junitProperty{Name: "version", Value: r.version})
+		}
+		r.addCases(&suite, t, r.platform)
+
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Skipped += suite.Skipped
+		root.Suites = append(root.Suites, suite)
+		total += t.Duration
+	}
+	root.Time = junitDuration(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// addCases appends t and, depth first, all of its subtests to suite.
+func (r *junitReporter) addCases(suite *junitTestSuite, t *reportedTest, classname string) {
+	tc := junitTestCase{
+		Name:      t.Name,
+		Classname: classname,
+		Time:      junitDuration(t.Duration),
+	}
+	// The output of a failed test is the content of its failure
+	// element, and isn't repeated in system-out.
+	switch t.Result {
+	case testresult.Fail:
+		tc.Failure = &junitMessage{Message: "Test failed", Content: t.Output}
+		suite.Failures++
+	case testresult.Skip:
+		tc.Skipped = &junitMessage{Message: "Test skipped"}
+		suite.Skipped++
+	case testresult.Warn:
+		// JUnit has no notion of a non-fatal failure; report the
+		// test as passed but keep the original result around.
+		tc.Properties = []junitProperty{{Name: "result", Value: string(testresult.Warn)}}
+	}
+	if tc.Failure == nil {
+		tc.SystemOut = t.Output
+	}
+	suite.Tests++
+	suite.Cases = append(suite.Cases, tc)
+
+	for _, sub := range t.children {
+		r.addCases(suite, sub, t.Name)
+	}
+}
+
+// junitDuration formats d in seconds, as expected by the time attributes.
+func junitDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -15,6 +15,9 @@
 package reporters
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
@@ -49,3 +52,124 @@ type Reporter interface {
 	Output(string) error
 	SetResult(testresult.TestResult)
 }
+
+// StreamingReporter is implemented by reporters which want to follow
+// the run as it progresses rather than only see finished tests.
+type StreamingReporter interface {
+	Reporter
+	Start(string) error
+	TestStarted(name string, subtest bool)
+	TestParallel(string)
+	TestLog(name, msg string)
+}
+
+// Start prepares streaming reporters to write into the report directory
+// path before any test runs.
+func (reps Reporters) Start(path string) error {
+	for _, r := range reps {
+		if s, ok := r.(StreamingReporter); ok {
+			if err := s.Start(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (reps Reporters) TestStarted(name string, subtest bool) {
+	for _, r := range reps {
+		if s, ok := r.(StreamingReporter); ok {
+			s.TestStarted(name, subtest)
+		}
+	}
+}
+
+func (reps Reporters) TestParallel(name string) {
+	for _, r := range reps {
+		if s, ok := r.(StreamingReporter); ok {
+			s.TestParallel(name)
+		}
+	}
+}
+
+func (reps Reporters) TestLog(name, msg string) {
+	for _, r := range reps {
+		if s, ok := r.(StreamingReporter); ok {
+			s.TestLog(name, msg)
+		}
+	}
+}
+
+// New creates a reporter for the given format. The reporter writes
+// to a file named after the format in the directory passed to Output.
+func New(format, platform, version string) (Reporter, error) {
+	switch format {
+	case "json":
+		return NewJSONReporter("report.json", platform, version), nil
+	case "junit":
+		return NewJUnitReporter("report.xml", platform, version), nil
+	case "tap":
+		return NewTAPReporter("report.tap"), nil
+	default:
+		return nil, fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// NewReporters creates one reporter for each of the given formats.
+func NewReporters(formats []string, platform, version string) (Reporters, error) {
+	var reps Reporters
+	for _, format := range formats {
+		r, err := New(format, platform, version)
+		if err != nil {
+			return nil, err
+		}
+		reps = append(reps, r)
+	}
+	return reps, nil
+}
+
+// reportedTest is a test recorded by one of the tree based reporters.
+type reportedTest struct {
+	Name     string
+	Result   testresult.TestResult
+	Duration time.Duration
+	Output   string
+
+	children []*reportedTest
+}
+
+// buildTestTree arranges the given tests by name, nesting subtests
+// (named "parent/child") below their parent. Tests are reported once
+// all their subtests have finished so the order of the roots and of
+// each set of children is sorted by name to keep output stable.
+func buildTestTree(tests []*reportedTest) []*reportedTest {
+	byName := make(map[string]*reportedTest, len(tests))
+	for _, t := range tests {
+		t.children = nil
+		byName[t.Name] = t
+	}
+
+	var roots []*reportedTest
+	for _, t := range tests {
+		i := strings.LastIndex(t.Name, "/")
+		if i >= 0 {
+			if parent, ok := byName[t.Name[:i]]; ok {
+				parent.children = append(parent.children, t)
+				continue
+			}
+		}
+		roots = append(roots, t)
+	}
+
+	sortTests(roots)
+	return roots
+}
+
+func sortTests(tests []*reportedTest) {
+	sort.SliceStable(tests, func(i, j int) bool {
+		return tests[i].Name < tests[j].Name
+	})
+	for _, t := range tests {
+		sortTests(t.children)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporters
+
+import (
+	"bytes"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
+)
+
+// report feeds r the results of a small run in the order the harness
+// reports them: subtests before their parent.
+func report(r Reporter) {
+	r.ReportTest("basic/sub1", nil, testresult.Pass, time.Second, []byte("sub1 output\n"))
+	r.ReportTest("basic/sub2", nil, testresult.Fail, 2*time.Second, []byte("sub2 failed\n"))
+	r.ReportTest("basic", []string{"sub1", "sub2"}, testresult.Fail, 3*time.Second, nil)
+	r.ReportTest("flaky", nil, testresult.Warn, time.Second, []byte("warn only\n"))
+	r.ReportTest("denied", nil, testresult.Skip, 0, nil)
+	r.SetResult(testresult.Fail)
+}
+
+func TestJUnitReporter(t *testing.T) {
+	r := NewJUnitReporter("report.xml", "qemu", "1.0")
+	report(r)
+
+	var buf bytes.Buffer
+	if err := r.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var suites junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, buf.String())
+	}
+	if suites.Tests != 5 || suites.Failures != 2 || suites.Skipped != 1 {
+		t.Errorf("unexpected totals: tests=%d failures=%d skipped=%d", suites.Tests, suites.Failures, suites.Skipped)
+	}
+	if len(suites.Suites) != 3 {
+		t.Fatalf("expected 3 suites, got %d", len(suites.Suites))
+	}
+
+	basic := suites.Suites[0]
+	if basic.Name != "basic" || len(basic.Cases) != 3 {
+		t.Fatalf("unexpected suite %q with %d cases", basic.Name, len(basic.Cases))
+	}
+	sub2 := basic.Cases[2]
+	if sub2.Name != "basic/sub2" || sub2.Classname != "basic" || sub2.Time != "2.000" {
+		t.Errorf("unexpected subtest case: %+v", sub2)
+	}
+	if sub2.Failure == nil || sub2.Failure.Content != "sub2 failed\n" {
+		t.Errorf("expected failure with output, got %+v", sub2.Failure)
+	}
+	if sub2.SystemOut != "" {
+		t.Errorf("output of failed test repeated in system-out: %q", sub2.SystemOut)
+	}
+	if sub1 := basic.Cases[1]; sub1.SystemOut != "sub1 output\n" {
+		t.Errorf("unexpected system-out %q", sub1.SystemOut)
+	}
+
+	flaky := suites.Suites[2].Cases[0]
+	if flaky.Failure != nil || len(flaky.Properties) != 1 || flaky.Properties[0].Value != "WARN" {
+		t.Errorf("unexpected warn case: %+v", flaky)
+	}
+	if suites.Suites[1].Cases[0].Skipped == nil {
+		t.Errorf("expected skipped case")
+	}
+}
+
+func TestTAPReporter(t *testing.T) {
+	r := NewTAPReporter("report.tap")
+	report(r)
+
+	var buf bytes.Buffer
+	if err := r.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"TAP version 14",
+		"1..3",
+		"    # Subtest: basic",
+		"    1..2",
+		"    ok 1 - basic/sub1",
+		"    not ok 2 - basic/sub2",
+		"      duration_ms: 2000",
+		"        sub2 failed",
+		"not ok 1 - basic",
+		"ok 2 - denied # SKIP",
+		"not ok 3 - flaky # TODO WARN",
+	}
+	out := buf.String()
+	pos := 0
+	for _, line := range expected {
+		i := strings.Index(out[pos:], line+"\n")
+		if i < 0 {
+			t.Fatalf("expected line %q in order in output:\n%s", line, out)
+		}
+		pos += i + len(line)
+	}
+}
+
+func TestNewReporters(t *testing.T) {
+	reps, err := NewReporters([]string{"json", "junit", "tap"}, "qemu", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reps) != 3 {
+		t.Errorf("expected 3 reporters, got %d", len(reps))
+	}
+	if _, err := NewReporters([]string{"html"}, "qemu", ""); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestStreamReporter(t *testing.T) {
+	dir := t.TempDir()
+	r := NewStreamReporter("events.jsonl", "qemu", "1.0")
+	if err := r.Start(dir); err != nil {
+		t.Fatal(err)
+	}
+	r.TestStarted("basic", false)
+	r.TestStarted("basic/sub1", true)
+	r.TestLog("basic/sub1", "hello\n")
+	r.ReportTest("basic/sub1", nil, testresult.Pass, time.Second, nil)
+	r.ReportTest("basic", []string{"sub1"}, testresult.Pass, time.Second, nil)
+	r.TestStarted("killed", false)
+
+	// Simulate a run killed in the middle of writing an event.
+	filename := filepath.Join(dir, "events.jsonl")
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"time":"2026-01-01T00:00:00Z","type":"test-fin`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	data, err := DeserialiseEvents(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Platform != "qemu" || data.Result != testresult.Fail {
+		t.Errorf("unexpected report context: platform=%q result=%q", data.Platform, data.Result)
+	}
+	results := make(map[string]testresult.TestResult)
+	for _, test := range data.Tests {
+		results[test.Name] = test.Result
+	}
+	expected := map[string]testresult.TestResult{
+		"basic":      testresult.Pass,
+		"basic/sub1": testresult.Pass,
+		"killed":     testresult.Fail,
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+
+	if err := r.Output(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedStreamReporter(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "events.jsonl")
+	r := NewSharedStreamReporter(filename, "qemu", "1.0")
+
+	// A run and its rerun in another report directory.
+	for _, result := range []testresult.TestResult{testresult.Fail, testresult.Pass} {
+		if err := r.Start(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		r.TestStarted("flaky", false)
+		r.ReportTest("flaky", nil, result, time.Second, nil)
+		r.SetResult(result)
+		if err := r.Output(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), `"type":"suite-start"`); n != 2 {
+		t.Errorf("expected the events of 2 suites, got %d:\n%s", n, b)
+	}
+	data, err := DeserialiseEvents(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Result != testresult.Pass || len(data.Tests) != 1 || data.Tests[0].Result != testresult.Pass {
+		t.Errorf("expected the rerun to pass, got %+v", data)
+	}
+}
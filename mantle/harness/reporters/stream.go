@@ -0,0 +1,313 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporters
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
+)
+
+type EventType string
+
+const (
+	// EventSuiteStart is sent once when the run starts.
+	EventSuiteStart EventType = "suite-start"
+	// EventTestStart is sent when a top-level test starts running.
+	EventTestStart EventType = "test-start"
+	// EventSubtestStart is sent when a subtest starts running.
+	EventSubtestStart EventType = "subtest-start"
+	// EventTestParallel is sent when a test which called Parallel
+	// acquired a parallel slot and resumes running.
+	EventTestParallel EventType = "test-parallel"
+	// EventLog is sent for each message logged by a test.
+	EventLog EventType = "log"
+	// EventTestFinish is sent when a test and all its subtests are done.
+	EventTestFinish EventType = "test-finish"
+	// EventSuiteFinish is sent once with the result of the whole run.
+	EventSuiteFinish EventType = "suite-finish"
+)
+
+// Event is a single line of a streamed report.
+type Event struct {
+	Time     time.Time             `json:"time"`
+	Type     EventType             `json:"type"`
+	Test     string                `json:"test,omitempty"`
+	Subtests []string              `json:"subtests,omitempty"`
+	Result   testresult.TestResult `json:"result,omitempty"`
+	Duration time.Duration         `json:"duration,omitempty"`
+	Message  string                `json:"message,omitempty"`
+
+	// Context variables, only set on the first event of a stream
+	Platform string `json:"platform,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+// streamReporter writes newline-delimited JSON events as the run
+// progresses rather than a single report at the end, so consumers can
+// follow a run live and a partial report survives a killed run.
+type streamReporter struct {
+	dest string
+	w    io.WriteCloser
+	err  error
+	// shared streams are kept open across suites until Close.
+	shared bool
+
+	// Context variables
+	platform string
+	version  string
+
+	mutex sync.Mutex
+}
+
+// NewStreamReporter creates a reporter streaming events to dest. dest
+// is either "fd:N" for an already open file descriptor, an absolute
+// path, or a path relative to the report directory given to Start.
+func NewStreamReporter(dest, platform, version string) *streamReporter {
+	return &streamReporter{
+		dest:     dest,
+		platform: platform,
+		version:  version,
+		mutex:    sync.Mutex{},
+	}
+}
+
+// NewSharedStreamReporter creates a reporter streaming events to dest
+// like NewStreamReporter, which can be used by several suites in a row,
+// e.g. a run and its reruns. The stream is opened by the first Start,
+// relative paths being relative to its report directory, and each
+// following suite appends its events to it. Output leaves it open; it
+// is closed by Close.
+func NewSharedStreamReporter(dest, platform, version string) *streamReporter {
+	r := NewStreamReporter(dest, platform, version)
+	r.shared = true
+	return r
+}
+
+func (r *streamReporter) Start(path string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.w != nil && !r.shared {
+		return nil
+	}
+	if r.w == nil {
+		if err := r.open(path); err != nil {
+			return err
+		}
+	}
+
+	r.send(Event{
+		Type:     EventSuiteStart,
+		Platform: r.platform,
+		Version:  r.version,
+	})
+	return nil
+}
+
+func (r *streamReporter) open(path string) error {
+	if fd, ok := strings.CutPrefix(r.dest, "fd:"); ok {
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return fmt.Errorf("invalid event stream %q: %v", r.dest, err)
+		}
+		r.w = os.NewFile(uintptr(n), r.dest)
+		return nil
+	}
+	dest := r.dest
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(path, dest)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	r.w = f
+	return nil
+}
+
+func (r *streamReporter) TestStarted(name string, subtest bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	typ := EventTestStart
+	if subtest {
+		typ = EventSubtestStart
+	}
+	r.send(Event{Type: typ, Test: name})
+}
+
+func (r *streamReporter) TestParallel(name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.send(Event{Type: EventTestParallel, Test: name})
+}
+
+func (r *streamReporter) TestLog(name, msg string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.send(Event{Type: EventLog, Test: name, Message: strings.TrimSuffix(msg, "\n")})
+}
+
+func (r *streamReporter) ReportTest(name string, subtests []string, result testresult.TestResult, duration time.Duration, b []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.send(Event{
+		Type:     EventTestFinish,
+		Test:     name,
+		Subtests: subtests,
+		Result:   result,
+		Duration: duration,
+	})
+}
+
+func (r *streamReporter) SetResult(result testresult.TestResult) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.send(Event{Type: EventSuiteFinish, Result: result})
+}
+
+// Output closes the stream unless it's shared; all events have already
+// been written.
+func (r *streamReporter) Output(path string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.shared {
+		return r.err
+	}
+	return r.close()
+}
+
+// Close closes the stream.
+func (r *streamReporter) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.close()
+}
+
+func (r *streamReporter) close() error {
+	if r.w == nil {
+		return r.err
+	}
+	if err := r.w.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	r.w = nil
+	return r.err
+}
+
+// send writes ev as a single line. Each event is written with a single
+// write call so it reaches the file immediately. The first error is
+// kept and returned by Output; reporting must never fail a test.
+func (r *streamReporter) send(ev Event) {
+	if r.w == nil || r.err != nil {
+		return
+	}
+	ev.Time = time.Now().UTC()
+	b, err := json.Marshal(ev)
+	if err != nil {
+		r.err = err
+		return
+	}
+	if _, err := r.w.Write(append(b, '\n')); err != nil {
+		r.err = err
+	}
+}
+
+// DeserialiseEvents rebuilds a report from an event stream, which may
+// have been cut short. Tests which started but never finished are
+// reported as failed. A trailing partial line is ignored.
+func DeserialiseEvents(filename string) (*jsonReporter, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var data jsonReporter
+	var order []string
+	started := make(map[string]bool)
+	finished := make(map[string]jsonTest)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			// Only the last line may be partially written.
+			if scanner.Scan() {
+				return nil, fmt.Errorf("parsing %s: %v", filename, err)
+			}
+			break
+		}
+		switch ev.Type {
+		case EventSuiteStart:
+			data.Platform = ev.Platform
+			data.Version = ev.Version
+		case EventTestStart, EventSubtestStart:
+			if !started[ev.Test] {
+				order = append(order, ev.Test)
+			}
+			started[ev.Test] = true
+		case EventTestFinish:
+			if !started[ev.Test] {
+				order = append(order, ev.Test)
+				started[ev.Test] = true
+			}
+			finished[ev.Test] = jsonTest{
+				Name:     ev.Test,
+				Subtests: ev.Subtests,
+				Result:   ev.Result,
+				Duration: ev.Duration,
+			}
+		case EventSuiteFinish:
+			data.Result = ev.Result
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, name := range order {
+		test, ok := finished[name]
+		if !ok {
+			test = jsonTest{
+				Name:   name,
+				Result: testresult.Fail,
+				Output: "test did not finish",
+			}
+		}
+		data.Tests = append(data.Tests, test)
+	}
+	if data.Result == "" {
+		data.Result = testresult.Fail
+	}
+	return &data, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reporters
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
+)
+
+// tapReporter writes results in the TAP version 14 format. Subtests
+// are written as indented subtest blocks preceding the result line of
+// their parent, and the duration and output of each test are attached
+// as a YAML diagnostic block.
+type tapReporter struct {
+	tests    []*reportedTest
+	filename string
+
+	mutex sync.Mutex
+}
+
+func NewTAPReporter(filename string) *tapReporter {
+	return &tapReporter{
+		filename: filename,
+		mutex:    sync.Mutex{},
+	}
+}
+
+func (r *tapReporter) ReportTest(name string, subtests []string, result testresult.TestResult, duration time.Duration, b []byte) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.tests = append(r.tests, &reportedTest{
+		Name:     name,
+		Result:   result,
+		Duration: duration,
+		Output:   string(b),
+	})
+}
+
+func (r *tapReporter) Output(path string) error {
+	f, err := os.Create(filepath.Join(path, r.filename))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.write(f)
+}
+
+// SetResult is a no-op; the overall result is implied by the test lines.
+func (r *tapReporter) SetResult(result testresult.TestResult) {}
+
+func (r *tapReporter) write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "TAP version 14")
+	writeTAPTests(bw, buildTestTree(r.tests), "")
+	return bw.Flush()
+}
+
+func writeTAPTests(w io.Writer, tests []*reportedTest, indent string) {
+	fmt.Fprintf(w, "%s1..%d\n", indent, len(tests))
+	for i, t := range tests {
+		if len(t.children) > 0 {
+			fmt.Fprintf(w, "%s# Subtest: %s\n", indent+"    ", t.Name)
+			writeTAPTests(w, t.children, indent+"    ")
+		}
+
+		// The description may not contain a "#", it starts a directive.
+		name := strings.ReplaceAll(t.Name, "#", "")
+		switch t.Result {
+		case testresult.Fail:
+			fmt.Fprintf(w, "%snot ok %d - %s\n", indent, i+1, name)
+		case testresult.Warn:
+			// A TODO directive marks a failure which does not count
+			// against the run, which is what a warn-only test is.
+			fmt.Fprintf(w, "%snot ok %d - %s # TODO %s\n", indent, i+1, name, testresult.Warn)
+		case testresult.Skip:
+			fmt.Fprintf(w, "%sok %d - %s # SKIP\n", indent, i+1, name)
+		default:
+			fmt.Fprintf(w, "%sok %d - %s\n", indent, i+1, name)
+		}
+
+		fmt.Fprintf(w, "%s  ---\n", indent)
+		fmt.Fprintf(w, "%s  duration_ms: %d\n", indent, t.Duration.Milliseconds())
+		if output := strings.TrimRight(t.Output, "\n"); output != "" {
+			fmt.Fprintf(w, "%s  output: |\n", indent)
+			for _, line := range strings.Split(output, "\n") {
+				fmt.Fprintf(w, "%s    %s\n", indent, line)
+			}
+		}
+		fmt.Fprintf(w, "%s  ...\n", indent)
+	}
+}
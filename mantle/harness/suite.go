@@ -221,6 +221,9 @@ func (s *Suite) Run() (err error) {
 			err = reportErr
 		}
 	}()
+	if err := s.opts.Reporters.Start(reportDir); err != nil {
+		return err
+	}
 
 	if s.opts.MemProfile {
 		runtime.MemProfileRate = s.opts.MemProfileRate
@@ -0,0 +1,300 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/coreos/coreos-assembler/mantle/kola/cluster"
+	"github.com/coreos/coreos-assembler/mantle/kola/register"
+	"github.com/coreos/coreos-assembler/mantle/platform"
+	"github.com/coreos/coreos-assembler/mantle/platform/conf"
+	"github.com/coreos/coreos-assembler/mantle/util"
+)
+
+// declarativeTestSuffix marks the files in external test directories
+// which define declarative tests.
+const declarativeTestSuffix = ".kola.yaml"
+
+// defaultStepTimeout bounds the steps which wait for the machine.
+const defaultStepTimeout = 2 * time.Minute
+
+// declarativeTest is a test defined in YAML rather than by an
+// executable: a config for the machines and a list of steps to run on
+// them. It accepts the same metadata as external tests.
+type declarativeTest struct {
+	externalTestMeta `yaml:",inline"`
+
+	ClusterSize int `yaml:"clusterSize"`
+	// Butane or Ignition is the config of all machines.
+	Butane   string            `yaml:"butane"`
+	Ignition string            `yaml:"ignition"`
+	Steps    []declarativeStep `yaml:"steps"`
+}
+
+// declarativeStep is a single action of a declarative test. Exactly one
+// of Run, Reboot, SoftReboot, WaitForUnit and Copy must be set.
+type declarativeStep struct {
+	Name string `yaml:"name"`
+	// Machine is the index of the machine the step runs on.
+	Machine int `yaml:"machine"`
+
+	// Run is a shell command which must succeed and whose output must
+	// match Expect if set.
+	Run    string `yaml:"run"`
+	Expect string `yaml:"expect"`
+
+	Reboot     bool `yaml:"reboot"`
+	SoftReboot bool `yaml:"softReboot"`
+
+	// WaitForUnit waits for the unit to be in State, by default active.
+	WaitForUnit string `yaml:"waitForUnit"`
+	State       string `yaml:"state"`
+
+	Copy *declarativeCopy `yaml:"copy"`
+
+	// Timeout bounds soft reboots and waiting for units, e.g. "5m".
+	Timeout string `yaml:"timeout"`
+
+	expect  *regexp.Regexp
+	timeout time.Duration
+}
+
+// declarativeCopy copies a file next to the test definition to the
+// machine.
+type declarativeCopy struct {
+	Src  string `yaml:"src"`
+	Dest string `yaml:"dest"`
+}
+
+// parseDeclarativeTest reads and validates the test defined in path.
+func parseDeclarativeTest(path string) (*declarativeTest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	test := declarativeTest{
+		externalTestMeta: externalTestMeta{Exclusive: true},
+		ClusterSize:      1,
+	}
+	if err := yaml.UnmarshalStrict(data, &test); err != nil {
+		return nil, err
+	}
+
+	if !test.Exclusive {
+		return nil, fmt.Errorf("declarative tests must be exclusive")
+	}
+	if test.ClusterSize < 1 {
+		return nil, fmt.Errorf("clusterSize must be at least 1")
+	}
+	if test.Butane != "" && test.Ignition != "" {
+		return nil, fmt.Errorf("only one of butane and ignition may be set")
+	}
+	if len(test.Steps) == 0 {
+		return nil, fmt.Errorf("no steps defined")
+	}
+	for i := range test.Steps {
+		if err := test.Steps[i].validate(filepath.Dir(path), test.ClusterSize); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return &test, nil
+}
+
+func (s *declarativeStep) validate(dir string, clusterSize int) error {
+	actions := 0
+	for _, set := range []bool{s.Run != "", s.Reboot, s.SoftReboot, s.WaitForUnit != "", s.Copy != nil} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return fmt.Errorf("exactly one of run, reboot, softReboot, waitForUnit and copy must be set")
+	}
+	if s.Machine < 0 || s.Machine >= clusterSize {
+		return fmt.Errorf("machine %d out of range for cluster of size %d", s.Machine, clusterSize)
+	}
+
+	if s.Expect != "" {
+		if s.Run == "" {
+			return fmt.Errorf("expect is only valid with run")
+		}
+		var err error
+		if s.expect, err = regexp.Compile(s.Expect); err != nil {
+			return err
+		}
+	}
+	if s.State != "" && s.WaitForUnit == "" {
+		return fmt.Errorf("state is only valid with waitForUnit")
+	}
+	if s.State == "" {
+		s.State = "active"
+	}
+	s.timeout = defaultStepTimeout
+	if s.Timeout != "" {
+		var err error
+		if s.timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return err
+		}
+	}
+
+	if s.Copy != nil {
+		if s.Copy.Src == "" || !filepath.IsAbs(s.Copy.Dest) {
+			return fmt.Errorf("copy needs a src and an absolute dest")
+		}
+		if !filepath.IsAbs(s.Copy.Src) {
+			s.Copy.Src = filepath.Join(dir, s.Copy.Src)
+		}
+		if _, err := os.Stat(s.Copy.Src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String describes the step for the name of its subtest.
+func (s *declarativeStep) String() string {
+	switch {
+	case s.Name != "":
+		return s.Name
+	case s.Run != "":
+		return "run"
+	case s.Reboot:
+		return "reboot"
+	case s.SoftReboot:
+		return "soft-reboot"
+	case s.WaitForUnit != "":
+		return "wait-for-unit"
+	default:
+		return "copy"
+	}
+}
+
+// registerDeclarativeTest registers the test defined in path.
+func registerDeclarativeTest(testname, path string) error {
+	spec, err := parseDeclarativeTest(path)
+	if err != nil {
+		return err
+	}
+
+	userdata := conf.EmptyIgnition()
+	if spec.Butane != "" {
+		userdata = conf.Butane(spec.Butane)
+	} else if spec.Ignition != "" {
+		userdata = conf.Ignition(spec.Ignition)
+	}
+	// Render now so that broken configs are reported when loading
+	// tests rather than when running them.
+	warningsAction := conf.FailWarnings
+	if spec.AllowConfigWarnings {
+		warningsAction = conf.IgnoreWarnings
+	}
+	if _, err := userdata.Render(warningsAction); err != nil {
+		return errors.Wrapf(err, "parsing config")
+	}
+
+	t := &register.Test{
+		Name:        testname,
+		Description: spec.Description,
+		ClusterSize: spec.ClusterSize,
+		Tags:        []string{"external", "declarative"},
+
+		MachineOptions:  spec.machineOptions(),
+		InjectContainer: spec.InjectContainer,
+		ReuseSnapshot:   spec.ReuseSnapshot,
+
+		Run: func(c cluster.TestCluster) {
+			runDeclarativeTest(c, spec.Steps)
+		},
+
+		UserData: userdata,
+		Timeout:  time.Duration(spec.TimeoutMin) * time.Minute,
+	}
+	if spec.AllowConfigWarnings {
+		t.Flags = append(t.Flags, register.AllowConfigWarnings)
+	}
+	spec.applyFilters(t)
+
+	register.RegisterTest(t)
+
+	return nil
+}
+
+// runDeclarativeTest runs each step as a subtest, stopping at the first
+// failure.
+func runDeclarativeTest(c cluster.TestCluster, steps []declarativeStep) {
+	machines := c.Machines()
+	for i := range steps {
+		step := &steps[i]
+		name := fmt.Sprintf("%d-%s", i+1, step)
+		ok := c.RunLogged(name, func(c cluster.TestCluster) {
+			if err := step.run(c, machines[step.Machine]); err != nil {
+				c.Fatal(err)
+			}
+		})
+		if !ok {
+			c.Fatalf("step %s failed", name)
+		}
+	}
+}
+
+func (s *declarativeStep) run(c cluster.TestCluster, m platform.Machine) error {
+	switch {
+	case s.Run != "":
+		out, err := c.SSH(m, s.Run)
+		if err != nil {
+			return fmt.Errorf("%q failed: %v", s.Run, err)
+		}
+		if s.expect != nil && !s.expect.Match(out) {
+			return fmt.Errorf("output of %q does not match %q: %s", s.Run, s.Expect, out)
+		}
+		return nil
+	case s.Reboot:
+		return m.Reboot()
+	case s.SoftReboot:
+		count, err := platform.GetMachineSoftRebootCount(m)
+		if err != nil {
+			return err
+		}
+		if out, stderr, err := m.SSH("sudo systemctl --no-block soft-reboot"); err != nil {
+			return fmt.Errorf("triggering soft-reboot: %s: %v: %s", out, err, stderr)
+		}
+		return m.WaitForSoftReboot(s.timeout, count)
+	case s.WaitForUnit != "":
+		return util.RetryUntilTimeout(s.timeout, 5*time.Second, func() error {
+			out, _, _ := m.SSH(fmt.Sprintf("systemctl show --value --property ActiveState %s", shellquote.Join(s.WaitForUnit)))
+			if state := strings.TrimSpace(string(out)); state != s.State {
+				return fmt.Errorf("unit %s is %q, expected %q", s.WaitForUnit, state, s.State)
+			}
+			return nil
+		})
+	default:
+		f, err := os.Open(s.Copy.Src)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return platform.InstallFile(f, m, s.Copy.Dest)
+	}
+}
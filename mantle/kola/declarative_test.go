@@ -0,0 +1,109 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/platform/conf"
+)
+
+func writeDeclarativeTest(t *testing.T, dir, contents string) string {
+	path := filepath.Join(dir, "test"+declarativeTestSuffix)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseDeclarativeTest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "motd"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := writeDeclarativeTest(t, dir, `
+description: check a unit
+platforms: qemu
+clusterSize: 2
+minMemory: 2048
+butane: |
+  variant: fcos
+  version: 1.4.0
+steps:
+  - waitForUnit: sshd.service
+  - copy:
+      src: motd
+      dest: /etc/motd.d/test
+  - run: cat /etc/motd.d/test
+    expect: ^hello$
+    machine: 1
+  - softReboot: true
+    timeout: 5m
+`)
+	test, err := parseDeclarativeTest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if test.ClusterSize != 2 || test.Platforms != "qemu" || test.MinMemory != 2048 || len(test.Steps) != 4 {
+		t.Errorf("unexpected test %+v", test)
+	}
+	if s := test.Steps[0]; s.State != "active" || s.timeout != defaultStepTimeout {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+	if s := test.Steps[1]; s.Copy.Src != filepath.Join(dir, "motd") {
+		t.Errorf("unexpected copy source %q", s.Copy.Src)
+	}
+	if s := test.Steps[2]; s.expect == nil || !s.expect.MatchString("hello") {
+		t.Errorf("unexpected expect %+v", s)
+	}
+	if s := test.Steps[3]; s.timeout != 5*time.Minute || s.String() != "soft-reboot" {
+		t.Errorf("unexpected step %+v", s)
+	}
+}
+
+func TestParseDeclarativeTestErrors(t *testing.T) {
+	for name, contents := range map[string]string{
+		"no steps":        `description: nothing`,
+		"unknown key":     "steps:\n  - run: true\n    foo: bar\n",
+		"two actions":     "steps:\n  - run: true\n    reboot: true\n",
+		"no action":       "steps:\n  - name: empty\n",
+		"machine":         "steps:\n  - run: true\n    machine: 1\n",
+		"expect":          "steps:\n  - reboot: true\n    expect: foo\n",
+		"missing copy":    "steps:\n  - copy: {src: missing, dest: /etc/foo}\n",
+		"non-exclusive":   "exclusive: false\nsteps:\n  - run: true\n",
+		"butane+ignition": "butane: a\nignition: b\nsteps:\n  - run: true\n",
+	} {
+		path := writeDeclarativeTest(t, t.TempDir(), contents)
+		if _, err := parseDeclarativeTest(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRegisterExternalTestReuseSnapshot(t *testing.T) {
+	executable := filepath.Join(t.TempDir(), "test.sh")
+	script := "#!/bin/bash\n# kola: { \"exclusive\": false, \"reuseSnapshot\": true }\ntrue\n"
+	if err := os.WriteFile(executable, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := registerExternalTest("ext.test", executable, "", conf.EmptyIgnition(), externalTestMeta{})
+	if err == nil || !strings.Contains(err.Error(), "requires exclusive: true") {
+		t.Errorf("expected non-exclusive reuseSnapshot to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/kola/register"
+	"github.com/coreos/coreos-assembler/mantle/platform"
+)
+
+// diagnosticsTimeout bounds the collectors of each machine so that a
+// wedged machine can't hold up the test teardown.
+var diagnosticsTimeout = 2 * time.Minute
+
+// defaultDiagnosticCollectors run on every machine of a failed test.
+var defaultDiagnosticCollectors = []register.DiagnosticCollector{
+	register.CommandCollector("failed-units.txt", "systemctl --failed --no-legend --plain --no-pager"),
+	register.CommandCollector("rpm-ostree-status.txt", "rpm-ostree status -v"),
+	register.CommandCollector("ignition-journal.txt", "journalctl -b 0 -t ignition --no-pager -o short-monotonic"),
+	register.CommandCollector("dmesg.txt", "sudo dmesg"),
+}
+
+// DiagnosticsSummary is written as summary.json next to the bundle of
+// a failed test.
+type DiagnosticsSummary struct {
+	Test     string                   `json:"test"`
+	Time     time.Time                `json:"time"`
+	Bundle   string                   `json:"bundle"`
+	Machines []MachineDiagnosticsInfo `json:"machines"`
+}
+
+type MachineDiagnosticsInfo struct {
+	ID             string   `json:"id"`
+	FailedUnits    []string `json:"failed_units"`
+	ConsoleMatches []string `json:"console_matches,omitempty"`
+	JournalMatches []string `json:"journal_matches,omitempty"`
+	Errors         []string `json:"errors,omitempty"`
+}
+
+// diagnostics accumulates the bundle of a failed test. Data is
+// gathered over SSH by collectDiagnostics while the machines are up, and
+// then completed with the console checks and written out by finish
+// once the machines are destroyed.
+type diagnostics struct {
+	dir      string
+	test     *register.Test
+	machines map[string]*MachineDiagnosticsInfo
+}
+
+// collectDiagnostics runs the default and the test's collectors on all
+// machines in parallel and stages their output in outputDir/diagnostics.
+func collectDiagnostics(outputDir string, t *register.Test, machines []platform.Machine) *diagnostics {
+	d := &diagnostics{
+		dir:      filepath.Join(outputDir, "diagnostics"),
+		test:     t,
+		machines: make(map[string]*MachineDiagnosticsInfo),
+	}
+	collectors := append(append([]register.DiagnosticCollector{}, defaultDiagnosticCollectors...), t.DiagnosticCollectors...)
+
+	var wg sync.WaitGroup
+	for _, m := range machines {
+		info := &MachineDiagnosticsInfo{ID: m.ID()}
+		d.machines[m.ID()] = info
+		wg.Add(1)
+		go func(m platform.Machine) {
+			defer wg.Done()
+			info.Errors = d.collectMachine(m, info, collectors)
+		}(m)
+	}
+	wg.Wait()
+	return d
+}
+
+func (d *diagnostics) collectMachine(m platform.Machine, info *MachineDiagnosticsInfo, collectors []register.DiagnosticCollector) []string {
+	dir := filepath.Join(d.dir, m.ID())
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return []string{err.Error()}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+
+	// Don't wait for each collector to fail on a machine which is gone.
+	if _, _, err := platform.SSHContext(ctx, m, "true"); err != nil {
+		return []string{fmt.Sprintf("machine unreachable, skipped collecting diagnostics: %v", err)}
+	}
+
+	var errs []string
+	for i, collect := range collectors {
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Sprintf("collecting diagnostics timed out after %v, skipped %d collectors", diagnosticsTimeout, len(collectors)-i))
+			break
+		}
+		files, err := collect(ctx, m)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		for name, data := range files {
+			if err := os.WriteFile(filepath.Join(dir, filepath.Base(name)), data, 0644); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "failed-units.txt")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				info.FailedUnits = append(info.FailedUnits, fields[0])
+			}
+		}
+	}
+	return errs
+}
+
+// addConsoleMatches records the console checks that matched on the
+// output of the now destroyed machines.
+func (d *diagnostics) addConsoleMatches(consoles, journals map[string]string) {
+	for id, output := range consoles {
+		if info, ok := d.machines[id]; ok {
+			_, info.ConsoleMatches = CheckConsole([]byte(output), d.test)
+		}
+	}
+	for id, output := range journals {
+		if info, ok := d.machines[id]; ok {
+			_, info.JournalMatches = CheckConsole([]byte(output), d.test)
+		}
+	}
+}
+
+// finish writes the summary and packs the staged files into bundle.tar.gz.
+func (d *diagnostics) finish() error {
+	summary := DiagnosticsSummary{
+		Test:   d.test.Name,
+		Time:   time.Now().UTC(),
+		Bundle: "bundle.tar.gz",
+	}
+	var ids []string
+	for id := range d.machines {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		summary.Machines = append(summary.Machines, *d.machines[id])
+	}
+
+	if err := os.MkdirAll(d.dir, 0777); err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(d.dir, "summary.json"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(&summary); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	bundle := filepath.Join(d.dir, summary.Bundle)
+	if err := writeTarGz(bundle, d.dir, ids); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := os.RemoveAll(filepath.Join(d.dir, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTarGz archives the given subdirectories of dir and the summary
+// into path.
+func writeTarGz(path, dir string, subdirs []string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+
+	add := func(p string, info os.FileInfo) error {
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	}
+
+	paths := []string{filepath.Join(dir, "summary.json")}
+	for _, sub := range subdirs {
+		paths = append(paths, filepath.Join(dir, sub))
+	}
+	for _, root := range paths {
+		err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			return add(p, info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,250 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/coreos-assembler/mantle/kola/register"
+	"github.com/coreos/coreos-assembler/mantle/network/mockssh"
+	"github.com/coreos/coreos-assembler/mantle/platform"
+)
+
+// fakeMachine answers SSH commands from a table. Commands which aren't
+// in the table exit with status 1. A machine without a table is
+// unreachable.
+type fakeMachine struct {
+	platform.Machine
+	id       string
+	commands map[string]string
+}
+
+func (m *fakeMachine) ID() string {
+	return m.id
+}
+
+func (m *fakeMachine) SSHClient() (*ssh.Client, error) {
+	if m.commands == nil {
+		return nil, errors.New("connection refused")
+	}
+	return mockssh.NewMockClient(func(s *mockssh.Session) {
+		out, ok := m.commands[s.Exec]
+		if !ok {
+			_, _ = io.WriteString(s.Stderr, "command not found\n")
+			_ = s.Exit(1)
+			return
+		}
+		_, _ = io.WriteString(s.Stdout, out)
+		_ = s.Exit(0)
+	}), nil
+}
+
+func newDiagnostics(t *testing.T) *diagnostics {
+	return &diagnostics{
+		dir:      filepath.Join(t.TempDir(), "diagnostics"),
+		test:     &register.Test{Name: "fake.test"},
+		machines: make(map[string]*MachineDiagnosticsInfo),
+	}
+}
+
+func readTarGz(t *testing.T, path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(data)
+	}
+	return files
+}
+
+func TestCollectDiagnosticsBundle(t *testing.T) {
+	outputDir := t.TempDir()
+	test := &register.Test{
+		Name: "fake.test",
+		DiagnosticCollectors: []register.DiagnosticCollector{
+			func(ctx context.Context, m platform.Machine) (map[string][]byte, error) {
+				return map[string][]byte{"extra.txt": []byte("extra " + m.ID())}, nil
+			},
+		},
+	}
+	m1 := &fakeMachine{
+		id: "m1",
+		commands: map[string]string{
+			"true": "",
+			"systemctl --failed --no-legend --plain --no-pager":         "foo.service loaded failed failed Foo\nbar.mount loaded failed failed Bar\n",
+			"rpm-ostree status -v":                                      "State: idle\n",
+			"journalctl -b 0 -t ignition --no-pager -o short-monotonic": "ignition: done\n",
+			"sudo dmesg": "kernel: hello\n",
+		},
+	}
+	m2 := &fakeMachine{id: "m2"}
+
+	d := collectDiagnostics(outputDir, test, []platform.Machine{m1, m2})
+	if err := d.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(outputDir, "diagnostics")
+	data, err := os.ReadFile(filepath.Join(dir, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary DiagnosticsSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Test != "fake.test" || summary.Bundle != "bundle.tar.gz" || summary.Time.IsZero() {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+	if len(summary.Machines) != 2 {
+		t.Fatalf("expected 2 machines, got %+v", summary.Machines)
+	}
+	got1, got2 := summary.Machines[0], summary.Machines[1]
+	if got1.ID != "m1" || !reflect.DeepEqual(got1.FailedUnits, []string{"foo.service", "bar.mount"}) || len(got1.Errors) != 0 {
+		t.Errorf("unexpected m1 info %+v", got1)
+	}
+	if got2.ID != "m2" || len(got2.FailedUnits) != 0 || len(got2.Errors) != 1 ||
+		!strings.HasPrefix(got2.Errors[0], "machine unreachable, skipped collecting diagnostics") {
+		t.Errorf("unexpected m2 info %+v", got2)
+	}
+
+	files := readTarGz(t, filepath.Join(dir, "bundle.tar.gz"))
+	if files["summary.json"] != string(data) {
+		t.Errorf("bundled summary.json differs from the written one")
+	}
+	for name, want := range map[string]string{
+		"m1/failed-units.txt":      m1.commands["systemctl --failed --no-legend --plain --no-pager"],
+		"m1/rpm-ostree-status.txt": "State: idle\n",
+		"m1/ignition-journal.txt":  "ignition: done\n",
+		"m1/dmesg.txt":             "kernel: hello\n",
+		"m1/extra.txt":             "extra m1",
+	} {
+		if got, ok := files[name]; !ok || got != want {
+			t.Errorf("bundle entry %s: got %q, want %q", name, got, want)
+		}
+	}
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	wantNames := []string{"m1", "m1/dmesg.txt", "m1/extra.txt", "m1/failed-units.txt",
+		"m1/ignition-journal.txt", "m1/rpm-ostree-status.txt", "m2", "summary.json"}
+	if !reflect.DeepEqual(names, wantNames) {
+		t.Errorf("bundle entries: got %v, want %v", names, wantNames)
+	}
+
+	for _, id := range []string{"m1", "m2"} {
+		if _, err := os.Stat(filepath.Join(dir, id)); !os.IsNotExist(err) {
+			t.Errorf("staging directory %s not removed: %v", id, err)
+		}
+	}
+}
+
+func TestCollectMachineErrors(t *testing.T) {
+	d := newDiagnostics(t)
+	m := &fakeMachine{id: "m", commands: map[string]string{"true": ""}}
+	info := &MachineDiagnosticsInfo{ID: "m"}
+	collectors := []register.DiagnosticCollector{
+		register.CommandCollector("missing.txt", "missing-command"),
+		func(ctx context.Context, m platform.Machine) (map[string][]byte, error) {
+			return nil, fmt.Errorf("collector broke")
+		},
+	}
+
+	errs := d.collectMachine(m, info, collectors)
+	if len(errs) != 2 || !strings.Contains(errs[0], `"missing-command" failed`) || errs[1] != "collector broke" {
+		t.Errorf("unexpected errors %q", errs)
+	}
+	// The output of a failed command is kept.
+	data, err := os.ReadFile(filepath.Join(d.dir, "m", "missing.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "command not found\n" {
+		t.Errorf("unexpected output %q", data)
+	}
+}
+
+func TestCollectMachineDeadline(t *testing.T) {
+	defer func(timeout time.Duration) { diagnosticsTimeout = timeout }(diagnosticsTimeout)
+	diagnosticsTimeout = 100 * time.Millisecond
+
+	d := newDiagnostics(t)
+	m := &fakeMachine{id: "m", commands: map[string]string{"true": ""}}
+	info := &MachineDiagnosticsInfo{ID: "m"}
+	ran := 0
+	other := func(ctx context.Context, m platform.Machine) (map[string][]byte, error) {
+		ran++
+		return nil, nil
+	}
+	collectors := []register.DiagnosticCollector{
+		func(ctx context.Context, m platform.Machine) (map[string][]byte, error) {
+			<-ctx.Done()
+			return map[string][]byte{"partial.txt": []byte("partial")}, ctx.Err()
+		},
+		other,
+		other,
+	}
+
+	errs := d.collectMachine(m, info, collectors)
+	want := []string{
+		context.DeadlineExceeded.Error(),
+		"collecting diagnostics timed out after 100ms, skipped 2 collectors",
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got errors %q, want %q", errs, want)
+	}
+	if ran != 0 {
+		t.Errorf("%d collectors ran after the deadline", ran)
+	}
+	if _, err := os.Stat(filepath.Join(d.dir, "m", "partial.txt")); err != nil {
+		t.Errorf("output of the timed out collector not kept: %v", err)
+	}
+}
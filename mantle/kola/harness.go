@@ -120,9 +120,11 @@ var (
 
 	CosaBuild *util.LocalBuild // this is a parsed cosa build
 
-	TestParallelism int    //glue var to set test parallelism from main
-	TAPFile         string // if not "", write TAP results here
-	NoNet           bool   // Disable tests requiring Internet
+	TestParallelism int      //glue var to set test parallelism from main
+	TAPFile         string   // if not "", write TAP results here
+	ReportFormats   []string // formats of the reports written to the reports/ output dir
+	EventStream     string   // if not "", also stream test events to this path or "fd:N"
+	NoNet           bool     // Disable tests requiring Internet
 
 	// reservedMemoryCountMiB tracks memory claimed by tests that have been
 	// scheduled but whose QEMU VMs may not have fully allocated yet.
@@ -786,14 +788,17 @@ func runProvidedTests(testsBank map[string]*register.Test, patterns []string, mu
 		plog.Fatalf("%v", err)
 	}
 
+	reps, err := NewReporters(pltfrm, versionStr)
+	if err != nil {
+		plog.Fatalf("%v", err)
+	}
+
 	opts := harness.Options{
 		OutputDir: outputDir,
 		Parallel:  TestParallelism,
 		Sharding:  Sharding,
 		Verbose:   true,
-		Reporters: reporters.Reporters{
-			reporters.NewJSONReporter("report.json", pltfrm, versionStr),
-		},
+		Reporters: reps,
 	}
 
 	var htests harness.Tests
@@ -815,8 +820,7 @@ func runProvidedTests(testsBank map[string]*register.Test, patterns []string, mu
 		caughtTestError := suiteErr != nil
 
 		if TAPFile != "" {
-			src := filepath.Join(outputDir, "test.tap")
-			err := system.CopyRegularFile(src, TAPFile)
+			err := copyTAPReport(outputDir)
 			if suiteErr == nil && err != nil {
 				return err
 			}
@@ -985,11 +989,67 @@ func getRerunnable(testsBank map[string]*register.Test, testResults []*harness.H
 	return testsToRerun
 }
 
+// copyTAPReport copies the TAP report of the run in outputDir to TAPFile.
+func copyTAPReport(outputDir string) error {
+	return system.CopyRegularFile(filepath.Join(outputDir, "reports", "report.tap"), TAPFile)
+}
+
+// NewReporters creates the reporters selected by ReportFormats. The JSON
+// reporter and the events.jsonl stream are always included since
+// `kola rerun` depends on them, and the TAP reporter is included when
+// its report is copied to TAPFile.
+func NewReporters(pltfrm, version string) (reporters.Reporters, error) {
+	formats := []string{"json"}
+	seen := map[string]bool{"json": true}
+	if TAPFile != "" {
+		formats = append(formats, "tap")
+		seen["tap"] = true
+	}
+	for _, format := range ReportFormats {
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	reps, err := reporters.NewReporters(formats, pltfrm, version)
+	if err != nil {
+		return nil, err
+	}
+	reps = append(reps, reporters.NewStreamReporter("events.jsonl", pltfrm, version))
+	if EventStream != "" {
+		// The suites of the reruns append to the stream of the run.
+		if eventStream == nil {
+			eventStream = reporters.NewSharedStreamReporter(EventStream, pltfrm, version)
+		}
+		reps = append(reps, eventStream)
+	}
+	return reps, nil
+}
+
+// eventStream streams the events of all the suites of this process to
+// EventStream.
+var eventStream interface {
+	reporters.StreamingReporter
+	Close() error
+}
+
+// CloseEventStream closes the EventStream once the run is over.
+func CloseEventStream() error {
+	if eventStream == nil {
+		return nil
+	}
+	err := eventStream.Close()
+	eventStream = nil
+	return err
+}
+
 func RunTests(patterns []string, multiply int, rerun bool, rerunSuccessTags []string, pltfrm, outputDir string) error {
+	defer CloseEventStream()
 	return runProvidedTests(register.Tests, patterns, multiply, rerun, rerunSuccessTags, pltfrm, outputDir)
 }
 
 func RunUpgradeTests(patterns []string, rerun bool, pltfrm, outputDir string) error {
+	defer CloseEventStream()
 	return runProvidedTests(register.UpgradeTests, patterns, 0, rerun, nil, pltfrm, outputDir)
 }
 
@@ -1017,6 +1077,8 @@ type externalTestMeta struct {
 	InstanceType              string   `json:"instanceType"                        yaml:"instanceType"`
 	Description               string   `json:"description"                         yaml:"description"`
 	BindMountHostRO           []string `json:"bindMountHostRO,omitempty"           yaml:"bindMountHostRO,omitempty"`
+	ReuseSnapshot             bool     `json:"reuseSnapshot,omitempty"             yaml:"reuseSnapshot,omitempty"`
+	PrivateNetwork            bool     `json:"privateNetwork,omitempty"            yaml:"privateNetwork,omitempty"`
 }
 
 // metadataFromTestBinary extracts JSON-in-comment like:
@@ -1176,6 +1238,12 @@ func registerExternalTest(testname, executable, dependencydir string, userdata *
 		targetMeta = &metaCopy
 	}
 
+	// Non-exclusive tests share the machine of their bucket, which
+	// doesn't reuse snapshots.
+	if targetMeta.ReuseSnapshot && !targetMeta.Exclusive {
+		return fmt.Errorf("test %v sets reuseSnapshot, which requires exclusive: true", testname)
+	}
+
 	warningsAction := conf.FailWarnings
 	if targetMeta.AllowConfigWarnings {
 		warningsAction = conf.IgnoreWarnings
@@ -1222,16 +1290,6 @@ ExecStart=%s
 	}
 	config.AddSystemdUnit(unitName, unit, conf.NoState)
 
-	// Architectures using 64k pages use slightly more memory, ask for more than requested
-	// to make sure that we don't run out of it. Currently, only ppc64le uses 64k pages by default.
-	// See similar logic in boot-mirror.go and luks.go.
-	switch Options.CosaBuildArch {
-	case "ppc64le":
-		if targetMeta.MinMemory <= 4096 {
-			targetMeta.MinMemory = targetMeta.MinMemory * 2
-		}
-	}
-
 	t := &register.Test{
 		Name:          testname,
 		Description:   targetMeta.Description,
@@ -1240,21 +1298,11 @@ ExecStart=%s
 		DependencyDir: destDirs,
 		Tags:          []string{"external"},
 
-		MachineOptions: platform.MachineOptions{
-			BindMountHostRO:           targetMeta.BindMountHostRO,
-			AdditionalDisks:           targetMeta.AdditionalDisks,
-			PrimaryDisk:               targetMeta.PrimaryDisk,
-			MinMemory:                 targetMeta.MinMemory,
-			NumaNodes:                 targetMeta.NumaNodes,
-			MinDiskSize:               targetMeta.MinDiskSize,
-			AdditionalNics:            targetMeta.AdditionalNics,
-			AppendKernelArgs:          targetMeta.AppendKernelArgs,
-			AppendFirstbootKernelArgs: targetMeta.AppendFirstbootKernelArgs,
-			InstanceType:              targetMeta.InstanceType,
-		},
+		MachineOptions:  targetMeta.machineOptions(),
 		InjectContainer: targetMeta.InjectContainer,
 		NonExclusive:    !targetMeta.Exclusive,
 		Conflicts:       targetMeta.Conflicts,
+		ReuseSnapshot:   targetMeta.ReuseSnapshot,
 
 		Run: func(c cluster.TestCluster) {
 			mach := c.Machines()[0]
@@ -1281,37 +1329,70 @@ ExecStart=%s
 		UserData: conf.Ignition(config.String()),
 		Timeout:  time.Duration(targetMeta.TimeoutMin) * time.Minute,
 	}
+	targetMeta.applyFilters(t)
 
+	register.RegisterTest(t)
+
+	return nil
+}
+
+// machineOptions returns the machine options requested by the metadata.
+func (meta *externalTestMeta) machineOptions() platform.MachineOptions {
+	minMemory := meta.MinMemory
+	// Architectures using 64k pages use slightly more memory, ask for more than requested
+	// to make sure that we don't run out of it. Currently, only ppc64le uses 64k pages by default.
+	// See similar logic in boot-mirror.go and luks.go.
+	switch Options.CosaBuildArch {
+	case "ppc64le":
+		if minMemory <= 4096 {
+			minMemory = minMemory * 2
+		}
+	}
+
+	return platform.MachineOptions{
+		BindMountHostRO:           meta.BindMountHostRO,
+		AdditionalDisks:           meta.AdditionalDisks,
+		PrimaryDisk:               meta.PrimaryDisk,
+		MinMemory:                 minMemory,
+		NumaNodes:                 meta.NumaNodes,
+		MinDiskSize:               meta.MinDiskSize,
+		AdditionalNics:            meta.AdditionalNics,
+		AppendKernelArgs:          meta.AppendKernelArgs,
+		AppendFirstbootKernelArgs: meta.AppendFirstbootKernelArgs,
+		InstanceType:              meta.InstanceType,
+		PrivateNetwork:            meta.PrivateNetwork,
+	}
+}
+
+// applyFilters sets the architectures, platforms, distros, tags and
+// flags of t from the metadata.
+func (meta *externalTestMeta) applyFilters(t *register.Test) {
 	// To avoid doubling the duplication here with register.Test, we support
 	// a ! prefix (inspired by systemd unit syntax), like:
 	//
 	// architectures: !ppc64le s390x
 	// platforms: aws qemu
-	if strings.HasPrefix(targetMeta.Architectures, "!") {
-		t.ExcludeArchitectures = strings.Fields(targetMeta.Architectures[1:])
+	if strings.HasPrefix(meta.Architectures, "!") {
+		t.ExcludeArchitectures = strings.Fields(meta.Architectures[1:])
 	} else {
-		t.Architectures = strings.Fields(targetMeta.Architectures)
+		t.Architectures = strings.Fields(meta.Architectures)
 	}
-	if strings.HasPrefix(targetMeta.Platforms, "!") {
-		t.ExcludePlatforms = strings.Fields(targetMeta.Platforms[1:])
+	if strings.HasPrefix(meta.Platforms, "!") {
+		t.ExcludePlatforms = strings.Fields(meta.Platforms[1:])
 	} else {
-		t.Platforms = strings.Fields(targetMeta.Platforms)
+		t.Platforms = strings.Fields(meta.Platforms)
 	}
-	if strings.HasPrefix(targetMeta.Distros, "!") {
-		t.ExcludeDistros = strings.Fields(targetMeta.Distros[1:])
+	if strings.HasPrefix(meta.Distros, "!") {
+		t.ExcludeDistros = strings.Fields(meta.Distros[1:])
 	} else {
-		t.Distros = strings.Fields(targetMeta.Distros)
+		t.Distros = strings.Fields(meta.Distros)
 	}
-	if targetMeta.NoInstanceCreds {
+	if meta.NoInstanceCreds {
 		t.Flags = append(t.Flags, register.NoInstanceCreds)
 	}
-	t.Tags = append(t.Tags, strings.Fields(targetMeta.Tags)...)
+	t.Tags = append(t.Tags, strings.Fields(meta.Tags)...)
 	// TODO validate tags here
-	t.RequiredTag = targetMeta.RequiredTag
-
-	register.RegisterTest(t)
-
-	return nil
+	t.RequiredTag = meta.RequiredTag
 }
 
 // testIsDenyListed returns true if the test was denied on the CLI. This is
@@ -1345,6 +1426,7 @@ func registerTestDir(dir, testprefix string, children []os.DirEntry) error {
 	var meta externalTestMeta
 	userdata := conf.EmptyIgnition()
 	executables := []string{}
+	declarative := []string{}
 	for _, e := range children {
 		c, err := e.Info()
 		if err != nil {
@@ -1404,6 +1486,8 @@ func registerTestDir(dir, testprefix string, children []os.DirEntry) error {
 			if err := registerTestDir(subdir, subprefix, subchildren); err != nil {
 				return err
 			}
+		} else if isreg && strings.HasSuffix(c.Name(), declarativeTestSuffix) {
+			declarative = append(declarative, fpath)
 		} else if isreg && (c.Mode().Perm()&0001) == 0 {
 			file, err := os.Open(filepath.Join(dir, c.Name()))
 			if err != nil {
@@ -1438,6 +1522,19 @@ func registerTestDir(dir, testprefix string, children []os.DirEntry) error {
 		}
 	}
 
+	for _, path := range declarative {
+		testname := fmt.Sprintf("%s.%s", testprefix, strings.TrimSuffix(filepath.Base(path), declarativeTestSuffix))
+		if denied, err := testIsDenyListed(testname); err != nil {
+			return err
+		} else if denied {
+			plog.Debugf("Skipping denylisted declarative test %s", testname)
+			continue
+		}
+		if err := registerDeclarativeTest(testname, path); err != nil {
+			return errors.Wrapf(err, "registering %s", path)
+		}
+	}
+
 	return nil
 }
 
@@ -1614,8 +1711,10 @@ func makeNonExclusiveTest(bucket int, tests []*register.Test, flight platform.Fl
 	var nonExclusiveTestConfs []*conf.Conf
 	dependencyDirs := make(register.DepDirMap)
 	var subtests []string
+	var collectors []register.DiagnosticCollector
 	for _, test := range tests {
 		subtests = append(subtests, test.Name)
+		collectors = append(collectors, test.DiagnosticCollectors...)
 		if test.HasFlag(register.NoSSHKeyInMetadata) || test.HasFlag(register.NoSSHKeyInUserData) {
 			plog.Fatalf("Non-exclusive test %v cannot have NoSSHKeyIn* flag", test.Name)
 		}
@@ -1628,6 +1727,9 @@ func makeNonExclusiveTest(bucket int, tests []*register.Test, flight platform.Fl
 		if !reflect.DeepEqual(test.MachineOptions, platform.MachineOptions{}) {
 			plog.Fatalf("Non-exclusive test %v cannot have MachineOptions set", test.Name)
 		}
+		if test.ReuseSnapshot {
+			plog.Fatalf("Non-exclusive test %v cannot have ReuseSnapshot set", test.Name)
+		}
 		if !internetAccess && testRequiresInternet(test) {
 			tags = append(tags, NeedsInternetTag)
 			internetAccess = true
@@ -1693,10 +1795,11 @@ func makeNonExclusiveTest(bucket int, tests []*register.Test, flight platform.Fl
 		UserData: mergedConfig,
 		Subtests: subtests,
 		// This will allow runTest to copy kolet to machine
-		NativeFuncs:   make(map[string]register.NativeFuncWrap),
-		ClusterSize:   1,
-		Tags:          tags,
-		DependencyDir: dependencyDirs,
+		NativeFuncs:          make(map[string]register.NativeFuncWrap),
+		ClusterSize:          1,
+		Tags:                 tags,
+		DependencyDir:        dependencyDirs,
+		DiagnosticCollectors: collectors,
 	}
 
 	return nonExclusiveWrapper
@@ -1829,11 +1932,22 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 	}
 	defer func() {
 		h.StopExecTimer()
+		// Gather diagnostics from the failed test while its machines are still up
+		var diags *diagnostics
+		if h.Failed() {
+			diags = collectDiagnostics(rconf.OutputDir, t, c.Machines())
+		}
 		// give some time for the remote journal to be flushed before we Destroy()
 		time.Sleep(2 * time.Second)
 		c.Destroy()
 		// Release the memory reservation (if there was one) now that the VM is gone.
 		releaseMemoryCount(flight, t)
+		if diags != nil {
+			diags.addConsoleMatches(c.ConsoleOutput(), c.JournalOutput())
+			if err := diags.finish(); err != nil {
+				plog.Warningf("Failed to write diagnostics for %s: %v", t.Name, err)
+			}
+		}
 		if h.TimedOut() {
 			// We'll allow tests that time out to succeed on rerun.
 			markTestForRerunSuccess(t, "Test timed out.")
@@ -1871,6 +1985,9 @@ func runTest(h *harness.H, t *register.Test, pltfrm string, flight platform.Flig
 		if testSecureBoot(t) {
 			options.Firmware = "uefi-secure"
 		}
+		if t.ReuseSnapshot && pltfrm == "qemu" {
+			options.ReuseSnapshot = true
+		}
 
 		// Providers sometimes fail to bring up a machine within a
 		// reasonable time frame. Let's try twice and then bail if
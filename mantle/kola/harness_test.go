@@ -0,0 +1,64 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/coreos/coreos-assembler/mantle/harness"
+)
+
+func TestTAPFile(t *testing.T) {
+	dir := t.TempDir()
+	defer func(tapFile string) { TAPFile = tapFile }(TAPFile)
+	TAPFile = filepath.Join(dir, "results.tap")
+
+	reps, err := NewReporters("qemu", "1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests harness.Tests
+	tests.Add("pass", func(h *harness.H) {}, 0)
+	tests.Add("fail", func(h *harness.H) { h.Fatal("broken") }, 0)
+	outputDir := filepath.Join(dir, "output")
+	suite := harness.NewSuite(harness.Options{
+		OutputDir: outputDir,
+		Parallel:  1,
+		Reporters: reps,
+	}, tests)
+	if err := suite.Run(); err != harness.SuiteFailed {
+		t.Fatalf("expected the suite to fail, got %v", err)
+	}
+	if err := copyTAPReport(outputDir); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(TAPFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tap := string(data)
+	if !strings.HasPrefix(tap, "TAP version 14\n1..2\n") {
+		t.Errorf("unexpected TAP header:\n%s", tap)
+	}
+	for _, line := range []string{"not ok 1 - fail\n", "ok 2 - pass\n", ": broken\n"} {
+		if !strings.Contains(tap, line) {
+			t.Errorf("missing %q in TAP report:\n%s", line, tap)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package history keeps a record of kola test results across runs so
+// that flaky and regressing tests can be identified from data rather
+// than from a single run.
+//
+// The store is a JSON lines file, one Record per test per run, which
+// is only ever appended to.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/harness/reporters"
+	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
+)
+
+// recentRuns is the number of most recent runs used for duration trends.
+const recentRuns = 5
+
+var (
+	nonexclusiveWrapperMatch = regexp.MustCompile(`^non-exclusive-test-bucket-[0-9]+$`)
+	nonexclusivePrefixMatch  = regexp.MustCompile(`^non-exclusive-test-bucket-[0-9]+/`)
+)
+
+// Record is the result of a single test in a single kola run.
+type Record struct {
+	Time     time.Time             `json:"time"`
+	Test     string                `json:"test"`
+	BuildID  string                `json:"build"`
+	Arch     string                `json:"arch"`
+	Platform string                `json:"platform"`
+	Result   testresult.TestResult `json:"result"`
+	Duration time.Duration         `json:"duration"`
+	// RerunResult is the result of the test when it was re-run after
+	// failing, or empty if it was not re-run.
+	RerunResult testresult.TestResult `json:"rerun_result,omitempty"`
+}
+
+// Flaked reports whether the test failed but then passed when re-run.
+func (r Record) Flaked() bool {
+	return r.Result == testresult.Fail && r.RerunResult == testresult.Pass
+}
+
+// RecordsFromRun builds the records for the kola run whose output is in
+// outputDir, merging in the results of the re-run of failed tests if
+// there was one. Non-exclusive test buckets are replaced by the tests
+// they contain, and subtests of other tests are not recorded.
+func RecordsFromRun(outputDir, buildID, arch, platform string, now time.Time) ([]Record, error) {
+	report, err := reporters.DeserialiseReport(filepath.Join(outputDir, "reports", "report.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	rerun := make(map[string]testresult.TestResult)
+	rerunReport, err := reporters.DeserialiseReport(filepath.Join(outputDir, "rerun", "reports", "report.json"))
+	if err == nil {
+		for _, t := range rerunReport.Tests {
+			if name, ok := recordedName(t.Name); ok {
+				rerun[name] = t.Result
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var records []Record
+	for _, t := range report.Tests {
+		name, ok := recordedName(t.Name)
+		if !ok {
+			continue
+		}
+		records = append(records, Record{
+			Time:        now,
+			Test:        name,
+			BuildID:     buildID,
+			Arch:        arch,
+			Platform:    platform,
+			Result:      t.Result,
+			Duration:    t.Duration,
+			RerunResult: rerun[name],
+		})
+	}
+	return records, nil
+}
+
+// recordedName returns the name a test is recorded under and whether
+// it should be recorded at all.
+func recordedName(name string) (string, bool) {
+	if nonexclusiveWrapperMatch.MatchString(name) {
+		return "", false
+	}
+	if nonexclusivePrefixMatch.MatchString(name) {
+		name = nonexclusivePrefixMatch.ReplaceAllString(name, "")
+	}
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+	return name, true
+}
+
+// Append adds records to the history file at path, creating it if needed.
+func Append(path string, records []Record) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads all records from the history file at path, sorted by time.
+func Load(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+// Filter selects records; empty fields match everything.
+type Filter struct {
+	Patterns []string
+	Platform string
+	Arch     string
+	Since    time.Time
+}
+
+// Match reports whether r is selected by the filter.
+func (f Filter) Match(r Record) (bool, error) {
+	if f.Platform != "" && r.Platform != f.Platform {
+		return false, nil
+	}
+	if f.Arch != "" && r.Arch != f.Arch {
+		return false, nil
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false, nil
+	}
+	if len(f.Patterns) == 0 {
+		return true, nil
+	}
+	for _, pattern := range f.Patterns {
+		match, err := filepath.Match(pattern, r.Test)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// TestStats summarizes the history of a single test.
+type TestStats struct {
+	Test     string `json:"test"`
+	Runs     int    `json:"runs"`
+	Passes   int    `json:"passes"`
+	Failures int    `json:"failures"`
+	Warnings int    `json:"warnings"`
+	Skips    int    `json:"skips"`
+	// Flakes counts the runs in which the test failed and then passed
+	// when re-run; they are also counted in Failures.
+	Flakes int `json:"flakes"`
+
+	// FlakeRate and FailureRate are relative to the runs which were
+	// not skipped.
+	FlakeRate   float64 `json:"flake_rate"`
+	FailureRate float64 `json:"failure_rate"`
+
+	// MeanDuration is over all runs which were not skipped, and
+	// RecentDuration over the last few of them.
+	MeanDuration   time.Duration `json:"mean_duration"`
+	RecentDuration time.Duration `json:"recent_duration"`
+
+	LastResult testresult.TestResult `json:"last_result"`
+	LastBuild  string                `json:"last_build"`
+	// FirstFailingBuild is the build in which the current streak of
+	// failures started, or empty if the test last passed.
+	FirstFailingBuild string `json:"first_failing_build,omitempty"`
+}
+
+// Summarize computes per test statistics from records sorted by time.
+// The result is sorted by test name.
+func Summarize(records []Record) []TestStats {
+	byTest := make(map[string][]Record)
+	for _, r := range records {
+		byTest[r.Test] = append(byTest[r.Test], r)
+	}
+
+	stats := make([]TestStats, 0, len(byTest))
+	for name, runs := range byTest {
+		stats = append(stats, summarizeTest(name, runs))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Test < stats[j].Test
+	})
+	return stats
+}
+
+func summarizeTest(name string, runs []Record) TestStats {
+	s := TestStats{Test: name, Runs: len(runs)}
+
+	var durations []time.Duration
+	for _, r := range runs {
+		switch r.Result {
+		case testresult.Pass:
+			s.Passes++
+		case testresult.Fail:
+			s.Failures++
+			if r.Flaked() {
+				s.Flakes++
+			}
+		case testresult.Warn:
+			s.Warnings++
+		case testresult.Skip:
+			s.Skips++
+			continue
+		}
+		durations = append(durations, r.Duration)
+
+		// A warning is a failure that was tolerated; it does not
+		// break a failure streak but does not start one either.
+		failed := r.Result == testresult.Fail && !r.Flaked()
+		if failed && s.FirstFailingBuild == "" {
+			s.FirstFailingBuild = r.BuildID
+		} else if r.Result == testresult.Pass || r.Flaked() {
+			s.FirstFailingBuild = ""
+		}
+	}
+
+	last := runs[len(runs)-1]
+	s.LastResult = last.Result
+	s.LastBuild = last.BuildID
+
+	if n := len(durations); n > 0 {
+		s.FlakeRate = float64(s.Flakes) / float64(n)
+		s.FailureRate = float64(s.Failures) / float64(n)
+		s.MeanDuration = meanDuration(durations)
+		s.RecentDuration = meanDuration(durations[max(0, n-recentRuns):])
+	}
+	return s
+}
+
+func meanDuration(durations []time.Duration) time.Duration {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
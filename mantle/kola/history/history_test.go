@@ -0,0 +1,110 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/coreos-assembler/mantle/harness/testresult"
+)
+
+func writeReport(t *testing.T, dir, report string) {
+	if err := os.MkdirAll(filepath.Join(dir, "reports"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "reports", "report.json"), []byte(report), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordsFromRun(t *testing.T) {
+	dir := t.TempDir()
+	writeReport(t, dir, `{"tests": [
+		{"name": "basic", "result": "PASS", "duration": 1000},
+		{"name": "basic/sub", "result": "PASS", "duration": 500},
+		{"name": "non-exclusive-test-bucket-0", "result": "FAIL", "duration": 3000},
+		{"name": "non-exclusive-test-bucket-0/ext.config.flaky", "result": "FAIL", "duration": 2000}
+	], "result": "FAIL", "platform": "qemu"}`)
+	writeReport(t, filepath.Join(dir, "rerun"), `{"tests": [
+		{"name": "non-exclusive-test-bucket-0/ext.config.flaky", "result": "PASS", "duration": 2000}
+	], "result": "PASS", "platform": "qemu"}`)
+
+	records, err := RecordsFromRun(dir, "42.1", "x86_64", "qemu", time.Unix(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %+v", records)
+	}
+	if records[0].Test != "basic" || records[0].RerunResult != "" {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+	if records[1].Test != "ext.config.flaky" || !records[1].Flaked() {
+		t.Errorf("unexpected record %+v", records[1])
+	}
+}
+
+func TestAppendLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "history.jsonl")
+	later := Record{Time: time.Unix(200, 0).UTC(), Test: "a", Result: testresult.Pass}
+	earlier := Record{Time: time.Unix(100, 0).UTC(), Test: "a", Result: testresult.Fail}
+	if err := Append(path, []Record{later}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(path, []Record{earlier}); err != nil {
+		t.Fatal(err)
+	}
+	records, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0] != earlier || records[1] != later {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	run := func(build string, result, rerun testresult.TestResult, d time.Duration) Record {
+		return Record{Test: "t", BuildID: build, Result: result, RerunResult: rerun, Duration: d * time.Second}
+	}
+	records := []Record{
+		run("1", testresult.Pass, "", 10),
+		run("2", testresult.Fail, testresult.Pass, 20),
+		run("3", testresult.Skip, "", 0),
+		run("4", testresult.Fail, testresult.Fail, 30),
+		run("5", testresult.Warn, "", 20),
+		run("6", testresult.Fail, "", 40),
+	}
+	stats := Summarize(records)
+	if len(stats) != 1 {
+		t.Fatalf("expected 1 test, got %d", len(stats))
+	}
+	s := stats[0]
+	if s.Runs != 6 || s.Passes != 1 || s.Failures != 3 || s.Flakes != 1 || s.Skips != 1 || s.Warnings != 1 {
+		t.Errorf("unexpected counts %+v", s)
+	}
+	if s.FlakeRate != 0.2 || s.FailureRate != 0.6 {
+		t.Errorf("unexpected rates %+v", s)
+	}
+	if s.MeanDuration != 24*time.Second {
+		t.Errorf("unexpected mean duration %v", s.MeanDuration)
+	}
+	if s.FirstFailingBuild != "4" || s.LastBuild != "6" || s.LastResult != testresult.Fail {
+		t.Errorf("unexpected failure streak %+v", s)
+	}
+}
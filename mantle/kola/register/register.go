@@ -15,6 +15,7 @@
 package register
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -100,6 +101,37 @@ type Test struct {
 	// Conflicts is non-empty iff nonexclusive is true
 	// Contains the tests that conflict with this particular test
 	Conflicts []string
+
+	// ReuseSnapshot marks the test as not depending on the first boot of
+	// its machines, so that on QEMU with --qemu-snapshot-reuse they may
+	// start from a snapshot of an identical machine booted earlier in
+	// the run rather than from the image.
+	ReuseSnapshot bool
+
+	// DiagnosticCollectors gather test specific data from each machine
+	// when the test fails, in addition to the standard diagnostics.
+	DiagnosticCollectors []DiagnosticCollector
+}
+
+// DiagnosticCollector gathers data from a machine of a failed test
+// before it is destroyed. It returns files, keyed by name, which are
+// added to the machine's directory in the diagnostics bundle. It must
+// give up when ctx, which bounds all the collectors of the machine, is
+// done.
+type DiagnosticCollector func(ctx context.Context, m platform.Machine) (map[string][]byte, error)
+
+// CommandCollector returns a DiagnosticCollector which runs cmd over
+// SSH and stores its combined stdout and stderr in the file name.
+func CommandCollector(name, cmd string) DiagnosticCollector {
+	return func(ctx context.Context, m platform.Machine) (map[string][]byte, error) {
+		stdout, stderr, err := platform.SSHContext(ctx, m, cmd)
+		out := append(stdout, stderr...)
+		if err != nil {
+			// Keep whatever the command printed, it may explain the error.
+			return map[string][]byte{name: out}, fmt.Errorf("%q failed: %v", cmd, err)
+		}
+		return map[string][]byte{name: out}, nil
+	}
 }
 
 // Registered tests that run as part of `kola run` live here. Mapping of names
@@ -25,6 +25,7 @@ import (
 	"github.com/coreos/coreos-assembler/mantle/kola"
 	"github.com/coreos/coreos-assembler/mantle/kola/cluster"
 	"github.com/coreos/coreos-assembler/mantle/kola/register"
+	"github.com/coreos/coreos-assembler/mantle/platform"
 	"github.com/coreos/coreos-assembler/mantle/platform/conf"
 	"github.com/coreos/coreos-assembler/mantle/util"
 )
@@ -55,8 +56,9 @@ func init() {
 }`),
 		Tags:    []string{kola.NeedsInternetTag}, // fetching etcd requires networking
 		Distros: []string{"rhcos"},
-		// qemu machines cannot communicate between each other
-		ExcludePlatforms: []string{"qemu"},
+		MachineOptions: platform.MachineOptions{
+			PrivateNetwork: true,
+		},
 	})
 	register.RegisterTest(&register.Test{
 		Run:         rhcosClusterTLS,
@@ -90,8 +92,9 @@ func init() {
 }`),
 		Tags:    []string{kola.NeedsInternetTag}, // fetching etcd requires networking
 		Distros: []string{"rhcos"},
-		// qemu machines cannot communicate between each other
-		ExcludePlatforms: []string{"qemu"},
+		MachineOptions: platform.MachineOptions{
+			PrivateNetwork: true,
+		},
 	})
 }
 
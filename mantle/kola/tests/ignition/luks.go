@@ -22,13 +22,14 @@ func init() {
 	// Create 0 cluster size to allow starting and setup of Tang as needed per test
 	// See: https://github.com/coreos/coreos-assembler/pull/1310#discussion_r401908836
 	register.RegisterTest(&register.Test{
-		Run:         luksTangTest,
-		ClusterSize: 0,
-		Name:        `luks.tang`,
-		Description: "Verify that the rootfs is encrypted with Tang.",
-		Flags:       []register.Flag{},
-		Distros:     []string{"rhcos"},
-		Tags:        []string{"luks", "tang", kola.NeedsInternetTag, "reprovision"},
+		Run:                  luksTangTest,
+		ClusterSize:          0,
+		Name:                 `luks.tang`,
+		Description:          "Verify that the rootfs is encrypted with Tang.",
+		Flags:                []register.Flag{},
+		Distros:              []string{"rhcos"},
+		Tags:                 []string{"luks", "tang", kola.NeedsInternetTag, "reprovision"},
+		DiagnosticCollectors: ut.LUKSDiagnosticCollectors,
 	})
 	register.RegisterTest(&register.Test{
 		Run:                  luksSSST1Test,
@@ -40,6 +41,7 @@ func init() {
 		Platforms:            []string{"qemu"},
 		ExcludeArchitectures: []string{"s390x"}, // no TPM backend support for s390x
 		Tags:                 []string{"luks", "tpm", "tang", "sss", kola.NeedsInternetTag, "reprovision"},
+		DiagnosticCollectors: ut.LUKSDiagnosticCollectors,
 	})
 	register.RegisterTest(&register.Test{
 		Run:                  luksSSST2Test,
@@ -51,16 +53,18 @@ func init() {
 		Platforms:            []string{"qemu"},
 		ExcludeArchitectures: []string{"s390x"}, // no TPM backend support for s390x
 		Tags:                 []string{"luks", "tpm", "tang", "sss", kola.NeedsInternetTag, "reprovision"},
+		DiagnosticCollectors: ut.LUKSDiagnosticCollectors,
 	})
 	register.RegisterTest(&register.Test{
-		Run:           runCexTest,
-		ClusterSize:   0,
-		Name:          `luks.cex`,
-		Description:   "Verify that CEX-based rootfs encryption works.",
-		Flags:         []register.Flag{},
-		Platforms:     []string{"qemu"},
-		Architectures: []string{"s390x"},
-		Tags:          []string{"luks", "cex", "reprovision"},
+		Run:                  runCexTest,
+		ClusterSize:          0,
+		Name:                 `luks.cex`,
+		Description:          "Verify that CEX-based rootfs encryption works.",
+		Flags:                []register.Flag{},
+		Platforms:            []string{"qemu"},
+		Architectures:        []string{"s390x"},
+		Tags:                 []string{"luks", "cex", "reprovision"},
+		DiagnosticCollectors: ut.LUKSDiagnosticCollectors,
 		NativeFuncs: map[string]register.NativeFuncWrap{
 			"RHCOSGrowpart": register.CreateNativeFuncWrap(coretest.TestRHCOSGrowfs, []string{"fcos"}...),
 			"FCOSGrowpart":  register.CreateNativeFuncWrap(coretest.TestFCOSGrowfs, []string{"rhcos"}...),
@@ -111,6 +111,12 @@ version: 1.6.0
 kernel_arguments:
   should_exist:
     - rd.multipath=default`)
+
+	// multipathCollectors capture the multipath topology when a test fails
+	multipathCollectors = []register.DiagnosticCollector{
+		register.CommandCollector("multipath.txt", "sudo multipath -ll"),
+		register.CommandCollector("lsblk.txt", "lsblk -o NAME,KNAME,TYPE,SIZE,WWN,MOUNTPOINTS"),
+	}
 )
 
 func init() {
@@ -124,6 +130,7 @@ func init() {
 		MachineOptions: platform.MachineOptions{
 			MultiPathDisk: true,
 		},
+		DiagnosticCollectors: multipathCollectors,
 	})
 	register.RegisterTest(&register.Test{
 		Name:        "multipath.day2",
@@ -134,6 +141,7 @@ func init() {
 		MachineOptions: platform.MachineOptions{
 			MultiPathDisk: true,
 		},
+		DiagnosticCollectors: multipathCollectors,
 	})
 	register.RegisterTest(&register.Test{
 		Name:        "multipath.partition",
@@ -145,6 +153,7 @@ func init() {
 		MachineOptions: platform.MachineOptions{
 			AdditionalDisks: []string{"1G:mpath,wwn=1"},
 		},
+		DiagnosticCollectors: multipathCollectors,
 	})
 	// See https://issues.redhat.com/browse/OCPBUGS-56597
 	register.RegisterTest(&register.Test{
@@ -157,6 +166,7 @@ func init() {
 		MachineOptions: platform.MachineOptions{
 			MultiPathDisk: true,
 		},
+		DiagnosticCollectors: multipathCollectors,
 	})
 }
 
@@ -15,59 +15,43 @@
 package upgrade
 
 import (
+	"encoding/base64"
 	"fmt"
-	"net/http"
 	"path/filepath"
-	"strings"
 	"time"
 
-	"github.com/coreos/pkg/capnslog"
-
 	"github.com/coreos/coreos-assembler/mantle/kola"
 	"github.com/coreos/coreos-assembler/mantle/kola/cluster"
 	"github.com/coreos/coreos-assembler/mantle/kola/register"
 	"github.com/coreos/coreos-assembler/mantle/kola/tests/util"
+	"github.com/coreos/coreos-assembler/mantle/kola/updateserver"
 	"github.com/coreos/coreos-assembler/mantle/platform"
 	"github.com/coreos/coreos-assembler/mantle/platform/conf"
 )
 
-const workdir = "/var/srv/upgrade"
-const ostreeRepo = workdir + "/repo"
-
-var plog = capnslog.NewPackageLogger("github.com/coreos/coreos-assembler/mantle", "kola/tests/upgrade")
+// updateServerImage is the name of the repository the update server
+// serves the build's container image as.
+const updateServerImage = "coreos"
 
 func init() {
 	register.RegisterUpgradeTest(&register.Test{
 		Run:         fcosUpgradeBasic,
 		ClusterSize: 1,
-		// if renaming this, also rename the command in kolet-httpd.service below
-		Name:     "fcos.upgrade.basic",
-		FailFast: true,
-		NativeFuncs: map[string]register.NativeFuncWrap{
-			"httpd": register.CreateNativeFuncWrap(httpd),
-		},
-		Tags:    []string{"upgrade"},
-		Distros: []string{"fcos"},
+		Name:        "fcos.upgrade.basic",
+		FailFast:    true,
+		Tags:        []string{"upgrade"},
+		Distros:     []string{"fcos"},
 		// This Ignition does a few things:
 		// 1. bumps Zincati verbosity
-		// 2. auto-runs httpd once kolet is scp'ed
-		// 3. changes the Zincati config to point to localhost:8080 so we'll be
-		//    able to feed the update graph we want
-		// 4. changes the Zincati config to have a 99-updates-enabled.toml config
+		// 2. changes the Zincati config to have a 99-updates-enabled.toml config
 		//    that overrides any previous config that would have disabled them like
 		//    the following that are dropped in various scenarios:
 		//      - 90-disable-auto-updates.toml
 		//      - 90-disable-on-non-production-stream.toml
 		//      - 95-disable-on-dev.toml
-		// 5. disables zincati.service in Ignition so we can finish setting it up here
+		// 3. disables zincati.service in Ignition so we can finish setting it up here
 		//    before starting it again without risking race conditions
-		// 6. change the OSTree remote to localhost:8080
-		// We could use file:/// to simplify things though using a URL at least
-		// exercises the ostree/libcurl stack.
-		// We use strings.Replace here because fmt.Sprintf would try to
-		// interpret the percent signs and there's too many of them to be worth
-		// escaping.
-		UserData: conf.Ignition(strings.Replace(`{
+		UserData: conf.Ignition(`{
   "ignition": { "version": "3.0.0" },
   "systemd": {
     "units": [
@@ -78,25 +62,11 @@ func init() {
           "name": "verbose.conf",
           "contents": "[Service]\nEnvironment=ZINCATI_VERBOSITY=\"-vvvv\""
         }]
-      },
-      {
-        "name": "kolet-httpd.path",
-        "enabled": true,
-        "contents": "[Path]\nPathExists=/usr/local/bin/kolet\n[Install]\nWantedBy=multi-user.target"
-      },
-      {
-        "name": "kolet-httpd.service",
-        "contents": "[Service]\nExecStart=/usr/local/bin/kolet run fcos.upgrade.basic httpd -v\n[Install]\nWantedBy=multi-user.target"
       }
     ]
   },
   "storage": {
     "files": [
-      {
-        "path": "/etc/zincati/config.d/99-cincinnati-url.toml",
-        "contents": { "source": "data:,cincinnati.base_url%3D%20%22http%3A%2F%2Flocalhost%3A8080%22%0A" },
-        "mode": 420
-      },
       {
         "path": "/etc/zincati/config.d/99-updates-enabled.toml",
         "contents": { "source": "data:,updates.enabled%20%3D%20true%0A" },
@@ -106,25 +76,10 @@ func init() {
         "path": "/etc/zincati/config.d/99-agent-timing-speedup.toml",
         "contents": { "source": "data:,agent.timing.steady_interval_secs%20%3D%2020%0A" },
         "mode": 420
-      },
-      {
-        "path": "/etc/ostree/remotes.d/fedora.conf",
-        "contents": { "source": "data:,%5Bremote%20%22fedora%22%5D%0Aurl%3Dhttp%3A%2F%2Flocalhost%3A8080%0Agpg-verify%3Dfalse%0A" },
-        "overwrite": true,
-        "mode": 420
-      }
-    ],
-    "directories": [
-      {
-        "path": "WORKDIR",
-        "mode": 493,
-        "user": {
-          "name": "core"
-        }
       }
     ]
   }
-}`, "WORKDIR", workdir, -1)),
+}`),
 	})
 }
 
@@ -137,12 +92,33 @@ func fcosUpgradeBasic(c cluster.TestCluster) {
 
 	sourceContainerRef := fmt.Sprintf("ostree-unverified-image:oci-archive:%s", containerImageFilename)
 
+	// On QEMU, the guest pulls the container image from the registry of
+	// the kola update server on the host.
+	var s *updateserver.Server
+	if c.Platform() == "qemu" {
+		var err error
+		s, err = updateserver.New("")
+		if err != nil {
+			c.Fatal(err)
+		}
+		defer s.Close()
+	}
+
 	c.Run("setup", func(c cluster.TestCluster) {
-		// this is the only heavy-weight part, though remember this test is
-		// optimized for qemu testing locally where this won't leave localhost at
-		// all. cloud testing should mostly be a pipeline thing, where the infra
-		// connection should be much faster
 		ociArchivePath := filepath.Join(kola.CosaBuild.Dir, containerImageFilename)
+
+		if s != nil {
+			if err := s.AddOCIArchive(updateServerImage, ociArchivePath); err != nil {
+				c.Fatal(err)
+			}
+			writeFile(c, m, "/etc/containers/registries.conf.d/99-kola-updateserver.conf", s.RegistriesConf())
+			sourceContainerRef = fmt.Sprintf("ostree-unverified-registry:%s/%s:%s", s.GuestRegistry(), updateServerImage, kola.CosaBuild.Meta.OstreeVersion)
+			return
+		}
+
+		// this is the only heavy-weight part, though remember cloud testing
+		// should mostly be a pipeline thing, where the infra connection
+		// should be much faster
 		if err := cluster.DropFile(c.Machines(), ociArchivePath); err != nil {
 			c.Fatal(err)
 		}
@@ -159,11 +135,10 @@ func fcosUpgradeBasic(c cluster.TestCluster) {
 		rpmostreeRebase(c, m, sourceContainerRef, version)
 	})
 
-	// Now, synthesize an update and serve that -- this is similar to
+	// Now, synthesize an update -- this is similar to
 	// `rpmostree.upgrade-rollback`, but the major difference here is that the
-	// starting disk is the previous release (and also, we're doing this via
-	// Zincati & HTTP). Essentially, this sanity-checks that old starting state
-	// + new content set can update.
+	// starting disk is the previous release. Essentially, this sanity-checks
+	// that old starting state + new content set can update.
 
 	c.Run("upgrade-from-current", func(c cluster.TestCluster) {
 		newVersion := kola.CosaBuild.Meta.OstreeVersion + ".kola"
@@ -230,11 +205,8 @@ func rpmostreeRebase(c cluster.TestCluster, m platform.Machine, ref, version str
 	})
 }
 
-func httpd() error {
-	http.Handle("/", http.FileServer(http.Dir(ostreeRepo)))
-	http.HandleFunc("/v1/graph", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "/var/home/core/graph.json")
-	})
-	plog.Info("Starting server")
-	return http.ListenAndServe("localhost:8080", nil)
+// writeFile writes contents to path on m.
+func writeFile(c cluster.TestCluster, m platform.Machine, path, contents string) {
+	c.RunCmdSyncf(m, "echo %s | base64 -d | sudo tee %s >/dev/null",
+		base64.StdEncoding.EncodeToString([]byte(contents)), path)
 }
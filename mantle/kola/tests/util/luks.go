@@ -17,9 +17,18 @@ import (
 	"regexp"
 
 	"github.com/coreos/coreos-assembler/mantle/kola/cluster"
+	"github.com/coreos/coreos-assembler/mantle/kola/register"
 	"github.com/coreos/coreos-assembler/mantle/platform"
 )
 
+// LUKSDiagnosticCollectors capture the state of the encrypted root
+// device when a LUKS test fails.
+var LUKSDiagnosticCollectors = []register.DiagnosticCollector{
+	register.CommandCollector("cryptsetup-status.txt", "sudo cryptsetup status root"),
+	register.CommandCollector("clevis-luks-list.txt", "sudo sh -c 'clevis luks list -d $(cryptsetup status root | sed -n \"s/ *device: *//p\")'"),
+	register.CommandCollector("lsblk.txt", "lsblk -o NAME,KNAME,TYPE,FSTYPE,SIZE,MOUNTPOINTS"),
+}
+
 // TangServer contains fields required to set up a tang server
 // Note: Placing it here to avoid circular dependency issue
 type TangServer struct {
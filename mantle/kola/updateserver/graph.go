@@ -0,0 +1,183 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updateserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// Metadata keys of the Fedora CoreOS update graph, as read by Zincati.
+const (
+	schemeKey        = "org.fedoraproject.coreos.scheme"
+	ageIndexKey      = "org.fedoraproject.coreos.releases.age_index"
+	deadendKey       = "org.fedoraproject.coreos.updates.deadend"
+	deadendReasonKey = "org.fedoraproject.coreos.updates.deadend_reason"
+)
+
+// Release is a node of the update graph.
+type Release struct {
+	Version string
+	// Payload is the OSTree commit of the release.
+	Payload string
+	// Barrier releases must be updated to by all older releases before
+	// they can update further, so older releases have no edges past
+	// them.
+	Barrier bool
+	// Deadend releases have no updates.
+	Deadend bool
+	// Metadata is added to the metadata of the node.
+	Metadata map[string]string
+}
+
+// Graph is a Cincinnati update graph. Releases are ordered from oldest
+// to newest, and each has an update to every newer release up to and
+// including the next barrier.
+type Graph struct {
+	Releases []Release
+}
+
+// graphNode and graphDoc are the Cincinnati wire format.
+type graphNode struct {
+	Version  string            `json:"version"`
+	Payload  string            `json:"payload"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+type graphDoc struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges [][2]int    `json:"edges"`
+}
+
+func (g *Graph) validate() error {
+	seen := make(map[string]bool)
+	for _, r := range g.Releases {
+		if r.Version == "" || r.Payload == "" {
+			return fmt.Errorf("releases need a version and a payload")
+		}
+		if seen[r.Version] {
+			return fmt.Errorf("duplicate release %s", r.Version)
+		}
+		seen[r.Version] = true
+	}
+	return nil
+}
+
+// Edges returns the updates of the graph, as pairs of indexes of
+// Releases.
+func (g *Graph) Edges() [][2]int {
+	var edges [][2]int
+	for i, from := range g.Releases {
+		if from.Deadend {
+			continue
+		}
+		for j := i + 1; j < len(g.Releases); j++ {
+			edges = append(edges, [2]int{i, j})
+			if g.Releases[j].Barrier {
+				break
+			}
+		}
+	}
+	return edges
+}
+
+// UpdatePath returns the versions a client on version from goes through
+// when it always updates to the newest release available, as Zincati
+// does, ending with the newest release it can reach.
+func (g *Graph) UpdatePath(from string) ([]string, error) {
+	cur := -1
+	for i, r := range g.Releases {
+		if r.Version == from {
+			cur = i
+		}
+	}
+	if cur < 0 {
+		return nil, fmt.Errorf("release %s is not in the graph", from)
+	}
+	next := make(map[int]int)
+	for _, e := range g.Edges() {
+		if e[1] > next[e[0]] {
+			next[e[0]] = e[1]
+		}
+	}
+	var path []string
+	for {
+		n, ok := next[cur]
+		if !ok {
+			return path, nil
+		}
+		cur = n
+		path = append(path, g.Releases[cur].Version)
+	}
+}
+
+// document renders the graph in the Cincinnati format.
+func (g *Graph) document() graphDoc {
+	doc := graphDoc{Nodes: []graphNode{}, Edges: g.Edges()}
+	if doc.Edges == nil {
+		doc.Edges = [][2]int{}
+	}
+	for i, r := range g.Releases {
+		metadata := map[string]string{
+			schemeKey:   "checksum",
+			ageIndexKey: strconv.Itoa(i),
+		}
+		if r.Deadend {
+			metadata[deadendKey] = "true"
+			metadata[deadendReasonKey] = "deadend release"
+		}
+		for k, v := range r.Metadata {
+			metadata[k] = v
+		}
+		doc.Nodes = append(doc.Nodes, graphNode{
+			Version:  r.Version,
+			Payload:  r.Payload,
+			Metadata: metadata,
+		})
+	}
+	return doc
+}
+
+// SetGraph replaces the update graph served; setting a graph with more
+// releases releases them to the clients.
+func (s *Server) SetGraph(g Graph) error {
+	if err := g.validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.graph = &g
+	return nil
+}
+
+// serveGraph serves the graph regardless of the query parameters
+// identifying the client, such as the stream and architecture.
+func (s *Server) serveGraph(w http.ResponseWriter, r *http.Request) {
+	if !readOnly(w, r) {
+		return
+	}
+	s.mu.RLock()
+	g := s.graph
+	s.mu.RUnlock()
+	if g == nil {
+		g = &Graph{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(g.document()); err != nil {
+		plog.Debugf("Serving graph: %v", err)
+	}
+}
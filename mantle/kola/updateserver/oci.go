@@ -0,0 +1,247 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updateserver
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// registryPath matches the registry API paths served: manifests and
+// blobs of a repository.
+var registryPath = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs)/([^/]+)$`)
+
+// ociDescriptor is an OCI content descriptor.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociArchive is an OCI image layout in a tar archive, such as the
+// ostree container image of a cosa build. The archive isn't extracted;
+// blobs are served from their offsets in it.
+type ociArchive struct {
+	file      *os.File
+	modTime   time.Time
+	manifests []ociDescriptor
+	// blobs are the sections of the archive by digest.
+	blobs map[string]*io.SectionReader
+}
+
+// countingReader tracks the offset in the archive, which archive/tar
+// doesn't expose.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openOCIArchive indexes the OCI archive at p.
+func openOCIArchive(p string) (*ociArchive, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	a := &ociArchive{
+		file:    f,
+		modTime: st.ModTime(),
+		blobs:   make(map[string]*io.SectionReader),
+	}
+	var index *io.SectionReader
+	cr := &countingReader{r: f}
+	tr := tar.NewReader(cr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			f.Close()
+			return nil, errors.Wrapf(err, "reading %s", p)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// The reader is at the start of the content after Next.
+		section := io.NewSectionReader(f, cr.n, hdr.Size)
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "index.json" {
+			index = section
+		} else if dir, hex := path.Split(name); strings.HasPrefix(dir, "blobs/") {
+			algo := strings.TrimSuffix(strings.TrimPrefix(dir, "blobs/"), "/")
+			a.blobs[algo+":"+hex] = section
+		}
+	}
+	if index == nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is not an OCI archive: no index.json", p)
+	}
+	var idx struct {
+		Manifests []ociDescriptor `json:"manifests"`
+	}
+	if err := json.NewDecoder(io.NewSectionReader(index, 0, index.Size())).Decode(&idx); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "parsing index.json of %s", p)
+	}
+	if len(idx.Manifests) == 0 {
+		f.Close()
+		return nil, fmt.Errorf("%s has no images", p)
+	}
+	a.manifests = idx.Manifests
+	return a, nil
+}
+
+// resolve returns the descriptor of the manifest for a tag or digest.
+// Archives with a single image serve it for any tag.
+func (a *ociArchive) resolve(reference string) (ociDescriptor, bool) {
+	for _, m := range a.manifests {
+		if m.Digest == reference || m.Annotations[ociRefNameAnnotation] == reference {
+			return m, true
+		}
+	}
+	if strings.Contains(reference, ":") {
+		// Another manifest in the archive, such as the one of a
+		// platform from an image index.
+		if _, ok := a.blobs[reference]; ok {
+			return ociDescriptor{Digest: reference}, true
+		}
+		return ociDescriptor{}, false
+	}
+	if len(a.manifests) == 1 {
+		return a.manifests[0], true
+	}
+	return ociDescriptor{}, false
+}
+
+// AddOCIArchive serves the OCI archive at path, such as the ostree
+// container image of a cosa build, as the repository name of the
+// registry.
+func (s *Server) AddOCIArchive(name, path string) error {
+	a, err := openOCIArchive(path)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old := s.images[name]; old != nil {
+		old.file.Close()
+	}
+	s.images[name] = a
+	return nil
+}
+
+// serveRegistry implements the pull side of the OCI distribution API.
+func (s *Server) serveRegistry(w http.ResponseWriter, r *http.Request) {
+	if !readOnly(w, r) {
+		return
+	}
+	w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+	if r.URL.Path == "/v2/" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	m := registryPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		registryError(w, http.StatusNotFound, "NAME_UNKNOWN", "unknown path")
+		return
+	}
+	name, kind, reference := m[1], m[2], m[3]
+
+	s.mu.RLock()
+	a := s.images[name]
+	s.mu.RUnlock()
+	if a == nil {
+		registryError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository name not known to registry")
+		return
+	}
+
+	var desc ociDescriptor
+	if kind == "manifests" {
+		var ok bool
+		if desc, ok = a.resolve(reference); !ok {
+			registryError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+			return
+		}
+	} else {
+		desc = ociDescriptor{Digest: reference}
+	}
+	blob, ok := a.blobs[desc.Digest]
+	if !ok {
+		code := "BLOB_UNKNOWN"
+		if kind == "manifests" {
+			code = "MANIFEST_UNKNOWN"
+		}
+		registryError(w, http.StatusNotFound, code, "blob unknown to registry")
+		return
+	}
+	if kind == "manifests" {
+		mediaType := desc.MediaType
+		if mediaType == "" {
+			mediaType = manifestMediaType(blob)
+		}
+		w.Header().Set("Content-Type", mediaType)
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Header().Set("Docker-Content-Digest", desc.Digest)
+	w.Header().Set("ETag", `"`+desc.Digest+`"`)
+	http.ServeContent(w, r, "", a.modTime, io.NewSectionReader(blob, 0, blob.Size()))
+}
+
+// manifestMediaType returns the media type recorded in a manifest.
+func manifestMediaType(blob *io.SectionReader) string {
+	var manifest struct {
+		MediaType string `json:"mediaType"`
+	}
+	if err := json.NewDecoder(io.NewSectionReader(blob, 0, blob.Size())).Decode(&manifest); err != nil || manifest.MediaType == "" {
+		return ociManifestMediaType
+	}
+	return manifest.MediaType
+}
+
+// registryError writes an error in the format of the distribution API.
+func registryError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{ //nolint // Nothing to do about errors
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
@@ -0,0 +1,116 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updateserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ServeOstreeRepo serves the archive mode OSTree repo at path, such as
+// the tmp/repo of a cosa working directory, under /repo/.
+func (s *Server) ServeOstreeRepo(path string) error {
+	config, err := os.ReadFile(filepath.Join(path, "config"))
+	if err != nil {
+		return errors.Wrapf(err, "reading repo config")
+	}
+	if !bytes.Contains(config, []byte("mode=archive")) {
+		return fmt.Errorf("%s is not an archive mode repo, which is needed to serve it over HTTP", path)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.repo = path
+	return nil
+}
+
+func (s *Server) serveRepo(w http.ResponseWriter, r *http.Request) {
+	if !readOnly(w, r) {
+		return
+	}
+	s.mu.RLock()
+	repo := s.repo
+	s.mu.RUnlock()
+	if repo == "" {
+		http.NotFound(w, r)
+		return
+	}
+	http.StripPrefix("/repo", http.FileServer(http.Dir(repo))).ServeHTTP(w, r)
+}
+
+// runOstree runs an ostree command on the served repo and returns its
+// output.
+func (s *Server) runOstree(args ...string) (string, error) {
+	s.mu.RLock()
+	repo := s.repo
+	s.mu.RUnlock()
+	if repo == "" {
+		return "", fmt.Errorf("no ostree repo is served")
+	}
+	cmd := exec.Command("ostree", append([]string{"--repo=" + repo}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.Wrapf(err, "running ostree %s: %s", strings.Join(args, " "), stderr.String())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// Commit synthesizes an update: a new commit on ref with the same
+// content as parent but the given version, like
+// cosa dev-synthesize-osupdate without the content changes. It returns
+// the checksum of the commit. The repo is modified, so it should be a
+// copy rather than the repo of the build.
+func (s *Server) Commit(ref, parent, version string) (string, error) {
+	checksum, err := s.runOstree("commit", "--branch="+ref, "--tree=ref="+parent,
+		"--parent="+parent, "--add-metadata-string=version="+version)
+	if err != nil {
+		return "", err
+	}
+	if err := s.UpdateSummary(); err != nil {
+		return "", err
+	}
+	return checksum, nil
+}
+
+// GenerateStaticDelta generates the static delta from one commit to
+// another, which clients then fetch instead of the individual objects.
+// An empty from generates a delta from scratch.
+func (s *Server) GenerateStaticDelta(from, to string) error {
+	args := []string{"static-delta", "generate", "--to=" + to}
+	if from == "" {
+		args = append(args, "--empty")
+	} else {
+		args = append(args, "--from="+from)
+	}
+	if _, err := s.runOstree(args...); err != nil {
+		return err
+	}
+	return s.UpdateSummary()
+}
+
+// UpdateSummary regenerates the summary of the repo, which lists its
+// refs and static deltas for clients.
+func (s *Server) UpdateSummary() error {
+	_, err := s.runOstree("summary", "--update")
+	return err
+}
@@ -0,0 +1,146 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package updateserver serves updates to machines under test from the
+// host: the OSTree repo and OCI archives of cosa builds, and a
+// Cincinnati update graph between them. Everything is served over a
+// single HTTP listener on the host loopback interface, which QEMU guests
+// with user mode networking reach as 10.0.2.2, so upgrade tests can run
+// entirely offline.
+//
+// The endpoints are:
+//
+//	/repo/       the OSTree repo, static deltas included
+//	/v2/         a read-only OCI distribution registry
+//	/v1/graph    the Cincinnati update graph
+package updateserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/coreos/pkg/capnslog"
+)
+
+// QemuHostAddress is the address at which QEMU guests with user mode
+// networking reach the host loopback interface.
+const QemuHostAddress = "10.0.2.2"
+
+var plog = capnslog.NewPackageLogger("github.com/coreos/coreos-assembler/mantle", "kola/updateserver")
+
+// Server is an update server. Its content can be changed while it runs,
+// e.g. to release a new update in the middle of a test.
+type Server struct {
+	listener net.Listener
+	srv      *http.Server
+
+	mu     sync.RWMutex
+	repo   string
+	images map[string]*ociArchive
+	graph  *Graph
+}
+
+// New starts an update server listening on addr, by default on a free
+// port of the loopback interface.
+func New(addr string) (*Server, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		listener: l,
+		images:   make(map[string]*ociArchive),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repo/", s.serveRepo)
+	mux.HandleFunc("/v2/", s.serveRegistry)
+	mux.HandleFunc("/v1/graph", s.serveGraph)
+	s.srv = &http.Server{Handler: logRequests(mux)}
+	go func() {
+		if err := s.srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			plog.Errorf("Update server: %v", err)
+		}
+	}()
+	return s, nil
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// URL returns the base URL of the server from the host.
+func (s *Server) URL() string {
+	return "http://" + s.listener.Addr().String()
+}
+
+// GuestURL returns the base URL of the server from QEMU guests with user
+// mode networking.
+func (s *Server) GuestURL() string {
+	return fmt.Sprintf("http://%s", s.GuestRegistry())
+}
+
+// GuestRegistry returns the host and port of the registry from QEMU
+// guests, for image references such as
+// ostree-unverified-registry:10.0.2.2:PORT/NAME:TAG. The registry is
+// plain HTTP, so it must be marked insecure; see RegistriesConf.
+func (s *Server) GuestRegistry() string {
+	return fmt.Sprintf("%s:%d", QemuHostAddress, s.Port())
+}
+
+// RegistriesConf returns a containers-registries.conf(5) drop-in which
+// lets guests pull from the registry.
+func (s *Server) RegistriesConf() string {
+	return fmt.Sprintf("[[registry]]\nlocation = %q\ninsecure = true\n", s.GuestRegistry())
+}
+
+// OstreeRemoteConf returns an ostree remote config for the repo, as
+// found in /etc/ostree/remotes.d.
+func (s *Server) OstreeRemoteConf(name string) string {
+	return fmt.Sprintf("[remote %q]\nurl=%s/repo\ngpg-verify=false\n", name, s.GuestURL())
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	err := s.srv.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, a := range s.images {
+		a.file.Close()
+	}
+	s.images = nil
+	return err
+}
+
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plog.Debugf("%s %s", r.Method, r.URL.Path)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// readOnly rejects requests which don't read.
+func readOnly(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
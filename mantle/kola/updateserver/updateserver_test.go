@@ -0,0 +1,190 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package updateserver
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	g := Graph{Releases: []Release{
+		{Version: "1", Payload: "a"},
+		{Version: "2", Payload: "b"},
+		{Version: "3", Payload: "c", Barrier: true},
+		{Version: "4", Payload: "d", Deadend: true},
+		{Version: "5", Payload: "e"},
+	}}
+	want := [][2]int{{0, 1}, {0, 2}, {1, 2}, {2, 3}, {2, 4}}
+	if got := g.Edges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got edges %v, expected %v", got, want)
+	}
+	path, err := g.UpdatePath("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(path, []string{"3", "5"}) {
+		t.Errorf("got path %v", path)
+	}
+	if path, _ := g.UpdatePath("4"); len(path) != 0 {
+		t.Errorf("deadend release has updates %v", path)
+	}
+
+	doc := g.document()
+	if doc.Nodes[3].Metadata[deadendKey] != "true" || doc.Nodes[4].Metadata[ageIndexKey] != "4" {
+		t.Errorf("unexpected metadata %v", doc.Nodes)
+	}
+
+	if err := (&Graph{Releases: []Release{{Version: "1", Payload: "a"}, {Version: "1", Payload: "b"}}}).validate(); err == nil {
+		t.Error("accepted duplicate releases")
+	}
+}
+
+// writeOCIArchive writes an archive with a single image whose manifest
+// references a single layer.
+func writeOCIArchive(t *testing.T, p string) (manifestDigest, layerDigest string) {
+	digest := func(b []byte) string {
+		sum := sha256.Sum256(b)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	layer := []byte("layer")
+	layerDigest = digest(layer)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[{"digest":"` + layerDigest + `"}]}`)
+	manifestDigest = digest(manifest)
+	index := []byte(`{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + manifestDigest + `","size":1}]}`)
+
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	for name, content := range map[string][]byte{
+		"oci-layout":                         []byte(`{"imageLayoutVersion":"1.0.0"}`),
+		"index.json":                         index,
+		"blobs/sha256/" + manifestDigest[7:]: manifest,
+		"blobs/sha256/" + layerDigest[7:]:    layer,
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return manifestDigest, layerDigest
+}
+
+func get(t *testing.T, url string) (*http.Response, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// OSTree repo
+	repo := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(filepath.Join(repo, "refs/heads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "config"), []byte("[core]\nrepo_version=1\nmode=bare\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ServeOstreeRepo(repo); err == nil {
+		t.Error("accepted a bare repo")
+	}
+	if err := os.WriteFile(filepath.Join(repo, "config"), []byte("[core]\nrepo_version=1\nmode=archive-z2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "refs/heads/stable"), []byte("abc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ServeOstreeRepo(repo); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := get(t, s.URL()+"/repo/refs/heads/stable"); resp.StatusCode != http.StatusOK || body != "abc\n" {
+		t.Errorf("got %s %q for ref", resp.Status, body)
+	}
+
+	// Registry
+	manifestDigest, layerDigest := writeOCIArchive(t, filepath.Join(dir, "image.ociarchive"))
+	if err := s.AddOCIArchive("coreos/os", filepath.Join(dir, "image.ociarchive")); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := get(t, s.URL()+"/v2/coreos/os/manifests/latest")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Docker-Content-Digest") != manifestDigest ||
+		resp.Header.Get("Content-Type") != ociManifestMediaType {
+		t.Errorf("got %s %v for manifest", resp.Status, resp.Header)
+	}
+	var manifest map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &manifest); err != nil {
+		t.Errorf("invalid manifest %q: %v", body, err)
+	}
+	if resp, body := get(t, s.URL()+"/v2/coreos/os/blobs/"+layerDigest); resp.StatusCode != http.StatusOK || body != "layer" {
+		t.Errorf("got %s %q for layer", resp.Status, body)
+	}
+	if resp, _ := get(t, s.URL()+"/v2/coreos/os/blobs/sha256:0000"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got %s for unknown blob", resp.Status)
+	}
+	if resp, _ := get(t, s.URL()+"/v2/other/manifests/latest"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got %s for unknown repository", resp.Status)
+	}
+	resp, err = http.Post(s.URL()+"/v2/coreos/os/blobs/uploads/", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("got %s for push", resp.Status)
+	}
+
+	// Graph
+	if err := s.SetGraph(Graph{Releases: []Release{{Version: "1", Payload: "a"}, {Version: "2", Payload: "b"}}}); err != nil {
+		t.Fatal(err)
+	}
+	resp, body = get(t, s.URL()+"/v1/graph?basearch=x86_64&stream=stable")
+	var doc graphDoc
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatalf("invalid graph %q: %v", body, err)
+	}
+	if resp.StatusCode != http.StatusOK || len(doc.Nodes) != 2 || !reflect.DeepEqual(doc.Edges, [][2]int{{0, 1}}) {
+		t.Errorf("got %s %q for graph", resp.Status, body)
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/coreos/coreos-assembler/mantle/util"
+)
+
+const (
+	// hotplugMemorySlots is the number of DIMM slots of machines with
+	// hotpluggable memory.
+	hotplugMemorySlots = 8
+
+	// maxHotplugSlots bounds the PCIe root ports, whose chassis numbers
+	// must fit in a byte.
+	maxHotplugSlots = 32
+
+	// hotplugRemoveTimeout bounds how long the guest may take to release
+	// a device being unplugged.
+	hotplugRemoveTimeout = 30 * time.Second
+)
+
+// QemuDevice is a device of a QEMU instance, as returned by Devices.
+type QemuDevice struct {
+	// ID is the qdev id, or the QOM path of anonymous devices.
+	ID   string
+	Type string
+	Path string
+	// Bus is the QOM path of the bus the device is plugged into, if any.
+	Bus string
+	// Hotplugged is set on the devices added at runtime.
+	Hotplugged bool
+	// Children are the devices plugged into the buses of this one.
+	Children []*QemuDevice
+}
+
+// hotplugState tracks the devices added to an instance at runtime.
+type hotplugState struct {
+	mu     sync.Mutex
+	nextID int
+	// pcie is set on machines whose root bus doesn't support hotplug,
+	// where devices go into the free root ports instead.
+	pcie    bool
+	ports   []string
+	devices map[string]*hotplugDevice
+}
+
+// hotplugDevice is a device added at runtime and the backends to remove
+// along with it.
+type hotplugDevice struct {
+	port     string
+	blockdev string
+	netdev   string
+	object   string
+	file     string
+}
+
+// EnableHotplug makes room for devices added at runtime: slots free PCIe
+// root ports on machines which need them for hotplug, and memory and
+// processors up to maxMemoryMiB and maxProcessors. Zero values leave the
+// corresponding limit alone.
+func (builder *QemuBuilder) EnableHotplug(slots, maxMemoryMiB, maxProcessors int) {
+	builder.hotplugSlots = slots
+	builder.maxMemoryMiB = maxMemoryMiB
+	builder.maxProcessors = maxProcessors
+}
+
+// usesPCIe returns whether devices can't be hotplugged into the root bus
+// of the machine, i.e. whether it's a q35 or virt machine.
+func (builder *QemuBuilder) usesPCIe() bool {
+	switch builder.architecture {
+	case "aarch64":
+		return true
+	case "x86_64":
+		return strings.HasPrefix(builder.Firmware, "uefi")
+	}
+	return false
+}
+
+// setupHotplug adds the root ports for hotplugged devices and returns the
+// arguments from baseQemuArgs with the memory and processor limits.
+func (builder *QemuBuilder) setupHotplug(argv []string, inst *QemuInstance) ([]string, error) {
+	inst.hotplug.pcie = builder.usesPCIe()
+	if builder.hotplugSlots == 0 && builder.maxMemoryMiB == 0 && builder.maxProcessors == 0 {
+		return argv, nil
+	}
+	if builder.NumaNodes && (builder.maxMemoryMiB != 0 || builder.maxProcessors != 0) {
+		return nil, fmt.Errorf("hotplugging memory and processors is not supported with NUMA nodes")
+	}
+	if builder.hotplugSlots < 0 || builder.hotplugSlots > maxHotplugSlots {
+		return nil, fmt.Errorf("hotplug slots must be between 0 and %d", maxHotplugSlots)
+	}
+	argv, err := hotplugLimitArgs(argv, builder.MemoryMiB, builder.maxMemoryMiB, builder.Processors, builder.maxProcessors)
+	if err != nil {
+		return nil, err
+	}
+	if inst.hotplug.pcie {
+		for i := 0; i < builder.hotplugSlots; i++ {
+			port := fmt.Sprintf("hotplug-port-%d", i)
+			builder.Append("-device", fmt.Sprintf("pcie-root-port,id=%s,chassis=%d", port, 100+i))
+			inst.hotplug.ports = append(inst.hotplug.ports, port)
+		}
+	}
+	return argv, nil
+}
+
+// hotplugLimitArgs extends the -m and -smp arguments in argv with the
+// maximum memory and processors.
+func hotplugLimitArgs(argv []string, memoryMiB, maxMemoryMiB, cpus, maxCPUs int) ([]string, error) {
+	if maxMemoryMiB != 0 && maxMemoryMiB < memoryMiB {
+		return nil, fmt.Errorf("maximum memory %dM is less than the memory %dM", maxMemoryMiB, memoryMiB)
+	}
+	if maxCPUs != 0 && maxCPUs < cpus {
+		return nil, fmt.Errorf("maximum processors %d is less than the processors %d", maxCPUs, cpus)
+	}
+	ret := append([]string{}, argv...)
+	for i := 0; i+1 < len(ret); i++ {
+		switch ret[i] {
+		case "-m":
+			if maxMemoryMiB > memoryMiB {
+				ret[i+1] += fmt.Sprintf(",slots=%d,maxmem=%dM", hotplugMemorySlots, maxMemoryMiB)
+			}
+		case "-smp":
+			if maxCPUs > cpus {
+				ret[i+1] += fmt.Sprintf(",maxcpus=%d", maxCPUs)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// qmpDeviceProps converts -device style options to device_add
+// arguments, which need the JSON types of the properties.
+func qmpDeviceProps(opts []string) map[string]interface{} {
+	props := make(map[string]interface{})
+	for _, opt := range opts {
+		for _, kv := range strings.Split(opt, ",") {
+			k, v, found := strings.Cut(kv, "=")
+			if !found {
+				props[k] = true
+				continue
+			}
+			if k == "serial" || k == "id" {
+				props[k] = v
+			} else if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+				props[k] = n
+			} else if v == "on" || v == "true" {
+				props[k] = true
+			} else if v == "off" || v == "false" {
+				props[k] = false
+			} else {
+				props[k] = v
+			}
+		}
+	}
+	return props
+}
+
+// allocateHotplug reserves a new device id with the given prefix and, on
+// PCIe machines, a root port for it.
+func (inst *QemuInstance) allocateHotplug(prefix string, needsPort bool) (string, *hotplugDevice, error) {
+	h := &inst.hotplug
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	dev := &hotplugDevice{}
+	if needsPort && h.pcie {
+		if len(h.ports) == 0 {
+			return "", nil, fmt.Errorf("no free hotplug slot; set HotplugSlots")
+		}
+		dev.port = h.ports[0]
+		h.ports = h.ports[1:]
+	}
+	h.nextID++
+	return fmt.Sprintf("hotplug-%s%d", prefix, h.nextID), dev, nil
+}
+
+// recordHotplug completes an allocation; if err is set, the port is
+// released instead.
+func (inst *QemuInstance) recordHotplug(id string, dev *hotplugDevice, err error) {
+	h := &inst.hotplug
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil {
+		if dev.port != "" {
+			h.ports = append(h.ports, dev.port)
+		}
+		return
+	}
+	if h.devices == nil {
+		h.devices = make(map[string]*hotplugDevice)
+	}
+	h.devices[id] = dev
+}
+
+// deviceArgs returns the device_add arguments of a device with the
+// given driver and id, in the root port of dev if any.
+func (dev *hotplugDevice) deviceArgs(driver, id string, props map[string]interface{}) map[string]interface{} {
+	args := map[string]interface{}{"driver": driver, "id": id}
+	for k, v := range props {
+		args[k] = v
+	}
+	if dev.port != "" {
+		args["bus"] = dev.port
+	}
+	return args
+}
+
+// AddDisk creates a new disk as described by spec, in the format of
+// --add-disk, and attaches it to the running instance. It returns the id
+// of the device, for RemoveDevice.
+func (inst *QemuInstance) AddDisk(spec string) (id string, err2 error) {
+	disk, err := ParseDisk(spec, false)
+	if err != nil {
+		return "", err
+	}
+	if disk.MultiPathDisk {
+		return "", fmt.Errorf("multipath disks cannot be hotplugged")
+	}
+	channel := disk.Channel
+	if channel == "" {
+		channel = "virtio"
+	}
+
+	id, dev, err := inst.allocateHotplug("disk", true)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err2 != nil {
+			inst.cleanupHotplug(dev)
+		}
+		inst.recordHotplug(id, dev, err2)
+	}()
+
+	dir, err := inst.ensureTempdir()
+	if err != nil {
+		return "", err
+	}
+	dev.file = filepath.Join(dir, id+".qcow2")
+	cmd := exec.Command("qemu-img", "create", "-q", "-f", "qcow2", dev.file, disk.Size)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrapf(err, "creating disk image")
+	}
+	node := id + "-node"
+	if _, err := inst.runQmpCommandArgs("blockdev-add", map[string]interface{}{
+		"driver":    "qcow2",
+		"node-name": node,
+		"file":      map[string]interface{}{"driver": "file", "filename": dev.file},
+	}); err != nil {
+		return "", errors.Wrapf(err, "adding block device for %s", id)
+	}
+	dev.blockdev = node
+
+	opts := disk.DeviceOpts
+	if disk.SectorSize != 0 {
+		logical := disk.LogicalSectorSize
+		if logical == 0 {
+			logical = disk.SectorSize
+		}
+		opts = append(opts, fmt.Sprintf("physical_block_size=%d,logical_block_size=%d", disk.SectorSize, logical))
+	}
+	props := qmpDeviceProps(opts)
+	props["drive"] = node
+	if _, ok := props["serial"]; !ok {
+		props["serial"] = id
+	}
+
+	switch channel {
+	case "virtio":
+		err = inst.deviceAdd(dev.deviceArgs(virtioDriver(inst.architecture, "blk"), id, props))
+	case "nvme":
+		err = inst.deviceAdd(dev.deviceArgs("nvme", id, props))
+	case "scsi":
+		// Like at boot, each SCSI disk gets its own controller, which
+		// takes the disk with it when unplugged.
+		wwn := disk.Wwn
+		if wwn == 0 {
+			wwn = rand.Uint64()
+		}
+		if err = inst.deviceAdd(dev.deviceArgs(virtioDriver(inst.architecture, "scsi"), id, nil)); err != nil {
+			break
+		}
+		delete(props, "serial")
+		props["driver"] = "scsi-hd"
+		props["id"] = id + "-hd"
+		props["bus"] = id + ".0"
+		props["wwn"] = wwn
+		if err = inst.deviceAdd(props); err != nil {
+			inst.removeDevice(id) //nolint // Already failing
+		}
+	default:
+		return "", fmt.Errorf("unhandled channel: %s", channel)
+	}
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// AddNic attaches a new NIC on its own user mode network to the running
+// instance. It returns the id of the device, for RemoveDevice.
+func (inst *QemuInstance) AddNic() (id string, err2 error) {
+	id, dev, err := inst.allocateHotplug("nic", true)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err2 != nil {
+			inst.cleanupHotplug(dev)
+		}
+		inst.recordHotplug(id, dev, err2)
+	}()
+
+	netdev := id + "-net"
+	if _, err := inst.runQmpCommandArgs("netdev_add", map[string]interface{}{"type": "user", "id": netdev}); err != nil {
+		return "", errors.Wrapf(err, "adding netdev for %s", id)
+	}
+	dev.netdev = netdev
+	if err := inst.deviceAdd(dev.deviceArgs(virtioDriver(inst.architecture, "net"), id, map[string]interface{}{"netdev": netdev})); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// AddMemory plugs a DIMM of sizeMiB into the running instance, which
+// must have been started with a higher maximum memory. The guest has to
+// online the memory. It returns the id of the device, for RemoveDevice.
+func (inst *QemuInstance) AddMemory(sizeMiB int) (id string, err2 error) {
+	id, dev, err := inst.allocateHotplug("dimm", false)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err2 != nil {
+			inst.cleanupHotplug(dev)
+		}
+		inst.recordHotplug(id, dev, err2)
+	}()
+
+	// Share it like the rest of the memory, which virtiofs needs.
+	object := id + "-mem"
+	if _, err := inst.runQmpCommandArgs("object-add", map[string]interface{}{
+		"qom-type": "memory-backend-memfd",
+		"id":       object,
+		"size":     uint64(sizeMiB) * 1024 * 1024,
+		"share":    true,
+	}); err != nil {
+		return "", errors.Wrapf(err, "adding memory backend for %s", id)
+	}
+	dev.object = object
+	if err := inst.deviceAdd(dev.deviceArgs("pc-dimm", id, map[string]interface{}{"memdev": object})); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// AddCPU plugs the next free processor into the running instance, which
+// must have been started with a higher maximum of processors. It returns
+// the id of the device, for RemoveDevice.
+func (inst *QemuInstance) AddCPU() (id string, err2 error) {
+	cpus, err := inst.listHotpluggableCPUs()
+	if err != nil {
+		return "", err
+	}
+	var free *QMPHotpluggableCPU
+	for i := range cpus.Return {
+		if cpus.Return[i].QOMPath == "" {
+			free = &cpus.Return[i]
+			break
+		}
+	}
+	if free == nil {
+		return "", fmt.Errorf("no free processor slot; set MaxProcessors")
+	}
+
+	id, dev, err := inst.allocateHotplug("cpu", false)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		inst.recordHotplug(id, dev, err2)
+	}()
+	if err := inst.deviceAdd(dev.deviceArgs(free.Type, id, free.Props)); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// RemoveDevice unplugs a device added at runtime, waits for the guest
+// to release it and removes its backends.
+func (inst *QemuInstance) RemoveDevice(id string) error {
+	inst.hotplug.mu.Lock()
+	dev, ok := inst.hotplug.devices[id]
+	inst.hotplug.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("device %s was not hotplugged", id)
+	}
+	if err := inst.removeDevice(id); err != nil {
+		return err
+	}
+	inst.hotplug.mu.Lock()
+	delete(inst.hotplug.devices, id)
+	if dev.port != "" {
+		inst.hotplug.ports = append(inst.hotplug.ports, dev.port)
+	}
+	inst.hotplug.mu.Unlock()
+	return inst.cleanupHotplug(dev)
+}
+
+// removeDevice unplugs a device and waits for it to be gone.
+func (inst *QemuInstance) removeDevice(id string) error {
+	if err := inst.deleteBlockDevice(id); err != nil {
+		return err
+	}
+	return util.RetryUntilTimeout(hotplugRemoveTimeout, 500*time.Millisecond, func() error {
+		devs, err := inst.listQOM("/machine/peripheral")
+		if err != nil {
+			return err
+		}
+		for _, dev := range devs.Return {
+			if dev.Name == id {
+				return fmt.Errorf("device %s was not released by the guest", id)
+			}
+		}
+		return nil
+	})
+}
+
+// cleanupHotplug removes the backends of a device which is gone.
+func (inst *QemuInstance) cleanupHotplug(dev *hotplugDevice) error {
+	var err error
+	if dev.blockdev != "" {
+		if _, err2 := inst.runQmpCommandArgs("blockdev-del", map[string]interface{}{"node-name": dev.blockdev}); err2 != nil && err == nil {
+			err = errors.Wrapf(err2, "removing block device %s", dev.blockdev)
+		}
+	}
+	if dev.netdev != "" {
+		if _, err2 := inst.runQmpCommandArgs("netdev_del", map[string]interface{}{"id": dev.netdev}); err2 != nil && err == nil {
+			err = errors.Wrapf(err2, "removing netdev %s", dev.netdev)
+		}
+	}
+	if dev.object != "" {
+		if _, err2 := inst.runQmpCommandArgs("object-del", map[string]interface{}{"id": dev.object}); err2 != nil && err == nil {
+			err = errors.Wrapf(err2, "removing object %s", dev.object)
+		}
+	}
+	if dev.file != "" {
+		os.Remove(dev.file) //nolint // Ignore errors
+	}
+	return err
+}
+
+// ensureTempdir returns the tempdir of the instance, creating it if the
+// builder didn't need one.
+func (inst *QemuInstance) ensureTempdir() (string, error) {
+	inst.hotplug.mu.Lock()
+	defer inst.hotplug.mu.Unlock()
+	if inst.tempdir == "" {
+		tempdir, err := os.MkdirTemp("/var/tmp", "mantle-qemu")
+		if err != nil {
+			return "", err
+		}
+		inst.tempdir = tempdir
+	}
+	return inst.tempdir, nil
+}
+
+// Devices returns the devices of the instance, nested by the buses they
+// are plugged into.
+func (inst *QemuInstance) Devices() ([]*QemuDevice, error) {
+	inst.hotplug.mu.Lock()
+	hotplugged := make(map[string]bool)
+	for id := range inst.hotplug.devices {
+		hotplugged[id] = true
+	}
+	inst.hotplug.mu.Unlock()
+
+	var all []*QemuDevice
+	for _, root := range []string{"/machine/peripheral", "/machine/peripheral-anon"} {
+		props, err := inst.listQOM(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, prop := range props.Return {
+			if !strings.HasPrefix(prop.Type, "child<") {
+				continue
+			}
+			devPath := path.Join(root, prop.Name)
+			dev := &QemuDevice{
+				ID:         prop.Name,
+				Type:       strings.TrimSuffix(strings.TrimPrefix(prop.Type, "child<"), ">"),
+				Path:       devPath,
+				Hotplugged: hotplugged[prop.Name],
+			}
+			if root != "/machine/peripheral" {
+				dev.ID = devPath
+			}
+			// Devices which aren't on a bus, such as DIMMs, have no
+			// parent_bus.
+			if bus, err := inst.qomGetString(devPath, "parent_bus"); err == nil {
+				dev.Bus = bus
+			}
+			all = append(all, dev)
+		}
+	}
+	return nestDevices(all), nil
+}
+
+// nestDevices arranges devices in a tree by their buses, which are
+// children of the devices providing them.
+func nestDevices(all []*QemuDevice) []*QemuDevice {
+	byPath := make(map[string]*QemuDevice)
+	for _, dev := range all {
+		byPath[dev.Path] = dev
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Path < all[j].Path })
+	var roots []*QemuDevice
+	for _, dev := range all {
+		if parent, ok := byPath[path.Dir(dev.Bus)]; ok && dev.Bus != "" && parent != dev {
+			parent.Children = append(parent.Children, dev)
+		} else {
+			roots = append(roots, dev)
+		}
+	}
+	return roots
+}
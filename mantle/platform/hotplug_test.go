@@ -0,0 +1,78 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHotplugLimitArgs(t *testing.T) {
+	argv := []string{"qemu-system-x86_64", "-m", "2048", "-smp", "2"}
+	got, err := hotplugLimitArgs(argv, 2048, 4096, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"qemu-system-x86_64", "-m", "2048,slots=8,maxmem=4096M", "-smp", "2,maxcpus=4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expected %v", got, want)
+	}
+	if argv[2] != "2048" {
+		t.Errorf("original arguments were modified: %v", argv)
+	}
+
+	got, err = hotplugLimitArgs(argv, 2048, 0, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, argv) {
+		t.Errorf("got %v, expected %v", got, argv)
+	}
+
+	if _, err := hotplugLimitArgs(argv, 2048, 1024, 2, 0); err == nil {
+		t.Error("accepted maximum memory below the memory")
+	}
+	if _, err := hotplugLimitArgs(argv, 2048, 0, 2, 1); err == nil {
+		t.Error("accepted maximum processors below the processors")
+	}
+}
+
+func TestQmpDeviceProps(t *testing.T) {
+	got := qmpDeviceProps([]string{"serial=1234", "physical_block_size=4096,logical_block_size=512", "rotational=on", "vendor=NVME"})
+	want := map[string]interface{}{
+		"serial":              "1234",
+		"physical_block_size": uint64(4096),
+		"logical_block_size":  uint64(512),
+		"rotational":          true,
+		"vendor":              "NVME",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, expected %v", got, want)
+	}
+}
+
+func TestNestDevices(t *testing.T) {
+	port := &QemuDevice{ID: "hotplug-port-0", Path: "/machine/peripheral/hotplug-port-0", Bus: "/machine/q35/pcie.0"}
+	disk := &QemuDevice{ID: "hotplug-disk1", Path: "/machine/peripheral/hotplug-disk1", Bus: "/machine/peripheral/hotplug-port-0/hotplug-port-0"}
+	dimm := &QemuDevice{ID: "hotplug-dimm2", Path: "/machine/peripheral/hotplug-dimm2"}
+
+	roots := nestDevices([]*QemuDevice{disk, dimm, port})
+	if len(roots) != 2 || roots[0] != dimm || roots[1] != port {
+		t.Fatalf("unexpected roots %v", roots)
+	}
+	if len(port.Children) != 1 || port.Children[0] != disk {
+		t.Errorf("unexpected children %v", port.Children)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -40,6 +41,11 @@ type Cluster struct {
 
 	// Use atomic.Bool to prevent race conditions
 	tearingDown atomic.Bool
+
+	// privnet is the private network of the machines which asked for
+	// one, created with the first of them.
+	privnetLock sync.Mutex
+	privnet     *platform.PrivateNetwork
 }
 
 func (qc *Cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
@@ -74,6 +80,19 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 		consolePath: filepath.Join(dir, "console.txt"),
 	}
 
+	// Machines which are eligible for snapshot reuse either boot from
+	// the snapshot of an earlier identical machine, or provide it.
+	var fingerprint, snapshot string
+	if reason := snapshotIneligibility(qc.flight.opts, options); reason == "" {
+		fingerprint, err = snapshotFingerprint(qc.flight.opts, config, options)
+		if err != nil {
+			return nil, err
+		}
+		snapshot = qc.flight.snapshots.get(fingerprint)
+	} else if options.ReuseSnapshot && qc.flight.opts.SnapshotReuse {
+		plog.Debugf("Not reusing snapshots for machine %s: %s", id, reason)
+	}
+
 	builder := platform.NewQemuBuilder()
 	if options.DisablePDeathSig {
 		builder.Pdeathsig = false
@@ -103,6 +122,20 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 		config.MountHost(dest, readonly)
 	}
 
+	if options.PrivateNetwork || qc.flight.opts.PrivateNetwork {
+		privnet, err := qc.privateNetwork()
+		if err != nil {
+			return nil, err
+		}
+		addr, err := privnet.AllocateAddress()
+		if err != nil {
+			return nil, err
+		}
+		config.AddFile("/etc/NetworkManager/system-connections/kola-private.nmconnection", addr.NMKeyfile(), 0600)
+		builder.AddPrivateNic(privnet.Addr(), addr.MAC)
+		qm.privateIP = addr.IP
+	}
+
 	builder.SetConfig(config)
 	defer builder.Close()
 	builder.UUID = qm.id
@@ -167,6 +200,11 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 	if options.OverrideBackingFile != "" {
 		primaryDisk.BackingFile = options.OverrideBackingFile
 	}
+	if snapshot != "" {
+		plog.Debugf("Booting machine %s from snapshot %s", id, snapshot)
+		primaryDisk.BackingFile = snapshot
+		primaryDisk.BackingFormat = "qcow2"
+	}
 
 	if err = builder.AddBootDisk(&primaryDisk); err != nil {
 		return nil, err
@@ -186,6 +224,10 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 	if options.AdditionalNics > 0 {
 		builder.AddAdditionalNics(options.AdditionalNics)
 	}
+	if options.NetworkImpairment != nil {
+		builder.EnableNetworkImpairment(*options.NetworkImpairment)
+	}
+	builder.EnableHotplug(options.HotplugSlots, options.MaxMemory, options.MaxProcessors)
 	if options.AppendKernelArgs != "" {
 		builder.AppendKernelArgs = options.AppendKernelArgs
 	}
@@ -224,6 +266,10 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 		return nil, err
 	}
 
+	if fingerprint != "" && snapshot == "" {
+		qc.takeSnapshot(qm, fingerprint)
+	}
+
 	qc.AddMach(qm)
 
 	// In this flow, nothing actually Wait()s for the QEMU process. Let's do it here
@@ -243,9 +289,32 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options platfo
 func (qc *Cluster) Destroy() {
 	qc.tearingDown.Store(true)
 	qc.BaseCluster.Destroy()
+	qc.privnetLock.Lock()
+	if qc.privnet != nil {
+		if err := qc.privnet.Close(); err != nil {
+			plog.Errorf("Error closing private network: %v", err)
+		}
+		qc.privnet = nil
+	}
+	qc.privnetLock.Unlock()
 	qc.flight.DelCluster(qc)
 }
 
+// privateNetwork returns the private network of the cluster, starting
+// it if needed.
+func (qc *Cluster) privateNetwork() (*platform.PrivateNetwork, error) {
+	qc.privnetLock.Lock()
+	defer qc.privnetLock.Unlock()
+	if qc.privnet == nil {
+		privnet, err := platform.NewPrivateNetwork()
+		if err != nil {
+			return nil, errors.Wrapf(err, "starting private network")
+		}
+		qc.privnet = privnet
+	}
+	return qc.privnet, nil
+}
+
 func (qc *Cluster) RenderUserDataIfNeeded(userdata any) (*conf.Conf, error) {
 	var config *conf.Conf
 	var err error
@@ -58,12 +58,21 @@ type Options struct {
 	// Option to create IBM cex based luks encryption
 	Cex bool
 
+	// PrivateNetwork connects all machines of a cluster to a private
+	// network, as if they all had MachineOptions.PrivateNetwork set.
+	PrivateNetwork bool
+
+	// SnapshotReuse lets machines of tests which allow it boot from a
+	// disk snapshot of an identical machine booted earlier in the flight.
+	SnapshotReuse bool
+
 	*platform.Options
 }
 
 type flight struct {
 	*platform.BaseFlight
-	opts *Options
+	opts      *Options
+	snapshots snapshotCache
 }
 
 var (
@@ -107,3 +116,8 @@ func (qf *flight) NewCluster(rconf *platform.RuntimeConfig) (platform.Cluster, e
 
 	return qc, nil
 }
+
+func (qf *flight) Destroy() {
+	qf.BaseFlight.Destroy()
+	qf.snapshots.destroy()
+}
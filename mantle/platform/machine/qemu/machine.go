@@ -33,6 +33,8 @@ type machine struct {
 	consolePath string
 	console     string
 	ip          string
+	// privateIP is the address on the cluster's private network, if any
+	privateIP string
 }
 
 func (m *machine) ID() string {
@@ -44,6 +46,9 @@ func (m *machine) IP() string {
 }
 
 func (m *machine) PrivateIP() string {
+	if m.privateIP != "" {
+		return m.privateIP
+	}
 	return m.ip
 }
 
@@ -128,3 +133,35 @@ func (m *machine) RemovePrimaryBlockDevice() error {
 func (m *machine) RemoveBlockDeviceForMultipath(device string) error {
 	return m.inst.RemoveBlockDeviceForMultipath(device)
 }
+
+func (m *machine) SetLink(up bool) error {
+	return m.inst.SetLink("eth0", up)
+}
+
+func (m *machine) SetNetworkImpairment(imp platform.NetworkImpairment) error {
+	return m.inst.SetNetworkImpairment(imp)
+}
+
+func (m *machine) AddDisk(spec string) (string, error) {
+	return m.inst.AddDisk(spec)
+}
+
+func (m *machine) AddNic() (string, error) {
+	return m.inst.AddNic()
+}
+
+func (m *machine) AddMemory(sizeMiB int) (string, error) {
+	return m.inst.AddMemory(sizeMiB)
+}
+
+func (m *machine) AddCPU() (string, error) {
+	return m.inst.AddCPU()
+}
+
+func (m *machine) RemoveDevice(id string) error {
+	return m.inst.RemoveDevice(id)
+}
+
+func (m *machine) Devices() ([]*platform.QemuDevice, error) {
+	return m.inst.Devices()
+}
@@ -0,0 +1,199 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/coreos/coreos-assembler/mantle/platform"
+	"github.com/coreos/coreos-assembler/mantle/platform/conf"
+)
+
+// snapshotCache holds the disk snapshots of booted machines taken in a
+// flight, by fingerprint. Machines with the same fingerprint as a
+// snapshot boot from a fresh overlay on top of it rather than from the
+// image, and so skip Ignition and the rest of the first boot. The
+// overlay is discarded with the machine, so each machine still starts
+// from the same state.
+type snapshotCache struct {
+	mu        sync.Mutex
+	dir       string
+	snapshots map[string]string
+	// pending tracks the snapshots being taken, so that only one
+	// machine per fingerprint does it.
+	pending map[string]bool
+}
+
+// get returns the snapshot for fingerprint, or "" if there is none.
+func (sc *snapshotCache) get(fingerprint string) string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.snapshots[fingerprint]
+}
+
+// reserve returns the path to which the snapshot for fingerprint should
+// be written, or "" if it exists or is being taken already.
+func (sc *snapshotCache) reserve(fingerprint string) (string, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.snapshots[fingerprint] != "" || sc.pending[fingerprint] {
+		return "", nil
+	}
+	if sc.dir == "" {
+		dir, err := os.MkdirTemp("/var/tmp", "mantle-qemu-snapshots")
+		if err != nil {
+			return "", err
+		}
+		sc.dir = dir
+	}
+	if sc.snapshots == nil {
+		sc.snapshots = make(map[string]string)
+		sc.pending = make(map[string]bool)
+	}
+	sc.pending[fingerprint] = true
+	return filepath.Join(sc.dir, fingerprint+".qcow2"), nil
+}
+
+// release completes a reservation, recording the snapshot if ok.
+func (sc *snapshotCache) release(fingerprint, path string, ok bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.pending, fingerprint)
+	if ok {
+		sc.snapshots[fingerprint] = path
+	} else {
+		os.Remove(path)
+	}
+}
+
+// destroy removes all snapshots.
+func (sc *snapshotCache) destroy() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.dir != "" {
+		if err := os.RemoveAll(sc.dir); err != nil {
+			plog.Errorf("Error removing snapshots: %v", err)
+		}
+	}
+	sc.dir = ""
+	sc.snapshots = nil
+	sc.pending = nil
+}
+
+// snapshotIneligibility returns why a machine with the given options
+// can't use snapshots, or "" if it can. Snapshots only cover the
+// primary disk, so anything which changes the first boot or attaches
+// other storage is excluded.
+func snapshotIneligibility(opts *Options, options platform.MachineOptions) string {
+	switch {
+	case !opts.SnapshotReuse:
+		return "snapshot reuse is disabled"
+	case !options.ReuseSnapshot:
+		return "the test does not allow reuse"
+	case len(options.AdditionalDisks) > 0:
+		return "additional disks"
+	case options.PrimaryDisk != "":
+		return "custom primary disk"
+	case options.MultiPathDisk || opts.MultiPathDisk:
+		return "multipath disk"
+	case opts.NbdDisk:
+		return "NBD disk"
+	case options.AppendKernelArgs != "" || options.AppendFirstbootKernelArgs != "":
+		return "kernel arguments"
+	case options.Cex || opts.Cex:
+		return "CEX device"
+	case opts.SecureExecution:
+		return "Secure Execution"
+	case len(options.BindMountHostRO) > 0 || len(opts.BindRO) > 0:
+		return "host bind mounts"
+	case options.PrivateNetwork || opts.PrivateNetwork:
+		return "private network"
+	}
+	return ""
+}
+
+// snapshotFingerprint identifies the state of a machine after its first
+// boot: the config and everything that determines the primary disk and
+// the firmware.
+func snapshotFingerprint(opts *Options, config *conf.Conf, options platform.MachineOptions) (string, error) {
+	// ReuseSnapshot itself doesn't change the disk.
+	options.ReuseSnapshot = false
+	data, err := json.Marshal(struct {
+		Config    string
+		Options   platform.MachineOptions
+		DiskImage string
+		DiskSize  string
+		Firmware  string
+		Arch      string
+		Native4k  bool
+		Disk512e  bool
+		Nvme      bool
+	}{
+		Config:    config.String(),
+		Options:   options,
+		DiskImage: opts.DiskImage,
+		DiskSize:  opts.DiskSize,
+		Firmware:  opts.Firmware,
+		Arch:      opts.Arch,
+		Native4k:  opts.Native4k,
+		Disk512e:  opts.Disk512e,
+		Nvme:      opts.Nvme,
+	})
+	if err != nil {
+		return "", fmt.Errorf("computing snapshot fingerprint: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// takeSnapshot waits for the first boot of qm to settle and snapshots
+// its primary disk. Failing to do so isn't fatal to the machine; it only
+// means that later machines boot from the image.
+func (qc *Cluster) takeSnapshot(qm *machine, fingerprint string) {
+	cache := &qc.flight.snapshots
+	path, err := cache.reserve(fingerprint)
+	if err != nil {
+		plog.Warningf("Not snapshotting machine %s: %v", qm.ID(), err)
+		return
+	}
+	if path == "" {
+		return
+	}
+	ok := false
+	defer func() {
+		cache.release(fingerprint, path, ok)
+	}()
+
+	// Wait for the firstboot units to remove the Ignition firstboot
+	// stamp, so that machines booting from the snapshot don't run
+	// Ignition again, and flush everything to disk.
+	cmd := "sudo sh -c 'systemctl is-system-running --wait >/dev/null; test ! -e /boot/ignition.firstboot && sync'"
+	if out, stderr, err := qm.SSH(cmd); err != nil {
+		plog.Warningf("Not snapshotting machine %s: %v: %s%s", qm.ID(), err, out, stderr)
+		return
+	}
+	if err := qm.inst.SnapshotPrimaryDisk(path); err != nil {
+		plog.Warningf("Snapshotting machine %s: %v", qm.ID(), err)
+		return
+	}
+	plog.Debugf("Snapshotted machine %s as %s", qm.ID(), path)
+	ok = true
+}
@@ -0,0 +1,65 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"testing"
+
+	"github.com/coreos/coreos-assembler/mantle/platform"
+	"github.com/coreos/coreos-assembler/mantle/platform/conf"
+)
+
+func TestSnapshotFingerprint(t *testing.T) {
+	opts := &Options{DiskImage: "a.qcow2", SnapshotReuse: true}
+	config := conf.Ignition(`{"ignition": {"version": "3.0.0"}}`)
+	rendered, err := config.Render(conf.FailWarnings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fingerprint := func(o *Options, options platform.MachineOptions) string {
+		f, err := snapshotFingerprint(o, rendered, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+	base := fingerprint(opts, platform.MachineOptions{})
+	if f := fingerprint(opts, platform.MachineOptions{ReuseSnapshot: true}); f != base {
+		t.Errorf("ReuseSnapshot changed the fingerprint")
+	}
+	if f := fingerprint(opts, platform.MachineOptions{MinMemory: 4096}); f == base {
+		t.Errorf("machine options did not change the fingerprint")
+	}
+	if f := fingerprint(&Options{DiskImage: "b.qcow2"}, platform.MachineOptions{}); f == base {
+		t.Errorf("disk image did not change the fingerprint")
+	}
+}
+
+func TestSnapshotIneligibility(t *testing.T) {
+	opts := &Options{SnapshotReuse: true}
+	if reason := snapshotIneligibility(opts, platform.MachineOptions{ReuseSnapshot: true}); reason != "" {
+		t.Errorf("expected machine to be eligible, got %q", reason)
+	}
+	if snapshotIneligibility(opts, platform.MachineOptions{}) == "" {
+		t.Errorf("expected machine of a test not allowing reuse to be ineligible")
+	}
+	if snapshotIneligibility(&Options{}, platform.MachineOptions{ReuseSnapshot: true}) == "" {
+		t.Errorf("expected machine to be ineligible with reuse disabled")
+	}
+	if snapshotIneligibility(opts, platform.MachineOptions{ReuseSnapshot: true, AdditionalDisks: []string{"1G"}}) == "" {
+		t.Errorf("expected machine with additional disks to be ineligible")
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// impairedQueueLength is the number of frames which may be in flight in
+// each direction; further frames are dropped, as by a full router queue.
+const impairedQueueLength = 1024
+
+// NetworkImpairment degrades the traffic of the primary NIC of a QEMU
+// machine. Each setting applies to both directions independently.
+type NetworkImpairment struct {
+	// Loss is the fraction of frames dropped, between 0 and 1.
+	Loss float64
+	// Latency is added to every frame.
+	Latency time.Duration
+	// Bandwidth caps the throughput in bits per second; 0 is unlimited.
+	Bandwidth int64
+}
+
+func (imp NetworkImpairment) validate() error {
+	if imp.Loss < 0 || imp.Loss > 1 {
+		return fmt.Errorf("loss %v is not between 0 and 1", imp.Loss)
+	}
+	if imp.Latency < 0 || imp.Bandwidth < 0 {
+		return fmt.Errorf("latency and bandwidth must not be negative")
+	}
+	return nil
+}
+
+// netImpairer applies a NetworkImpairment to the frames of a netdev,
+// which QEMU filter-redirector objects send to it and take back from it
+// over unix sockets.
+type netImpairer struct {
+	mu  sync.Mutex
+	imp NetworkImpairment
+	rnd *rand.Rand
+
+	paths []*impairedPath
+	conns []net.Conn
+	wg    sync.WaitGroup
+}
+
+// impairedPath is one direction of traffic.
+type impairedPath struct {
+	name string
+	// out receives the frames from QEMU, and in gives them back.
+	out, in net.Listener
+	// nextFree is when the emulated link is done sending the previous
+	// frame.
+	nextFree time.Time
+}
+
+type impairedFrame struct {
+	at    time.Time
+	frame []byte
+}
+
+// newNetImpairer listens for QEMU in dir and returns the arguments which
+// redirect the traffic of netdev through it.
+func newNetImpairer(dir, netdev string, imp NetworkImpairment) (*netImpairer, []string, error) {
+	if err := imp.validate(); err != nil {
+		return nil, nil, err
+	}
+	ni := &netImpairer{
+		imp: imp,
+		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	var args []string
+	for _, queue := range []string{"rx", "tx"} {
+		p := &impairedPath{name: queue}
+		var err error
+		outPath := filepath.Join(dir, fmt.Sprintf("impair-%s-out.sock", queue))
+		if p.out, err = net.Listen("unix", outPath); err != nil {
+			ni.Close()
+			return nil, nil, err
+		}
+		inPath := filepath.Join(dir, fmt.Sprintf("impair-%s-in.sock", queue))
+		if p.in, err = net.Listen("unix", inPath); err != nil {
+			p.out.Close()
+			ni.Close()
+			return nil, nil, err
+		}
+		ni.paths = append(ni.paths, p)
+
+		outID := fmt.Sprintf("impair-%s-out", queue)
+		inID := fmt.Sprintf("impair-%s-in", queue)
+		args = append(args,
+			"-chardev", fmt.Sprintf("socket,id=%s,path=%s", outID, outPath),
+			"-chardev", fmt.Sprintf("socket,id=%s,path=%s", inID, inPath),
+			"-object", fmt.Sprintf("filter-redirector,id=impair-%s,netdev=%s,queue=%s,outdev=%s,indev=%s", queue, netdev, queue, outID, inID))
+	}
+	for _, p := range ni.paths {
+		ni.wg.Add(1)
+		go ni.serve(p)
+	}
+	return ni, args, nil
+}
+
+// Set changes the impairment of the frames sent from now on.
+func (ni *netImpairer) Set(imp NetworkImpairment) error {
+	if err := imp.validate(); err != nil {
+		return err
+	}
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+	ni.imp = imp
+	return nil
+}
+
+// Close stops forwarding frames.
+func (ni *netImpairer) Close() {
+	ni.mu.Lock()
+	for _, p := range ni.paths {
+		p.out.Close()
+		p.in.Close()
+	}
+	for _, conn := range ni.conns {
+		conn.Close()
+	}
+	ni.mu.Unlock()
+	ni.wg.Wait()
+}
+
+// accept waits for QEMU to connect to l.
+func (ni *netImpairer) accept(l net.Listener) (net.Conn, error) {
+	conn, err := l.Accept()
+	if err != nil {
+		return nil, err
+	}
+	ni.mu.Lock()
+	ni.conns = append(ni.conns, conn)
+	ni.mu.Unlock()
+	return conn, nil
+}
+
+func (ni *netImpairer) serve(p *impairedPath) {
+	defer ni.wg.Done()
+	out, err := ni.accept(p.out)
+	if err != nil {
+		return
+	}
+	defer out.Close()
+	in, err := ni.accept(p.in)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+
+	var wmu sync.Mutex
+	write := func(frame []byte) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		return writeFrame(in, frame)
+	}
+	queue := make(chan impairedFrame, impairedQueueLength)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for f := range queue {
+			time.Sleep(time.Until(f.at))
+			if err := write(f.frame); err != nil {
+				plog.Debugf("network impairment %s: %v", p.name, err)
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(queue)
+		<-done
+	}()
+
+	r := bufio.NewReader(out)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		// Leave SSH alone, so that kola keeps control of the machine.
+		if isSSHFrame(frame) {
+			if err := write(frame); err != nil {
+				return
+			}
+			continue
+		}
+		at, drop := ni.schedule(p, frame)
+		if drop {
+			continue
+		}
+		select {
+		case queue <- impairedFrame{at, frame}:
+		default:
+		}
+	}
+}
+
+// schedule returns when frame should be delivered, or whether it
+// should be dropped.
+func (ni *netImpairer) schedule(p *impairedPath, frame []byte) (time.Time, bool) {
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+	now := time.Now()
+	if ni.imp.Loss > 0 && ni.rnd.Float64() < ni.imp.Loss {
+		return time.Time{}, true
+	}
+	sent := now
+	if ni.imp.Bandwidth > 0 {
+		if p.nextFree.After(sent) {
+			sent = p.nextFree
+		}
+		sent = sent.Add(time.Duration(int64(len(frame)) * 8 * int64(time.Second) / ni.imp.Bandwidth))
+		p.nextFree = sent
+	}
+	return sent.Add(ni.imp.Latency), false
+}
+
+// isSSHFrame reports whether frame is an IPv4 TCP segment from or to
+// port 22.
+func isSSHFrame(frame []byte) bool {
+	const ethHeader = 14
+	if len(frame) < ethHeader+20 || binary.BigEndian.Uint16(frame[12:14]) != 0x0800 {
+		return false
+	}
+	ip := frame[ethHeader:]
+	ihl := int(ip[0]&0x0f) * 4
+	if ip[9] != 6 || len(ip) < ihl+4 {
+		return false
+	}
+	src := binary.BigEndian.Uint16(ip[ihl : ihl+2])
+	dst := binary.BigEndian.Uint16(ip[ihl+2 : ihl+4])
+	return src == 22 || dst == 22
+}
@@ -0,0 +1,99 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tcpFrame builds an IPv4 TCP frame between the given ports.
+func tcpFrame(srcPort, dstPort byte) []byte {
+	frame := make([]byte, 14+20+20)
+	frame[12], frame[13] = 0x08, 0x00
+	frame[14] = 0x45
+	frame[14+9] = 6
+	frame[14+20+1] = srcPort
+	frame[14+20+3] = dstPort
+	return frame
+}
+
+func TestNetImpairer(t *testing.T) {
+	dir := t.TempDir()
+	ni, args, err := newNetImpairer(dir, "eth0", NetworkImpairment{Latency: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ni.Close()
+	if !strings.Contains(strings.Join(args, " "), "filter-redirector,id=impair-rx,netdev=eth0,queue=rx") {
+		t.Errorf("unexpected arguments %v", args)
+	}
+
+	// Connect as QEMU would for the rx direction.
+	out, err := net.Dial("unix", filepath.Join(dir, "impair-rx-out.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	in, err := net.Dial("unix", filepath.Join(dir, "impair-rx-in.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+
+	// Frames are delayed, but SSH overtakes them.
+	delayed := tcpFrame(80, 80)
+	ssh := tcpFrame(22, 80)
+	start := time.Now()
+	if err := writeFrame(out, delayed); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(out, ssh); err != nil {
+		t.Fatal(err)
+	}
+	in.SetReadDeadline(time.Now().Add(5 * time.Second))
+	first, err := readFrame(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSSHFrame(first) {
+		t.Errorf("expected the SSH frame first")
+	}
+	if _, err := readFrame(in); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		t.Errorf("frame was delayed by only %v", elapsed)
+	}
+
+	// Everything else is dropped with full loss.
+	if err := ni.Set(NetworkImpairment{Loss: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(out, delayed); err != nil {
+		t.Fatal(err)
+	}
+	in.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if frame, err := readFrame(in); err == nil {
+		t.Errorf("unexpected frame %x", frame)
+	}
+
+	if err := ni.Set(NetworkImpairment{Loss: 2}); err == nil {
+		t.Errorf("expected invalid loss to be rejected")
+	}
+}
@@ -160,6 +160,10 @@ type MachineOptions struct {
 	AdditionalDisks []string
 	MinDiskSize     int
 	InstanceType    string
+	// PrivateNetwork connects the machine to a network shared with the
+	// other machines of the cluster which have it set, on which
+	// PrivateIP is reachable. Cloud platforms always have one.
+	PrivateNetwork bool
 
 	// Fields below are only supported on QEMU-based platforms.
 	// Non-QEMU platforms call EnsureNoQEMUOnlyOptions() to reject them.
@@ -177,6 +181,19 @@ type MachineOptions struct {
 	Nvme                      bool
 	Cex                       bool
 	BindMountHostRO           []string
+	// NetworkImpairment, if set, degrades the traffic of the machine
+	// as given; it can be changed at runtime through QEMUMachine.
+	NetworkImpairment *NetworkImpairment
+	// HotplugSlots, MaxMemory (in MiB) and MaxProcessors leave room
+	// for devices added at runtime through QEMUMachine. Slots are only
+	// needed for disks and NICs on PCIe machines (x86_64 with UEFI and
+	// aarch64).
+	HotplugSlots  int
+	MaxMemory     int
+	MaxProcessors int
+	// ReuseSnapshot allows booting from a snapshot of an identical
+	// machine, if enabled for the flight.
+	ReuseSnapshot bool
 }
 
 // EnsureNoQEMUOnlyOptions returns an error if any QEMU-only options
@@ -225,6 +242,15 @@ func (m *MachineOptions) EnsureNoQEMUOnlyOptions(platformName string) error {
 	if len(m.BindMountHostRO) > 0 {
 		return fmt.Errorf("platform %s does not support bind mounting host paths", platformName)
 	}
+	if m.NetworkImpairment != nil {
+		return fmt.Errorf("platform %s does not support network impairment", platformName)
+	}
+	if m.HotplugSlots != 0 || m.MaxMemory != 0 || m.MaxProcessors != 0 {
+		return fmt.Errorf("platform %s does not support hotplug", platformName)
+	}
+	if m.ReuseSnapshot {
+		return fmt.Errorf("platform %s does not support reusing snapshots", platformName)
+	}
 	return nil
 }
 
@@ -0,0 +1,256 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// maxFrameSize bounds the frames accepted from QEMU, which are at
+	// most 64k with offloads enabled.
+	maxFrameSize = 128 * 1024
+
+	// privateNetworkPrefix is the subnet of private networks; each
+	// network is isolated so they can all use the same one.
+	privateNetworkPrefix = "10.0.3"
+)
+
+// PrivateNetwork is an L2 segment shared by QEMU instances. It is a
+// learning switch in userspace which QEMU connects to with a socket
+// netdev, so that it works without privileges and stays isolated from
+// the host and other networks.
+type PrivateNetwork struct {
+	listener net.Listener
+
+	mu     sync.Mutex
+	ports  map[*privatePort]struct{}
+	macs   map[string]*privatePort
+	nextIP int
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// privatePort is the connection of a single QEMU NIC to the switch.
+type privatePort struct {
+	conn net.Conn
+	// wmu serializes writes of frames from other ports.
+	wmu sync.Mutex
+}
+
+// PrivateAddress is the address of a NIC on a private network.
+type PrivateAddress struct {
+	MAC  string
+	IP   string
+	CIDR string
+}
+
+// NewPrivateNetwork starts a private network listening on the loopback
+// interface.
+func NewPrivateNetwork() (*PrivateNetwork, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	n := &PrivateNetwork{
+		listener: l,
+		ports:    make(map[*privatePort]struct{}),
+		macs:     make(map[string]*privatePort),
+		nextIP:   2,
+	}
+	n.wg.Add(1)
+	go n.accept()
+	return n, nil
+}
+
+// Addr returns the address QEMU should connect to.
+func (n *PrivateNetwork) Addr() string {
+	return n.listener.Addr().String()
+}
+
+// AllocateAddress returns a new unique address on the network.
+func (n *PrivateNetwork) AllocateAddress() (PrivateAddress, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.nextIP > 254 {
+		return PrivateAddress{}, fmt.Errorf("private network is out of addresses")
+	}
+	host := n.nextIP
+	n.nextIP++
+	return PrivateAddress{
+		MAC:  fmt.Sprintf("52:54:00:ab:03:%02x", host),
+		IP:   fmt.Sprintf("%s.%d", privateNetworkPrefix, host),
+		CIDR: fmt.Sprintf("%s.%d/24", privateNetworkPrefix, host),
+	}, nil
+}
+
+// NMKeyfile returns a NetworkManager connection which statically
+// configures addr on the NIC with its MAC address.
+func (addr PrivateAddress) NMKeyfile() string {
+	return fmt.Sprintf(`[connection]
+id=kola-private
+type=ethernet
+autoconnect-priority=100
+
+[ethernet]
+mac-address=%s
+
+[ipv4]
+method=manual
+address1=%s
+never-default=true
+
+[ipv6]
+method=disabled
+`, addr.MAC, addr.CIDR)
+}
+
+// Close disconnects all instances and stops the network.
+func (n *PrivateNetwork) Close() error {
+	n.mu.Lock()
+	n.closed = true
+	for p := range n.ports {
+		p.conn.Close()
+	}
+	n.mu.Unlock()
+	err := n.listener.Close()
+	n.wg.Wait()
+	return err
+}
+
+func (n *PrivateNetwork) accept() {
+	defer n.wg.Done()
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		p := &privatePort{conn: conn}
+		n.mu.Lock()
+		if n.closed {
+			n.mu.Unlock()
+			conn.Close()
+			return
+		}
+		n.ports[p] = struct{}{}
+		n.mu.Unlock()
+		n.wg.Add(1)
+		go n.serve(p)
+	}
+}
+
+// serve forwards the frames received from p until it disconnects.
+func (n *PrivateNetwork) serve(p *privatePort) {
+	defer n.wg.Done()
+	defer func() {
+		n.mu.Lock()
+		delete(n.ports, p)
+		for mac, port := range n.macs {
+			if port == p {
+				delete(n.macs, mac)
+			}
+		}
+		n.mu.Unlock()
+		p.conn.Close()
+	}()
+
+	r := bufio.NewReader(p.conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF && !n.isClosed() {
+				plog.Debugf("private network: %v", err)
+			}
+			return
+		}
+		if len(frame) < 14 {
+			continue
+		}
+		for _, dst := range n.route(p, frame) {
+			dst.write(frame)
+		}
+	}
+}
+
+// route learns the source of frame and returns the ports it should be
+// forwarded to.
+func (n *PrivateNetwork) route(src *privatePort, frame []byte) []*privatePort {
+	dstMAC := net.HardwareAddr(frame[0:6]).String()
+	srcMAC := net.HardwareAddr(frame[6:12]).String()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.macs[srcMAC] = src
+	if frame[0]&1 == 0 {
+		if dst, ok := n.macs[dstMAC]; ok {
+			if dst == src {
+				return nil
+			}
+			return []*privatePort{dst}
+		}
+	}
+	// Flood broadcast, multicast and unknown destinations.
+	var dsts []*privatePort
+	for p := range n.ports {
+		if p != src {
+			dsts = append(dsts, p)
+		}
+	}
+	return dsts
+}
+
+func (n *PrivateNetwork) isClosed() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.closed
+}
+
+func (p *privatePort) write(frame []byte) {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	// A failed write means the port is going away, which its own
+	// goroutine will notice.
+	_ = writeFrame(p.conn, frame)
+}
+
+// readFrame reads a frame in the framing of QEMU stream netdevs: a 32-bit
+// big endian length followed by the frame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size > maxFrameSize {
+		return nil, fmt.Errorf("frame of %d bytes is too large", size)
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func writeFrame(w io.Writer, frame []byte) error {
+	buf := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+	_, err := w.Write(buf)
+	return err
+}
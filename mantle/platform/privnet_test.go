@@ -0,0 +1,116 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func testFrame(dst, src string, payload string) []byte {
+	d, _ := net.ParseMAC(dst)
+	s, _ := net.ParseMAC(src)
+	frame := append(append(append([]byte{}, d...), s...), 0x08, 0x00)
+	return append(frame, payload...)
+}
+
+func expectFrame(t *testing.T, conn net.Conn, want []byte) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	got, err := readFrame(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got frame %x, want %x", got, want)
+	}
+}
+
+func expectNoFrame(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if frame, err := readFrame(conn); err == nil {
+		t.Fatalf("unexpected frame %x", frame)
+	}
+}
+
+func TestPrivateNetwork(t *testing.T) {
+	n, err := NewPrivateNetwork()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.Close()
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", n.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	const a, b = "52:54:00:00:00:0a", "52:54:00:00:00:0b"
+
+	// Wait for all ports to be registered.
+	for start := time.Now(); ; {
+		n.mu.Lock()
+		ports := len(n.ports)
+		n.mu.Unlock()
+		if ports == len(conns) {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("ports did not connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Broadcasts are flooded, and teach the switch where a is.
+	broadcast := testFrame("ff:ff:ff:ff:ff:ff", a, "hello")
+	if err := writeFrame(conns[0], broadcast); err != nil {
+		t.Fatal(err)
+	}
+	expectFrame(t, conns[1], broadcast)
+	expectFrame(t, conns[2], broadcast)
+
+	// Unicast to a known address only goes to its port.
+	reply := testFrame(a, b, "reply")
+	if err := writeFrame(conns[1], reply); err != nil {
+		t.Fatal(err)
+	}
+	expectFrame(t, conns[0], reply)
+	expectNoFrame(t, conns[2])
+}
+
+func TestPrivateNetworkAddresses(t *testing.T) {
+	n := &PrivateNetwork{nextIP: 2}
+	addr, err := n.AllocateAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr.IP != "10.0.3.2" || addr.CIDR != "10.0.3.2/24" || addr.MAC != "52:54:00:ab:03:02" {
+		t.Errorf("unexpected address %+v", addr)
+	}
+	next, err := n.AllocateAddress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.IP == addr.IP || next.MAC == addr.MAC {
+		t.Errorf("addresses are not unique: %+v %+v", addr, next)
+	}
+}
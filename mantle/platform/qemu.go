@@ -76,6 +76,28 @@ type QEMUMachine interface {
 	RemovePrimaryBlockDevice() error
 	// RemoveBlockDeviceForMultipath removes the specified device on multipath.
 	RemoveBlockDeviceForMultipath(device string) error
+	// SetLink brings the primary NIC up or down.
+	SetLink(up bool) error
+	// SetNetworkImpairment changes how the traffic of the primary NIC is
+	// degraded; MachineOptions.NetworkImpairment must have been set.
+	SetNetworkImpairment(imp NetworkImpairment) error
+
+	// AddDisk attaches a new disk described as in --add-disk and returns
+	// its device id.
+	AddDisk(spec string) (string, error)
+	// AddNic attaches a new NIC on its own user mode network and returns
+	// its device id.
+	AddNic() (string, error)
+	// AddMemory plugs sizeMiB of memory, up to MachineOptions.MaxMemory,
+	// and returns its device id.
+	AddMemory(sizeMiB int) (string, error)
+	// AddCPU plugs a processor, up to MachineOptions.MaxProcessors, and
+	// returns its device id.
+	AddCPU() (string, error)
+	// RemoveDevice unplugs a device added by one of the above.
+	RemoveDevice(id string) error
+	// Devices returns the device tree of the machine.
+	Devices() ([]*QemuDevice, error)
 }
 
 // Disk holds the details of a virtual disk.
@@ -178,6 +200,15 @@ type QemuInstance struct {
 
 	qmpSocket     *qmp.SocketMonitor
 	qmpSocketPath string
+
+	// primaryDisk and its drive id, if any
+	primaryDisk   *Disk
+	primaryDiskID string
+
+	// impairer degrades the traffic of the primary NIC, if enabled
+	impairer *netImpairer
+
+	hotplug hotplugState
 }
 
 // Signaled returns whether QEMU process was signaled.
@@ -318,6 +349,11 @@ func (inst *QemuInstance) Destroy() {
 	}
 	inst.helpers = nil
 
+	if inst.impairer != nil {
+		inst.impairer.Close()
+		inst.impairer = nil
+	}
+
 	if inst.tempdir != "" {
 		if err := os.RemoveAll(inst.tempdir); err != nil {
 			plog.Errorf("Error removing tempdir: %v", err)
@@ -469,6 +505,63 @@ func (inst *QemuInstance) RemoveBlockDeviceForMultipath(device string) error {
 	return nil
 }
 
+// SetLink brings the NIC attached to netdev up or down, as if its cable
+// was plugged or unplugged. The netdev of the primary NIC is "eth0".
+func (inst *QemuInstance) SetLink(netdev string, up bool) error {
+	return inst.setLink(netdev, up)
+}
+
+// SetNetworkImpairment changes how the traffic of the primary NIC is
+// degraded. It must have been enabled with EnableNetworkImpairment.
+func (inst *QemuInstance) SetNetworkImpairment(imp NetworkImpairment) error {
+	if inst.impairer == nil {
+		return fmt.Errorf("network impairment is not enabled")
+	}
+	return inst.impairer.Set(imp)
+}
+
+// SnapshotPrimaryDisk writes the current state of the primary disk to a
+// new qcow2 image at target, which has the same backing file as the
+// primary disk and so only contains the blocks written since boot. The
+// guest is paused while the snapshot is taken; callers should have it
+// flush its filesystems first. Memory state is not captured.
+func (inst *QemuInstance) SnapshotPrimaryDisk(target string) (err2 error) {
+	disk := inst.primaryDisk
+	if disk == nil || disk.BackingFile == "" {
+		return fmt.Errorf("no primary disk with a backing file to snapshot")
+	}
+	if disk.MultiPathDisk || disk.NbdDisk {
+		return fmt.Errorf("cannot snapshot a primary disk served over NBD")
+	}
+	backingFile, err := resolveBackingFile(disk.BackingFile)
+	if err != nil {
+		return err
+	}
+	qcow2Opts := fmt.Sprintf("nocow=on,backing_file=%s", backingFile)
+	if format := disk.backingFormat(backingFile); format != "" {
+		qcow2Opts += fmt.Sprintf(",backing_fmt=%s", format)
+	}
+	imgOpts := []string{"create", "-f", "qcow2", "-o", qcow2Opts, target}
+	if disk.Size != "" {
+		imgOpts = append(imgOpts, disk.Size)
+	}
+	qemuImg := exec.Command("qemu-img", imgOpts...)
+	qemuImg.Stderr = os.Stderr
+	if err := qemuImg.Run(); err != nil {
+		return errors.Wrapf(err, "creating snapshot image")
+	}
+
+	if err := inst.stopCPUs(); err != nil {
+		return err
+	}
+	defer func() {
+		if err := inst.resumeCPUs(); err != nil && err2 == nil {
+			err2 = err
+		}
+	}()
+	return inst.backupBlockDevice(inst.primaryDiskID, target)
+}
+
 // A directory mounted from the host into the guest, via 9p or virtiofs
 type HostMount struct {
 	src      string
@@ -533,12 +626,19 @@ type QemuBuilder struct {
 	RestrictNetworking        bool
 	requestedHostForwardPorts []HostForwardPort
 	additionalNics            int
+	privateNetworkAddr        string
+	privateNetworkMAC         string
+	networkImpairment         *NetworkImpairment
+	hotplugSlots              int
+	maxMemoryMiB              int
+	maxProcessors             int
 	netbootP                  string
 	netbootDir                string
 
-	finalized bool
-	diskID    uint
-	disks     []*Disk
+	finalized     bool
+	diskID        uint
+	disks         []*Disk
+	primaryDiskID string
 	// virtioSerialID is incremented for each device
 	virtioSerialID uint
 	// hostMounts is an array of directories mounted (via 9p or virtiofs) from the host
@@ -637,6 +737,12 @@ func (builder *QemuBuilder) AddFd(fd *os.File) string {
 
 // virtio returns a virtio device argument for qemu, which is architecture dependent
 func virtio(arch, device, args string) string {
+	return fmt.Sprintf("%s,%s", virtioDriver(arch, device), args)
+}
+
+// virtioDriver returns the name of the virtio device of the given type
+// for the architecture.
+func virtioDriver(arch, device string) string {
 	var suffix string
 	switch arch {
 	case "x86_64", "ppc64le", "aarch64":
@@ -646,7 +752,7 @@ func virtio(arch, device, args string) string {
 	default:
 		panic(fmt.Sprintf("RpmArch %s unhandled in virtio()", arch))
 	}
-	return fmt.Sprintf("virtio-%s-%s,%s", device, suffix, args)
+	return fmt.Sprintf("virtio-%s-%s", device, suffix)
 }
 
 // EnableUsermodeNetworking configure forwarding for all requested ports,
@@ -667,6 +773,19 @@ func (builder *QemuBuilder) AddAdditionalNics(additionalNics int) {
 	builder.additionalNics = additionalNics
 }
 
+// EnableNetworkImpairment routes the traffic of the user mode network
+// through kola so that it can be degraded, initially as set in imp.
+func (builder *QemuBuilder) EnableNetworkImpairment(imp NetworkImpairment) {
+	builder.networkImpairment = &imp
+}
+
+// AddPrivateNic attaches a NIC with the given MAC address to the
+// PrivateNetwork listening on addr.
+func (builder *QemuBuilder) AddPrivateNic(addr, mac string) {
+	builder.privateNetworkAddr = addr
+	builder.privateNetworkMAC = mac
+}
+
 func (builder *QemuBuilder) setupNetworking() error {
 	netdev := "user,id=eth0"
 	for i := range builder.requestedHostForwardPorts {
@@ -747,6 +866,16 @@ func (builder *QemuBuilder) setupAdditionalNetworking() error {
 	return nil
 }
 
+func (builder *QemuBuilder) setupPrivateNetworking() {
+	netdev := fmt.Sprintf("socket,id=priv0,connect=%s", builder.privateNetworkAddr)
+	device := virtio(builder.architecture, "net", fmt.Sprintf("netdev=priv0,mac=%s", builder.privateNetworkMAC))
+	// Keep clear of the devnos of the additional NICs, see above.
+	if builder.architecture == "s390x" {
+		device += ",devno=fe.2.0000"
+	}
+	builder.Append("-netdev", netdev, "-device", device)
+}
+
 // SetArchitecture enables qemu full emulation for the target architecture.
 func (builder *QemuBuilder) SetArchitecture(arch string) error {
 	switch arch {
@@ -1094,6 +1223,22 @@ func resolveBackingFile(backingFile string) (string, error) {
 	return backingFile, nil
 }
 
+// backingFormat returns the format of the resolved backing file of the
+// disk, or "" if it is unknown.
+func (disk *Disk) backingFormat(backingFile string) string {
+	if disk.BackingFormat != "" {
+		return disk.BackingFormat
+	}
+	// QEMU 5 warns if format is omitted, let's do detection for the common case
+	// on our own.
+	if strings.HasSuffix(backingFile, "qcow2") {
+		return "qcow2"
+	} else if strings.HasSuffix(backingFile, "raw") {
+		return "raw"
+	}
+	return ""
+}
+
 // prepare creates the target disk and sets all the runtime attributes
 // for use by the QemuBuilder.
 func (disk *Disk) prepare(builder *QemuBuilder) error {
@@ -1119,17 +1264,7 @@ func (disk *Disk) prepare(builder *QemuBuilder) error {
 			return err
 		}
 		qcow2Opts += fmt.Sprintf(",backing_file=%s,lazy_refcounts=on", backingFile)
-		format := disk.BackingFormat
-		if format == "" {
-			// QEMU 5 warns if format is omitted, let's do detection for the common case
-			// on our own.
-			if strings.HasSuffix(backingFile, "qcow2") {
-				format = "qcow2"
-			} else if strings.HasSuffix(backingFile, "raw") {
-				format = "raw"
-			}
-		}
-		if format != "" {
+		if format := disk.backingFormat(backingFile); format != "" {
 			qcow2Opts += fmt.Sprintf(",backing_fmt=%s", format)
 		}
 	}
@@ -1230,6 +1365,9 @@ func (builder *QemuBuilder) addDiskImpl(disk *Disk, primary bool) error {
 	}
 
 	id := fmt.Sprintf("disk-%d", builder.diskID)
+	if primary {
+		builder.primaryDiskID = id
+	}
 
 	// Avoid file locking detection, and the disks we create
 	// here are always currently ephemeral.
@@ -1842,6 +1980,9 @@ func (builder *QemuBuilder) Exec() (*QemuInstance, error) {
 	if err != nil {
 		return nil, err
 	}
+	if argv, err = builder.setupHotplug(argv, &inst); err != nil {
+		return nil, err
+	}
 
 	switch builder.Firmware {
 	case "":
@@ -1929,6 +2070,18 @@ func (builder *QemuBuilder) Exec() (*QemuInstance, error) {
 			return nil, err
 		}
 		inst.hostForwardedPorts = builder.requestedHostForwardPorts
+
+		if builder.networkImpairment != nil {
+			if err := builder.ensureTempdir(); err != nil {
+				return nil, err
+			}
+			impairer, args, err := newNetImpairer(builder.tempdir, "eth0", *builder.networkImpairment)
+			if err != nil {
+				return nil, errors.Wrapf(err, "setting up network impairment")
+			}
+			inst.impairer = impairer
+			builder.Append(args...)
+		}
 	}
 
 	// Handle Additional NICs networking
@@ -1938,6 +2091,10 @@ func (builder *QemuBuilder) Exec() (*QemuInstance, error) {
 		}
 	}
 
+	if builder.privateNetworkAddr != "" {
+		builder.setupPrivateNetworking()
+	}
+
 	// Handle Software TPM
 	if builder.Swtpm && builder.supportsSwtpm() {
 		err = builder.ensureTempdir()
@@ -2100,6 +2257,8 @@ func (builder *QemuBuilder) Exec() (*QemuInstance, error) {
 	inst.tempdir = builder.tempdir
 	builder.tempdir = ""
 	cleanupInst = false
+	inst.primaryDisk = builder.primaryDisk
+	inst.primaryDiskID = builder.primaryDiskID
 
 	// Connect to the QMP socket which allows us to control qemu.  We wait up to 30s
 	// to avoid flakes on loaded CI systems.  But, probably rather than bumping this
@@ -19,6 +19,7 @@ package platform
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -99,3 +100,163 @@ func (inst *QemuInstance) deleteBlockDevice(device string) error {
 	}
 	return nil
 }
+
+// setLink uses the qmp socket to change the link status of a NIC.
+func (inst *QemuInstance) setLink(name string, up bool) error {
+	cmd := fmt.Sprintf(`{ "execute": "set_link", "arguments": { "name": "%s", "up": %t } }`, name, up)
+	if _, err := inst.runQmpCommand(cmd); err != nil {
+		return errors.Wrapf(err, "Setting link of %s up=%t", name, up)
+	}
+	return nil
+}
+
+// stopCPUs uses the qmp socket to pause the guest.
+func (inst *QemuInstance) stopCPUs() error {
+	if _, err := inst.runQmpCommand(`{ "execute": "stop" }`); err != nil {
+		return errors.Wrapf(err, "Stopping guest")
+	}
+	return nil
+}
+
+// resumeCPUs uses the qmp socket to resume a paused guest.
+func (inst *QemuInstance) resumeCPUs() error {
+	if _, err := inst.runQmpCommand(`{ "execute": "cont" }`); err != nil {
+		return errors.Wrapf(err, "Resuming guest")
+	}
+	return nil
+}
+
+// QMPJobs is the output of the query-jobs command.
+type QMPJobs struct {
+	Return []struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+		Error  string `json:"error"`
+	} `json:"return"`
+}
+
+// backupBlockDevice uses the qmp socket to copy the top layer of a block
+// device to the existing qcow2 image target, and waits for it to finish.
+func (inst *QemuInstance) backupBlockDevice(device, target string) (err2 error) {
+	const node = "backup-target"
+	const job = "backup"
+	addcmd := fmt.Sprintf(`{ "execute": "blockdev-add", "arguments": { "driver": "qcow2", "node-name": "%s", "backing": null, "file": { "driver": "file", "filename": "%s" } } }`,
+		node, target)
+	if _, err := inst.runQmpCommand(addcmd); err != nil {
+		return errors.Wrapf(err, "Adding block device %s", target)
+	}
+	defer func() {
+		delcmd := fmt.Sprintf(`{ "execute": "blockdev-del", "arguments": { "node-name": "%s" } }`, node)
+		if _, err := inst.runQmpCommand(delcmd); err != nil && err2 == nil {
+			err2 = errors.Wrapf(err, "Removing block device %s", target)
+		}
+	}()
+
+	backupcmd := fmt.Sprintf(`{ "execute": "blockdev-backup", "arguments": { "job-id": "%s", "device": "%s", "target": "%s", "sync": "top", "auto-dismiss": false } }`,
+		job, device, node)
+	if _, err := inst.runQmpCommand(backupcmd); err != nil {
+		return errors.Wrapf(err, "Backing up block device %s", device)
+	}
+	defer func() {
+		dismisscmd := fmt.Sprintf(`{ "execute": "job-dismiss", "arguments": { "id": "%s" } }`, job)
+		if _, err := inst.runQmpCommand(dismisscmd); err != nil && err2 == nil {
+			err2 = errors.Wrapf(err, "Dismissing job %s", job)
+		}
+	}()
+
+	for {
+		out, err := inst.runQmpCommand(`{ "execute": "query-jobs" }`)
+		if err != nil {
+			return errors.Wrapf(err, "Running QMP query-jobs command")
+		}
+		var jobs QMPJobs
+		if err := json.Unmarshal(out, &jobs); err != nil {
+			return errors.Wrapf(err, "De-serializing QMP query-jobs output")
+		}
+		for _, j := range jobs.Return {
+			if j.ID != job || j.Status != "concluded" {
+				continue
+			}
+			if j.Error != "" {
+				return fmt.Errorf("backing up block device %s: %s", device, j.Error)
+			}
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// QMPHotpluggableCPU is an entry of the output of query-hotpluggable-cpus.
+type QMPHotpluggableCPU struct {
+	Type  string                 `json:"type"`
+	Props map[string]interface{} `json:"props"`
+	// QOMPath is set if the processor is plugged.
+	QOMPath string `json:"qom-path"`
+}
+
+// QMPHotpluggableCPUs is the output of query-hotpluggable-cpus.
+type QMPHotpluggableCPUs struct {
+	Return []QMPHotpluggableCPU `json:"return"`
+}
+
+// runQmpCommandArgs executes a qemu command with the given arguments over
+// the QMP socket.
+func (inst *QemuInstance) runQmpCommandArgs(execute string, args map[string]interface{}) ([]byte, error) {
+	cmd, err := json.Marshal(map[string]interface{}{"execute": execute, "arguments": args})
+	if err != nil {
+		return nil, err
+	}
+	return inst.runQmpCommand(string(cmd))
+}
+
+// deviceAdd uses the qmp socket to plug a device.
+func (inst *QemuInstance) deviceAdd(args map[string]interface{}) error {
+	if _, err := inst.runQmpCommandArgs("device_add", args); err != nil {
+		return errors.Wrapf(err, "Adding device %v", args["id"])
+	}
+	return nil
+}
+
+// listQOM uses the qmp socket to list the properties of a QOM object.
+func (inst *QemuInstance) listQOM(path string) (*QOMDev, error) {
+	out, err := inst.runQmpCommandArgs("qom-list", map[string]interface{}{"path": path})
+	if err != nil {
+		return nil, errors.Wrapf(err, "Running QMP qom-list command")
+	}
+
+	var devs QOMDev
+	if err = json.Unmarshal(out, &devs); err != nil {
+		return nil, errors.Wrapf(err, "De-serializing QMP qom-list output")
+	}
+	return &devs, nil
+}
+
+// qomGetString uses the qmp socket to read a string or link property of
+// a QOM object.
+func (inst *QemuInstance) qomGetString(path, property string) (string, error) {
+	out, err := inst.runQmpCommandArgs("qom-get", map[string]interface{}{"path": path, "property": property})
+	if err != nil {
+		return "", errors.Wrapf(err, "Getting %s of %s", property, path)
+	}
+	var ret struct {
+		Return string `json:"return"`
+	}
+	if err = json.Unmarshal(out, &ret); err != nil {
+		return "", errors.Wrapf(err, "De-serializing QMP qom-get output")
+	}
+	return ret.Return, nil
+}
+
+// listHotpluggableCPUs uses the qmp socket to list the processor slots.
+func (inst *QemuInstance) listHotpluggableCPUs() (*QMPHotpluggableCPUs, error) {
+	out, err := inst.runQmpCommand(`{ "execute": "query-hotpluggable-cpus" }`)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Running QMP query-hotpluggable-cpus command")
+	}
+
+	var cpus QMPHotpluggableCPUs
+	if err = json.Unmarshal(out, &cpus); err != nil {
+		return nil, errors.Wrapf(err, "De-serializing QMP query-hotpluggable-cpus output")
+	}
+	return &cpus, nil
+}
@@ -15,6 +15,7 @@
 package platform
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
@@ -92,6 +93,62 @@ func Manhole(m Machine) (err error) {
 	return nil
 }
 
+// SSHContext runs cmd over a new SSH connection to m like m.SSH, but
+// gives up when ctx is done, closing the connection which ends the
+// remote command. Unlike m.SSH, stdout and stderr aren't trimmed.
+func SSHContext(ctx context.Context, m Machine, cmd string) ([]byte, []byte, error) {
+	type dialResult struct {
+		client *ssh.Client
+		err    error
+	}
+	dialed := make(chan dialResult, 1)
+	go func() {
+		client, err := m.SSHClient()
+		dialed <- dialResult{client, err}
+	}()
+	var client *ssh.Client
+	select {
+	case r := <-dialed:
+		if r.err != nil {
+			return nil, nil, r.err
+		}
+		client = r.client
+	case <-ctx.Done():
+		// The dialer gives up on its own; close the client if it
+		// still connects.
+		go func() {
+			if r := <-dialed; r.client != nil {
+				r.client.Close()
+			}
+		}()
+		return nil, nil, ctx.Err()
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Start(cmd); err != nil {
+		return nil, nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		client.Close()
+		<-done
+		err = ctx.Err()
+	}
+	return stdout.Bytes(), stderr.Bytes(), err
+}
+
 // Reboots a machine, stopping ssh first.
 // Afterwards run CheckMachine to verify the system is back and operational.
 func StartReboot(m Machine) error {
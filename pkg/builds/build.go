@@ -15,6 +15,7 @@
 package builds
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -50,11 +51,6 @@ const (
 	CosaMetaJSON = "meta.json"
 )
 
-type objectInfo struct {
-	info os.FileInfo
-	name string
-}
-
 // SetArch overrides the build arch
 func SetArch(a string) {
 	forceArch = a
@@ -69,25 +65,6 @@ func BuilderArch() string {
 	return coreosarch.CurrentRpmArch()
 }
 
-// defaultWalkFunc walks over a directory and returns a channel of os.FileInfo
-func walkFn(p string) <-chan *objectInfo {
-	ret := make(chan *objectInfo)
-	go func() {
-		defer close(ret) //nolint
-		_ = filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil
-			}
-			ret <- &objectInfo{
-				name: filepath.Join(p, info.Name()),
-				info: info,
-			}
-			return nil
-		})
-	}()
-	return ret
-}
-
 // ReadBuild returns a build upon finding a meta.json. Returns a Build, the path string
 // to the build, and an error (if any). If the buildID is not set, "latest" is assumed.
 func ReadBuild(dir, buildID, arch string) (*Build, string, error) {
@@ -116,6 +93,7 @@ func ReadBuild(dir, buildID, arch string) (*Build, string, error) {
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to open %s to read meta.json: %w", p, err)
 	}
+	defer f.Close()
 
 	b, err := buildParser(f)
 	if err != nil {
@@ -126,38 +104,67 @@ func ReadBuild(dir, buildID, arch string) (*Build, string, error) {
 	// into the memory model of the build
 	if b != nil && b.CosaDelayedMetaMerge {
 		log.Info("Searching for extra meta.json files")
-		files := walkFn(p)
-		for {
-			fi, ok := <-files
-			if !ok {
-				break
-			}
-			if fi == nil || fi.info.IsDir() || fi.info.Name() == CosaMetaJSON {
-				continue
-			}
-			if !IsMetaJSON(fi.info.Name()) {
-				continue
-			}
-			log.WithField("extra meta.json", fi.name).Info("found meta")
-			f, err := os.Open(filepath.Join(p, fi.info.Name()))
-			if err != nil {
-				return b, p, err
-			}
-			defer f.Close()
-			if err := b.mergeMeta(f); err != nil {
-				return b, p, err
-			}
+		fragments, err := readMetaFragments(p)
+		if err != nil {
+			return b, p, err
+		}
+		for _, f := range fragments {
+			log.WithField("extra meta.json", f.name).Info("found meta")
+		}
+		b, err = foldBuild(filepath.Join(p, CosaMetaJSON), fragments)
+		if err != nil {
+			return nil, p, err
 		}
 	}
 
 	return b, p, err
 }
 
+// ReadBuildVerified is ReadBuild, also verifying the signatures recorded
+// in meta.json of the artifacts present in the build directory: it fails
+// unless each has a valid signature from one of verifiers.
+func ReadBuildVerified(dir, buildID, arch string, verifiers ...SignatureVerifier) (*Build, string, error) {
+	if len(verifiers) == 0 {
+		return nil, "", fmt.Errorf("no signature verifiers given")
+	}
+	b, p, err := ReadBuild(dir, buildID, arch)
+	if err != nil {
+		return b, p, err
+	}
+	if err := b.checkSignatures(p, verifiers); err != nil {
+		return b, p, err
+	}
+	return b, p, nil
+}
+
+// foldBuild returns the build of the meta.json at path with fragments
+// merged in, as FoldMeta would write it.
+func foldBuild(path string, fragments []metaFragment) (*Build, error) {
+	var meta map[string]interface{}
+	if err := readJSONFile(path, &meta); err != nil {
+		return nil, err
+	}
+	return foldBuildJSON(meta, fragments)
+}
+
+func foldBuildJSON(meta map[string]interface{}, fragments []metaFragment) (*Build, error) {
+	if err := foldMetaFragments(meta, fragments); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	return buildParser(bytes.NewReader(data))
+}
+
 func buildParser(r io.Reader) (*Build, error) {
-	dec := json.NewDecoder(r)
-	dec.DisallowUnknownFields()
-	var cosaBuild *Build
-	if err := dec.Decode(&cosaBuild); err != nil {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read build")
+	}
+	cosaBuild, err := decodeMeta(data)
+	if err != nil {
 		return nil, errors.Wrapf(err, "failed to parse build")
 	}
 	return cosaBuild, nil
@@ -177,7 +184,8 @@ func ParseBuild(path string) (*Build, error) {
 	return b, err
 }
 
-// WriteMeta records the meta-data. Writes are local only.
+// WriteMeta records the meta-data. Writes are local only, and atomic, but
+// unlike UpdateMeta they replace any concurrent change of meta.json.
 func (build *Build) WriteMeta(path string, validate bool) error {
 	if validate {
 		if err := build.Validate(); len(err) != 0 {
@@ -188,7 +196,7 @@ func (build *Build) WriteMeta(path string, validate bool) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, out, 0644)
+	return writeFileAtomic(path, out)
 }
 
 // GetArtifact returns an artifact by JSON tag
@@ -236,6 +244,12 @@ func GetCommandBuildableArtifacts() []string {
 			continue
 		case "kernel", "initramfs":
 			continue
+		case SBOMSPDXArtifact, SBOMCycloneDXArtifact:
+			// Made by `cosa sbom`
+			continue
+		case ProvenanceArtifact:
+			// Made by `cosa provenance`
+			continue
 		case "iso", "live-iso", "live-kernel", "live-initramfs", "live-rootfs":
 			if !liveAdded {
 				ret = append(ret, "live")
@@ -294,13 +308,6 @@ func (build *Build) artifacts() map[string]*Artifact {
 	return ret
 }
 
-// mergeMeta uses JSON to merge in the data
-func (b *Build) mergeMeta(r io.Reader) error {
-	dec := json.NewDecoder(r)
-	dec.DisallowUnknownFields()
-	return dec.Decode(b)
-}
-
 // IsMetaJSON is a helper for identifying if a file is meta.json
 func IsMetaJSON(path string) bool {
 	b := filepath.Base(path)
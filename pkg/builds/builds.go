@@ -6,6 +6,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -26,12 +28,21 @@ type build struct {
 	Arches []string `json:"arches"`
 }
 
+// Tag is a named reference to a build, as managed by cosa tag.
+type Tag struct {
+	Name        string `json:"name"`
+	Target      string `json:"target"`
+	Created     string `json:"created,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
 // BuildsJSON represents the JSON that records the builds
 // TODO: this should be generated by a schema
 type BuildsJSON struct {
 	SchemaVersion string  `json:"schema-version"`
 	Builds        []build `json:"builds"`
 	TimeStamp     string  `json:"timestamp"`
+	Tags          []Tag   `json:"tags,omitempty"`
 }
 
 func GetBuilds(dir string) (*BuildsJSON, error) {
@@ -45,8 +56,14 @@ func GetBuilds(dir string) (*BuildsJSON, error) {
 	if _, err := io.Copy(bufD, f); err != nil {
 		return nil, err
 	}
+	return ParseBuilds(bufD.Bytes())
+}
+
+// ParseBuilds parses the contents of a builds.json, e.g. one read from a
+// remote session.
+func ParseBuilds(data []byte) (*BuildsJSON, error) {
 	b := &BuildsJSON{}
-	if err := json.Unmarshal(bufD.Bytes(), b); err != nil {
+	if err := json.Unmarshal(data, b); err != nil {
 		return nil, err
 	}
 	return b, nil
@@ -63,3 +80,290 @@ func (b *BuildsJSON) getLatest(arch string) (string, bool) {
 	}
 	return "", false
 }
+
+// Latest returns the latest build for the arch.
+func (b *BuildsJSON) Latest(arch string) (string, bool) {
+	return b.getLatest(arch)
+}
+
+// Arches returns the architectures of the builds, sorted.
+func (b *BuildsJSON) Arches() []string {
+	seen := make(map[string]bool)
+	var ret []string
+	for _, build := range b.Builds {
+		for _, a := range build.Arches {
+			if !seen[a] {
+				seen[a] = true
+				ret = append(ret, a)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// BuildRef identifies the build of an architecture.
+type BuildRef struct {
+	ID   string `json:"id"`
+	Arch string `json:"arch"`
+}
+
+// Missing returns the builds of b which other doesn't have, newest
+// first. other may be nil.
+func (b *BuildsJSON) Missing(other *BuildsJSON) []BuildRef {
+	have := make(map[BuildRef]bool)
+	if other != nil {
+		for _, build := range other.Builds {
+			for _, a := range build.Arches {
+				have[BuildRef{build.ID, a}] = true
+			}
+		}
+	}
+	var ret []BuildRef
+	for _, build := range b.Builds {
+		for _, a := range build.Arches {
+			if ref := (BuildRef{build.ID, a}); !have[ref] {
+				ret = append(ret, ref)
+			}
+		}
+	}
+	return ret
+}
+
+// MergeBuildsJSON merges the builds.json other, e.g. one read from a
+// remote session, into the builds.json of the builds directory dir. The
+// builds of both are kept, with the arches of a build listed by both
+// merged, and ordered newest first by the build timestamps of their
+// meta.json in dir. The order of each list is kept, so a build without a
+// timestamp directly follows the build before it in its own list. Tags of
+// the same name take the most recently created one. Fields this package
+// doesn't know about are kept, and the local builds.json is written
+// atomically with a new timestamp.
+func MergeBuildsJSON(dir string, other []byte) error {
+	path := filepath.Join(dir, CosaBuildsJSON)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return writeFileAtomic(path, other)
+	} else if err != nil {
+		return err
+	}
+
+	var doc, otherDoc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return errors.Wrapf(err, "parsing %s", path)
+	}
+	if err := json.Unmarshal(other, &otherDoc); err != nil {
+		return errors.Wrap(err, "parsing merged builds.json")
+	}
+	local, err := parseBuildEntries(doc["builds"])
+	if err != nil {
+		return errors.Wrapf(err, "parsing builds of %s", path)
+	}
+	remote, err := parseBuildEntries(otherDoc["builds"])
+	if err != nil {
+		return errors.Wrap(err, "parsing builds of merged builds.json")
+	}
+
+	byID := make(map[string]*buildEntry)
+	for _, e := range local {
+		byID[e.ID] = e
+	}
+	var added []*buildEntry
+	for _, e := range remote {
+		if l, ok := byID[e.ID]; ok {
+			l.mergeArches(e.Arches)
+		} else {
+			byID[e.ID] = e
+			added = append(added, e)
+		}
+	}
+	timestamps := make(map[string]time.Time)
+	timestamp := func(e *buildEntry) time.Time {
+		if ts, ok := timestamps[e.ID]; ok {
+			return ts
+		}
+		var ret time.Time
+		for _, arch := range e.Arches {
+			meta, err := readMetaLenient(filepath.Join(dir, e.ID, arch, CosaMetaJSON))
+			if err != nil {
+				continue
+			}
+			if ts, err := time.Parse(time.RFC3339, meta.BuildTimeStamp); err == nil && ts.After(ret) {
+				ret = ts
+			}
+		}
+		timestamps[e.ID] = ret
+		return ret
+	}
+	// takeAdded tells whether the next build comes from added rather
+	// than local. A build without a timestamp can't be compared, so it's
+	// taken as soon as it's at the head of its list.
+	takeAdded := func() bool {
+		switch {
+		case len(added) == 0:
+			return false
+		case len(local) == 0:
+			return true
+		case timestamp(local[0]).IsZero():
+			return false
+		case timestamp(added[0]).IsZero():
+			return true
+		}
+		return timestamp(added[0]).After(timestamp(local[0]))
+	}
+	// Both lists are newest first already, so interleave them.
+	merged := []json.RawMessage{}
+	for len(local) > 0 || len(added) > 0 {
+		var e *buildEntry
+		if takeAdded() {
+			e, added = added[0], added[1:]
+		} else {
+			e, local = local[0], local[1:]
+		}
+		raw, err := e.marshal()
+		if err != nil {
+			return err
+		}
+		merged = append(merged, raw)
+	}
+	if doc["builds"], err = json.Marshal(merged); err != nil {
+		return err
+	}
+
+	if _, ok := otherDoc["tags"]; ok {
+		var tags, otherTags []map[string]json.RawMessage
+		if raw, ok := doc["tags"]; ok {
+			if err := json.Unmarshal(raw, &tags); err != nil {
+				return errors.Wrapf(err, "parsing tags of %s", path)
+			}
+		}
+		if err := json.Unmarshal(otherDoc["tags"], &otherTags); err != nil {
+			return errors.Wrap(err, "parsing tags of merged builds.json")
+		}
+		merged, err := mergeTags(tags, otherTags)
+		if err != nil {
+			return errors.Wrap(err, "merging tags")
+		}
+		if doc["tags"], err = json.Marshal(merged); err != nil {
+			return err
+		}
+	}
+
+	if doc["timestamp"], err = json.Marshal(time.Now().UTC().Format("2006-01-02T15:04:05Z")); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, out)
+}
+
+// buildEntry is a build of builds.json along with its raw JSON, which
+// may have fields this package doesn't know about.
+type buildEntry struct {
+	build
+	raw     map[string]json.RawMessage
+	changed bool
+}
+
+func parseBuildEntries(data json.RawMessage) ([]*buildEntry, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	var ret []*buildEntry
+	for _, raw := range raws {
+		e := &buildEntry{}
+		if err := json.Unmarshal(raw, &e.build); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &e.raw); err != nil {
+			return nil, err
+		}
+		ret = append(ret, e)
+	}
+	return ret, nil
+}
+
+// mergeArches adds the arches the entry lacks.
+func (e *buildEntry) mergeArches(arches []string) {
+	have := make(map[string]bool)
+	for _, a := range e.Arches {
+		have[a] = true
+	}
+	for _, a := range arches {
+		if !have[a] {
+			have[a] = true
+			e.Arches = append(e.Arches, a)
+			e.changed = true
+		}
+	}
+}
+
+func (e *buildEntry) marshal() (json.RawMessage, error) {
+	if e.changed {
+		arches, err := json.Marshal(e.Arches)
+		if err != nil {
+			return nil, err
+		}
+		e.raw["arches"] = arches
+	}
+	return json.Marshal(e.raw)
+}
+
+// mergeTags merges the tags of other into tags. Tags of the same name
+// are replaced by the most recently created one, or kept from tags if
+// that can't be told. The tags are handled as raw JSON objects so that
+// their fields this package doesn't know about are kept.
+func mergeTags(tags, other []map[string]json.RawMessage) ([]map[string]json.RawMessage, error) {
+	field := func(t map[string]json.RawMessage, key string) (string, error) {
+		var ret string
+		if raw, ok := t[key]; ok {
+			if err := json.Unmarshal(raw, &ret); err != nil {
+				return "", errors.Wrapf(err, "parsing tag field %s", key)
+			}
+		}
+		return ret, nil
+	}
+	byName := make(map[string]int)
+	for i, t := range tags {
+		name, err := field(t, "name")
+		if err != nil {
+			return nil, err
+		}
+		byName[name] = i
+	}
+	for _, t := range other {
+		name, err := field(t, "name")
+		if err != nil {
+			return nil, err
+		}
+		i, ok := byName[name]
+		if !ok {
+			byName[name] = len(tags)
+			tags = append(tags, t)
+			continue
+		}
+		oursCreated, err := field(tags[i], "created")
+		if err != nil {
+			return nil, err
+		}
+		theirsCreated, err := field(t, "created")
+		if err != nil {
+			return nil, err
+		}
+		ours, errOurs := time.Parse(time.RFC3339, oursCreated)
+		theirs, errTheirs := time.Parse(time.RFC3339, theirsCreated)
+		if errOurs == nil && errTheirs == nil && theirs.After(ours) {
+			tags[i] = t
+		}
+	}
+	return tags, nil
+}
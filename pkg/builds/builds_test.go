@@ -1,8 +1,10 @@
 package builds
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -55,3 +57,115 @@ func TestCanArtifact(t *testing.T) {
 		t.Errorf("darkCloud is not a valid cloud")
 	}
 }
+
+func TestBuildsMissing(t *testing.T) {
+	remote, err := ParseBuilds([]byte(`{"builds": [
+		{"id": "41.3", "arches": ["x86_64"]},
+		{"id": "41.2", "arches": ["x86_64", "aarch64"]},
+		{"id": "41.1", "arches": ["x86_64"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, err := ParseBuilds([]byte(`{"builds": [
+		{"id": "41.2", "arches": ["x86_64"]},
+		{"id": "41.1", "arches": ["x86_64"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []BuildRef{{"41.3", "x86_64"}, {"41.2", "aarch64"}}
+	if got := remote.Missing(local); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := remote.Missing(nil); len(got) != 4 {
+		t.Errorf("expected all builds, got %v", got)
+	}
+	if got := remote.Arches(); !reflect.DeepEqual(got, []string{"aarch64", "x86_64"}) {
+		t.Errorf("unexpected arches %v", got)
+	}
+	if latest, _ := remote.Latest("aarch64"); latest != "41.2" {
+		t.Errorf("unexpected latest aarch64 build %s", latest)
+	}
+}
+
+func TestMergeBuildsJSON(t *testing.T) {
+	dir := t.TempDir()
+	for id, ts := range map[string]string{
+		"41.1": "2026-01-01T00:00:00Z",
+		"41.2": "2026-01-02T00:00:00Z",
+		"41.3": "2026-01-03T00:00:00Z",
+		"41.4": "2026-01-04T00:00:00Z",
+	} {
+		buildDir := filepath.Join(dir, id, "x86_64")
+		if err := os.MkdirAll(buildDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		meta := `{"buildid": "` + id + `", "coreos-assembler.build-timestamp": "` + ts + `"}`
+		if err := os.WriteFile(filepath.Join(buildDir, CosaMetaJSON), []byte(meta), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 41.5, 41.4 and 41.2 were built locally, 41.3 and 41.3.1 remotely.
+	// 41.5 and 41.3.1 have no meta.json, so no timestamp.
+	if err := os.WriteFile(filepath.Join(dir, CosaBuildsJSON), []byte(`{
+		"schema-version": "1.0.0",
+		"builds": [
+			{"id": "41.5", "arches": ["x86_64"]},
+			{"id": "41.4", "arches": ["x86_64"], "extra": true},
+			{"id": "41.2", "arches": ["x86_64"]},
+			{"id": "41.1", "arches": ["x86_64"]}],
+		"tags": [{"name": "stable", "target": "41.1", "created": "2026-01-01T00:00:00Z"}],
+		"timestamp": "2026-01-04T00:00:00Z",
+		"local-field": 1}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote := []byte(`{
+		"schema-version": "1.0.0",
+		"builds": [
+			{"id": "41.3", "arches": ["x86_64"]},
+			{"id": "41.3.1", "arches": ["x86_64"]},
+			{"id": "41.1", "arches": ["x86_64", "aarch64"]}],
+		"tags": [
+			{"name": "stable", "target": "41.3", "created": "2026-01-03T00:00:00Z", "tag-extra": "x"},
+			{"name": "next", "target": "41.1"}],
+		"timestamp": "2026-01-03T00:00:00Z"}`)
+	if err := MergeBuildsJSON(dir, remote); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := GetBuilds(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []build{
+		{"41.5", []string{"x86_64"}},
+		{"41.4", []string{"x86_64"}},
+		{"41.3", []string{"x86_64"}},
+		{"41.3.1", []string{"x86_64"}},
+		{"41.2", []string{"x86_64"}},
+		{"41.1", []string{"x86_64", "aarch64"}},
+	}
+	if !reflect.DeepEqual(b.Builds, want) {
+		t.Errorf("expected builds %v, got %v", want, b.Builds)
+	}
+	if len(b.Tags) != 2 || b.Tags[0].Target != "41.3" || b.Tags[1].Name != "next" {
+		t.Errorf("unexpected tags %+v", b.Tags)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, CosaBuildsJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"local-field"`)) || !bytes.Contains(data, []byte(`"extra"`)) ||
+		!bytes.Contains(data, []byte(`"tag-extra"`)) {
+		t.Errorf("unknown fields weren't kept: %s", data)
+	}
+
+	// Without a local builds.json, the other one is taken as is.
+	empty := filepath.Join(t.TempDir(), "builds")
+	if err := MergeBuildsJSON(empty, remote); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(empty, CosaBuildsJSON)); err != nil || !bytes.Equal(data, remote) {
+		t.Errorf("unexpected builds.json %s: %v", data, err)
+	}
+}
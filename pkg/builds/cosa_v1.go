@@ -1,12 +1,10 @@
 package builds
 
 // generated by 'make schema'
-// source hash: e6319430c382239f42a623bd132eb03dca261df38b33ea8ab642ab2946d91b2f
+// source hash: ece3d72e284298a56c16d63655985fbe8174e72ee711753f96085dce7d786e8c
 
 type AdvisoryDiff []AdvisoryDiffItems
 
-type AdvisoryDiffItems interface{}
-
 type AliyunImage struct {
 	ImageID string `json:"id"`
 	Region  string `json:"name"`
@@ -19,12 +17,20 @@ type Amis struct {
 }
 
 type Artifact struct {
-	Path               string  `json:"path"`
-	Sha256             string  `json:"sha256"`
-	SizeInBytes        float64 `json:"size,omitempty"`
-	SkipCompression    bool    `json:"skip-compression,omitempty"`
-	UncompressedSha256 string  `json:"uncompressed-sha256,omitempty"`
-	UncompressedSize   int     `json:"uncompressed-size,omitempty"`
+	Path               string              `json:"path"`
+	Sha256             string              `json:"sha256"`
+	Signatures         []ArtifactSignature `json:"signatures,omitempty"`
+	SizeInBytes        float64             `json:"size,omitempty"`
+	SkipCompression    bool                `json:"skip-compression,omitempty"`
+	UncompressedSha256 string              `json:"uncompressed-sha256,omitempty"`
+	UncompressedSize   int                 `json:"uncompressed-size,omitempty"`
+}
+
+type ArtifactSignature struct {
+	KeyID  string `json:"key-id,omitempty"`
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256,omitempty"`
+	Type   string `json:"type"`
 }
 
 type AwsWinLiAmis struct {
@@ -57,6 +63,7 @@ type Build struct {
 	CosaImageChecksum         string                                     `json:"coreos-assembler.image-config-checksum,omitempty"`
 	CosaImageVersion          int                                        `json:"coreos-assembler.image-genver,omitempty"`
 	CosaImportedOciImage      bool                                       `json:"coreos-assembler.oci-imported,omitempty"`
+	CosaMetaSchemaVersion     int                                        `json:"coreos-assembler.meta-schema-version,omitempty"`
 	Extensions                *Extensions                                `json:"extensions,omitempty"`
 	ExtensionsContainer       *PrimaryImage                              `json:"extensions-container,omitempty"`
 	FedoraCoreOsParentCommit  string                                     `json:"fedora-coreos.parent-commit,omitempty"`
@@ -123,8 +130,11 @@ type BuildArtifacts struct {
 	OracleCloudInfrastructure     *Artifact `json:"oraclecloud,omitempty"`
 	Ostree                        Artifact  `json:"ostree"`
 	PowerVirtualServer            *Artifact `json:"powervs,omitempty"`
+	Provenance                    *Artifact `json:"provenance,omitempty"`
 	ProxmoxVe                     *Artifact `json:"proxmoxve,omitempty"`
 	Qemu                          *Artifact `json:"qemu,omitempty"`
+	SbomCycloneDX                 *Artifact `json:"sbom-cyclonedx,omitempty"`
+	SbomSpdx                      *Artifact `json:"sbom-spdx,omitempty"`
 	SecureExecutionIgnitionPubKey *Artifact `json:"ignition-gpg-key,omitempty"`
 	SecureExecutionQemu           *Artifact `json:"qemu-secex,omitempty"`
 	VirtualBox                    *Artifact `json:"virtualbox,omitempty"`
@@ -180,8 +190,6 @@ type Koji struct {
 
 type PackageSetDifferences []PackageSetDifferencesItems
 
-type PackageSetDifferencesItems interface{}
-
 type PrimaryImage struct {
 	AdditionalImages   []interface{}     `json:"additional-images,omitempty"`
 	Comment            string            `json:"comment,omitempty"`
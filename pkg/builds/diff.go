@@ -0,0 +1,496 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// CosaCommitMetaJSON is the metadata of the OSTree commit of a build.
+	CosaCommitMetaJSON = "commitmeta.json"
+
+	// imageJSON is the rendered image.yaml, which isn't part of every
+	// build directory.
+	imageJSON = "image.json"
+
+	pkglistKey    = "rpmostree.rpmdb.pkglist"
+	advisoriesKey = "rpmostree.advisories"
+	kernelKey     = "ostree.linux"
+)
+
+// metaDiffSkip are the meta.json keys which BuildDiff reports in a
+// structured form, or which describe the difference with another build.
+var metaDiffSkip = map[string]bool{
+	"images":                 true,
+	"pkgdiff":                true,
+	"parent-pkgdiff":         true,
+	"advisories-diff":        true,
+	"parent-advisories-diff": true,
+}
+
+// commitMetaDiffSkip are the commit metadata keys which BuildDiff reports
+// in a structured form.
+var commitMetaDiffSkip = map[string]bool{
+	pkglistKey:    true,
+	advisoriesKey: true,
+	kernelKey:     true,
+}
+
+// BuildInfo identifies one side of a BuildDiff.
+type BuildInfo struct {
+	ID           string `json:"id"`
+	Arch         string `json:"arch"`
+	OstreeCommit string `json:"ostree-commit"`
+	Dir          string `json:"dir"`
+}
+
+// ValueChange is a value which differs between two builds. An empty
+// string means that the value is absent from the build.
+type ValueChange struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// FieldChange is a metadata field which differs between two builds. The
+// path joins object keys with dots and indexes arrays with brackets,
+// using the name or ID of their elements when they have one.
+type FieldChange struct {
+	Path string `json:"path"`
+	ValueChange
+}
+
+// KargsChange are the kernel arguments added and removed by a build.
+type KargsChange struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// ArtifactDelta is an artifact whose size differs between two builds.
+// A size of zero means that the artifact is absent from the build.
+type ArtifactDelta struct {
+	Name     string `json:"name"`
+	FromSize int64  `json:"from-size"`
+	ToSize   int64  `json:"to-size"`
+	Delta    int64  `json:"delta"`
+}
+
+// BuildDiff is the difference between two builds.
+type BuildDiff struct {
+	From BuildInfo `json:"from"`
+	To   BuildInfo `json:"to"`
+
+	Packages []PackageChange `json:"packages,omitempty"`
+	// Advisories are the advisories of the new build which don't apply
+	// to the old one.
+	Advisories []Advisory   `json:"advisories,omitempty"`
+	Kernel     *ValueChange `json:"kernel,omitempty"`
+	// Kargs is only set when both builds record their image.json.
+	Kargs      *KargsChange    `json:"kargs,omitempty"`
+	Artifacts  []ArtifactDelta `json:"artifacts,omitempty"`
+	Meta       []FieldChange   `json:"meta,omitempty"`
+	CommitMeta []FieldChange   `json:"commitmeta,omitempty"`
+}
+
+// diffSide is a build directory loaded for diffing.
+type diffSide struct {
+	build      *Build
+	meta       map[string]interface{}
+	commitMeta map[string]json.RawMessage
+	kargs      []string
+	hasKargs   bool
+}
+
+func loadDiffSide(dir string) (*diffSide, error) {
+	s := &diffSide{}
+	var err error
+	if s.build, err = readMetaLenient(filepath.Join(dir, CosaMetaJSON)); err != nil {
+		return nil, err
+	}
+	if err := readJSONFile(filepath.Join(dir, CosaMetaJSON), &s.meta); err != nil {
+		return nil, err
+	}
+	if err := readJSONFile(filepath.Join(dir, CosaCommitMetaJSON), &s.commitMeta); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var image struct {
+		Kargs []string `json:"extra-kargs"`
+	}
+	err = readJSONFile(filepath.Join(dir, imageJSON), &image)
+	switch {
+	case err == nil:
+		s.kargs, s.hasKargs = image.Kargs, true
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	return s, nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// packages returns the package list of the commit metadata, or nil if
+// the build has none.
+func (s *diffSide) packages() ([]Package, error) {
+	data, ok := s.commitMeta[pkglistKey]
+	if !ok {
+		return nil, nil
+	}
+	return parsePackageList(data)
+}
+
+// kernel returns the version of the kernel of the build, from the commit
+// metadata or else from its package list.
+func (s *diffSide) kernel(pkgs []Package) string {
+	var version string
+	if data, ok := s.commitMeta[kernelKey]; ok && json.Unmarshal(data, &version) == nil {
+		return version
+	}
+	for _, name := range []string{"kernel", "kernel-core", "kernel-rt-core"} {
+		for i := range pkgs {
+			if pkgs[i].Name == name {
+				return pkgs[i].Version + "-" + pkgs[i].Release + "." + pkgs[i].Arch
+			}
+		}
+	}
+	return ""
+}
+
+// DiffBuildDirs compares the builds in the directories from and to,
+// which each hold a meta.json and usually a commitmeta.json.
+func DiffBuildDirs(from, to string) (*BuildDiff, error) {
+	f, err := loadDiffSide(from)
+	if err != nil {
+		return nil, err
+	}
+	t, err := loadDiffSide(to)
+	if err != nil {
+		return nil, err
+	}
+	d := &BuildDiff{
+		From: BuildInfo{ID: f.build.BuildID, Arch: f.build.Architecture, OstreeCommit: f.build.OstreeCommit, Dir: from},
+		To:   BuildInfo{ID: t.build.BuildID, Arch: t.build.Architecture, OstreeCommit: t.build.OstreeCommit, Dir: to},
+	}
+
+	fromPkgs, err := f.packages()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", from, err)
+	}
+	toPkgs, err := t.packages()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", to, err)
+	}
+	isParent := t.build.FedoraCoreOsParentVersion != "" && t.build.FedoraCoreOsParentVersion == f.build.BuildID
+	switch {
+	case fromPkgs != nil && toPkgs != nil:
+		d.Packages = DiffPackages(fromPkgs, toPkgs)
+	case isParent:
+		// Without package lists, fall back to the diff which cosa
+		// build recorded against the parent.
+		d.Packages = t.build.PkgdiffAgainstParent.Changes()
+	}
+	if k := (ValueChange{From: f.kernel(fromPkgs), To: t.kernel(toPkgs)}); k.From != k.To {
+		d.Kernel = &k
+	}
+	if f.hasKargs && t.hasKargs {
+		added, removed := diffStrings(f.kargs, t.kargs)
+		if len(added) > 0 || len(removed) > 0 {
+			d.Kargs = &KargsChange{Added: added, Removed: removed}
+		}
+	}
+
+	if _, ok := t.commitMeta[advisoriesKey]; !ok && isParent {
+		d.Advisories = t.build.AdvisoryDiffAgainstParent.Advisories()
+	}
+	if data, ok := t.commitMeta[advisoriesKey]; ok {
+		toAdvisories, err := parseAdvisories(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", to, err)
+		}
+		known := make(map[string]bool)
+		if data, ok := f.commitMeta[advisoriesKey]; ok {
+			fromAdvisories, err := parseAdvisories(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", from, err)
+			}
+			for _, a := range fromAdvisories {
+				known[a.ID] = true
+			}
+		}
+		for _, a := range toAdvisories {
+			if !known[a.ID] {
+				d.Advisories = append(d.Advisories, a)
+			}
+		}
+	}
+
+	d.Artifacts = diffArtifacts(f.build, t.build)
+
+	fromFields := make(map[string]string)
+	toFields := make(map[string]string)
+	for k, v := range f.meta {
+		if !metaDiffSkip[k] {
+			flattenJSON(k, v, fromFields)
+		}
+	}
+	for k, v := range t.meta {
+		if !metaDiffSkip[k] {
+			flattenJSON(k, v, toFields)
+		}
+	}
+	d.Meta = diffFields(fromFields, toFields)
+
+	fromFields = make(map[string]string)
+	toFields = make(map[string]string)
+	if err := flattenCommitMeta(f.commitMeta, fromFields); err != nil {
+		return nil, fmt.Errorf("%s: %w", from, err)
+	}
+	if err := flattenCommitMeta(t.commitMeta, toFields); err != nil {
+		return nil, fmt.Errorf("%s: %w", to, err)
+	}
+	d.CommitMeta = diffFields(fromFields, toFields)
+
+	return d, nil
+}
+
+// diffStrings returns the strings of to which aren't in from, and those
+// of from which aren't in to.
+func diffStrings(from, to []string) (added, removed []string) {
+	in := func(s string, list []string) bool {
+		for _, e := range list {
+			if e == s {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range to {
+		if !in(s, from) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range from {
+		if !in(s, to) {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func diffArtifacts(from, to *Build) []ArtifactDelta {
+	sizes := func(b *Build) map[string]int64 {
+		ret := make(map[string]int64)
+		if b.BuildArtifacts == nil {
+			return ret
+		}
+		for name, a := range b.artifacts() {
+			if a != nil && a.Path != "" {
+				ret[name] = int64(a.SizeInBytes)
+			}
+		}
+		return ret
+	}
+	fromSizes := sizes(from)
+	toSizes := sizes(to)
+	names := make(map[string]bool)
+	for name := range fromSizes {
+		names[name] = true
+	}
+	for name := range toSizes {
+		names[name] = true
+	}
+	var ret []ArtifactDelta
+	for name := range names {
+		if fromSizes[name] != toSizes[name] {
+			ret = append(ret, ArtifactDelta{
+				Name:     name,
+				FromSize: fromSizes[name],
+				ToSize:   toSizes[name],
+				Delta:    toSizes[name] - fromSizes[name],
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func flattenCommitMeta(meta map[string]json.RawMessage, out map[string]string) error {
+	for k, data := range meta {
+		if commitMetaDiffSkip[k] {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("parsing commit metadata %s: %w", k, err)
+		}
+		flattenJSON(k, v, out)
+	}
+	return nil
+}
+
+// flattenJSON records the scalars of v in out, by their path. Array
+// elements are keyed by their name or ID when they have one, so that
+// e.g. reordered AMIs don't show up as changes.
+func flattenJSON(path string, v interface{}, out map[string]string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			flattenJSON(path+"."+k, e, out)
+		}
+	case []interface{}:
+		for i, e := range v {
+			key := fmt.Sprint(i)
+			if obj, ok := e.(map[string]interface{}); ok {
+				for _, field := range []string{"name", "id"} {
+					if s, ok := obj[field].(string); ok && s != "" {
+						key = s
+						break
+					}
+				}
+			}
+			flattenJSON(path+"["+key+"]", e, out)
+		}
+	default:
+		out[path] = scalarString(v)
+	}
+}
+
+func diffFields(from, to map[string]string) []FieldChange {
+	var ret []FieldChange
+	for path, f := range from {
+		if t, ok := to[path]; !ok || t != f {
+			ret = append(ret, FieldChange{Path: path, ValueChange: ValueChange{From: f, To: t}})
+		}
+	}
+	for path, t := range to {
+		if _, ok := from[path]; !ok {
+			ret = append(ret, FieldChange{Path: path, ValueChange: ValueChange{To: t}})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return ret
+}
+
+// formatSize formats a size in bytes using binary units.
+func formatSize(n int64) string {
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%s%d B", sign, n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%s%.1f %ciB", sign, float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func orAbsent(s string) string {
+	if s == "" {
+		return "(absent)"
+	}
+	return s
+}
+
+// WriteText writes a human readable form of the diff to w.
+func (d *BuildDiff) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "from: %s (%s, %s)\n", d.From.ID, d.From.Arch, d.From.OstreeCommit)
+	fmt.Fprintf(&b, "to:   %s (%s, %s)\n", d.To.ID, d.To.Arch, d.To.OstreeCommit)
+
+	if d.Kernel != nil {
+		fmt.Fprintf(&b, "\nKernel: %s -> %s\n", orAbsent(d.Kernel.From), orAbsent(d.Kernel.To))
+	}
+	if d.Kargs != nil {
+		b.WriteString("\nKernel arguments:\n")
+		for _, k := range d.Kargs.Added {
+			fmt.Fprintf(&b, "  + %s\n", k)
+		}
+		for _, k := range d.Kargs.Removed {
+			fmt.Fprintf(&b, "  - %s\n", k)
+		}
+	}
+
+	var lastType PackageDiffType = -1
+	for _, p := range d.Packages {
+		if lastType == -1 {
+			b.WriteString("\nPackages:\n")
+		}
+		if p.Type != lastType {
+			fmt.Fprintf(&b, "  %s:\n", strings.ToUpper(p.Type.String()[:1])+p.Type.String()[1:])
+			lastType = p.Type
+		}
+		switch p.Type {
+		case PackageAdded:
+			fmt.Fprintf(&b, "    %s-%s\n", p.Name, p.New.EVR())
+		case PackageRemoved:
+			fmt.Fprintf(&b, "    %s-%s\n", p.Name, p.Previous.EVR())
+		default:
+			fmt.Fprintf(&b, "    %s %s -> %s\n", p.Name, p.Previous.EVR(), p.New.EVR())
+		}
+	}
+
+	if len(d.Advisories) > 0 {
+		b.WriteString("\nAdvisories:\n")
+		for _, a := range d.Advisories {
+			fmt.Fprintf(&b, "  %s (%s, %s)\n", a.ID, a.Kind, a.Severity)
+		}
+	}
+
+	if len(d.Artifacts) > 0 {
+		b.WriteString("\nArtifacts:\n")
+		for _, a := range d.Artifacts {
+			sign := "+"
+			if a.Delta < 0 {
+				sign = ""
+			}
+			fmt.Fprintf(&b, "  %-20s %10s -> %10s (%s%s)\n", a.Name, formatSize(a.FromSize), formatSize(a.ToSize), sign, formatSize(a.Delta))
+		}
+	}
+
+	for _, section := range []struct {
+		title   string
+		changes []FieldChange
+	}{{"Meta", d.Meta}, {"Commit metadata", d.CommitMeta}} {
+		if len(section.changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", section.title)
+		for _, c := range section.changes {
+			fmt.Fprintf(&b, "  %s: %s -> %s\n", c.Path, orAbsent(c.From), orAbsent(c.To))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,218 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRpmvercmp(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.010", "1.10", 0},
+		{"2.0a", "2.0", 1},
+		{"1.0a", "1.0.1", -1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"0.7.rc4.fc31", "2.fc31", -1},
+		{"a", "1", -1},
+	} {
+		if got := rpmvercmp(tc.a, tc.b); got != tc.want {
+			t.Errorf("rpmvercmp(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := rpmvercmp(tc.b, tc.a); got != -tc.want {
+			t.Errorf("rpmvercmp(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestDiffPackages(t *testing.T) {
+	from := []Package{
+		{Name: "podman", Epoch: "2", Version: "1.8.1", Release: "0.7.rc4.fc31", Arch: "x86_64"},
+		{Name: "kernel", Epoch: "0", Version: "6.1.0", Release: "1.fc41", Arch: "x86_64"},
+		{Name: "vim-minimal", Epoch: "2", Version: "9.0", Release: "1.fc41", Arch: "x86_64"},
+		{Name: "bash", Epoch: "0", Version: "5.2", Release: "2.fc41", Arch: "x86_64"},
+	}
+	to := []Package{
+		{Name: "podman", Epoch: "2", Version: "1.8.1", Release: "2.fc31", Arch: "x86_64"},
+		{Name: "kernel", Epoch: "1", Version: "5.0.0", Release: "1.fc41", Arch: "x86_64"},
+		{Name: "bash", Epoch: "0", Version: "5.2", Release: "1.fc41", Arch: "x86_64"},
+		{Name: "nano", Epoch: "0", Version: "7.2", Release: "1.fc41", Arch: "x86_64"},
+	}
+	var got []string
+	for _, c := range DiffPackages(from, to) {
+		got = append(got, c.Type.String()+" "+c.Name)
+	}
+	want := []string{"added nano", "removed vim-minimal", "upgraded kernel", "upgraded podman", "downgraded bash"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func writeDiffBuild(t *testing.T, dir string, meta, commitMeta map[string]interface{}) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, v := range map[string]interface{}{CosaMetaJSON: meta, CosaCommitMetaJSON: commitMeta} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiffBuildDirs(t *testing.T) {
+	dir := t.TempDir()
+	from := filepath.Join(dir, "41.1", "x86_64")
+	to := filepath.Join(dir, "41.2", "x86_64")
+	writeDiffBuild(t, from, map[string]interface{}{
+		"buildid":                   "41.1",
+		"ostree-commit":             "aaaa",
+		"coreos-assembler.basearch": "x86_64",
+		"images": map[string]interface{}{
+			"qemu":  map[string]interface{}{"path": "fcos-qemu.qcow2", "sha256": "a", "size": 1048576},
+			"metal": map[string]interface{}{"path": "fcos-metal.raw", "sha256": "b", "size": 2048},
+		},
+		"amis": []interface{}{
+			map[string]interface{}{"name": "us-east-1", "hvm": "ami-1", "snapshot": "snap-1"},
+			map[string]interface{}{"name": "us-west-1", "hvm": "ami-2", "snapshot": "snap-2"},
+		},
+		"pkgdiff": []interface{}{},
+	}, map[string]interface{}{
+		"version": "41.1",
+		"rpmostree.rpmdb.pkglist": [][]string{
+			{"kernel", "0", "6.1.0", "1.fc41", "x86_64"},
+			{"podman", "2", "1.8.1", "0.7.rc4.fc31", "x86_64"},
+		},
+		"rpmostree.advisories": []interface{}{
+			[]interface{}{"FEDORA-2026-1", 2, 0, []string{"podman-2:1.8.1-0.7.rc4.fc31.x86_64"}, map[string]interface{}{}},
+		},
+	})
+	writeDiffBuild(t, to, map[string]interface{}{
+		"buildid":                   "41.2",
+		"ostree-commit":             "bbbb",
+		"coreos-assembler.basearch": "x86_64",
+		"images": map[string]interface{}{
+			"qemu":  map[string]interface{}{"path": "fcos-qemu.qcow2", "sha256": "c", "size": 1572864},
+			"metal": map[string]interface{}{"path": "fcos-metal.raw", "sha256": "d", "size": 2048},
+		},
+		"amis": []interface{}{
+			map[string]interface{}{"name": "us-west-1", "hvm": "ami-2", "snapshot": "snap-2"},
+			map[string]interface{}{"name": "us-east-1", "hvm": "ami-3", "snapshot": "snap-1"},
+		},
+	}, map[string]interface{}{
+		"version": "41.2",
+		"rpmostree.rpmdb.pkglist": [][]string{
+			{"kernel", "0", "6.2.0", "1.fc41", "x86_64"},
+			{"podman", "2", "1.8.1", "2.fc31", "x86_64"},
+		},
+		"rpmostree.advisories": []interface{}{
+			[]interface{}{"FEDORA-2026-1", 2, 0, []string{"podman-2:1.8.1-0.7.rc4.fc31.x86_64"}, map[string]interface{}{}},
+			[]interface{}{"FEDORA-2026-2", 1, 3, []string{"kernel-6.2.0-1.fc41.x86_64"}, map[string]interface{}{
+				"cve_references": [][]string{{"CVE-2026-0001", "https://example.com/CVE-2026-0001"}},
+			}},
+		},
+	})
+	for _, d := range []string{from, to} {
+		if err := os.WriteFile(filepath.Join(d, imageJSON), []byte(`{"extra-kargs": ["mitigations=auto"]}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d, err := DiffBuildDirs(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.From.ID != "41.1" || d.To.OstreeCommit != "bbbb" {
+		t.Errorf("unexpected builds %+v -> %+v", d.From, d.To)
+	}
+	if len(d.Packages) != 2 || d.Packages[0].Name != "kernel" || d.Packages[0].Type != PackageUpgraded {
+		t.Errorf("unexpected packages %+v", d.Packages)
+	}
+	if d.Kernel == nil || d.Kernel.From != "6.1.0-1.fc41.x86_64" || d.Kernel.To != "6.2.0-1.fc41.x86_64" {
+		t.Errorf("unexpected kernel change %+v", d.Kernel)
+	}
+	if d.Kargs != nil {
+		t.Errorf("unexpected kargs change %+v", d.Kargs)
+	}
+	wantAdvisory := Advisory{
+		ID:       "FEDORA-2026-2",
+		Kind:     AdvisorySecurity,
+		Severity: AdvisorySeverityImportant,
+		Packages: []string{"kernel-6.2.0-1.fc41.x86_64"},
+		CVEs:     []CVEReference{{Title: "CVE-2026-0001", URL: "https://example.com/CVE-2026-0001"}},
+	}
+	if !reflect.DeepEqual(d.Advisories, []Advisory{wantAdvisory}) {
+		t.Errorf("unexpected advisories %+v", d.Advisories)
+	}
+	if !reflect.DeepEqual(d.Artifacts, []ArtifactDelta{{Name: "qemu", FromSize: 1048576, ToSize: 1572864, Delta: 524288}}) {
+		t.Errorf("unexpected artifacts %+v", d.Artifacts)
+	}
+	wantMeta := []FieldChange{
+		{Path: "amis[us-east-1].hvm", ValueChange: ValueChange{From: "ami-1", To: "ami-3"}},
+		{Path: "buildid", ValueChange: ValueChange{From: "41.1", To: "41.2"}},
+		{Path: "ostree-commit", ValueChange: ValueChange{From: "aaaa", To: "bbbb"}},
+	}
+	if !reflect.DeepEqual(d.Meta, wantMeta) {
+		t.Errorf("unexpected meta changes %+v", d.Meta)
+	}
+	if !reflect.DeepEqual(d.CommitMeta, []FieldChange{{Path: "version", ValueChange: ValueChange{From: "41.1", To: "41.2"}}}) {
+		t.Errorf("unexpected commit metadata changes %+v", d.CommitMeta)
+	}
+
+	var buf bytes.Buffer
+	if err := d.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"Kernel: 6.1.0-1.fc41.x86_64 -> 6.2.0-1.fc41.x86_64",
+		"    podman 2:1.8.1-0.7.rc4.fc31 -> 2:1.8.1-2.fc31",
+		"  FEDORA-2026-2 (security, important)",
+		"(+512.0 KiB)",
+		"  amis[us-east-1].hvm: ami-1 -> ami-3",
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("text output lacks %q:\n%s", line, buf.String())
+		}
+	}
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var roundTrip BuildDiff
+	if err := json.Unmarshal(data, &roundTrip); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&roundTrip, d) {
+		t.Errorf("JSON round trip mismatch:\n%s", data)
+	}
+}
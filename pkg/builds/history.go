@@ -0,0 +1,219 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// streamLabel is the label of the container image of a build which
+// names its stream.
+const streamLabel = "fedora-coreos.stream"
+
+// HistoryEntry is a build of builds.json, along with the meta.json of
+// each of its arches which is present locally.
+type HistoryEntry struct {
+	ID     string
+	Arches []string
+	// Tags are the names of the tags pointing at the build.
+	Tags []string
+	// Metas holds the meta.json of the arches present locally.
+	Metas map[string]*Build
+	// Timestamp is the newest build timestamp of the local arches, or
+	// zero if none is known.
+	Timestamp time.Time
+}
+
+// Stream returns the stream of the build, from the labels of its
+// container image or else from its ref, or "" if unknown.
+func (e *HistoryEntry) Stream() string {
+	for _, meta := range e.Metas {
+		if stream := string(meta.OciLabels[streamLabel]); stream != "" {
+			return stream
+		}
+		if meta.BuildRef != "" {
+			return meta.BuildRef[strings.LastIndex(meta.BuildRef, "/")+1:]
+		}
+	}
+	return ""
+}
+
+// Age returns how old the build is at now, and false if its timestamp
+// is unknown.
+func (e *HistoryEntry) Age(now time.Time) (time.Duration, bool) {
+	if e.Timestamp.IsZero() {
+		return 0, false
+	}
+	return now.Sub(e.Timestamp), true
+}
+
+// History is the list of builds of a builds directory.
+type History struct {
+	dir string
+	// Entries are in the order of builds.json, newest first.
+	Entries []*HistoryEntry
+}
+
+// HistoryFilter selects builds from a History. Unset fields don't
+// filter.
+type HistoryFilter struct {
+	// Arch selects the builds with the arch.
+	Arch string
+	// Stream selects the builds of the stream.
+	Stream string
+	// MinAge and MaxAge select the builds whose age is in the range;
+	// builds whose age is unknown are excluded when either is set.
+	MinAge time.Duration
+	MaxAge time.Duration
+	// Limit is the maximum number of builds, newest first.
+	Limit int
+	// Now is the time ages are computed at, by default the current
+	// time.
+	Now time.Time
+}
+
+// LoadHistory reads builds.json of the builds directory dir and the
+// meta.json of the builds present locally.
+func LoadHistory(dir string) (*History, error) {
+	b, err := GetBuilds(dir)
+	if err != nil {
+		return nil, err
+	}
+	h := &History{dir: dir}
+	tags := make(map[string][]string)
+	for _, t := range b.Tags {
+		tags[t.Target] = append(tags[t.Target], t.Name)
+	}
+	for _, build := range b.Builds {
+		e := &HistoryEntry{
+			ID:     build.ID,
+			Arches: build.Arches,
+			Tags:   tags[build.ID],
+			Metas:  make(map[string]*Build),
+		}
+		for _, arch := range build.Arches {
+			meta, err := readMetaLenient(filepath.Join(dir, build.ID, arch, CosaMetaJSON))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			e.Metas[arch] = meta
+			if ts, err := time.Parse(time.RFC3339, meta.BuildTimeStamp); err == nil && ts.After(e.Timestamp) {
+				e.Timestamp = ts
+			}
+		}
+		h.Entries = append(h.Entries, e)
+	}
+	return h, nil
+}
+
+// readMetaLenient reads a meta.json, ignoring the fields it doesn't
+// know, which is enough for looking at the history of old builds.
+func readMetaLenient(path string) (*Build, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b Build
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &b, nil
+}
+
+// Get returns the build with the given ID.
+func (h *History) Get(id string) (*HistoryEntry, bool) {
+	for _, e := range h.Entries {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Filter returns the builds matching f, newest first.
+func (h *History) Filter(f HistoryFilter) []*HistoryEntry {
+	if f.Now.IsZero() {
+		f.Now = time.Now()
+	}
+	var ret []*HistoryEntry
+	for _, e := range h.Entries {
+		if f.Limit > 0 && len(ret) >= f.Limit {
+			break
+		}
+		if f.Arch != "" && !contains(e.Arches, f.Arch) {
+			continue
+		}
+		if f.Stream != "" && e.Stream() != f.Stream {
+			continue
+		}
+		if f.MinAge != 0 || f.MaxAge != 0 {
+			age, ok := e.Age(f.Now)
+			if !ok || age < f.MinAge || (f.MaxAge != 0 && age > f.MaxAge) {
+				continue
+			}
+		}
+		ret = append(ret, e)
+	}
+	return ret
+}
+
+// Parents returns the builds referenced as parents by other builds,
+// through the parent version recorded in their meta.json, mapped to the
+// IDs of their children.
+func (h *History) Parents() map[string][]string {
+	byVersion := make(map[string]string)
+	for _, e := range h.Entries {
+		byVersion[e.ID] = e.ID
+	}
+	for _, e := range h.Entries {
+		for _, meta := range e.Metas {
+			if meta.OstreeVersion != "" {
+				if _, ok := byVersion[meta.OstreeVersion]; !ok {
+					byVersion[meta.OstreeVersion] = e.ID
+				}
+			}
+		}
+	}
+
+	ret := make(map[string][]string)
+	for _, e := range h.Entries {
+		seen := make(map[string]bool)
+		for _, meta := range e.Metas {
+			parent, ok := byVersion[meta.FedoraCoreOsParentVersion]
+			if meta.FedoraCoreOsParentVersion == "" || !ok || parent == e.ID || seen[parent] {
+				continue
+			}
+			seen[parent] = true
+			ret[parent] = append(ret[parent], e.ID)
+		}
+	}
+	return ret
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var historyNow = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// writeHistory creates a builds directory with builds of the given ages
+// in days, newest first, each the parent of the previous one.
+func writeHistory(t *testing.T, ages []int, tags map[string]string) string {
+	dir := t.TempDir()
+	var ids []string
+	for i, age := range ages {
+		id := "40." + strings.Repeat("1", i+1)
+		ids = append(ids, id)
+		meta := map[string]interface{}{
+			"buildid":                          id,
+			"ostree-version":                   id,
+			"ref":                              "fedora/x86_64/coreos/testing-devel",
+			"coreos-assembler.build-timestamp": historyNow.AddDate(0, 0, -age).Format(time.RFC3339),
+		}
+		if i+1 < len(ages) {
+			meta["fedora-coreos.parent-version"] = "40." + strings.Repeat("1", i+2)
+		}
+		data, _ := json.Marshal(meta)
+		if err := os.MkdirAll(filepath.Join(dir, id, "x86_64"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, id, "x86_64", CosaMetaJSON), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	doc := map[string]interface{}{"schema-version": "1.0.0", "timestamp": "2026-01-01T00:00:00Z"}
+	var builds []map[string]interface{}
+	for _, id := range ids {
+		builds = append(builds, map[string]interface{}{"id": id, "arches": []string{"x86_64"}, "policy-cleanup": map[string]bool{"images": true}})
+	}
+	doc["builds"] = builds
+	var tagList []Tag
+	for name, target := range tags {
+		tagList = append(tagList, Tag{Name: name, Target: target})
+	}
+	doc["tags"] = tagList
+	data, _ := json.Marshal(doc)
+	if err := os.WriteFile(filepath.Join(dir, CosaBuildsJSON), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestHistory(t *testing.T) {
+	dir := writeHistory(t, []int{1, 10, 20, 40}, map[string]string{"stable": "40.111"})
+	h, err := LoadHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Entries) != 4 || h.Entries[0].Stream() != "testing-devel" {
+		t.Fatalf("unexpected history %v", h.Entries)
+	}
+	if e, _ := h.Get("40.111"); !reflect.DeepEqual(e.Tags, []string{"stable"}) {
+		t.Errorf("got tags %v", e.Tags)
+	}
+
+	ids := func(entries []*HistoryEntry) []string {
+		var ret []string
+		for _, e := range entries {
+			ret = append(ret, e.ID)
+		}
+		return ret
+	}
+	if got := ids(h.Filter(HistoryFilter{MinAge: 5 * 24 * time.Hour, MaxAge: 30 * 24 * time.Hour, Now: historyNow})); !reflect.DeepEqual(got, []string{"40.11", "40.111"}) {
+		t.Errorf("filtering by age got %v", got)
+	}
+	if got := h.Filter(HistoryFilter{Limit: 2, Stream: "testing-devel"}); len(got) != 2 {
+		t.Errorf("filtering by count got %v", ids(got))
+	}
+	if got := h.Filter(HistoryFilter{Stream: "stable"}); len(got) != 0 {
+		t.Errorf("filtering by stream got %v", ids(got))
+	}
+
+	parents := h.Parents()
+	if !reflect.DeepEqual(parents["40.11"], []string{"40.1"}) || len(parents) != 3 {
+		t.Errorf("got parents %v", parents)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := writeHistory(t, []int{1, 10, 20, 40, 50}, map[string]string{"stable": "40.1111"})
+	h, err := LoadHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := h.PlanPrune(PrunePolicy{KeepLastN: 2, Now: historyNow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := plan.Pruned(); !reflect.DeepEqual(got, []string{"40.111", "40.11111"}) {
+		t.Errorf("keeping the last 2 builds prunes %v", got)
+	}
+
+	plan, err = h.PlanPrune(PrunePolicy{MaxAge: 15 * 24 * time.Hour, KeepParents: true, Now: historyNow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every old build is the parent of a kept one, the oldest of the
+	// tagged one.
+	if got := plan.Pruned(); len(got) != 0 {
+		t.Errorf("keeping parents prunes %v", got)
+	}
+	if d := plan.Decisions[2]; d.Reason != "parent of 40.11" {
+		t.Errorf("unexpected decision %v", d)
+	}
+
+	if _, err := h.PlanPrune(PrunePolicy{Builds: []string{"40.1111"}}); err == nil {
+		t.Error("planned to prune a tagged build")
+	}
+	plan, err = h.PlanPrune(PrunePolicy{Builds: []string{"40.11"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := plan.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "prune 40.11 (x86_64): pruned explicitly") {
+		t.Errorf("unexpected plan output %q", out.String())
+	}
+
+	if err := h.ExecutePrune(plan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "40.11")); !os.IsNotExist(err) {
+		t.Errorf("build directory was not removed: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "latest")); err != nil || target != "40.1" {
+		t.Errorf("latest points to %q: %v", target, err)
+	}
+	h, err = LoadHistory(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.Entries) != 4 {
+		t.Errorf("builds.json has %d builds", len(h.Entries))
+	}
+	data, err := os.ReadFile(filepath.Join(dir, CosaBuildsJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("policy-cleanup")) || !bytes.Contains(data, []byte(`"stable"`)) {
+		t.Errorf("fields were lost from builds.json: %s", data)
+	}
+
+	// A build whose meta.json is being written is kept.
+	defer func(timeout time.Duration) { pruneLockTimeout = timeout }(pruneLockTimeout)
+	pruneLockTimeout = 200 * time.Millisecond
+	l, err := LockMeta(filepath.Join(dir, "40.111", "x86_64", CosaMetaJSON), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Unlock()
+	plan, err = h.PlanPrune(PrunePolicy{Builds: []string{"40.111"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ExecutePrune(plan); err == nil || !strings.Contains(err.Error(), "timed out waiting for the lock") {
+		t.Errorf("pruned a locked build: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "40.111", "x86_64", CosaMetaJSON)); err != nil {
+		t.Errorf("locked build was removed: %v", err)
+	}
+	if _, ok := h.Get("40.111"); !ok {
+		t.Error("locked build was removed from the history")
+	}
+}
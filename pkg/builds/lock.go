@@ -0,0 +1,138 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// metaLockLifetime is how long a lock is valid for, after which it
+	// is considered stale and broken.
+	metaLockLifetime = 10 * time.Minute
+	// MetaLockTimeout is how long LockMeta waits for the lock by default.
+	MetaLockTimeout = 5 * time.Minute
+
+	metaLockPoll = 100 * time.Millisecond
+)
+
+// MetaLock is a held lock on a meta.json. The lock file protocol is the
+// one of the flufl.lock Python module which cosalib uses, so Go and
+// Python writers exclude each other: a claim file is hard linked to the
+// .meta.json.lock file, whose mtime is the time the lock expires.
+type MetaLock struct {
+	path  string
+	claim string
+}
+
+// metaLockPath returns the lock file of path, as named by cosalib.
+func metaLockPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+}
+
+// LockMeta takes the lock on the meta.json at path, waiting up to timeout
+// for other writers to release it.
+func LockMeta(path string, timeout time.Duration) (*MetaLock, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	lockPath := metaLockPath(path)
+	l := &MetaLock{
+		path:  lockPath,
+		claim: fmt.Sprintf("%s|%s|%d|%d", lockPath, hostname, os.Getpid(), rand.Int63()),
+	}
+	if err := os.WriteFile(l.claim, []byte(l.claim), 0644); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		expires := time.Now().Add(metaLockLifetime)
+		if err := os.Chtimes(l.claim, expires, expires); err != nil {
+			os.Remove(l.claim)
+			return nil, err
+		}
+		err := os.Link(l.claim, lockPath)
+		if err == nil || l.owned() {
+			return l, nil
+		}
+		if !os.IsExist(err) {
+			os.Remove(l.claim)
+			return nil, err
+		}
+		l.breakIfStale()
+		if time.Now().After(deadline) {
+			os.Remove(l.claim)
+			owner, _ := os.ReadFile(lockPath)
+			return nil, fmt.Errorf("timed out waiting for the lock on %s, held by %s", path, lockOwner(string(owner)))
+		}
+		time.Sleep(metaLockPoll)
+	}
+}
+
+// owned checks if the lock file is our claim, in case the link succeeded
+// but reported an error, as it can on NFS.
+func (l *MetaLock) owned() bool {
+	fi, err := os.Stat(l.claim)
+	if err != nil {
+		return false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink != 2 {
+		return false
+	}
+	data, err := os.ReadFile(l.path)
+	return err == nil && string(data) == l.claim
+}
+
+// breakIfStale removes the lock file if it has expired, along with the
+// claim file of its holder.
+func (l *MetaLock) breakIfStale() {
+	fi, err := os.Stat(l.path)
+	if err != nil || time.Now().Before(fi.ModTime()) {
+		return
+	}
+	owner, _ := os.ReadFile(l.path)
+	if err := os.Remove(l.path); err == nil && strings.HasPrefix(string(owner), l.path+"|") {
+		os.Remove(string(owner))
+	}
+}
+
+// lockOwner formats the host and PID of a claim file name.
+func lockOwner(claim string) string {
+	parts := strings.Split(claim, "|")
+	if len(parts) != 4 {
+		return "an unknown owner"
+	}
+	return fmt.Sprintf("PID %s on %s", parts[2], parts[1])
+}
+
+// Unlock releases the lock.
+func (l *MetaLock) Unlock() error {
+	var err error
+	if l.owned() {
+		err = os.Remove(l.path)
+	}
+	if rerr := os.Remove(l.claim); err == nil && !os.IsNotExist(rerr) {
+		err = rerr
+	}
+	return err
+}
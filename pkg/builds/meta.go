@@ -0,0 +1,468 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// metaStampKey is the version stamp of a meta.json, an integer of
+	// nanoseconds since the epoch like cosalib's time.time_ns().
+	metaStampKey = "coreos-assembler.meta-stamp"
+)
+
+// ErrMetaConflict is wrapped by the errors of meta.json files which set
+// a field to different values.
+var ErrMetaConflict = errors.New("meta.json conflict")
+
+// identityFields are the fields which must match for two meta.json files
+// to describe the same build. They are checked first, so that merging
+// files of different builds only reports them.
+var identityFields = []string{"buildid", "ostree-commit", "ostree-content-checksum", "coreos-assembler.image-config-checksum"}
+
+// MetaConflict is a field which two meta.json files set differently. The
+// path is formatted like the ones of BuildDiff.
+type MetaConflict struct {
+	Path   string      `json:"path"`
+	Ours   interface{} `json:"ours"`
+	Theirs interface{} `json:"theirs"`
+}
+
+// MetaConflictError lists the conflicts found while merging a meta.json.
+type MetaConflictError struct {
+	Source    string
+	Conflicts []MetaConflict
+}
+
+func (e *MetaConflictError) Error() string {
+	var paths []string
+	for _, c := range e.Conflicts {
+		paths = append(paths, fmt.Sprintf("%s (%v != %v)", c.Path, c.Ours, c.Theirs))
+	}
+	return fmt.Sprintf("%v merging %s: %s", ErrMetaConflict, e.Source, strings.Join(paths, ", "))
+}
+
+func (e *MetaConflictError) Unwrap() error {
+	return ErrMetaConflict
+}
+
+// MergeMetaJSON merges the meta.json theirs into ours, field by field:
+//
+//   - a field set on one side only takes that value;
+//   - objects are merged recursively;
+//   - arrays of objects with a name, such as AMIs, are merged by name, and
+//     other arrays are merged by appending the elements of theirs which
+//     ours lacks;
+//   - the newest coreos-assembler.meta-stamp is kept;
+//   - the identity fields (build ID, OSTree commit and content checksum,
+//     image config checksum) must be equal;
+//   - other scalars set differently take the value of the side with the
+//     newest coreos-assembler.meta-stamp, like cosalib's merge_meta, e.g.
+//     an image path renamed by compress. They conflict if neither side is
+//     newer.
+//
+// All the fields which can't be merged are reported in a
+// *MetaConflictError, in which case ours is left unchanged.
+func MergeMetaJSON(ours, theirs map[string]interface{}) error {
+	var conflicts []MetaConflict
+	for _, k := range identityFields {
+		o, ook := ours[k]
+		t, tok := theirs[k]
+		if ook && tok && !reflect.DeepEqual(o, t) {
+			conflicts = append(conflicts, MetaConflict{Path: k, Ours: o, Theirs: t})
+		}
+	}
+	if len(conflicts) > 0 {
+		return &MetaConflictError{Conflicts: conflicts}
+	}
+
+	oStamp, tStamp := metaStamp(ours[metaStampKey]), metaStamp(theirs[metaStampKey])
+	m := metaMerger{theirsNewer: tStamp > oStamp, oursNewer: oStamp > tStamp}
+	merged := m.mergeObject("", ours, theirs)
+	if len(m.conflicts) > 0 {
+		return &MetaConflictError{Conflicts: m.conflicts}
+	}
+	for k, v := range merged {
+		ours[k] = v
+	}
+	return nil
+}
+
+// metaMerger merges two meta.json documents, resolving the scalars set
+// differently in favor of the newest one.
+type metaMerger struct {
+	theirsNewer bool
+	oursNewer   bool
+	conflicts   []MetaConflict
+}
+
+func (m *metaMerger) mergeObject(path string, ours, theirs map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{}, len(ours))
+	for k, v := range ours {
+		ret[k] = v
+	}
+	keys := make([]string, 0, len(theirs))
+	for k := range theirs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		ret[k] = m.mergeValue(p, ours[k], theirs[k])
+	}
+	return ret
+}
+
+func (m *metaMerger) mergeValue(path string, ours, theirs interface{}) interface{} {
+	switch {
+	case ours == nil:
+		return theirs
+	case theirs == nil, reflect.DeepEqual(ours, theirs):
+		return ours
+	case path == metaStampKey:
+		if metaStamp(theirs) > metaStamp(ours) {
+			return theirs
+		}
+		return ours
+	}
+	switch o := ours.(type) {
+	case map[string]interface{}:
+		if t, ok := theirs.(map[string]interface{}); ok {
+			return m.mergeObject(path, o, t)
+		}
+	case []interface{}:
+		if t, ok := theirs.([]interface{}); ok {
+			return m.mergeArray(path, o, t)
+		}
+	}
+	switch {
+	case m.theirsNewer:
+		return theirs
+	case m.oursNewer:
+		return ours
+	}
+	m.conflicts = append(m.conflicts, MetaConflict{Path: path, Ours: ours, Theirs: theirs})
+	return ours
+}
+
+// elementName returns the name of an array element, if it is an object
+// with a name.
+func elementName(v interface{}) (string, bool) {
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	name, ok := obj["name"].(string)
+	return name, ok && name != ""
+}
+
+func (m *metaMerger) mergeArray(path string, ours, theirs []interface{}) []interface{} {
+	ret := append([]interface{}{}, ours...)
+	named := make(map[string]int)
+	for i, v := range ret {
+		if name, ok := elementName(v); ok {
+			named[name] = i
+		}
+	}
+	for _, v := range theirs {
+		if name, ok := elementName(v); ok {
+			if i, ok := named[name]; ok {
+				ret[i] = m.mergeValue(fmt.Sprintf("%s[%s]", path, name), ret[i], v)
+				continue
+			}
+			named[name] = len(ret)
+			ret = append(ret, v)
+			continue
+		}
+		found := false
+		for _, o := range ret {
+			if reflect.DeepEqual(o, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// readMetaMap reads the meta.json document at path. Numbers are decoded
+// as json.Number rather than float64, which can't hold version stamps
+// exactly.
+func readMetaMap(path string) (map[string]interface{}, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	var ret map[string]interface{}
+	if err := dec.Decode(&ret); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return ret, nil
+}
+
+// metaStamp returns the value of a version stamp, or 0 if it isn't one.
+func metaStamp(v interface{}) int64 {
+	switch s := v.(type) {
+	case json.Number:
+		if i, err := s.Int64(); err == nil {
+			return i
+		}
+		f, _ := s.Float64()
+		return int64(f)
+	case int64:
+		return s
+	case float64:
+		return int64(s)
+	}
+	return 0
+}
+
+// metaFragment is a meta.*.json written by a job when the meta merge of a
+// build is delayed.
+type metaFragment struct {
+	name string
+	data map[string]interface{}
+}
+
+// readMetaFragments reads the meta.*.json files of the build in dir.
+func readMetaFragments(dir string) ([]metaFragment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ret []metaFragment
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == CosaMetaJSON || !IsMetaJSON(e.Name()) {
+			continue
+		}
+		data, err := readMetaMap(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, metaFragment{name: e.Name(), data: data})
+	}
+	return ret, nil
+}
+
+// foldMetaFragments merges fragments into meta in a deterministic order:
+// by version stamp and then by file name.
+func foldMetaFragments(meta map[string]interface{}, fragments []metaFragment) error {
+	sort.SliceStable(fragments, func(i, j int) bool {
+		si, sj := metaStamp(fragments[i].data[metaStampKey]), metaStamp(fragments[j].data[metaStampKey])
+		if si != sj {
+			return si < sj
+		}
+		return fragments[i].name < fragments[j].name
+	})
+	for _, f := range fragments {
+		if err := MergeMetaJSON(meta, f.data); err != nil {
+			var cerr *MetaConflictError
+			if errors.As(err, &cerr) {
+				cerr.Source = f.name
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data, so that readers never see a
+// partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// writeMetaJSON stamps and atomically writes a meta.json document.
+func writeMetaJSON(path string, meta map[string]interface{}) error {
+	meta[metaStampKey] = time.Now().UnixNano()
+	out, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, out)
+}
+
+// UpdateMeta applies update to the meta.json at path under its lock, and
+// atomically writes the result. Since update is given the current
+// meta.json rather than a copy read earlier, concurrent writers don't
+// lose each other's changes. Only the fields which update changed are
+// written, so fields of meta.json which Build doesn't know are preserved,
+// including in objects such as images.
+func UpdateMeta(path string, update func(*Build) error) error {
+	lock, err := LockMeta(path, MetaLockTimeout)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock() //nolint
+
+	raw, err := readMetaMap(path)
+	if err != nil {
+		return err
+	}
+	b, err := readMetaLenient(path)
+	if err != nil {
+		return err
+	}
+	before, err := buildToMap(b)
+	if err != nil {
+		return err
+	}
+	if err := update(b); err != nil {
+		return err
+	}
+	if errs := b.Validate(); len(errs) > 0 {
+		return fmt.Errorf("updated %s is not compliant with the schema: %v", path, errs)
+	}
+	after, err := buildToMap(b)
+	if err != nil {
+		return err
+	}
+	overlayMetaChanges(raw, before, after)
+	return writeMetaJSON(path, raw)
+}
+
+// buildToMap returns the JSON document of b.
+func buildToMap(b *Build) (map[string]interface{}, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]interface{}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// overlayMetaChanges applies the changes from before to after, the
+// documents of a Build before and after an update, to the meta.json doc.
+// Objects are updated recursively, so that the fields of doc which Build
+// doesn't know are kept at any depth, and so are the fields which Build
+// would write differently without having been changed.
+func overlayMetaChanges(doc, before, after map[string]interface{}) {
+	for k, v := range after {
+		old, had := before[k]
+		if had && reflect.DeepEqual(old, v) {
+			continue
+		}
+		if vm, ok := v.(map[string]interface{}); ok {
+			if dm, ok := doc[k].(map[string]interface{}); ok {
+				om, _ := old.(map[string]interface{})
+				overlayMetaChanges(dm, om, vm)
+				continue
+			}
+		}
+		doc[k] = v
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			delete(doc, k)
+		}
+	}
+}
+
+// buildJSONFields are the meta.json fields of Build.
+var buildJSONFields = func() map[string]struct{} {
+	ret := make(map[string]struct{})
+	t := reflect.TypeOf(Build{})
+	for i := 0; i < t.NumField(); i++ {
+		ret[strings.Split(t.Field(i).Tag.Get("json"), ",")[0]] = struct{}{}
+	}
+	return ret
+}()
+
+// FoldResult describes the meta.*.json files folded into a meta.json.
+type FoldResult struct {
+	Folded []string `json:"folded"`
+}
+
+// FoldMeta merges the meta.*.json files of the build in dir into its
+// meta.json under its lock, following the policy of MergeMetaJSON in the
+// order of their version stamps. Nothing is written if any fragment
+// conflicts. Unless keep is set, the folded fragments are removed.
+func FoldMeta(dir string, keep bool) (*FoldResult, error) {
+	path := filepath.Join(dir, CosaMetaJSON)
+	lock, err := LockMeta(path, MetaLockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock() //nolint
+
+	meta, err := readMetaMap(path)
+	if err != nil {
+		return nil, err
+	}
+	fragments, err := readMetaFragments(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := foldMetaFragments(meta, fragments); err != nil {
+		return nil, err
+	}
+	res := &FoldResult{}
+	if len(fragments) == 0 {
+		return res, nil
+	}
+	if err := writeMetaJSON(path, meta); err != nil {
+		return nil, err
+	}
+	for _, f := range fragments {
+		res.Folded = append(res.Folded, f.name)
+		if !keep {
+			if err := os.Remove(filepath.Join(dir, f.name)); err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
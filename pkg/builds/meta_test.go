@@ -0,0 +1,310 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func parseMetaJSON(t *testing.T, s string) map[string]interface{} {
+	var ret map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &ret); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestMergeMetaJSON(t *testing.T) {
+	ours := parseMetaJSON(t, `{
+		"buildid": "41.1", "ostree-commit": "aaaa", "coreos-assembler.meta-stamp": 10,
+		"images": {"qemu": {"path": "qemu.qcow2"}},
+		"amis": [{"name": "us-east-1", "hvm": "ami-1"}],
+		"tags": ["a"]
+	}`)
+	theirs := parseMetaJSON(t, `{
+		"buildid": "41.1", "coreos-assembler.meta-stamp": 20,
+		"images": {"aws": {"path": "aws.vmdk"}},
+		"amis": [{"name": "us-east-1", "hvm": "ami-1", "snapshot": "snap-1"}, {"name": "us-west-1", "hvm": "ami-2"}],
+		"tags": ["b", "a"],
+		"gcp": {"image": "gcp-image"}
+	}`)
+	if err := MergeMetaJSON(ours, theirs); err != nil {
+		t.Fatal(err)
+	}
+	want := parseMetaJSON(t, `{
+		"buildid": "41.1", "ostree-commit": "aaaa", "coreos-assembler.meta-stamp": 20,
+		"images": {"qemu": {"path": "qemu.qcow2"}, "aws": {"path": "aws.vmdk"}},
+		"amis": [{"name": "us-east-1", "hvm": "ami-1", "snapshot": "snap-1"}, {"name": "us-west-1", "hvm": "ami-2"}],
+		"tags": ["a", "b"],
+		"gcp": {"image": "gcp-image"}
+	}`)
+	if !reflect.DeepEqual(ours, want) {
+		t.Errorf("got %v, want %v", ours, want)
+	}
+
+	// Scalars set differently conflict when neither side is newer.
+	conflicting := parseMetaJSON(t, `{"coreos-assembler.meta-stamp": 20, "amis": [{"name": "us-east-1", "hvm": "ami-3"}], "gcp": {"image": "other"}}`)
+	err := MergeMetaJSON(ours, conflicting)
+	var cerr *MetaConflictError
+	if !errors.As(err, &cerr) || !errors.Is(err, ErrMetaConflict) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	var paths []string
+	for _, c := range cerr.Conflicts {
+		paths = append(paths, c.Path)
+	}
+	if !reflect.DeepEqual(paths, []string{"amis[us-east-1].hvm", "gcp.image"}) {
+		t.Errorf("unexpected conflicts %v", cerr.Conflicts)
+	}
+	if !reflect.DeepEqual(ours, want) {
+		t.Errorf("a conflicting merge modified ours: %v", ours)
+	}
+
+	// Otherwise the newest side wins, e.g. after compress renamed an image.
+	if err := MergeMetaJSON(ours, parseMetaJSON(t, `{"coreos-assembler.meta-stamp": 5, "gcp": {"image": "older"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ours, want) {
+		t.Errorf("an older merge modified ours: %v", ours)
+	}
+	if err := MergeMetaJSON(ours, parseMetaJSON(t, `{"coreos-assembler.meta-stamp": 30, "images": {"qemu": {"path": "qemu.qcow2.xz"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if path := ours["images"].(map[string]interface{})["qemu"].(map[string]interface{})["path"]; path != "qemu.qcow2.xz" || ours[metaStampKey] != float64(30) {
+		t.Errorf("a newer merge wasn't applied: %v", ours)
+	}
+
+	err = MergeMetaJSON(ours, parseMetaJSON(t, `{"buildid": "41.2", "coreos-assembler.meta-stamp": 40, "summary": "x"}`))
+	if !errors.As(err, &cerr) || len(cerr.Conflicts) != 1 || cerr.Conflicts[0].Path != "buildid" {
+		t.Errorf("expected a build ID conflict, got %v", err)
+	}
+}
+
+func TestLockMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CosaMetaJSON)
+	l, err := LockMeta(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockPath := filepath.Join(filepath.Dir(path), ".meta.json.lock")
+	owner, err := os.ReadFile(lockPath)
+	if err != nil || !strings.HasPrefix(string(owner), lockPath+"|") {
+		t.Fatalf("unexpected lock file %q: %v", owner, err)
+	}
+	if _, err := LockMeta(path, 200*time.Millisecond); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("PID %d", os.Getpid())) {
+		t.Errorf("expected a timeout naming the holder, got %v", err)
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 0 {
+		t.Errorf("unlocking left %v", entries)
+	}
+
+	// An expired lock, e.g. of a killed job, is broken.
+	stale := lockPath + "|otherhost|1|1"
+	if err := os.WriteFile(stale, []byte(stale), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(stale, lockPath); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(lockPath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	l, err = LockMeta(path, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("the claim of the stale lock wasn't removed")
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CosaMetaJSON)
+	initial := `{"buildid": "41.1", "name": "fedora-coreos", "ostree-commit": "` + strings.Repeat("a", 64) + `",
+		"ostree-timestamp": "2026-01-01T00:00:00Z", "ostree-version": "41.1", "future-field": {"a": 1},
+		"images": {"qemu": {"path": "q.qcow2", "sha256": "` + strings.Repeat("b", 64) + `", "size": 1}, "futureimg": {"path": "f"}}}`
+	if err := os.WriteFile(path, []byte(initial), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Parallel jobs each add an AMI; none of them may be lost.
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- UpdateMeta(path, func(b *Build) error {
+				b.Amis = append(b.Amis, Amis{Region: fmt.Sprintf("region-%d", i), Hvm: fmt.Sprintf("ami-%d", i)})
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var meta map[string]interface{}
+	if err := readJSONFile(path, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if amis, _ := meta["amis"].([]interface{}); len(amis) != 8 {
+		t.Errorf("expected 8 AMIs, got %v", meta["amis"])
+	}
+	if !reflect.DeepEqual(meta["future-field"], map[string]interface{}{"a": float64(1)}) {
+		t.Errorf("unknown field not preserved: %v", meta)
+	}
+	images, _ := meta["images"].(map[string]interface{})
+	if _, ok := images["futureimg"]; !ok {
+		t.Errorf("unknown image not preserved: %v", images)
+	}
+	if _, ok := images["ostree"]; ok {
+		t.Errorf("unset image written: %v", images)
+	}
+
+	// Changes within objects are applied.
+	if err := UpdateMeta(path, func(b *Build) error {
+		b.BuildArtifacts.Qemu.Path = "q.qcow2.xz"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	meta = nil
+	if err := readJSONFile(path, &meta); err != nil {
+		t.Fatal(err)
+	}
+	images, _ = meta["images"].(map[string]interface{})
+	if qemu, _ := images["qemu"].(map[string]interface{}); qemu["path"] != "q.qcow2.xz" || images["futureimg"] == nil {
+		t.Errorf("unexpected images after an update: %v", images)
+	}
+	if _, ok := meta[metaStampKey]; !ok {
+		t.Errorf("meta.json not stamped")
+	}
+
+	if err := UpdateMeta(path, func(b *Build) error { return errors.New("failed") }); err == nil {
+		t.Errorf("expected the error of the update")
+	}
+}
+
+func TestFoldMeta(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		CosaMetaJSON: `{"buildid": "41.1", "name": "fedora-coreos", "ostree-commit": "aaaa", "ostree-timestamp": "",
+			"ostree-version": "41.1", "coreos-assembler.delayed-meta-merge": true, "coreos-assembler.meta-stamp": 1,
+			"images": {"qemu": {"path": "q.qcow2", "sha256": "a", "size": 1}}}`,
+		"meta.compress.json": `{"buildid": "41.1", "coreos-assembler.meta-stamp": 4,
+			"images": {"qemu": {"path": "q.qcow2.xz", "sha256": "b", "size": 1, "uncompressed-sha256": "a"}}}`,
+		"meta.aws.json":   `{"buildid": "41.1", "coreos-assembler.meta-stamp": 3, "amis": [{"name": "us-east-1", "hvm": "ami-1", "snapshot": "s"}]}`,
+		"meta.gcp.json":   `{"buildid": "41.1", "coreos-assembler.meta-stamp": 2, "gcp": {"image": "gcp-image", "url": "u"}}`,
+		"meta.azure.json": `{"buildid": "41.1", "azure": {"image": "azure.vhd", "url": "u"}}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := FoldMeta(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Folded, []string{"meta.azure.json", "meta.gcp.json", "meta.aws.json", "meta.compress.json"}) {
+		t.Errorf("unexpected fold order %v", res.Folded)
+	}
+	b, err := ParseBuild(filepath.Join(dir, CosaMetaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Amis) != 1 || b.Gcp == nil || b.Azure == nil {
+		t.Errorf("fragments not folded: %+v", b)
+	}
+	if b.BuildArtifacts.Qemu.Path != "q.qcow2.xz" {
+		t.Errorf("the newer image path wasn't folded: %+v", b.BuildArtifacts.Qemu)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("fragments not removed: %v", entries)
+	}
+
+	before, _ := os.ReadFile(filepath.Join(dir, CosaMetaJSON))
+	if err := os.WriteFile(filepath.Join(dir, "meta.bad.json"), []byte(`{"ostree-commit": "bbbb"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FoldMeta(dir, false); !errors.Is(err, ErrMetaConflict) || !strings.Contains(err.Error(), "meta.bad.json") {
+		t.Errorf("expected a conflict in meta.bad.json, got %v", err)
+	}
+	after, _ := os.ReadFile(filepath.Join(dir, CosaMetaJSON))
+	if string(before) != string(after) {
+		t.Errorf("a conflicting fold modified meta.json")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "meta.bad.json")); err != nil {
+		t.Errorf("a conflicting fragment was removed")
+	}
+}
+
+func TestMetaStampPrecision(t *testing.T) {
+	// Stamps this close are equal as float64.
+	dir := t.TempDir()
+	files := map[string]string{
+		CosaMetaJSON:     `{"buildid": "41.1", "coreos-assembler.meta-stamp": 1760000000000000000, "gcp": {"image": "old"}}`,
+		"meta.gcp1.json": `{"buildid": "41.1", "coreos-assembler.meta-stamp": 1760000000000000002, "gcp": {"image": "newer"}}`,
+		"meta.gcp2.json": `{"buildid": "41.1", "coreos-assembler.meta-stamp": 1760000000000000001, "gcp": {"image": "new"}}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := FoldMeta(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res.Folded, []string{"meta.gcp2.json", "meta.gcp1.json"}) {
+		t.Errorf("unexpected fold order %v", res.Folded)
+	}
+	meta, err := readMetaMap(filepath.Join(dir, CosaMetaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gcp, _ := meta["gcp"].(map[string]interface{}); gcp["image"] != "newer" {
+		t.Errorf("the newest fragment didn't win: %v", meta["gcp"])
+	}
+	// The stamp is written as an integer, like cosalib writes it.
+	stamp, ok := meta[metaStampKey].(json.Number)
+	if _, err := stamp.Int64(); !ok || err != nil {
+		t.Errorf("stamp %v isn't an integer", meta[metaStampKey])
+	}
+}
@@ -0,0 +1,268 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MetaSchemaVersionKey records the schema version of a meta.json
+	// which was migrated with MigrateMetaFile.
+	MetaSchemaVersionKey = "coreos-assembler.meta-schema-version"
+
+	// CurrentMetaSchemaVersion is the version of the schema of Build.
+	CurrentMetaSchemaVersion = 1
+)
+
+var (
+	// compatMode when set tolerates meta.json fields unknown to Build,
+	// e.g. when reading the builds of a newer cosa.
+	compatMode, _ = strconv.ParseBool(os.Getenv("COSA_META_COMPAT"))
+)
+
+// SetCompatMode sets whether meta.json fields unknown to Build and newer
+// schema versions are tolerated, with a warning, rather than rejected.
+// It defaults to the value of $COSA_META_COMPAT.
+func SetCompatMode(enabled bool) {
+	compatMode = enabled
+}
+
+// Migration upgrades a meta.json document from schema version From to
+// From+1.
+type Migration struct {
+	From        int
+	Description string
+	Migrate     func(meta map[string]interface{}) error
+	// detect reports whether a document without an explicit version
+	// predates the migration.
+	detect func(meta map[string]interface{}) bool
+}
+
+// migrations is the registry of migrations, by version. Version 1 is the
+// first versioned schema, which unversioned meta.json documents already
+// follow, so there are none yet: an incompatible change to Build
+// registers its migration from CurrentMetaSchemaVersion and bumps it.
+var migrations []Migration
+
+// Migrations returns the registered migrations, oldest first.
+func Migrations() []Migration {
+	ret := append([]Migration{}, migrations...)
+	sort.Slice(ret, func(i, j int) bool { return ret[i].From < ret[j].From })
+	return ret
+}
+
+// DetectMetaSchemaVersion returns the schema version of a meta.json
+// document: its explicit version if it has one, or else the oldest
+// version whose migration it predates.
+func DetectMetaSchemaVersion(meta map[string]interface{}) (int, error) {
+	if v, ok := meta[MetaSchemaVersionKey]; ok {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f != float64(int(f)) {
+			return 0, fmt.Errorf("invalid %s %v", MetaSchemaVersionKey, v)
+		}
+		return int(f), nil
+	}
+	for _, m := range Migrations() {
+		if m.detect != nil && m.detect(meta) {
+			return m.From, nil
+		}
+	}
+	return CurrentMetaSchemaVersion, nil
+}
+
+// MigrateMeta upgrades a meta.json document in place to the current
+// schema version, returning the descriptions of the migrations applied.
+// The explicit version of the document, if any, is updated.
+func MigrateMeta(meta map[string]interface{}) ([]string, error) {
+	version, err := DetectMetaSchemaVersion(meta)
+	if err != nil {
+		return nil, err
+	}
+	if version > CurrentMetaSchemaVersion {
+		return nil, fmt.Errorf("meta.json schema version %d is newer than the supported version %d", version, CurrentMetaSchemaVersion)
+	}
+	var applied []string
+	for _, m := range Migrations() {
+		if m.From < version {
+			continue
+		}
+		if err := m.Migrate(meta); err != nil {
+			return applied, fmt.Errorf("migrating meta.json from schema version %d: %w", m.From, err)
+		}
+		applied = append(applied, m.Description)
+	}
+	if _, ok := meta[MetaSchemaVersionKey]; ok {
+		meta[MetaSchemaVersionKey] = CurrentMetaSchemaVersion
+	}
+	return applied, nil
+}
+
+// decodeMeta decodes a meta.json document into a Build, migrating it in
+// memory if it uses an older schema. Fields unknown to Build, at any
+// depth, are rejected, unless in compatibility mode.
+func decodeMeta(data []byte) (*Build, error) {
+	var meta map[string]interface{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	version, err := DetectMetaSchemaVersion(meta)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case version > CurrentMetaSchemaVersion && !compatMode:
+		return nil, fmt.Errorf("meta.json schema version %d is newer than the supported version %d; set COSA_META_COMPAT=1 to read it anyway", version, CurrentMetaSchemaVersion)
+	case version < CurrentMetaSchemaVersion:
+		applied, err := MigrateMeta(meta)
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("migrations", applied).Debugf("migrated meta.json from schema version %d", version)
+		if data, err = json.Marshal(meta); err != nil {
+			return nil, err
+		}
+	}
+
+	if unknown := unknownMetaFields(meta); len(unknown) > 0 {
+		if !compatMode {
+			return nil, fmt.Errorf("meta.json fields unknown to this version of cosa: %s; set COSA_META_COMPAT=1 to ignore them", strings.Join(unknown, ", "))
+		}
+		log.WithField("fields", unknown).Warn("Ignoring meta.json fields unknown to this version of cosa")
+	}
+	var b *Build
+	return b, json.Unmarshal(data, &b)
+}
+
+// unknownMetaFields returns the fields of a meta.json document, at any
+// depth, which have no JSON tag in the corresponding struct of Build.
+func unknownMetaFields(meta map[string]interface{}) []string {
+	var ret []string
+	collectUnknownFields(meta, reflect.TypeOf(Build{}), "", &ret)
+	sort.Strings(ret)
+	return ret
+}
+
+func collectUnknownFields(v interface{}, t reflect.Type, prefix string, ret *[]string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for k, fv := range v {
+				ft, ok := fields[k]
+				if !ok {
+					*ret = append(*ret, prefix+k)
+					continue
+				}
+				collectUnknownFields(fv, ft, prefix+k+".", ret)
+			}
+		case reflect.Map:
+			for k, fv := range v {
+				collectUnknownFields(fv, t.Elem(), prefix+k+".", ret)
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, e := range v {
+				collectUnknownFields(e, t.Elem(), prefix, ret)
+			}
+		}
+	}
+}
+
+// jsonFields returns the types of the fields of a struct by their JSON
+// names.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	ret := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		switch {
+		case name == "-" || !f.IsExported():
+			continue
+		case name == "":
+			name = f.Name
+		}
+		ret[name] = f.Type
+	}
+	return ret
+}
+
+// MigrationResult describes the migration of a meta.json file.
+type MigrationResult struct {
+	Path    string   `json:"path"`
+	From    int      `json:"from"`
+	Applied []string `json:"applied,omitempty"`
+	// Changed is whether the file was, or in a dry run would be,
+	// rewritten.
+	Changed bool `json:"changed"`
+}
+
+// MigrateMetaFile migrates the meta.json at path to the current schema
+// version under its lock and records the version in it, unless dryRun
+// is set. Files already recording the current version are left alone.
+func MigrateMetaFile(path string, dryRun bool) (*MigrationResult, error) {
+	lock, err := LockMeta(path, MetaLockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock() //nolint
+
+	var meta map[string]interface{}
+	if err := readJSONFile(path, &meta); err != nil {
+		return nil, err
+	}
+	res := &MigrationResult{Path: path}
+	if res.From, err = DetectMetaSchemaVersion(meta); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	_, recorded := meta[MetaSchemaVersionKey]
+	if res.Applied, err = MigrateMeta(meta); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if recorded && res.From == CurrentMetaSchemaVersion {
+		return res, nil
+	}
+	meta[MetaSchemaVersionKey] = CurrentMetaSchemaVersion
+	res.Changed = true
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	var b Build
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if errs := b.Validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("migrated %s is not compliant with the schema: %v", path, errs)
+	}
+	if dryRun {
+		return res, nil
+	}
+	return res, writeMetaJSON(path, meta)
+}
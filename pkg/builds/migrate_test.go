@@ -0,0 +1,201 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// withTestMigration registers, for the duration of the test, a migration
+// from schema version 0 which renames the summary field, standing in for
+// a future incompatible change to Build.
+func withTestMigration(t *testing.T) {
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = []Migration{{
+		From:        0,
+		Description: "rename old-summary to summary",
+		Migrate: func(meta map[string]interface{}) error {
+			if v, ok := meta["old-summary"]; ok {
+				if _, ok := meta["summary"]; ok {
+					return fmt.Errorf("both old-summary and summary are set")
+				}
+				meta["summary"] = v
+				delete(meta, "old-summary")
+			}
+			return nil
+		},
+		detect: func(meta map[string]interface{}) bool {
+			_, ok := meta["old-summary"]
+			return ok
+		},
+	}}
+}
+
+// legacyMeta returns a meta.json from before the test migration.
+func legacyMeta(extra string) string {
+	return `{"buildid": "31.1", "name": "fedora-coreos", "ostree-commit": "` + strings.Repeat("a", 64) + `",
+		"ostree-timestamp": "2020-01-01T00:00:00Z", "ostree-version": "31.1",
+		"old-summary": "Fedora CoreOS", "images": {"qemu": {"path": "fcos.qcow2", "sha256": "x"}}` + extra + `}`
+}
+
+func TestNoMigrations(t *testing.T) {
+	// The registered migrations must leave the meta.json of existing
+	// builds alone, e.g. the legacy installer artifacts of RHCOS.
+	for _, path := range testMeta {
+		var meta map[string]interface{}
+		if err := readJSONFile(path, &meta); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := DetectMetaSchemaVersion(meta); err != nil || v != CurrentMetaSchemaVersion {
+			t.Errorf("%s: unexpected schema version %d: %v", path, v, err)
+		}
+	}
+	b, err := ParseBuild(rhcosJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BuildArtifacts.Iso == nil || !strings.HasSuffix(b.BuildArtifacts.Iso.Path, "-installer.x86_64.iso") || b.BuildArtifacts.LiveIso != nil {
+		t.Errorf("installer ISO of %s not kept: %+v", rhcosJSON, b.BuildArtifacts)
+	}
+	if b.BuildArtifacts.Kernel == nil || b.BuildArtifacts.Initramfs == nil {
+		t.Errorf("installer PXE artifacts of %s not kept: %+v", rhcosJSON, b.BuildArtifacts)
+	}
+}
+
+func TestDetectMetaSchemaVersion(t *testing.T) {
+	withTestMigration(t)
+	for doc, want := range map[string]int{
+		legacyMeta(""): 0,
+		legacyMeta(`, "coreos-assembler.meta-schema-version": 1`): 1,
+		`{"summary": "Fedora CoreOS"}`:                            CurrentMetaSchemaVersion,
+		`{"coreos-assembler.meta-schema-version": 7}`:             7,
+	} {
+		got, err := DetectMetaSchemaVersion(parseMetaJSON(t, doc))
+		if err != nil || got != want {
+			t.Errorf("DetectMetaSchemaVersion(%s) = %d, %v, want %d", doc, got, err, want)
+		}
+	}
+	if _, err := DetectMetaSchemaVersion(parseMetaJSON(t, `{"coreos-assembler.meta-schema-version": "1"}`)); err == nil {
+		t.Errorf("expected an invalid version to fail")
+	}
+}
+
+func TestMigrateMeta(t *testing.T) {
+	withTestMigration(t)
+	meta := parseMetaJSON(t, legacyMeta(""))
+	applied, err := MigrateMeta(meta)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("unexpected migrations %v: %v", applied, err)
+	}
+	if meta["summary"] != "Fedora CoreOS" || meta["old-summary"] != nil {
+		t.Errorf("summary not migrated: %v", meta)
+	}
+	if _, ok := meta[MetaSchemaVersionKey]; ok {
+		t.Errorf("in-memory migration recorded the version")
+	}
+
+	both := parseMetaJSON(t, `{"old-summary": "a", "summary": "b"}`)
+	if _, err := MigrateMeta(both); err == nil {
+		t.Errorf("expected a failing migration to fail")
+	}
+}
+
+func TestParseBuildCompat(t *testing.T) {
+	withTestMigration(t)
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	b, err := ParseBuild(write("legacy.json", legacyMeta("")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.BuildSummary != "Fedora CoreOS" {
+		t.Errorf("legacy meta.json not migrated: %+v", b)
+	}
+
+	newer := write("newer.json", legacyMeta(`, "coreos-assembler.meta-schema-version": 2, "future": true`))
+	unknown := write("unknown.json", legacyMeta(`, "future": {"a": 1}`))
+	defer SetCompatMode(false)
+	for _, compat := range []bool{false, true} {
+		SetCompatMode(compat)
+		for _, p := range []string{newer, unknown} {
+			b, err := ParseBuild(p)
+			if compat && (err != nil || b.BuildID != "31.1") {
+				t.Errorf("%s: compatibility mode failed: %v", p, err)
+			}
+			if !compat && err == nil {
+				t.Errorf("%s: expected strict parsing to fail", p)
+			}
+		}
+	}
+
+	meta := parseMetaJSON(t, legacyMeta(`, "future": 1, "images": {"qemu": {"size": 1, "future-digest": "x"}, "teleporter": {}},
+		"amis": [{"name": "us-east-1", "hvm": "ami-1", "future": true}], "coreos-assembler.container-config-git": {"branch": "main"}`))
+	want := []string{"amis.future", "future", "images.qemu.future-digest", "images.teleporter", "old-summary"}
+	if got := unknownMetaFields(meta); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected unknown fields %v", got)
+	}
+
+	// A nested unknown field is rejected like a top-level one.
+	SetCompatMode(false)
+	nested := write("nested.json", `{"buildid": "31.1", "name": "fedora-coreos", "ostree-commit": "`+strings.Repeat("a", 64)+`",
+		"ostree-timestamp": "2020-01-01T00:00:00Z", "ostree-version": "31.1", "images": {"qemu": {"path": "fcos.qcow2", "sha256": "x", "future": 1}}}`)
+	if _, err := ParseBuild(nested); err == nil || !strings.Contains(err.Error(), "images.qemu.future") {
+		t.Errorf("expected a nested unknown field to be rejected, got %v", err)
+	}
+}
+
+func TestMigrateMetaFile(t *testing.T) {
+	withTestMigration(t)
+	path := filepath.Join(t.TempDir(), CosaMetaJSON)
+	if err := os.WriteFile(path, []byte(legacyMeta("")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := MigrateMetaFile(path, true)
+	if err != nil || !res.Changed || res.From != 0 {
+		t.Fatalf("unexpected dry run %+v: %v", res, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != legacyMeta("") {
+		t.Errorf("dry run modified meta.json")
+	}
+
+	if res, err = MigrateMetaFile(path, false); err != nil || !res.Changed {
+		t.Fatalf("unexpected migration %+v: %v", res, err)
+	}
+	b, err := ParseBuild(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.CosaMetaSchemaVersion != CurrentMetaSchemaVersion || b.BuildSummary != "Fedora CoreOS" {
+		t.Errorf("meta.json not migrated: %+v", b)
+	}
+
+	if res, err = MigrateMetaFile(path, false); err != nil || res.Changed {
+		t.Errorf("expected a migrated meta.json to be left alone, got %+v: %v", res, err)
+	}
+}
@@ -0,0 +1,551 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PackageDiffType is the kind of change of a package between two builds.
+// The values are the ones used by rpm-ostree and cosa diff.
+type PackageDiffType int
+
+const (
+	PackageAdded PackageDiffType = iota
+	PackageRemoved
+	PackageUpgraded
+	PackageDowngraded
+)
+
+var packageDiffTypeNames = []string{"added", "removed", "upgraded", "downgraded"}
+
+func (t PackageDiffType) String() string {
+	if t < 0 || int(t) >= len(packageDiffTypeNames) {
+		return fmt.Sprintf("PackageDiffType(%d)", int(t))
+	}
+	return packageDiffTypeNames[t]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t PackageDiffType) MarshalText() ([]byte, error) {
+	return marshalEnum("package diff type", packageDiffTypeNames, int(t))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *PackageDiffType) UnmarshalText(text []byte) error {
+	return unmarshalEnum("package diff type", packageDiffTypeNames, text, (*int)(t))
+}
+
+// marshalEnum and unmarshalEnum convert the enums of this file to and
+// from their names.
+func marshalEnum(what string, names []string, v int) ([]byte, error) {
+	if v < 0 || v >= len(names) {
+		return nil, fmt.Errorf("invalid %s %d", what, v)
+	}
+	return []byte(names[v]), nil
+}
+
+func unmarshalEnum(what string, names []string, text []byte, v *int) error {
+	for i, name := range names {
+		if name == string(text) {
+			*v = i
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid %s %q", what, text)
+}
+
+// Package is an RPM of the package list of an OSTree commit.
+type Package struct {
+	Name    string `json:"name"`
+	Epoch   string `json:"epoch,omitempty"`
+	Version string `json:"version"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+}
+
+// EVR returns the epoch:version-release of the package, omitting a zero
+// epoch.
+func (p *Package) EVR() string {
+	if p.Epoch == "" || p.Epoch == "0" {
+		return p.Version + "-" + p.Release
+	}
+	return p.Epoch + ":" + p.Version + "-" + p.Release
+}
+
+// ComparePackages compares the epoch, version and release of a and b the
+// way RPM does, returning -1, 0 or 1 if a is older, the same or newer
+// than b.
+func ComparePackages(a, b *Package) int {
+	ea, _ := strconv.Atoi(a.Epoch)
+	eb, _ := strconv.Atoi(b.Epoch)
+	switch {
+	case ea < eb:
+		return -1
+	case ea > eb:
+		return 1
+	}
+	if c := rpmvercmp(a.Version, b.Version); c != 0 {
+		return c
+	}
+	return rpmvercmp(a.Release, b.Release)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// span splits s after its leading characters matching f.
+func span(s string, f func(byte) bool) (string, string) {
+	i := 0
+	for i < len(s) && f(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// rpmvercmp is a port of rpmvercmp() of librpm.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	isSep := func(c byte) bool {
+		return !isDigit(c) && !isAlpha(c) && c != '~' && c != '^'
+	}
+	for {
+		_, a = span(a, isSep)
+		_, b = span(b, isSep)
+
+		// A tilde sorts before everything, even the end of the string.
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		// A caret sorts after the end of the string, but before
+		// everything else.
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if a == "" {
+				return -1
+			}
+			if b == "" {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		if a == "" || b == "" {
+			break
+		}
+
+		numeric := isDigit(a[0])
+		class := isAlpha
+		if numeric {
+			class = isDigit
+		}
+		var sa, sb string
+		sa, a = span(a, class)
+		sb, b = span(b, class)
+		// Numeric segments are newer than alphabetic ones.
+		if sb == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			sa = strings.TrimLeft(sa, "0")
+			sb = strings.TrimLeft(sb, "0")
+			if len(sa) != len(sb) {
+				if len(sa) > len(sb) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if c := strings.Compare(sa, sb); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a == "" && b == "":
+		return 0
+	case a == "":
+		return -1
+	default:
+		return 1
+	}
+}
+
+// PackageChange is a package which differs between two builds.
+type PackageChange struct {
+	Name     string          `json:"name"`
+	Type     PackageDiffType `json:"type"`
+	Previous *Package        `json:"previous,omitempty"`
+	New      *Package        `json:"new,omitempty"`
+}
+
+// DiffPackages compares two package lists, returning the changes sorted
+// by type and then by name.
+func DiffPackages(from, to []Package) []PackageChange {
+	old := make(map[string]*Package)
+	for i := range from {
+		old[from[i].Name] = &from[i]
+	}
+	var ret []PackageChange
+	seen := make(map[string]bool)
+	for i := range to {
+		p := &to[i]
+		seen[p.Name] = true
+		prev, ok := old[p.Name]
+		if !ok {
+			ret = append(ret, PackageChange{Name: p.Name, Type: PackageAdded, New: p})
+			continue
+		}
+		switch c := ComparePackages(prev, p); {
+		case c < 0:
+			ret = append(ret, PackageChange{Name: p.Name, Type: PackageUpgraded, Previous: prev, New: p})
+		case c > 0:
+			ret = append(ret, PackageChange{Name: p.Name, Type: PackageDowngraded, Previous: prev, New: p})
+		}
+	}
+	for i := range from {
+		if !seen[from[i].Name] {
+			ret = append(ret, PackageChange{Name: from[i].Name, Type: PackageRemoved, Previous: &from[i]})
+		}
+	}
+	sortPackageChanges(ret)
+	return ret
+}
+
+func sortPackageChanges(changes []PackageChange) {
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Type != changes[j].Type {
+			return changes[i].Type < changes[j].Type
+		}
+		return changes[i].Name < changes[j].Name
+	})
+}
+
+// AdvisoryKind is the type of an advisory, as numbered by libdnf.
+type AdvisoryKind int
+
+const (
+	AdvisoryUnknown AdvisoryKind = iota
+	AdvisorySecurity
+	AdvisoryBugfix
+	AdvisoryEnhancement
+	AdvisoryNewPackage
+)
+
+var advisoryKindNames = []string{"unknown", "security", "bugfix", "enhancement", "newpackage"}
+
+func (k AdvisoryKind) String() string {
+	if k < 0 || int(k) >= len(advisoryKindNames) {
+		return fmt.Sprintf("AdvisoryKind(%d)", int(k))
+	}
+	return advisoryKindNames[k]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k AdvisoryKind) MarshalText() ([]byte, error) {
+	return marshalEnum("advisory kind", advisoryKindNames, int(k))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *AdvisoryKind) UnmarshalText(text []byte) error {
+	return unmarshalEnum("advisory kind", advisoryKindNames, text, (*int)(k))
+}
+
+// AdvisorySeverity is the severity of an advisory, as numbered by
+// rpm-ostree.
+type AdvisorySeverity int
+
+const (
+	AdvisorySeverityNone AdvisorySeverity = iota
+	AdvisorySeverityLow
+	AdvisorySeverityModerate
+	AdvisorySeverityImportant
+	AdvisorySeverityCritical
+)
+
+var advisorySeverityNames = []string{"none", "low", "moderate", "important", "critical"}
+
+func (s AdvisorySeverity) String() string {
+	if s < 0 || int(s) >= len(advisorySeverityNames) {
+		return fmt.Sprintf("AdvisorySeverity(%d)", int(s))
+	}
+	return advisorySeverityNames[s]
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s AdvisorySeverity) MarshalText() ([]byte, error) {
+	return marshalEnum("advisory severity", advisorySeverityNames, int(s))
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *AdvisorySeverity) UnmarshalText(text []byte) error {
+	return unmarshalEnum("advisory severity", advisorySeverityNames, text, (*int)(s))
+}
+
+// CVEReference is a CVE fixed by an advisory.
+type CVEReference struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Advisory is an update advisory which applies to the packages of a build.
+type Advisory struct {
+	ID       string           `json:"id"`
+	Kind     AdvisoryKind     `json:"kind"`
+	Severity AdvisorySeverity `json:"severity"`
+	// Packages are the NEVRAs of the packages fixed by the advisory.
+	Packages []string       `json:"packages,omitempty"`
+	CVEs     []CVEReference `json:"cves,omitempty"`
+}
+
+// scalarString formats a JSON scalar, printing whole numbers without an
+// exponent.
+func scalarString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// parsePackageList parses the rpmostree.rpmdb.pkglist commit metadata,
+// an array of [name, epoch, version, release, arch] arrays.
+func parsePackageList(data json.RawMessage) ([]Package, error) {
+	var raw [][]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing package list: %w", err)
+	}
+	ret := make([]Package, 0, len(raw))
+	for _, p := range raw {
+		if len(p) != 5 {
+			return nil, fmt.Errorf("parsing package list: expected 5 fields, got %v", p)
+		}
+		ret = append(ret, Package{
+			Name:    scalarString(p[0]),
+			Epoch:   scalarString(p[1]),
+			Version: scalarString(p[2]),
+			Release: scalarString(p[3]),
+			Arch:    scalarString(p[4]),
+		})
+	}
+	return ret, nil
+}
+
+// parseAdvisories parses the rpmostree.advisories commit metadata, which
+// uses the same format as the advisory diffs of meta.json.
+func parseAdvisories(data json.RawMessage) ([]Advisory, error) {
+	var items AdvisoryDiff
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("parsing advisories: %w", err)
+	}
+	return items.Advisories(), nil
+}
+
+// parseEVR returns the package with the given epoch:version-release.
+func parseEVR(name, evr, arch string) Package {
+	p := Package{Name: name, Arch: arch}
+	if i := strings.Index(evr, ":"); i >= 0 {
+		p.Epoch, evr = evr[:i], evr[i+1:]
+	}
+	if i := strings.LastIndex(evr, "-"); i >= 0 {
+		p.Version, p.Release = evr[:i], evr[i+1:]
+	} else {
+		p.Version = evr
+	}
+	return p
+}
+
+// rpmostreePackage is the [name, evr, arch] form of a package used by
+// rpm-ostree db diff.
+type rpmostreePackage [3]string
+
+func (p rpmostreePackage) pkg() *Package {
+	ret := parseEVR(p[0], p[1], p[2])
+	return &ret
+}
+
+func newRpmostreePackage(p *Package) *rpmostreePackage {
+	if p == nil {
+		return nil
+	}
+	return &rpmostreePackage{p.Name, p.EVR(), p.Arch}
+}
+
+// PackageSetDifferencesItems is a package change of the pkgdiff of a
+// build, which rpm-ostree serializes as [name, type, {"PreviousPackage":
+// [name, evr, arch], "NewPackage": [name, evr, arch]}].
+type PackageSetDifferencesItems struct {
+	PackageChange
+}
+
+type rpmostreePackageVersions struct {
+	Previous *rpmostreePackage `json:"PreviousPackage,omitempty"`
+	New      *rpmostreePackage `json:"NewPackage,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (i PackageSetDifferencesItems) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{
+		i.Name,
+		int(i.Type),
+		rpmostreePackageVersions{
+			Previous: newRpmostreePackage(i.Previous),
+			New:      newRpmostreePackage(i.New),
+		},
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (i *PackageSetDifferencesItems) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("package diff: expected 3 fields, got %d", len(raw))
+	}
+	var versions rpmostreePackageVersions
+	*i = PackageSetDifferencesItems{}
+	if err := json.Unmarshal(raw[0], &i.Name); err != nil {
+		return fmt.Errorf("package diff name: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], (*int)(&i.Type)); err != nil {
+		return fmt.Errorf("package diff type of %s: %w", i.Name, err)
+	}
+	if err := json.Unmarshal(raw[2], &versions); err != nil {
+		return fmt.Errorf("package diff versions of %s: %w", i.Name, err)
+	}
+	if versions.Previous != nil {
+		i.Previous = versions.Previous.pkg()
+	}
+	if versions.New != nil {
+		i.New = versions.New.pkg()
+	}
+	return nil
+}
+
+// Changes returns the package changes, sorted by type and then by name.
+func (d PackageSetDifferences) Changes() []PackageChange {
+	var ret []PackageChange
+	for _, i := range d {
+		ret = append(ret, i.PackageChange)
+	}
+	sortPackageChanges(ret)
+	return ret
+}
+
+// AdvisoryDiffItems is an advisory of the advisory diff of a build, which
+// rpm-ostree serializes as [id, kind, severity, [nevra...],
+// {"cve_references": [[title, url]...]}].
+type AdvisoryDiffItems struct {
+	Advisory
+}
+
+// MarshalJSON implements json.Marshaler.
+func (i AdvisoryDiffItems) MarshalJSON() ([]byte, error) {
+	packages := i.Packages
+	if packages == nil {
+		packages = []string{}
+	}
+	refs := make([][2]string, 0, len(i.CVEs))
+	for _, ref := range i.CVEs {
+		refs = append(refs, [2]string{ref.Title, ref.URL})
+	}
+	return json.Marshal([]interface{}{
+		i.ID,
+		int(i.Kind),
+		int(i.Severity),
+		packages,
+		map[string]interface{}{"cve_references": refs},
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (i *AdvisoryDiffItems) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw) < 4 || len(raw) > 5 {
+		return fmt.Errorf("advisory: expected 4 or 5 fields, got %d", len(raw))
+	}
+	*i = AdvisoryDiffItems{}
+	if err := json.Unmarshal(raw[0], &i.ID); err != nil {
+		return fmt.Errorf("advisory ID: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], (*int)(&i.Kind)); err != nil {
+		return fmt.Errorf("kind of advisory %s: %w", i.ID, err)
+	}
+	if err := json.Unmarshal(raw[2], (*int)(&i.Severity)); err != nil {
+		return fmt.Errorf("severity of advisory %s: %w", i.ID, err)
+	}
+	if err := json.Unmarshal(raw[3], &i.Packages); err != nil {
+		return fmt.Errorf("packages of advisory %s: %w", i.ID, err)
+	}
+	if len(raw) > 4 {
+		var info struct {
+			CVEs [][]string `json:"cve_references"`
+		}
+		if err := json.Unmarshal(raw[4], &info); err != nil {
+			return fmt.Errorf("references of advisory %s: %w", i.ID, err)
+		}
+		for _, ref := range info.CVEs {
+			if len(ref) != 2 {
+				return fmt.Errorf("references of advisory %s: expected [title, url], got %v", i.ID, ref)
+			}
+			i.CVEs = append(i.CVEs, CVEReference{Title: ref[0], URL: ref[1]})
+		}
+	}
+	return nil
+}
+
+// Advisories returns the advisories of the diff.
+func (d AdvisoryDiff) Advisories() []Advisory {
+	var ret []Advisory
+	for _, i := range d {
+		ret = append(ret, i.Advisory)
+	}
+	return ret
+}
@@ -0,0 +1,135 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// TestPackageDiffRoundTrip checks that the typed pkgdiff of the fixtures
+// serializes back to what rpm-ostree wrote.
+func TestPackageDiffRoundTrip(t *testing.T) {
+	for _, df := range testMeta {
+		data, err := os.ReadFile(df)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ParseBuild(df)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b.PkgdiffBetweenBuilds) == 0 {
+			t.Fatalf("%s: no pkgdiff", df)
+		}
+		out, err := json.Marshal(b.PkgdiffBetweenBuilds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got interface{}
+		if err := json.Unmarshal(out, &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, raw["pkgdiff"]) {
+			t.Errorf("%s: pkgdiff round trip mismatch:\n%s", df, out)
+		}
+	}
+
+	b, err := ParseBuild(fcosJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range b.PkgdiffBetweenBuilds.Changes() {
+		if c.Name != "podman" {
+			continue
+		}
+		want := PackageChange{
+			Name:     "podman",
+			Type:     PackageUpgraded,
+			Previous: &Package{Name: "podman", Epoch: "2", Version: "1.8.1", Release: "0.7.rc4.fc31", Arch: "x86_64"},
+			New:      &Package{Name: "podman", Epoch: "2", Version: "1.8.1", Release: "2.fc31", Arch: "x86_64"},
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("got %+v, want %+v", c, want)
+		}
+		return
+	}
+	t.Errorf("podman is missing from the pkgdiff of %s", fcosJSON)
+}
+
+func TestAdvisoryDiffRoundTrip(t *testing.T) {
+	in := `[["FEDORA-2026-1",1,3,["kernel-6.2.0-1.fc41.x86_64"],{"cve_references":[["CVE-2026-0001","https://example.com/CVE-2026-0001"]]}],` +
+		`["FEDORA-2026-2",2,0,["podman-2:1.8.1-2.fc31.x86_64"],{"cve_references":[]}]]`
+	var d AdvisoryDiff
+	if err := json.Unmarshal([]byte(in), &d); err != nil {
+		t.Fatal(err)
+	}
+	want := []Advisory{
+		{
+			ID:       "FEDORA-2026-1",
+			Kind:     AdvisorySecurity,
+			Severity: AdvisorySeverityImportant,
+			Packages: []string{"kernel-6.2.0-1.fc41.x86_64"},
+			CVEs:     []CVEReference{{Title: "CVE-2026-0001", URL: "https://example.com/CVE-2026-0001"}},
+		},
+		{
+			ID:       "FEDORA-2026-2",
+			Kind:     AdvisoryBugfix,
+			Severity: AdvisorySeverityNone,
+			Packages: []string{"podman-2:1.8.1-2.fc31.x86_64"},
+		},
+	}
+	if !reflect.DeepEqual(d.Advisories(), want) {
+		t.Errorf("got %+v, want %+v", d.Advisories(), want)
+	}
+	out, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("round trip mismatch:\n%s\n%s", out, in)
+	}
+
+	b, err := ParseBuild(fcosJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.AdvisoryDiffBetweenBuilds = d
+	if errs := b.Validate(); len(errs) > 0 {
+		t.Errorf("build with advisories fails validation: %v", errs)
+	}
+}
+
+func TestParseEVR(t *testing.T) {
+	for evr, want := range map[string]Package{
+		"2:1.8.1-2.fc31":                       {Epoch: "2", Version: "1.8.1", Release: "2.fc31"},
+		"4.4.0-202001151823.git.1.7a12db8.el8": {Version: "4.4.0", Release: "202001151823.git.1.7a12db8.el8"},
+		"1.0":                                  {Version: "1.0"},
+	} {
+		got := parseEVR("", evr, "")
+		if got != want {
+			t.Errorf("parseEVR(%q) = %+v, want %+v", evr, got, want)
+		}
+		if got.Release != "" && got.EVR() != evr {
+			t.Errorf("EVR() = %q, want %q", got.EVR(), evr)
+		}
+	}
+}
@@ -0,0 +1,531 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ProvenanceArtifact is the name of the provenance artifact.
+	ProvenanceArtifact = "provenance"
+
+	// InTotoStatementType is the type of in-toto v1 statements.
+	InTotoStatementType = "https://in-toto.io/Statement/v1"
+	// InTotoPayloadType is the DSSE payload type of in-toto statements.
+	InTotoPayloadType = "application/vnd.in-toto+json"
+	// SLSAProvenanceType is the predicate type of SLSA v1 provenance.
+	SLSAProvenanceType = "https://slsa.dev/provenance/v1"
+	// ProvenanceBuildType identifies the parameters of cosa builds.
+	ProvenanceBuildType = "https://github.com/coreos/coreos-assembler/buildtypes/cosa/v1"
+	// ProvenanceBuilderID identifies coreos-assembler as the builder.
+	ProvenanceBuilderID = "https://github.com/coreos/coreos-assembler"
+
+	// OCI labels of builds imported from a derived container image.
+	baseImageNameLabel   = "org.opencontainers.image.base.name"
+	baseImageDigestLabel = "org.opencontainers.image.base.digest"
+
+	// ostreeCommitDigest is the digest algorithm of OSTree commit
+	// checksums, which aren't the SHA-256 of any file.
+	ostreeCommitDigest = "ostreeCommit"
+)
+
+// InTotoStatement is an in-toto v1 statement with SLSA v1 provenance.
+type InTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []InTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     SLSAProvenance  `json:"predicate"`
+}
+
+// InTotoSubject is a product of a build.
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// SLSAProvenance is the SLSA v1 provenance predicate.
+type SLSAProvenance struct {
+	BuildDefinition SLSABuildDefinition `json:"buildDefinition"`
+	RunDetails      SLSARunDetails      `json:"runDetails"`
+}
+
+// SLSABuildDefinition describes the inputs of a build.
+type SLSABuildDefinition struct {
+	BuildType            string                   `json:"buildType"`
+	ExternalParameters   map[string]string        `json:"externalParameters"`
+	InternalParameters   map[string]string        `json:"internalParameters,omitempty"`
+	ResolvedDependencies []SLSAResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// SLSAResourceDescriptor is a material or byproduct of a build.
+type SLSAResourceDescriptor struct {
+	Name   string            `json:"name"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// SLSARunDetails describes the builder and run of a build.
+type SLSARunDetails struct {
+	Builder    SLSABuilder              `json:"builder"`
+	Metadata   SLSABuildMetadata        `json:"metadata"`
+	Byproducts []SLSAResourceDescriptor `json:"byproducts,omitempty"`
+}
+
+// SLSABuilder identifies the builder.
+type SLSABuilder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// SLSABuildMetadata identifies the run of a build.
+type SLSABuildMetadata struct {
+	InvocationID string `json:"invocationId,omitempty"`
+	FinishedOn   string `json:"finishedOn,omitempty"`
+}
+
+// DSSEEnvelope is a DSSE envelope of a statement, with or without
+// signatures.
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     []byte          `json:"payload"`
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+// DSSESignature is a signature of a DSSE envelope.
+type DSSESignature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   []byte `json:"sig"`
+}
+
+// dssePAE is the pre-authentication encoding of a DSSE payload, which is
+// what is signed.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// gitDependency describes a git repository as a build material.
+func gitDependency(name string, g *Git) SLSAResourceDescriptor {
+	ret := SLSAResourceDescriptor{Name: name, Digest: map[string]string{"gitCommit": g.Commit}}
+	if g.Origin != "" {
+		ret.URI = "git+" + g.Origin
+		if g.Branch != "" {
+			ret.URI += "@refs/heads/" + g.Branch
+		}
+	}
+	return ret
+}
+
+// NewProvenance returns the provenance statement of the build for arch.
+// Its subjects are the artifacts of the build and the container images it
+// was pushed as, and its materials are the git repositories and base
+// images it was built from.
+func NewProvenance(build *Build, arch string) *InTotoStatement {
+	st := &InTotoStatement{
+		Type:          InTotoStatementType,
+		PredicateType: SLSAProvenanceType,
+	}
+
+	if build.BuildArtifacts != nil {
+		var names []string
+		artifacts := build.artifacts()
+		for name, a := range artifacts {
+			if a.Path != "" && a.Sha256 != "" && name != ProvenanceArtifact {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			a := artifacts[name]
+			st.Subject = append(st.Subject, InTotoSubject{Name: a.Path, Digest: map[string]string{"sha256": a.Sha256}})
+		}
+	}
+	for _, c := range []*PrimaryImage{build.BaseOsContainer, build.Oscontainer, build.ExtensionsContainer, build.KubevirtContainer} {
+		if c == nil || !strings.HasPrefix(c.Digest, "sha256:") {
+			continue
+		}
+		st.Subject = append(st.Subject, InTotoSubject{
+			Name:   c.Image,
+			Digest: map[string]string{"sha256": strings.TrimPrefix(c.Digest, "sha256:")},
+		})
+	}
+
+	def := &st.Predicate.BuildDefinition
+	def.BuildType = ProvenanceBuildType
+	def.ExternalParameters = map[string]string{
+		"name":    build.Name,
+		"buildid": build.BuildID,
+		"arch":    arch,
+	}
+	if build.ConfigVariant != "" {
+		def.ExternalParameters["variant"] = build.ConfigVariant
+	}
+	def.InternalParameters = make(map[string]string)
+	for key, value := range map[string]string{
+		"image-input-checksum":  build.ImageInputChecksum,
+		"image-config-checksum": build.CosaImageChecksum,
+		"rpm-ostree-inputhash":  build.InputHashOfTheRpmOstree,
+		"config-dirty":          build.GitDirty,
+		"code-source":           build.CoreOsSource,
+	} {
+		if value != "" {
+			def.InternalParameters[key] = value
+		}
+	}
+	if build.OverridesActive {
+		def.InternalParameters["overrides-active"] = strconv.FormatBool(build.OverridesActive)
+	}
+
+	switch {
+	case build.ContainerConfigGit != nil:
+		def.ResolvedDependencies = append(def.ResolvedDependencies, gitDependency("config", build.ContainerConfigGit))
+	case build.ConfigGitRev != "":
+		def.ResolvedDependencies = append(def.ResolvedDependencies, SLSAResourceDescriptor{
+			Name:   "config",
+			Digest: map[string]string{"gitCommit": build.ConfigGitRev},
+		})
+	}
+	if build.YumReposGit != nil {
+		def.ResolvedDependencies = append(def.ResolvedDependencies, gitDependency("yumrepos", build.YumReposGit))
+	}
+	if build.CosaContainerImageGit != nil {
+		def.ResolvedDependencies = append(def.ResolvedDependencies, gitDependency("coreos-assembler", build.CosaContainerImageGit))
+	}
+	if digest := string(build.OciLabels[baseImageDigestLabel]); strings.HasPrefix(digest, "sha256:") {
+		def.ResolvedDependencies = append(def.ResolvedDependencies, SLSAResourceDescriptor{
+			Name:   "base-image",
+			URI:    string(build.OciLabels[baseImageNameLabel]),
+			Digest: map[string]string{"sha256": strings.TrimPrefix(digest, "sha256:")},
+		})
+	}
+	if build.FedoraCoreOsParentCommit != "" {
+		def.ResolvedDependencies = append(def.ResolvedDependencies, SLSAResourceDescriptor{
+			Name:   "parent",
+			Digest: map[string]string{ostreeCommitDigest: build.FedoraCoreOsParentCommit},
+		})
+	}
+
+	run := &st.Predicate.RunDetails
+	run.Builder.ID = ProvenanceBuilderID
+	if build.CosaContainerImageGit != nil {
+		run.Builder.Version = map[string]string{"coreos-assembler": build.CosaContainerImageGit.Commit}
+	}
+	run.Metadata.InvocationID = build.BuildURL
+	run.Metadata.FinishedOn = build.BuildTimeStamp
+	if build.OstreeCommit != "" {
+		run.Byproducts = append(run.Byproducts, SLSAResourceDescriptor{
+			Name:   "ostree-commit",
+			Digest: map[string]string{ostreeCommitDigest: build.OstreeCommit},
+		})
+	}
+	return st
+}
+
+// NewDSSEEnvelope wraps the statement in a DSSE envelope, signed with key
+// unless it is nil.
+func NewDSSEEnvelope(st *InTotoStatement, key crypto.Signer) (*DSSEEnvelope, error) {
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return nil, err
+	}
+	env := &DSSEEnvelope{PayloadType: InTotoPayloadType, Payload: payload, Signatures: []DSSESignature{}}
+	if key == nil {
+		return env, nil
+	}
+	keyID, err := sigstoreKeyHint(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(dssePAE(env.PayloadType, env.Payload))
+	sig, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	env.Signatures = append(env.Signatures, DSSESignature{KeyID: keyID, Sig: sig})
+	return env, nil
+}
+
+// Verify checks that a signature of the envelope was made by key, and
+// returns the ID of the key.
+func (env *DSSEEnvelope) Verify(key crypto.PublicKey) (string, error) {
+	keyID, err := sigstoreKeyHint(key)
+	if err != nil {
+		return "", err
+	}
+	if len(env.Signatures) == 0 {
+		return "", fmt.Errorf("envelope isn't signed")
+	}
+	digest := sha256.Sum256(dssePAE(env.PayloadType, env.Payload))
+	for _, s := range env.Signatures {
+		if s.KeyID != "" && s.KeyID != keyID {
+			continue
+		}
+		if err = verifyDigest(key, digest[:], s.Sig); err == nil {
+			return keyID, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("envelope isn't signed by key %s", keyID)
+	}
+	return "", err
+}
+
+// Statement decodes the in-toto statement of the envelope.
+func (env *DSSEEnvelope) Statement() (*InTotoStatement, error) {
+	if env.PayloadType != InTotoPayloadType {
+		return nil, fmt.Errorf("unsupported payload type %q", env.PayloadType)
+	}
+	var st InTotoStatement
+	if err := json.Unmarshal(env.Payload, &st); err != nil {
+		return nil, fmt.Errorf("parsing statement: %w", err)
+	}
+	if st.Type != InTotoStatementType || st.PredicateType != SLSAProvenanceType {
+		return nil, fmt.Errorf("unsupported statement %s with predicate %s", st.Type, st.PredicateType)
+	}
+	return &st, nil
+}
+
+// WriteProvenance writes the provenance of the build in dir, signed with
+// key unless it is nil, and records it as an artifact in meta.json. It
+// returns the path of the provenance, relative to dir.
+func WriteProvenance(dir string, key crypto.Signer) (string, error) {
+	metaPath := filepath.Join(dir, CosaMetaJSON)
+	build, err := readMetaLenient(metaPath)
+	if err != nil {
+		return "", err
+	}
+	arch := buildArch(build, dir)
+	env, err := NewDSSEEnvelope(NewProvenance(build, arch), key)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s-provenance.%s.intoto.json", build.Name, build.BuildID, arch)
+	if err := writeFileAtomic(filepath.Join(dir, name), data); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+
+	err = UpdateMeta(metaPath, func(b *Build) error {
+		if b.BuildArtifacts == nil {
+			b.BuildArtifacts = new(BuildArtifacts)
+		}
+		b.BuildArtifacts.Provenance = &Artifact{
+			Path:            name,
+			Sha256:          hex.EncodeToString(sum[:]),
+			SizeInBytes:     float64(len(data)),
+			SkipCompression: true,
+		}
+		return nil
+	})
+	if err != nil {
+		os.Remove(filepath.Join(dir, name))
+		return "", err
+	}
+	return name, nil
+}
+
+// ProvenanceVerification is the result of verifying a build directory
+// against its provenance.
+type ProvenanceVerification struct {
+	Path string `json:"path"`
+	// KeyID is the key which signed the provenance, if a key was given.
+	KeyID string `json:"key-id,omitempty"`
+	// Subjects are the results of checking the attested artifacts and
+	// container images against the build directory and meta.json.
+	Subjects []ArtifactVerification `json:"subjects"`
+	// Mismatches are the parameters and materials of meta.json which
+	// differ from the attested ones.
+	Mismatches []string `json:"mismatches,omitempty"`
+	// Unattested are the artifacts of meta.json which the provenance
+	// doesn't cover, e.g. because they were made after it.
+	Unattested []string `json:"unattested,omitempty"`
+}
+
+// Failed reports whether a subject is missing or corrupt, or the
+// parameters or materials differ.
+func (r *ProvenanceVerification) Failed() bool {
+	for _, s := range r.Subjects {
+		if s.Status != ArtifactOK {
+			return true
+		}
+	}
+	return len(r.Mismatches) > 0
+}
+
+// VerifyProvenance checks the build in dir against its recorded
+// provenance. If key isn't nil, the provenance must be signed by it.
+func VerifyProvenance(dir string, key crypto.PublicKey) (*ProvenanceVerification, error) {
+	build, err := readMetaLenient(filepath.Join(dir, CosaMetaJSON))
+	if err != nil {
+		return nil, err
+	}
+	if build.BuildArtifacts == nil || build.BuildArtifacts.Provenance == nil {
+		return nil, fmt.Errorf("build in %s has no provenance", dir)
+	}
+	prov := build.BuildArtifacts.Provenance
+	ret := &ProvenanceVerification{Path: prov.Path}
+	if status, msg := checkFile(filepath.Join(dir, prov.Path), int64(prov.SizeInBytes), prov.Sha256); status != ArtifactOK {
+		return nil, fmt.Errorf("provenance %s is %s %s", prov.Path, status, msg)
+	}
+
+	var env DSSEEnvelope
+	if err := readJSONFile(filepath.Join(dir, prov.Path), &env); err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if ret.KeyID, err = env.Verify(key); err != nil {
+			return nil, fmt.Errorf("verifying %s: %w", prov.Path, err)
+		}
+	}
+	attested, err := env.Statement()
+	if err != nil {
+		return nil, err
+	}
+
+	expected := NewProvenance(build, buildArch(build, dir))
+	artifacts := build.artifacts()
+	files := make(map[string]bool)
+	for _, a := range artifacts {
+		if a.Path != "" {
+			files[a.Path] = true
+		}
+	}
+	want := make(map[string]string)
+	for _, s := range expected.Subject {
+		want[s.Name] = s.Digest["sha256"]
+	}
+	seen := make(map[string]bool)
+	for _, s := range attested.Subject {
+		seen[s.Name] = true
+		v := ArtifactVerification{Name: s.Name, Path: s.Name}
+		digest := s.Digest["sha256"]
+		switch {
+		case digest == "":
+			v.Status, v.Error = ArtifactCorrupt, "no sha256 digest"
+		case files[s.Name]:
+			v.Status, v.Error = checkFile(filepath.Join(dir, s.Name), 0, digest)
+		case want[s.Name] == "":
+			// The artifact may have been compressed since, in which case
+			// its uncompressed digest is the attested one.
+			a := compressedArtifact(artifacts, s.Name, digest)
+			if a == nil {
+				v.Status = ArtifactMissing
+				break
+			}
+			// meta.json isn't signed, so check the attested digest
+			// against the decompressed file.
+			seen[a.Path] = true
+			v.Path = a.Path
+			v.Status, v.Error = checkUncompressed(filepath.Join(dir, a.Path), digest)
+		case want[s.Name] != digest:
+			v.Status, v.Error = ArtifactCorrupt, fmt.Sprintf("meta.json records sha256 %s", want[s.Name])
+		default:
+			v.Status = ArtifactOK
+		}
+		ret.Subjects = append(ret.Subjects, v)
+	}
+	for _, s := range expected.Subject {
+		if !seen[s.Name] {
+			ret.Unattested = append(ret.Unattested, s.Name)
+		}
+	}
+
+	ret.Mismatches = diffBuildDefinitions(&attested.Predicate.BuildDefinition, &expected.Predicate.BuildDefinition)
+	return ret, nil
+}
+
+// compressedArtifact returns the artifact which meta.json records as the
+// compressed form of the file name with the given digest, or nil.
+func compressedArtifact(artifacts map[string]*Artifact, name, digest string) *Artifact {
+	for _, a := range artifacts {
+		if a.Path == "" || a.UncompressedSha256 != digest {
+			continue
+		}
+		for _, suffix := range compressionSuffixes {
+			if a.Path == name+suffix {
+				return a
+			}
+		}
+	}
+	return nil
+}
+
+// diffBuildDefinitions describes how the current build definition
+// differs from the attested one.
+func diffBuildDefinitions(attested, current *SLSABuildDefinition) []string {
+	var ret []string
+	if attested.BuildType != current.BuildType {
+		ret = append(ret, fmt.Sprintf("build type: %s, attested %s", current.BuildType, attested.BuildType))
+	}
+	diffParams := func(kind string, attested, current map[string]string) {
+		keys := make(map[string]bool)
+		for k := range attested {
+			keys[k] = true
+		}
+		for k := range current {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			if attested[k] != current[k] {
+				ret = append(ret, fmt.Sprintf("%s parameter %s: %q, attested %q", kind, k, current[k], attested[k]))
+			}
+		}
+	}
+	diffParams("external", attested.ExternalParameters, current.ExternalParameters)
+	diffParams("internal", attested.InternalParameters, current.InternalParameters)
+
+	deps := make(map[string]SLSAResourceDescriptor)
+	for _, d := range attested.ResolvedDependencies {
+		deps[d.Name] = d
+	}
+	for _, d := range current.ResolvedDependencies {
+		a, ok := deps[d.Name]
+		delete(deps, d.Name)
+		if !ok {
+			ret = append(ret, fmt.Sprintf("material %s isn't attested", d.Name))
+		} else if !reflect.DeepEqual(a, d) {
+			ret = append(ret, fmt.Sprintf("material %s: %v, attested %v", d.Name, d.Digest, a.Digest))
+		}
+	}
+	var extra []string
+	for name := range deps {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		ret = append(ret, fmt.Sprintf("attested material %s isn't in meta.json", name))
+	}
+	return ret
+}
@@ -0,0 +1,231 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDSSEPAE(t *testing.T) {
+	// From the DSSE specification.
+	got := string(dssePAE("http://example.com/HelloWorld", []byte("hello world")))
+	if want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "41.1", "x86_64")
+	digests := make(map[string]string)
+	writeDiffBuild(t, dir, map[string]interface{}{
+		"buildid":                   "41.1",
+		"name":                      "fedora-coreos",
+		"ostree-commit":             strings.Repeat("a", 64),
+		"ostree-timestamp":          "2026-01-01T00:00:00Z",
+		"ostree-version":            "41.1",
+		"coreos-assembler.basearch": "x86_64",
+		"images":                    map[string]interface{}{},
+		"base-oscontainer": map[string]interface{}{
+			"image":  "quay.io/fedora/fedora-coreos:41.1",
+			"digest": "sha256:" + strings.Repeat("b", 64),
+		},
+		"coreos-assembler.container-config-git": map[string]interface{}{
+			"origin": "https://github.com/coreos/fedora-coreos-config",
+			"commit": "cccccccc",
+			"branch": "testing-devel",
+		},
+		"coreos-assembler.yumrepos-git": map[string]interface{}{
+			"origin": "https://example.com/yumrepos",
+			"commit": "dddddddd",
+		},
+		"coreos-assembler.image-input-checksum": strings.Repeat("e", 64),
+		"fedora-coreos.parent-commit":           strings.Repeat("f", 64),
+	}, map[string]interface{}{})
+	images := make(map[string]interface{})
+	for name, file := range map[string]string{"ostree": "fcos.ociarchive", "qemu": "fcos.qcow2"} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(name))
+		digests[file] = hex.EncodeToString(sum[:])
+		images[name] = map[string]interface{}{"path": file, "sha256": digests[file]}
+	}
+	update := func(f func(map[string]interface{})) {
+		var meta map[string]interface{}
+		if err := readJSONFile(filepath.Join(dir, CosaMetaJSON), &meta); err != nil {
+			t.Fatal(err)
+		}
+		f(meta)
+		if err := writeMetaJSON(filepath.Join(dir, CosaMetaJSON), meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update(func(meta map[string]interface{}) { meta["images"] = images })
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := WriteProvenance(dir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "fedora-coreos-41.1-provenance.x86_64.intoto.json" {
+		t.Errorf("unexpected path %s", path)
+	}
+
+	var env DSSEEnvelope
+	if err := readJSONFile(filepath.Join(dir, path), &env); err != nil {
+		t.Fatal(err)
+	}
+	st, err := env.Statement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var subjects []string
+	for _, s := range st.Subject {
+		subjects = append(subjects, s.Name)
+	}
+	if want := []string{"fcos.ociarchive", "fcos.qcow2", "quay.io/fedora/fedora-coreos:41.1"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("expected subjects %v, got %v", want, subjects)
+	}
+	deps := st.Predicate.BuildDefinition.ResolvedDependencies
+	if len(deps) != 3 || deps[0].URI != "git+https://github.com/coreos/fedora-coreos-config@refs/heads/testing-devel" ||
+		deps[0].Digest["gitCommit"] != "cccccccc" || deps[1].Name != "yumrepos" ||
+		!reflect.DeepEqual(deps[2].Digest, map[string]string{"ostreeCommit": strings.Repeat("f", 64)}) {
+		t.Errorf("unexpected materials: %+v", deps)
+	}
+	if b := st.Predicate.RunDetails.Byproducts; len(b) != 1 || !reflect.DeepEqual(b[0].Digest, map[string]string{"ostreeCommit": strings.Repeat("a", 64)}) {
+		t.Errorf("unexpected byproducts: %+v", b)
+	}
+
+	res, err := VerifyProvenance(dir, key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Failed() || res.KeyID == "" || len(res.Subjects) != 3 {
+		t.Errorf("unexpected verification: %+v", res)
+	}
+	if _, err := VerifyProvenance(dir, nil); err != nil {
+		t.Error(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyProvenance(dir, other.Public()); err == nil {
+		t.Error("verified the provenance with the wrong key")
+	}
+
+	// Compressing an artifact after the provenance was written keeps it
+	// attested through its uncompressed digest.
+	compressed := gzipBytes(t, "qemu")
+	if err := os.WriteFile(filepath.Join(dir, "fcos.qcow2.gz"), compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "fcos.qcow2")); err != nil {
+		t.Fatal(err)
+	}
+	compress := func(content []byte) {
+		sum := sha256.Sum256(content)
+		update(func(meta map[string]interface{}) {
+			meta["images"].(map[string]interface{})["qemu"] = map[string]interface{}{
+				"path":                "fcos.qcow2.gz",
+				"sha256":              hex.EncodeToString(sum[:]),
+				"size":                len(content),
+				"uncompressed-sha256": digests["fcos.qcow2"],
+			}
+		})
+	}
+	compress(compressed)
+	res, err = VerifyProvenance(dir, key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Failed() || len(res.Unattested) != 0 {
+		t.Errorf("unexpected verification after compression: %+v", res)
+	}
+	for _, s := range res.Subjects {
+		if s.Name == "fcos.qcow2" && s.Path != "fcos.qcow2.gz" {
+			t.Errorf("expected fcos.qcow2 to be verified as fcos.qcow2.gz, got %s", s.Path)
+		}
+	}
+
+	// meta.json isn't signed, so a swapped file whose digests were
+	// recorded in it must still fail.
+	swapped := gzipBytes(t, "evil")
+	if err := os.WriteFile(filepath.Join(dir, "fcos.qcow2.gz"), swapped, 0644); err != nil {
+		t.Fatal(err)
+	}
+	compress(swapped)
+	if res, err = VerifyProvenance(dir, key.Public()); err != nil {
+		t.Fatal(err)
+	}
+	if !res.Failed() {
+		t.Errorf("verified a swapped compressed artifact: %+v", res)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fcos.qcow2.gz"), compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	compress(compressed)
+
+	// Tamper with an artifact and a material, and add an artifact.
+	if err := os.WriteFile(filepath.Join(dir, "fcos.qcow2.gz"), gzipBytes(t, "QEMU"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	update(func(meta map[string]interface{}) {
+		meta["coreos-assembler.container-config-git"].(map[string]interface{})["commit"] = "ffffffff"
+		meta["images"].(map[string]interface{})["metal"] = map[string]interface{}{"path": "fcos.raw", "sha256": "0000"}
+	})
+	res, err = VerifyProvenance(dir, key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Failed() {
+		t.Error("verification didn't fail")
+	}
+	for _, s := range res.Subjects {
+		want := ArtifactOK
+		if s.Name == "fcos.qcow2" {
+			want = ArtifactCorrupt
+		}
+		if s.Status != want {
+			t.Errorf("%s: expected %s, got %s", s.Name, want, s.Status)
+		}
+	}
+	if len(res.Mismatches) != 1 || !strings.Contains(res.Mismatches[0], "material config") {
+		t.Errorf("unexpected mismatches: %v", res.Mismatches)
+	}
+	if !reflect.DeepEqual(res.Unattested, []string{"fcos.raw"}) {
+		t.Errorf("unexpected unattested artifacts: %v", res.Unattested)
+	}
+
+	// An unsigned provenance only verifies without a key.
+	if _, err := WriteProvenance(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyProvenance(dir, key.Public()); err == nil {
+		t.Error("verified an unsigned provenance with a key")
+	}
+}
@@ -0,0 +1,305 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pruneLockTimeout is how long ExecutePrune waits for the meta.json
+// lock of a build. It's a variable for tests.
+var pruneLockTimeout = MetaLockTimeout
+
+// PrunePolicy decides which builds to keep. A build is kept if any of
+// the rules set keeps it; tagged builds and the latest build are always
+// kept, unless listed in Builds.
+type PrunePolicy struct {
+	// KeepLastN keeps the newest N untagged builds.
+	KeepLastN int
+	// MaxAge keeps the builds younger than it.
+	MaxAge time.Duration
+	// Stream restricts pruning to the builds of the stream.
+	Stream string
+	// KeepParents keeps the builds which are the parent of a kept build.
+	KeepParents bool
+	// Builds are pruned explicitly, ignoring the rules above.
+	Builds []string
+	// Now is the time ages are computed at, by default the current
+	// time.
+	Now time.Time
+}
+
+// PruneDecision is what happens to a build and why.
+type PruneDecision struct {
+	ID     string   `json:"id"`
+	Arches []string `json:"arches"`
+	Prune  bool     `json:"prune"`
+	Reason string   `json:"reason"`
+}
+
+// PrunePlan is the outcome of applying a PrunePolicy to a History.
+type PrunePlan struct {
+	// Decisions are in the order of builds.json, newest first.
+	Decisions []PruneDecision `json:"decisions"`
+}
+
+// Pruned returns the IDs of the builds to prune.
+func (p *PrunePlan) Pruned() []string {
+	var ret []string
+	for _, d := range p.Decisions {
+		if d.Prune {
+			ret = append(ret, d.ID)
+		}
+	}
+	return ret
+}
+
+// Write prints the plan, one build per line, for dry runs.
+func (p *PrunePlan) Write(w io.Writer) error {
+	for _, d := range p.Decisions {
+		action := "keep"
+		if d.Prune {
+			action = "prune"
+		}
+		if _, err := fmt.Fprintf(w, "%-5s %s (%s): %s\n", action, d.ID, strings.Join(d.Arches, ", "), d.Reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PlanPrune decides which builds to prune according to policy.
+func (h *History) PlanPrune(policy PrunePolicy) (*PrunePlan, error) {
+	if policy.Now.IsZero() {
+		policy.Now = time.Now()
+	}
+	explicit := make(map[string]bool)
+	for _, id := range policy.Builds {
+		e, ok := h.Get(id)
+		if !ok {
+			return nil, fmt.Errorf("build %s not found", id)
+		}
+		if len(e.Tags) > 0 {
+			return nil, fmt.Errorf("build %s is tagged (%s)", id, strings.Join(e.Tags, ", "))
+		}
+		explicit[id] = true
+	}
+	ruled := policy.KeepLastN > 0 || policy.MaxAge > 0
+
+	plan := &PrunePlan{}
+	kept := make(map[string]bool)
+	untagged := 0
+	for i, e := range h.Entries {
+		d := PruneDecision{ID: e.ID, Arches: e.Arches}
+		age, hasAge := e.Age(policy.Now)
+		switch {
+		case explicit[e.ID]:
+			d.Prune, d.Reason = true, "pruned explicitly"
+		case len(policy.Builds) > 0:
+			d.Reason = "not listed"
+		case len(e.Tags) > 0:
+			d.Reason = fmt.Sprintf("tagged (%s)", strings.Join(e.Tags, ", "))
+		case i == 0:
+			d.Reason = "latest build"
+		case policy.Stream != "" && e.Stream() != policy.Stream:
+			d.Reason = "other stream"
+		case !ruled:
+			d.Reason = "no retention rule"
+		case policy.KeepLastN > 0 && untagged < policy.KeepLastN:
+			d.Reason = fmt.Sprintf("among the last %d builds", policy.KeepLastN)
+		case policy.MaxAge > 0 && !hasAge:
+			d.Reason = "unknown age"
+		case policy.MaxAge > 0 && age <= policy.MaxAge:
+			d.Reason = fmt.Sprintf("younger than %s", policy.MaxAge)
+		default:
+			d.Prune = true
+			if policy.MaxAge > 0 && hasAge {
+				d.Reason = fmt.Sprintf("%s old", age.Round(time.Hour))
+			} else {
+				d.Reason = fmt.Sprintf("beyond the last %d builds", policy.KeepLastN)
+			}
+		}
+		if len(e.Tags) == 0 && (policy.Stream == "" || e.Stream() == policy.Stream) {
+			untagged++
+		}
+		if !d.Prune {
+			kept[e.ID] = true
+		}
+		plan.Decisions = append(plan.Decisions, d)
+	}
+
+	if policy.KeepParents && len(policy.Builds) == 0 {
+		// Keeping a parent may make it keep its own parent, so iterate
+		// until nothing changes.
+		parents := h.Parents()
+		for changed := true; changed; {
+			changed = false
+			for i := range plan.Decisions {
+				d := &plan.Decisions[i]
+				if !d.Prune {
+					continue
+				}
+				for _, child := range parents[d.ID] {
+					if kept[child] {
+						d.Prune, d.Reason = false, fmt.Sprintf("parent of %s", child)
+						kept[d.ID] = true
+						changed = true
+						break
+					}
+				}
+			}
+		}
+	}
+	return plan, nil
+}
+
+// ExecutePrune deletes the builds of plan: it removes them from
+// builds.json, updates the latest symlink and deletes their
+// directories. The meta.json lock of each build is taken first, so that
+// its writers finish; builds whose lock can't be taken are kept. It
+// carries on past such failures and failures to delete directories,
+// returning the first one. OSTree refs in the repo of the working
+// directory are not touched.
+func (h *History) ExecutePrune(plan *PrunePlan) error {
+	var firstErr error
+	prune := make(map[string]bool)
+	var locks []*MetaLock
+	defer func() {
+		for _, l := range locks {
+			l.Unlock()
+		}
+	}()
+	for _, d := range plan.Decisions {
+		if !d.Prune {
+			continue
+		}
+		buildLocks, err := h.lockBuild(d.ID, d.Arches)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "pruning build %s", d.ID)
+			}
+			continue
+		}
+		locks = append(locks, buildLocks...)
+		prune[d.ID] = true
+	}
+	if len(prune) == 0 {
+		return firstErr
+	}
+	if err := h.rewriteBuildsJSON(prune); err != nil {
+		return err
+	}
+
+	var entries []*HistoryEntry
+	for _, e := range h.Entries {
+		if !prune[e.ID] {
+			entries = append(entries, e)
+		}
+	}
+	h.Entries = entries
+
+	latest := filepath.Join(h.dir, "latest")
+	if len(h.Entries) > 0 {
+		tmp := latest + ".tmp"
+		os.Remove(tmp)
+		if err := os.Symlink(h.Entries[0].ID, tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, latest); err != nil {
+			return err
+		}
+	} else if err := os.Remove(latest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, d := range plan.Decisions {
+		if !prune[d.ID] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(h.dir, d.ID)); err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "pruning build %s", d.ID)
+		}
+	}
+	return firstErr
+}
+
+// lockBuild takes the meta.json locks of the arches of a build present
+// locally.
+func (h *History) lockBuild(id string, arches []string) ([]*MetaLock, error) {
+	var locks []*MetaLock
+	for _, arch := range arches {
+		dir := filepath.Join(h.dir, id, arch)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		l, err := LockMeta(filepath.Join(dir, CosaMetaJSON), pruneLockTimeout)
+		if err != nil {
+			for _, l := range locks {
+				l.Unlock()
+			}
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, nil
+}
+
+// rewriteBuildsJSON drops the given builds from builds.json, keeping
+// the fields this package doesn't know about, and bumps its timestamp.
+func (h *History) rewriteBuildsJSON(prune map[string]bool) error {
+	path := filepath.Join(h.dir, CosaBuildsJSON)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return errors.Wrapf(err, "parsing %s", path)
+	}
+	var builds []json.RawMessage
+	if err := json.Unmarshal(doc["builds"], &builds); err != nil {
+		return errors.Wrapf(err, "parsing builds of %s", path)
+	}
+	kept := []json.RawMessage{}
+	for _, raw := range builds {
+		var b build
+		if err := json.Unmarshal(raw, &b); err != nil {
+			return errors.Wrapf(err, "parsing builds of %s", path)
+		}
+		if !prune[b.ID] {
+			kept = append(kept, raw)
+		}
+	}
+	if doc["builds"], err = json.Marshal(kept); err != nil {
+		return err
+	}
+	if doc["timestamp"], err = json.Marshal(time.Now().UTC().Format("2006-01-02T15:04:05Z")); err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, out)
+}
@@ -0,0 +1,557 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// SBOMSPDXArtifact is the name of the SPDX SBOM artifact.
+	SBOMSPDXArtifact = "sbom-spdx"
+	// SBOMCycloneDXArtifact is the name of the CycloneDX SBOM artifact.
+	SBOMCycloneDXArtifact = "sbom-cyclonedx"
+
+	// sbomNamespace prefixes the SPDX document namespaces and seeds the
+	// CycloneDX serial numbers.
+	sbomNamespace = "https://github.com/coreos/coreos-assembler/sbom"
+)
+
+// SBOMFormat is a format of software bill of materials.
+type SBOMFormat string
+
+const (
+	// SBOMSPDX is SPDX 2.3 JSON.
+	SBOMSPDX SBOMFormat = "spdx"
+	// SBOMCycloneDX is CycloneDX 1.5 JSON.
+	SBOMCycloneDX SBOMFormat = "cyclonedx"
+)
+
+// SBOMFormats are the supported SBOM formats.
+var SBOMFormats = []SBOMFormat{SBOMSPDX, SBOMCycloneDX}
+
+// suffix returns the file extension of the format.
+func (f SBOMFormat) suffix() string {
+	if f == SBOMCycloneDX {
+		return ".cdx.json"
+	}
+	return ".spdx.json"
+}
+
+// SBOMContainer is a container image of a build.
+type SBOMContainer struct {
+	// Name is the meta.json key of the container, e.g. base-oscontainer.
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// SBOMSource is a git repository which a build was made from.
+type SBOMSource struct {
+	// Name is "config" for the config repository and "cosa" for
+	// coreos-assembler itself.
+	Name   string `json:"name"`
+	Origin string `json:"origin"`
+	Commit string `json:"commit"`
+	Branch string `json:"branch,omitempty"`
+	Dirty  bool   `json:"dirty,omitempty"`
+}
+
+// BuildSBOM is the inventory of a build which its SBOMs describe.
+type BuildSBOM struct {
+	Name         string          `json:"name"`
+	BuildID      string          `json:"buildid"`
+	Arch         string          `json:"arch"`
+	OstreeCommit string          `json:"ostree-commit"`
+	Timestamp    string          `json:"timestamp"`
+	Packages     []Package       `json:"packages"`
+	Containers   []SBOMContainer `json:"containers,omitempty"`
+	Sources      []SBOMSource    `json:"sources,omitempty"`
+}
+
+// ReadBuildSBOM collects the inventory of the build in dir from its
+// meta.json and the package list of its commitmeta.json.
+func ReadBuildSBOM(dir string) (*BuildSBOM, error) {
+	build, err := readMetaLenient(filepath.Join(dir, CosaMetaJSON))
+	if err != nil {
+		return nil, err
+	}
+	var commitMeta map[string]json.RawMessage
+	if err := readJSONFile(filepath.Join(dir, CosaCommitMetaJSON), &commitMeta); err != nil {
+		return nil, fmt.Errorf("reading package list: %w", err)
+	}
+	data, ok := commitMeta[pkglistKey]
+	if !ok {
+		return nil, fmt.Errorf("%s has no %s", CosaCommitMetaJSON, pkglistKey)
+	}
+	pkgs, err := parsePackageList(data)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		if pkgs[i].Name != pkgs[j].Name {
+			return pkgs[i].Name < pkgs[j].Name
+		}
+		return pkgs[i].Arch < pkgs[j].Arch
+	})
+
+	s := &BuildSBOM{
+		Name:         build.Name,
+		BuildID:      build.BuildID,
+		Arch:         buildArch(build, dir),
+		OstreeCommit: build.OstreeCommit,
+		Timestamp:    build.BuildTimeStamp,
+		Packages:     pkgs,
+	}
+	if s.Timestamp == "" {
+		s.Timestamp = build.OstreeTimestamp
+	}
+	for _, c := range []struct {
+		name  string
+		image *PrimaryImage
+	}{
+		{"base-oscontainer", build.BaseOsContainer},
+		{"oscontainer", build.Oscontainer},
+		{"extensions-container", build.ExtensionsContainer},
+		{"kubevirt", build.KubevirtContainer},
+	} {
+		if c.image != nil && c.image.Image != "" {
+			s.Containers = append(s.Containers, SBOMContainer{Name: c.name, Image: c.image.Image, Digest: c.image.Digest})
+		}
+	}
+	for _, g := range []struct {
+		name string
+		git  *Git
+	}{
+		{"config", build.ContainerConfigGit},
+		{"cosa", build.CosaContainerImageGit},
+	} {
+		if g.git != nil && g.git.Commit != "" {
+			s.Sources = append(s.Sources, SBOMSource{
+				Name:   g.name,
+				Origin: g.git.Origin,
+				Commit: g.git.Commit,
+				Branch: g.git.Branch,
+				Dirty:  g.git.Dirty == "true",
+			})
+		}
+	}
+	return s, nil
+}
+
+// buildArch returns the architecture of the build in dir.
+func buildArch(build *Build, dir string) string {
+	if build.Architecture != "" {
+		return build.Architecture
+	}
+	return filepath.Base(dir)
+}
+
+// Marshal renders the SBOM in format.
+func (s *BuildSBOM) Marshal(format SBOMFormat) ([]byte, error) {
+	var doc interface{}
+	switch format {
+	case SBOMSPDX:
+		doc = s.spdx()
+	case SBOMCycloneDX:
+		doc = s.cycloneDX()
+	default:
+		return nil, fmt.Errorf("unknown SBOM format %q", format)
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// id identifies the build the SBOM describes.
+func (s *BuildSBOM) id() string {
+	return fmt.Sprintf("%s/%s/%s/%s", s.Name, s.BuildID, s.Arch, s.OstreeCommit)
+}
+
+// purlNamespace is the vendor of the packages of the build.
+func (s *BuildSBOM) purlNamespace() string {
+	switch {
+	case strings.HasPrefix(s.Name, "fedora"):
+		return "fedora"
+	case s.Name == "rhcos":
+		return "redhat"
+	case s.Name == "scos":
+		return "centos"
+	}
+	return s.Name
+}
+
+// packageURL returns the purl of an RPM package.
+func (s *BuildSBOM) packageURL(p *Package) string {
+	q := url.Values{}
+	q.Set("arch", p.Arch)
+	if p.Epoch != "" && p.Epoch != "0" {
+		q.Set("epoch", p.Epoch)
+	}
+	q.Set("distro", fmt.Sprintf("%s-%s", s.Name, s.BuildID))
+	return fmt.Sprintf("pkg:rpm/%s/%s@%s?%s", s.purlNamespace(), purlEscape(p.Name),
+		purlEscape(p.Version+"-"+p.Release), q.Encode())
+}
+
+// containerURL returns the purl of a container image.
+func containerURL(c *SBOMContainer) string {
+	repo := c.Image
+	if i := strings.Index(repo, "@"); i >= 0 {
+		repo = repo[:i]
+	}
+	if i := strings.LastIndex(repo, "/"); strings.Contains(repo[i+1:], ":") {
+		repo = repo[:i+1+strings.Index(repo[i+1:], ":")]
+	}
+	name := repo[strings.LastIndex(repo, "/")+1:]
+	ret := "pkg:oci/" + purlEscape(strings.ToLower(name))
+	if c.Digest != "" {
+		ret += "@" + purlEscape(c.Digest)
+	}
+	return ret + "?" + url.Values{"repository_url": {repo}}.Encode()
+}
+
+func purlEscape(s string) string {
+	return strings.NewReplacer("+", "%2B", ":", "%3A").Replace(url.PathEscape(s))
+}
+
+var reSPDXID = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+func spdxID(kind, name string) string {
+	return "SPDXRef-" + kind + "-" + reSPDXID.ReplaceAllString(name, "-")
+}
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	PrimaryPurpose   string            `json:"primaryPackagePurpose,omitempty"`
+	Comment          string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	Element        string `json:"spdxElementId"`
+	Type           string `json:"relationshipType"`
+	RelatedElement string `json:"relatedSpdxElement"`
+}
+
+func (s *BuildSBOM) spdx() *spdxDocument {
+	const buildID = "SPDXRef-Build"
+	doc := &spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s-%s-%s", s.Name, s.BuildID, s.Arch),
+		DocumentNamespace: sbomNamespace + "/spdx/" + s.id(),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Timestamp,
+			Creators: []string{"Tool: coreos-assembler"},
+		},
+	}
+	build := spdxPackage{
+		Name:             s.Name,
+		SPDXID:           buildID,
+		VersionInfo:      s.BuildID,
+		DownloadLocation: "NOASSERTION",
+		PrimaryPurpose:   "OPERATING-SYSTEM",
+		Comment:          fmt.Sprintf("OSTree commit %s for %s", s.OstreeCommit, s.Arch),
+	}
+	if s.OstreeCommit != "" {
+		// The commit checksum isn't a digest of the build as a file,
+		// so it's a reference rather than a checksum.
+		build.ExternalRefs = []spdxExternalRef{{
+			ReferenceCategory: "OTHER",
+			ReferenceType:     "coreos-assembler:ostree-commit",
+			ReferenceLocator:  s.OstreeCommit,
+		}}
+	}
+	doc.Packages = append(doc.Packages, build)
+	doc.Relationships = append(doc.Relationships, spdxRelationship{doc.SPDXID, "DESCRIBES", buildID})
+
+	for i := range s.Packages {
+		p := &s.Packages[i]
+		id := spdxID("Package", p.Name+"-"+p.EVR()+"."+p.Arch)
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             p.Name,
+			SPDXID:           id,
+			VersionInfo:      p.EVR(),
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "LIBRARY",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  s.packageURL(p),
+			}},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{buildID, "CONTAINS", id})
+	}
+
+	for i := range s.Containers {
+		c := &s.Containers[i]
+		id := spdxID("Container", c.Name)
+		pkg := spdxPackage{
+			Name:             c.Image,
+			SPDXID:           id,
+			VersionInfo:      c.Digest,
+			DownloadLocation: "NOASSERTION",
+			PrimaryPurpose:   "CONTAINER",
+			ExternalRefs: []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER",
+				ReferenceType:     "purl",
+				ReferenceLocator:  containerURL(c),
+			}},
+			Comment: c.Name,
+		}
+		if digest := strings.TrimPrefix(c.Digest, "sha256:"); digest != c.Digest {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: digest}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{id, "GENERATED_FROM", buildID})
+	}
+
+	for _, src := range s.Sources {
+		id := spdxID("Source", src.Name)
+		location := "NOASSERTION"
+		if src.Origin != "" {
+			location = "git+" + src.Origin + "@" + src.Commit
+		}
+		comment := ""
+		if src.Dirty {
+			comment = "built from a dirty working tree"
+		}
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             src.Name,
+			SPDXID:           id,
+			VersionInfo:      src.Commit,
+			DownloadLocation: location,
+			PrimaryPurpose:   "SOURCE",
+			Comment:          comment,
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{buildID, "GENERATED_FROM", id})
+	}
+	return doc
+}
+
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp,omitempty"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	Hashes             []cdxHash        `json:"hashes,omitempty"`
+	Properties         []cdxProperty    `json:"properties,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+}
+
+type cdxHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxExternalRef struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn,omitempty"`
+}
+
+func (s *BuildSBOM) cycloneDX() *cdxDocument {
+	// The serial number is derived from the build so that regenerating
+	// the SBOM of a build gives the same document.
+	sum := sha1.Sum([]byte(sbomNamespace + "/cyclonedx/" + s.id()))
+	sum[6] = (sum[6] & 0x0f) | 0x50
+	sum[8] = (sum[8] & 0x3f) | 0x80
+	u := hex.EncodeToString(sum[:16])
+	serial := fmt.Sprintf("urn:uuid:%s-%s-%s-%s-%s", u[0:8], u[8:12], u[12:16], u[16:20], u[20:32])
+
+	build := cdxComponent{
+		Type:    "operating-system",
+		BOMRef:  "build",
+		Name:    s.Name,
+		Version: s.BuildID,
+		Properties: []cdxProperty{
+			{Name: "coreos-assembler:arch", Value: s.Arch},
+			{Name: "coreos-assembler:ostree-commit", Value: s.OstreeCommit},
+		},
+	}
+	for _, src := range s.Sources {
+		comment := fmt.Sprintf("%s commit %s", src.Name, src.Commit)
+		if src.Dirty {
+			comment += " (dirty)"
+		}
+		build.ExternalReferences = append(build.ExternalReferences, cdxExternalRef{Type: "vcs", URL: src.Origin, Comment: comment})
+	}
+
+	doc := &cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: serial,
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: s.Timestamp,
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: "coreos-assembler"}}},
+			Component: build,
+		},
+		Components: []cdxComponent{},
+	}
+	deps := cdxDependency{Ref: build.BOMRef}
+	for i := range s.Packages {
+		p := &s.Packages[i]
+		purl := s.packageURL(p)
+		doc.Components = append(doc.Components, cdxComponent{
+			Type:       "library",
+			BOMRef:     purl,
+			Name:       p.Name,
+			Version:    p.EVR(),
+			PURL:       purl,
+			Properties: []cdxProperty{{Name: "coreos-assembler:arch", Value: p.Arch}},
+		})
+		deps.DependsOn = append(deps.DependsOn, purl)
+	}
+	for i := range s.Containers {
+		c := &s.Containers[i]
+		comp := cdxComponent{
+			Type:       "container",
+			BOMRef:     containerURL(c),
+			Name:       c.Image,
+			Version:    c.Digest,
+			PURL:       containerURL(c),
+			Properties: []cdxProperty{{Name: "coreos-assembler:meta-key", Value: c.Name}},
+		}
+		if digest := strings.TrimPrefix(c.Digest, "sha256:"); digest != c.Digest {
+			comp.Hashes = []cdxHash{{Algorithm: "SHA-256", Content: digest}}
+		}
+		doc.Components = append(doc.Components, comp)
+	}
+	doc.Dependencies = []cdxDependency{deps}
+	return doc
+}
+
+// WriteSBOMs writes the SBOMs of the build in dir in the given formats,
+// and records them as artifacts in meta.json. It returns the paths of the
+// SBOMs, relative to dir.
+func WriteSBOMs(dir string, formats ...SBOMFormat) ([]string, error) {
+	s, err := ReadBuildSBOM(dir)
+	if err != nil {
+		return nil, err
+	}
+	written := make(map[SBOMFormat]*Artifact)
+	var paths []string
+	for _, format := range formats {
+		data, err := s.Marshal(format)
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprintf("%s-%s-sbom.%s%s", s.Name, s.BuildID, s.Arch, format.suffix())
+		if err := writeFileAtomic(filepath.Join(dir, name), data); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		written[format] = &Artifact{
+			Path:            name,
+			Sha256:          hex.EncodeToString(sum[:]),
+			SizeInBytes:     float64(len(data)),
+			SkipCompression: true,
+		}
+		paths = append(paths, name)
+	}
+
+	err = UpdateMeta(filepath.Join(dir, CosaMetaJSON), func(b *Build) error {
+		if b.BuildArtifacts == nil {
+			b.BuildArtifacts = new(BuildArtifacts)
+		}
+		if a, ok := written[SBOMSPDX]; ok {
+			b.BuildArtifacts.SbomSpdx = a
+		}
+		if a, ok := written[SBOMCycloneDX]; ok {
+			b.BuildArtifacts.SbomCycloneDX = a
+		}
+		return nil
+	})
+	if err != nil {
+		for _, p := range paths {
+			os.Remove(filepath.Join(dir, p))
+		}
+		return nil, err
+	}
+	return paths, nil
+}
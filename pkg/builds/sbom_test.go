@@ -0,0 +1,142 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteSBOMs(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "41.1", "x86_64")
+	commit := strings.Repeat("a", 64)
+	writeDiffBuild(t, dir, map[string]interface{}{
+		"buildid":                          "41.1",
+		"name":                             "fedora-coreos",
+		"ostree-commit":                    commit,
+		"ostree-timestamp":                 "2026-01-01T00:00:00Z",
+		"ostree-version":                   "41.1",
+		"coreos-assembler.basearch":        "x86_64",
+		"coreos-assembler.build-timestamp": "2026-01-01T01:00:00Z",
+		"images": map[string]interface{}{
+			"ostree": map[string]interface{}{"path": "fcos.ociarchive", "sha256": "a"},
+		},
+		"base-oscontainer": map[string]interface{}{
+			"image":  "quay.io/fedora/fedora-coreos:41.1",
+			"digest": "sha256:" + strings.Repeat("b", 64),
+		},
+		"coreos-assembler.container-config-git": map[string]interface{}{
+			"origin": "https://github.com/coreos/fedora-coreos-config",
+			"commit": "cccccccc",
+			"branch": "testing-devel",
+			"dirty":  "false",
+		},
+	}, map[string]interface{}{
+		"rpmostree.rpmdb.pkglist": [][]string{
+			{"podman", "5", "5.2.0", "1.fc41", "x86_64"},
+			{"kernel", "0", "6.1.0", "1.fc41", "x86_64"},
+			{"c++-lib", "0", "1.0+git", "1.fc41", "noarch"},
+		},
+	})
+
+	paths, err := WriteSBOMs(dir, SBOMFormats...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fedora-coreos-41.1-sbom.x86_64.spdx.json", "fedora-coreos-41.1-sbom.x86_64.cdx.json"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("expected %v, got %v", want, paths)
+	}
+
+	build, err := ParseBuild(filepath.Join(dir, CosaMetaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := build.BuildArtifacts.SbomSpdx; a == nil || a.Path != want[0] || a.Sha256 == "" {
+		t.Errorf("SPDX SBOM not recorded: %v", a)
+	}
+	if a := build.BuildArtifacts.SbomCycloneDX; a == nil || a.Path != want[1] {
+		t.Errorf("CycloneDX SBOM not recorded: %v", a)
+	}
+	report, err := build.Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range report.Artifacts {
+		if strings.HasPrefix(a.Name, "sbom-") && a.Status != ArtifactOK {
+			t.Errorf("%s: %s", a.Name, a.Status)
+		}
+	}
+
+	var spdx spdxDocument
+	if err := readJSONFile(filepath.Join(dir, want[0]), &spdx); err != nil {
+		t.Fatal(err)
+	}
+	if spdx.SPDXVersion != "SPDX-2.3" || len(spdx.Packages) != 6 {
+		t.Fatalf("unexpected SPDX document: %+v", spdx)
+	}
+	if p := spdx.Packages[0]; len(p.Checksums) != 0 || len(p.ExternalRefs) != 1 ||
+		p.ExternalRefs[0].ReferenceType != "coreos-assembler:ostree-commit" || p.ExternalRefs[0].ReferenceLocator != commit {
+		t.Errorf("unexpected build package: %+v", p)
+	}
+	if p := spdx.Packages[1]; p.Name != "c++-lib" || p.SPDXID != "SPDXRef-Package-c--lib-1.0-git-1.fc41.noarch" ||
+		p.ExternalRefs[0].ReferenceLocator != "pkg:rpm/fedora/c%2B%2B-lib@1.0%2Bgit-1.fc41?arch=noarch&distro=fedora-coreos-41.1" {
+		t.Errorf("unexpected package: %+v", p)
+	}
+	if p := spdx.Packages[3]; p.VersionInfo != "5:5.2.0-1.fc41" ||
+		p.ExternalRefs[0].ReferenceLocator != "pkg:rpm/fedora/podman@5.2.0-1.fc41?arch=x86_64&distro=fedora-coreos-41.1&epoch=5" {
+		t.Errorf("unexpected package: %+v", p)
+	}
+	if p := spdx.Packages[4]; p.ExternalRefs[0].ReferenceLocator != "pkg:oci/fedora-coreos@sha256%3A"+strings.Repeat("b", 64)+"?repository_url=quay.io%2Ffedora%2Ffedora-coreos" {
+		t.Errorf("unexpected container: %+v", p)
+	}
+	if p := spdx.Packages[5]; p.DownloadLocation != "git+https://github.com/coreos/fedora-coreos-config@cccccccc" {
+		t.Errorf("unexpected source: %+v", p)
+	}
+	if len(spdx.Relationships) != 6 {
+		t.Errorf("unexpected relationships: %v", spdx.Relationships)
+	}
+
+	var cdx cdxDocument
+	if err := readJSONFile(filepath.Join(dir, want[1]), &cdx); err != nil {
+		t.Fatal(err)
+	}
+	if cdx.BOMFormat != "CycloneDX" || len(cdx.Components) != 4 || len(cdx.Dependencies[0].DependsOn) != 3 {
+		t.Fatalf("unexpected CycloneDX document: %+v", cdx)
+	}
+	if c := cdx.Metadata.Component; len(c.Hashes) != 0 || c.Properties[1].Name != "coreos-assembler:ostree-commit" || c.Properties[1].Value != commit {
+		t.Errorf("unexpected build component: %+v", c)
+	}
+
+	// Regenerating the SBOMs of a build gives the same documents.
+	s, err := ReadBuildSBOM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := s.Marshal(SBOMCycloneDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cdx2 cdxDocument
+	if err := json.Unmarshal(again, &cdx2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cdx, cdx2) {
+		t.Errorf("CycloneDX SBOM isn't reproducible")
+	}
+}
@@ -1,5 +1,5 @@
 // Generated by ./generate-schema.sh
-// Source hash: e6319430c382239f42a623bd132eb03dca261df38b33ea8ab642ab2946d91b2f
+// Source hash: ece3d72e284298a56c16d63655985fbe8174e72ee711753f96085dce7d786e8c
 // DO NOT EDIT
 
 package builds
@@ -19,6 +19,15 @@ var generatedSchemaJSON = `{
           "type": "string",
           "title": "SHA256"
         },
+        "signatures": {
+          "$id": "#/artifact/signatures",
+          "type": "array",
+          "title": "Signatures",
+          "description": "Detached signatures of the artifact",
+          "items": {
+            "$ref": "#/definitions/artifact-signature"
+          }
+        },
         "size": {
           "$id": "#/artifact/size",
           "type": "number",
@@ -43,6 +52,7 @@ var generatedSchemaJSON = `{
         }
       },
       "optional": [
+        "signatures",
         "size",
         "uncompressed-sha256",
         "uncompressed-size",
@@ -53,6 +63,46 @@ var generatedSchemaJSON = `{
         "sha256"
       ]
     },
+    "artifact-signature": {
+      "type": "object",
+      "required": [
+        "type",
+        "path"
+      ],
+      "optional": [
+        "key-id",
+        "sha256"
+      ],
+      "properties": {
+        "key-id": {
+          "$id": "#/artifact-signature/key-id",
+          "type": "string",
+          "title": "Key ID",
+          "description": "Fingerprint or hint of the signing key"
+        },
+        "path": {
+          "$id": "#/artifact-signature/path",
+          "type": "string",
+          "title": "Path",
+          "description": "Path of the signature, relative to the build directory"
+        },
+        "sha256": {
+          "$id": "#/artifact-signature/sha256",
+          "type": "string",
+          "title": "SHA256",
+          "description": "SHA256 of the signed file, which is the uncompressed artifact once it is compressed"
+        },
+        "type": {
+          "$id": "#/artifact-signature/type",
+          "type": "string",
+          "title": "Type",
+          "enum": [
+            "openpgp",
+            "sigstore-bundle"
+          ]
+        }
+      }
+    },
     "image": {
       "type": "object",
       "required": [
@@ -239,8 +289,10 @@ var generatedSchemaJSON = `{
       "items": {
         "$id": "#/pkgdiff/items/item",
         "title": "Items",
-        "default": "",
-        "minLength": 1
+        "description": "[name, change kind (0: added, 1: removed, 2: upgraded, 3: downgraded), {\"PreviousPackage\": [name, evr, arch], \"NewPackage\": [name, evr, arch]}]",
+        "type": "array",
+        "minItems": 3,
+        "maxItems": 3
       }
     },
     "advisory-items": {
@@ -249,7 +301,10 @@ var generatedSchemaJSON = `{
       "items": {
         "$id": "#/advisory-diff/items/item",
         "title": "Items",
-        "default": ""
+        "description": "[advisory ID, kind (0: unknown, 1: security, 2: bugfix, 3: enhancement, 4: newpackage), severity (0: none, 1: low, 2: moderate, 3: important, 4: critical), [package NEVRA...], {\"cve_references\": [[title, url]...]}]",
+        "type": "array",
+        "minItems": 4,
+        "maxItems": 5
       }
     }
   },
@@ -300,6 +355,7 @@ var generatedSchemaJSON = `{
     "coreos-assembler.image-config-checksum",
     "coreos-assembler.image-genver",
     "coreos-assembler.image-input-checksum",
+    "coreos-assembler.meta-schema-version",
     "coreos-assembler.meta-stamp",
     "coreos-assembler.overrides-active",
     "coreos-assembler.yumrepos-git",
@@ -452,6 +508,13 @@ var generatedSchemaJSON = `{
       "title": "YUM repos Git",
       "$ref": "#/definitions/git"
     },
+    "coreos-assembler.meta-schema-version": {
+      "$id": "#/properties/coreos-assembler.meta-schema-version",
+      "type": "integer",
+      "title": "COSA Meta Schema Version",
+      "description": "Version of this schema which the document was migrated to; documents without it are detected from their fields",
+      "minimum": 0
+    },
     "coreos-assembler.meta-stamp": {
       "$id": "#/properties/coreos-assembler.meta-stamp",
       "type": "number",
@@ -549,7 +612,10 @@ var generatedSchemaJSON = `{
         "vultr",
         "qemu-secex",
         "ignition-gpg-key",
-        "oci-manifest"
+        "oci-manifest",
+        "sbom-spdx",
+        "sbom-cyclonedx",
+        "provenance"
       ],
       "properties": {
         "ostree": {
@@ -564,6 +630,27 @@ var generatedSchemaJSON = `{
           "title": "OCI Manifest",
           "$ref": "#/definitions/artifact"
         },
+        "sbom-spdx": {
+          "$id": "#/properties/images/properties/sbom-spdx",
+          "type": "object",
+          "title": "SBOM SPDX",
+          "description": "SPDX JSON software bill of materials of the build",
+          "$ref": "#/definitions/artifact"
+        },
+        "sbom-cyclonedx": {
+          "$id": "#/properties/images/properties/sbom-cyclonedx",
+          "type": "object",
+          "title": "SBOM CycloneDX",
+          "description": "CycloneDX JSON software bill of materials of the build",
+          "$ref": "#/definitions/artifact"
+        },
+        "provenance": {
+          "$id": "#/properties/images/properties/provenance",
+          "type": "object",
+          "title": "Provenance",
+          "description": "DSSE envelope of the in-toto SLSA provenance statement of the build",
+          "$ref": "#/definitions/artifact"
+        },
         "dasd": {
           "$id": "#/properties/images/properties/dasd",
           "type": "object",
@@ -1,8 +1,8 @@
 package builds
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,9 +14,9 @@ import (
 )
 
 const (
-	fcosJSON   = "../../../fixtures/fcos.json"
-	rhcosJSON  = "../../../fixtures/rhcos.json"
-	cosaSchema = "../../../src/schema/v1.json"
+	fcosJSON   = "../../fixtures/fcos.json"
+	rhcosJSON  = "../../fixtures/rhcos.json"
+	cosaSchema = "../../src/v1.json"
 )
 
 var testMeta = []string{fcosJSON, rhcosJSON}
@@ -140,7 +140,6 @@ func TestMergeMeta(t *testing.T) {
 	}
 	// remove artifacts from c
 	c.BuildArtifacts = nil
-	c.BuildID = "foo"
 
 	// remove AMIs from b and set delayed merge on
 	b.Amis = nil
@@ -176,26 +175,8 @@ func TestMergeMeta(t *testing.T) {
 		t.Fatalf("failed to write tmp meta.test.json: %v", err)
 	}
 
-	// Now merge
-	data, _ = json.Marshal(b)
-	dR := bytes.NewReader(data)
-
-	if err := c.mergeMeta(dR); err != nil {
-		t.Fatalf("failed to merge: %v", err)
-	}
-
-	// Build Artifacts should be added into c
-	if !reflect.DeepEqual(c.BuildArtifacts, b.BuildArtifacts) {
-		t.Fatal("build artifacts are not equal")
-	}
-	// c.BuildID is set to 'foo', check its updated
-	if c.BuildID != b.BuildID {
-		t.Fatalf("buildID should have been updated:\n want: %s\n  got: %s\n", c.BuildID, b.BuildID)
-	}
-
 	// m represents the merger of b and c
 	// where b is the starting meta.json
-	// m.BuildID should be c.Build
 	m, _, err := ReadBuild(filepath.Join(tmpd, "builds"), "", BuilderArch())
 	if err != nil {
 		t.Fatal("failed to find build")
@@ -210,6 +191,15 @@ func TestMergeMeta(t *testing.T) {
 	if !reflect.DeepEqual(m.Amis, c.Amis) {
 		t.Errorf("merge should have AMIs")
 	}
+
+	// a meta.*.json of another build conflicts
+	c.BuildID = "foo"
+	if err := c.WriteMeta(filepath.Join(fakeBuildDir, "meta.foo.json"), false); err != nil {
+		t.Fatalf("failed to write tmp meta.foo.json: %v", err)
+	}
+	if _, _, err := ReadBuild(filepath.Join(tmpd, "builds"), "", BuilderArch()); !errors.Is(err, ErrMetaConflict) {
+		t.Errorf("merging the meta.json of another build should conflict, got %v", err)
+	}
 }
 
 func TestMetaRegEx(t *testing.T) {
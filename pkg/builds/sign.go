@@ -0,0 +1,730 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// SignatureType is the format of a detached artifact signature.
+type SignatureType string
+
+const (
+	// SignatureOpenPGP is a binary detached OpenPGP signature, as
+	// verified by coreos-installer download.
+	SignatureOpenPGP SignatureType = "openpgp"
+	// SignatureSigstoreBundle is a sigstore bundle with a message
+	// signature made by a public key, as verified by
+	// cosign verify-blob --key.
+	SignatureSigstoreBundle SignatureType = "sigstore-bundle"
+
+	// SigstoreBundleMediaType is the media type of the bundles written
+	// by the sigstore signer.
+	SigstoreBundleMediaType = "application/vnd.dev.sigstore.bundle.v0.3+json"
+)
+
+// Signer produces detached signatures of artifacts.
+type Signer interface {
+	Type() SignatureType
+	// KeyID identifies the signing key in meta.json.
+	KeyID() string
+	// Suffix is appended to the path of an artifact to get the path
+	// of its signature.
+	Suffix() string
+	Sign(r io.Reader) ([]byte, error)
+}
+
+// SignatureVerifier checks detached signatures of a given type.
+type SignatureVerifier interface {
+	Type() SignatureType
+	// Verify checks that sig is a signature of the data read from r,
+	// and returns the ID of the key which made it.
+	Verify(r io.Reader, sig []byte) (string, error)
+}
+
+type openPGPSigner struct {
+	entity *openpgp.Entity
+}
+
+// NewOpenPGPSigner returns a Signer of detached OpenPGP signatures made
+// with the (decrypted) private key of entity.
+func NewOpenPGPSigner(entity *openpgp.Entity) (Signer, error) {
+	if entity.PrivateKey == nil {
+		return nil, fmt.Errorf("key %s has no private key", openPGPKeyID(entity))
+	}
+	return &openPGPSigner{entity: entity}, nil
+}
+
+// LoadOpenPGPSigner reads an armored or binary secret key from path,
+// decrypting it with passphrase if needed.
+func LoadOpenPGPSigner(path string, passphrase []byte) (Signer, error) {
+	keyring, err := readOpenPGPKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range keyring {
+		if e.PrivateKey == nil {
+			continue
+		}
+		if e.PrivateKey.Encrypted {
+			if err := e.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, fmt.Errorf("decrypting key %s: %w", openPGPKeyID(e), err)
+			}
+		}
+		for _, sk := range e.Subkeys {
+			if sk.PrivateKey != nil && sk.PrivateKey.Encrypted {
+				if err := sk.PrivateKey.Decrypt(passphrase); err != nil {
+					return nil, fmt.Errorf("decrypting subkey of %s: %w", openPGPKeyID(e), err)
+				}
+			}
+		}
+		return NewOpenPGPSigner(e)
+	}
+	return nil, fmt.Errorf("no secret key in %s", path)
+}
+
+func (s *openPGPSigner) Type() SignatureType { return SignatureOpenPGP }
+func (s *openPGPSigner) KeyID() string       { return openPGPKeyID(s.entity) }
+func (s *openPGPSigner) Suffix() string      { return ".sig" }
+
+func (s *openPGPSigner) Sign(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.DetachSign(&buf, s.entity, r, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type openPGPVerifier struct {
+	keyring openpgp.EntityList
+}
+
+// NewOpenPGPVerifier returns a SignatureVerifier accepting detached
+// OpenPGP signatures, binary or armored, made by a key of keyring.
+func NewOpenPGPVerifier(keyring openpgp.EntityList) SignatureVerifier {
+	return &openPGPVerifier{keyring: keyring}
+}
+
+// LoadOpenPGPVerifier reads an armored or binary public keyring from
+// path.
+func LoadOpenPGPVerifier(path string) (SignatureVerifier, error) {
+	keyring, err := readOpenPGPKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewOpenPGPVerifier(keyring), nil
+}
+
+func (v *openPGPVerifier) Type() SignatureType { return SignatureOpenPGP }
+
+func (v *openPGPVerifier) Verify(r io.Reader, sig []byte) (string, error) {
+	var signer *openpgp.Entity
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+		signer, err = openpgp.CheckArmoredDetachedSignature(v.keyring, r, bytes.NewReader(sig), nil)
+	} else {
+		signer, err = openpgp.CheckDetachedSignature(v.keyring, r, bytes.NewReader(sig), nil)
+	}
+	if err != nil {
+		return "", err
+	}
+	return openPGPKeyID(signer), nil
+}
+
+func readOpenPGPKeyring(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keyring openpgp.EntityList
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring %s: %w", path, err)
+	}
+	return keyring, nil
+}
+
+// openPGPKeyID is the fingerprint of the primary key of e.
+func openPGPKeyID(e *openpgp.Entity) string {
+	return strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint[:]))
+}
+
+// SigstoreBundle is the subset of a sigstore bundle which describes a
+// signature made by a public key over the SHA-256 digest of a blob.
+type SigstoreBundle struct {
+	MediaType            string                       `json:"mediaType"`
+	VerificationMaterial SigstoreVerificationMaterial `json:"verificationMaterial"`
+	MessageSignature     SigstoreMessageSignature     `json:"messageSignature"`
+}
+
+// SigstoreVerificationMaterial identifies the key which made a bundle.
+type SigstoreVerificationMaterial struct {
+	PublicKey struct {
+		Hint string `json:"hint"`
+	} `json:"publicKey"`
+}
+
+// SigstoreMessageSignature is the signature of a bundle.
+type SigstoreMessageSignature struct {
+	MessageDigest struct {
+		Algorithm string `json:"algorithm"`
+		Digest    []byte `json:"digest"`
+	} `json:"messageDigest"`
+	Signature []byte `json:"signature"`
+}
+
+type sigstoreSigner struct {
+	key  crypto.Signer
+	hint string
+}
+
+// NewSigstoreSigner returns a Signer of sigstore bundles made with an
+// ECDSA or RSA private key.
+func NewSigstoreSigner(key crypto.Signer) (Signer, error) {
+	hint, err := sigstoreKeyHint(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &sigstoreSigner{key: key, hint: hint}, nil
+}
+
+// LoadSigstoreSigner reads an unencrypted PEM private key from path.
+func LoadSigstoreSigner(path string) (Signer, error) {
+	key, err := LoadPrivateKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigstoreSigner(key)
+}
+
+// LoadPrivateKey reads an unencrypted PEM private key from path.
+func LoadPrivateKey(path string) (crypto.Signer, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T in %s", key, path)
+	}
+	return signer, nil
+}
+
+func (s *sigstoreSigner) Type() SignatureType { return SignatureSigstoreBundle }
+func (s *sigstoreSigner) KeyID() string       { return s.hint }
+func (s *sigstoreSigner) Suffix() string      { return ".sigstore.json" }
+
+func (s *sigstoreSigner) Sign(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	digest := h.Sum(nil)
+	sig, err := s.key.Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := SigstoreBundle{MediaType: SigstoreBundleMediaType}
+	bundle.VerificationMaterial.PublicKey.Hint = s.hint
+	bundle.MessageSignature.MessageDigest.Algorithm = "SHA2_256"
+	bundle.MessageSignature.MessageDigest.Digest = digest
+	bundle.MessageSignature.Signature = sig
+	return json.MarshalIndent(bundle, "", "  ")
+}
+
+type sigstoreVerifier struct {
+	key  crypto.PublicKey
+	hint string
+}
+
+// NewSigstoreVerifier returns a SignatureVerifier accepting sigstore
+// bundles made by the private key of an ECDSA or RSA public key.
+func NewSigstoreVerifier(key crypto.PublicKey) (SignatureVerifier, error) {
+	hint, err := sigstoreKeyHint(key)
+	if err != nil {
+		return nil, err
+	}
+	return &sigstoreVerifier{key: key, hint: hint}, nil
+}
+
+// LoadSigstoreVerifier reads a PEM public key from path, such as the
+// cosign.pub written by cosign generate-key-pair.
+func LoadSigstoreVerifier(path string) (SignatureVerifier, error) {
+	key, err := LoadPublicKey(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSigstoreVerifier(key)
+}
+
+// LoadPublicKey reads a PEM public key from path.
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return key, nil
+}
+
+func (v *sigstoreVerifier) Type() SignatureType { return SignatureSigstoreBundle }
+
+func (v *sigstoreVerifier) Verify(r io.Reader, sig []byte) (string, error) {
+	var bundle SigstoreBundle
+	if err := json.Unmarshal(sig, &bundle); err != nil {
+		return "", fmt.Errorf("parsing bundle: %w", err)
+	}
+	if !strings.HasPrefix(bundle.MediaType, "application/vnd.dev.sigstore.bundle") {
+		return "", fmt.Errorf("unsupported bundle media type %q", bundle.MediaType)
+	}
+	if hint := bundle.VerificationMaterial.PublicKey.Hint; hint != "" && hint != v.hint {
+		return "", fmt.Errorf("bundle was signed by key %s", hint)
+	}
+	md := bundle.MessageSignature.MessageDigest
+	if md.Algorithm != "SHA2_256" {
+		return "", fmt.Errorf("unsupported digest algorithm %q", md.Algorithm)
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	digest := h.Sum(nil)
+	if !bytes.Equal(digest, md.Digest) {
+		return "", fmt.Errorf("digest mismatch")
+	}
+
+	if err := verifyDigest(v.key, digest, bundle.MessageSignature.Signature); err != nil {
+		return "", err
+	}
+	return v.hint, nil
+}
+
+// verifyDigest checks an ECDSA or RSA signature of a SHA-256 digest.
+func verifyDigest(key crypto.PublicKey, digest, sig []byte) error {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return fmt.Errorf("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("invalid signature: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// sigstoreKeyHint identifies a public key by the digest of its PKIX
+// encoding.
+func sigstoreKeyHint(key crypto.PublicKey) (string, error) {
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey:
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+// SignedArtifact is an artifact signed by SignBuild.
+type SignedArtifact struct {
+	Name      string
+	Signature ArtifactSignature
+}
+
+// SignBuild signs the named artifacts of the build in dir, or all the
+// artifacts present in dir if names is empty. The signatures are written
+// next to the artifacts and recorded in meta.json, replacing previous
+// signatures of the same type and key. Artifacts which don't match the
+// digest in meta.json are refused.
+func SignBuild(dir string, signer Signer, names ...string) ([]SignedArtifact, error) {
+	metaPath := filepath.Join(dir, CosaMetaJSON)
+	build, err := readMetaLenient(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	if build.BuildArtifacts == nil {
+		return nil, fmt.Errorf("build has no artifacts")
+	}
+
+	artifacts := build.artifacts()
+	if len(names) == 0 {
+		for name, a := range artifacts {
+			if a.Path == "" || build.artifactRef(name) == nil {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, a.Path)); err == nil {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+
+	var signed []SignedArtifact
+	for _, name := range names {
+		a, ok := artifacts[name]
+		if !ok || a.Path == "" {
+			return nil, fmt.Errorf("build has no artifact %q", name)
+		}
+		if build.artifactRef(name) == nil {
+			return nil, fmt.Errorf("signatures of artifact %q can't be recorded", name)
+		}
+		sig, err := signArtifact(filepath.Join(dir, a.Path), a.Sha256, signer)
+		if err != nil {
+			return nil, fmt.Errorf("signing %s: %w", name, err)
+		}
+		ref := ArtifactSignature{
+			KeyID:  signer.KeyID(),
+			Path:   a.Path + signer.Suffix(),
+			Sha256: a.Sha256,
+			Type:   string(signer.Type()),
+		}
+		if err := writeFileAtomic(filepath.Join(dir, ref.Path), sig); err != nil {
+			return nil, err
+		}
+		signed = append(signed, SignedArtifact{Name: name, Signature: ref})
+	}
+
+	err = UpdateMeta(metaPath, func(b *Build) error {
+		for _, s := range signed {
+			a := b.artifactRef(s.Name)
+			if a == nil || a.Sha256 != artifacts[s.Name].Sha256 {
+				return fmt.Errorf("artifact %s changed while signing it", s.Name)
+			}
+			a.Signatures = setSignature(a.Signatures, s.Signature)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// signArtifact signs the file at path, checking on the way that its
+// digest is the expected one.
+func signArtifact(path, digest string, signer Signer) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	sig, err := signer.Sign(io.TeeReader(f, h))
+	if err != nil {
+		return nil, err
+	}
+	// Drain the file in case the signer didn't read it to the end.
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); digest != "" && got != digest {
+		return nil, fmt.Errorf("sha256 is %s, expected %s from meta.json", got, digest)
+	}
+	return sig, nil
+}
+
+// setSignature adds sig to sigs, replacing a signature of the same type
+// by the same key or at the same path.
+func setSignature(sigs []ArtifactSignature, sig ArtifactSignature) []ArtifactSignature {
+	for i, s := range sigs {
+		if s.Type == sig.Type && (s.KeyID == sig.KeyID || s.Path == sig.Path) {
+			sigs[i] = sig
+			return sigs
+		}
+	}
+	return append(sigs, sig)
+}
+
+// artifactRef returns the artifact of the build named name, such that
+// changes to it are reflected in the build, or nil if there's none.
+func (build *Build) artifactRef(name string) *Artifact {
+	if build.BuildArtifacts == nil {
+		return nil
+	}
+	v := reflect.ValueOf(build.BuildArtifacts).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if strings.ToLower(tag) != name {
+			continue
+		}
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				return nil
+			}
+			a, _ := field.Interface().(*Artifact)
+			return a
+		}
+		a, _ := field.Addr().Interface().(*Artifact)
+		return a
+	}
+	return nil
+}
+
+// SignatureStatus is the outcome of verifying an artifact signature.
+type SignatureStatus string
+
+const (
+	// SignatureValid means that a trusted key made the signature.
+	SignatureValid SignatureStatus = "valid"
+	// SignatureInvalid means that no trusted key made the signature.
+	SignatureInvalid SignatureStatus = "invalid"
+	// SignatureMissing means that meta.json records a signature which
+	// isn't in the build directory.
+	SignatureMissing SignatureStatus = "missing"
+	// SignatureUnverified means that no verifier handles the type of
+	// the signature.
+	SignatureUnverified SignatureStatus = "unverified"
+	// SignatureUnsigned means that meta.json records no signature of
+	// the artifact.
+	SignatureUnsigned SignatureStatus = "unsigned"
+)
+
+// SignatureVerification is the result of verifying a signature.
+type SignatureVerification struct {
+	Name      string          `json:"name"`
+	Path      string          `json:"path"`
+	Signature string          `json:"signature"`
+	Type      SignatureType   `json:"type"`
+	KeyID     string          `json:"key-id,omitempty"`
+	Status    SignatureStatus `json:"status"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// VerifySignatures checks the signatures recorded in meta.json of the
+// artifacts present in dir, which are the ones SignBuild signs. The
+// signatures of artifacts compressed since they were signed are checked
+// against their uncompressed contents. Artifacts without signatures are
+// reported as unsigned. Artifacts which aren't in
+// dir, e.g. because buildfetch skipped them, are ignored.
+func (build *Build) VerifySignatures(dir string, verifiers ...SignatureVerifier) []SignatureVerification {
+	if build.BuildArtifacts == nil {
+		return nil
+	}
+	var names []string
+	artifacts := build.artifacts()
+	for name, a := range artifacts {
+		if a.Path != "" && build.artifactRef(name) != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var ret []SignatureVerification
+	for _, name := range names {
+		a := artifacts[name]
+		if _, err := os.Stat(filepath.Join(dir, a.Path)); err != nil {
+			continue
+		}
+		if len(a.Signatures) == 0 {
+			ret = append(ret, SignatureVerification{Name: name, Path: a.Path, Status: SignatureUnsigned})
+		}
+		for _, s := range a.Signatures {
+			ret = append(ret, verifySignature(dir, name, a, s, verifiers))
+		}
+	}
+	return ret
+}
+
+// UntrustedArtifacts returns the names of the artifacts which none of the
+// verifiers given to VerifySignatures found a valid signature of, given
+// its results. Once verifiers are given, an artifact is only trusted if
+// one of its signatures is valid: unsigned artifacts and artifacts only
+// signed in formats without a verifier are untrusted too.
+func UntrustedArtifacts(results []SignatureVerification) []string {
+	trusted := make(map[string]bool)
+	for _, r := range results {
+		trusted[r.Name] = trusted[r.Name] || r.Status == SignatureValid
+	}
+	var ret []string
+	for name, ok := range trusted {
+		if !ok {
+			ret = append(ret, name)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func verifySignature(dir, name string, a *Artifact, s ArtifactSignature, verifiers []SignatureVerifier) SignatureVerification {
+	ret := SignatureVerification{
+		Name:      name,
+		Path:      a.Path,
+		Signature: s.Path,
+		Type:      SignatureType(s.Type),
+		KeyID:     s.KeyID,
+		Status:    SignatureUnverified,
+	}
+	sig, err := os.ReadFile(filepath.Join(dir, s.Path))
+	if errors.Is(err, os.ErrNotExist) {
+		ret.Status = SignatureMissing
+		return ret
+	} else if err != nil {
+		ret.Status, ret.Error = SignatureInvalid, err.Error()
+		return ret
+	}
+
+	// Find which form of the artifact was signed. Signatures made before
+	// cosa compress are over the uncompressed file; a signature of
+	// another file is refused.
+	path := filepath.Join(dir, a.Path)
+	compressed := a.UncompressedSha256 != "" && isCompressed(a.Path)
+	var forms []bool
+	switch {
+	case s.Sha256 == "":
+		forms = []bool{false}
+		if compressed {
+			forms = append(forms, true)
+		}
+	case s.Sha256 == a.Sha256:
+		forms = []bool{false}
+	case s.Sha256 == a.UncompressedSha256 && compressed:
+		forms = []bool{true}
+	default:
+		ret.Status, ret.Error = SignatureInvalid, fmt.Sprintf("signature is of a file with sha256 %s", s.Sha256)
+		return ret
+	}
+
+	for _, v := range verifiers {
+		if v.Type() != ret.Type {
+			continue
+		}
+		for _, uncompressed := range forms {
+			keyID, err := verifyFile(path, uncompressed, sig, v)
+			if err == nil {
+				ret.Status, ret.KeyID, ret.Error = SignatureValid, keyID, ""
+				return ret
+			}
+			if errors.Is(err, exec.ErrNotFound) {
+				ret.Status, ret.Error = SignatureUnverified, err.Error()
+			} else {
+				ret.Status, ret.Error = SignatureInvalid, err.Error()
+			}
+		}
+	}
+	return ret
+}
+
+// verifyFile checks sig against the file at path, or its uncompressed
+// contents.
+func verifyFile(path string, uncompressed bool, sig []byte, v SignatureVerifier) (string, error) {
+	open := func(path string) (io.ReadCloser, error) { return os.Open(path) }
+	if uncompressed {
+		open = openUncompressed
+	}
+	r, err := open(path)
+	if err != nil {
+		return "", err
+	}
+	keyID, err := v.Verify(r, sig)
+	if closeErr := r.Close(); err == nil && closeErr != nil {
+		return "", fmt.Errorf("decompressing: %w", closeErr)
+	}
+	return keyID, err
+}
+
+// checkSignatures verifies the signatures of the build in dir with
+// verifiers, failing unless every artifact has a valid signature.
+func (build *Build) checkSignatures(dir string, verifiers []SignatureVerifier) error {
+	results := build.VerifySignatures(dir, verifiers...)
+	var failed []string
+	for _, name := range UntrustedArtifacts(results) {
+		var statuses []string
+		for _, v := range results {
+			if v.Name != name {
+				continue
+			}
+			msg := string(v.Status)
+			if v.Signature != "" {
+				msg = fmt.Sprintf("%s %s", v.Signature, v.Status)
+			}
+			if v.Error != "" {
+				msg += ": " + v.Error
+			}
+			statuses = append(statuses, msg)
+		}
+		failed = append(failed, fmt.Sprintf("%s (%s)", name, strings.Join(statuses, ", ")))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("signature verification of %s failed: %s", dir, strings.Join(failed, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,356 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func writeSignBuild(t *testing.T) (string, string) {
+	top := t.TempDir()
+	dir := filepath.Join(top, "41.1", "x86_64")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	digests := make(map[string]string)
+	for name, content := range map[string]string{"ostree.ociarchive": "ostree", "disk.qcow2": "qemu"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		digests[name] = hex.EncodeToString(sum[:])
+	}
+	meta := `{"buildid": "41.1", "name": "fedora-coreos", "ostree-commit": "` + strings.Repeat("a", 64) + `",
+		"ostree-timestamp": "2026-01-01T00:00:00Z", "ostree-version": "41.1", "images": {
+		"ostree": {"path": "ostree.ociarchive", "sha256": "` + digests["ostree.ociarchive"] + `"},
+		"qemu": {"path": "disk.qcow2", "sha256": "` + digests["disk.qcow2"] + `"},
+		"metal": {"path": "disk.raw", "sha256": "` + strings.Repeat("b", 64) + `"}}}`
+	if err := os.WriteFile(filepath.Join(dir, CosaMetaJSON), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return top, dir
+}
+
+func TestSignBuild(t *testing.T) {
+	top, dir := writeSignBuild(t)
+
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pgpSigner, err := NewOpenPGPSigner(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundleSigner, err := NewSigstoreSigner(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The metal image isn't in the build directory, so isn't signed.
+	signed, err := SignBuild(dir, pgpSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signed) != 2 || signed[0].Name != "ostree" || signed[1].Name != "qemu" {
+		t.Fatalf("unexpected signed artifacts: %v", signed)
+	}
+	if _, err := SignBuild(dir, bundleSigner, "qemu"); err != nil {
+		t.Fatal(err)
+	}
+	// Re-signing replaces the previous signature.
+	if _, err := SignBuild(dir, bundleSigner, "qemu"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignBuild(dir, bundleSigner, "metal"); err == nil {
+		t.Error("signed a missing artifact")
+	}
+
+	build, err := ParseBuild(filepath.Join(dir, CosaMetaJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs := build.BuildArtifacts.Qemu.Signatures
+	if len(sigs) != 2 || sigs[0].Path != "disk.qcow2.sig" || sigs[1].Path != "disk.qcow2.sigstore.json" {
+		t.Fatalf("unexpected qemu signatures: %v", sigs)
+	}
+	if sigs[0].KeyID != pgpSigner.KeyID() || sigs[1].KeyID != bundleSigner.KeyID() {
+		t.Errorf("unexpected key IDs: %v", sigs)
+	}
+
+	// Load the verifiers as a user would.
+	var pub strings.Builder
+	w, err := armor.Encode(&pub, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	keyring := filepath.Join(t.TempDir(), "key.asc")
+	if err := os.WriteFile(keyring, []byte(pub.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pgpVerifier, err := LoadOpenPGPVerifier(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(ecKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPath := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bundleVerifier, err := LoadSigstoreVerifier(pubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := build.VerifySignatures(dir, pgpVerifier, bundleVerifier)
+	if len(results) != 3 {
+		t.Fatalf("expected 3 signatures, got %v", results)
+	}
+	for _, r := range results {
+		if r.Status != SignatureValid {
+			t.Errorf("%s: %s %s", r.Signature, r.Status, r.Error)
+		}
+	}
+
+	if _, _, err := ReadBuildVerified(top, "41.1", "x86_64", pgpVerifier, bundleVerifier); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only OpenPGP signatures can be checked with the keyring.
+	for _, r := range build.VerifySignatures(dir, pgpVerifier) {
+		if r.Type == SignatureSigstoreBundle && r.Status != SignatureUnverified {
+			t.Errorf("%s: expected unverified, got %s", r.Signature, r.Status)
+		}
+	}
+	// The ostree image only has an OpenPGP signature, which the sigstore
+	// key can't vouch for.
+	if got := UntrustedArtifacts(build.VerifySignatures(dir, bundleVerifier)); !reflect.DeepEqual(got, []string{"ostree"}) {
+		t.Errorf("expected the ostree image to be untrusted, got %v", got)
+	}
+	if _, _, err := ReadBuildVerified(top, "41.1", "x86_64", bundleVerifier); err == nil || !strings.Contains(err.Error(), "ostree (ostree.ociarchive.sig unverified)") {
+		t.Errorf("expected the ostree image to fail verification, got %v", err)
+	}
+
+	// Stripping the signatures from meta.json doesn't bypass verification.
+	metaPath := filepath.Join(dir, CosaMetaJSON)
+	signedMeta, err := os.ReadFile(metaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateMeta(metaPath, func(b *Build) error {
+		b.BuildArtifacts.Qemu.Signatures = nil
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadBuildVerified(top, "41.1", "x86_64", pgpVerifier, bundleVerifier); err == nil || !strings.Contains(err.Error(), "qemu (unsigned)") {
+		t.Errorf("expected the unsigned qemu image to fail verification, got %v", err)
+	}
+	if err := os.WriteFile(metaPath, signedMeta, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A key which didn't sign anything.
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVerifier, err := NewSigstoreVerifier(other.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range build.VerifySignatures(dir, otherVerifier) {
+		if r.Type == SignatureSigstoreBundle && r.Status != SignatureInvalid {
+			t.Errorf("%s: expected invalid, got %s", r.Signature, r.Status)
+		}
+	}
+
+	// Tampering with an artifact breaks its signatures, and reading the
+	// build.
+	if err := os.WriteFile(filepath.Join(dir, "disk.qcow2"), []byte("QEMU"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range build.VerifySignatures(dir, pgpVerifier, bundleVerifier) {
+		want := SignatureValid
+		if r.Name == "qemu" {
+			want = SignatureInvalid
+		}
+		if r.Status != want {
+			t.Errorf("%s: expected %s, got %s", r.Signature, want, r.Status)
+		}
+	}
+	if _, _, err := ReadBuildVerified(top, "41.1", "x86_64", pgpVerifier, bundleVerifier); err == nil {
+		t.Error("read a build with invalid signatures")
+	}
+	// ReadBuild doesn't check signatures.
+	if _, _, err := ReadBuild(top, "41.1", "x86_64"); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := ReadBuildVerified(top, "41.1", "x86_64"); err == nil {
+		t.Error("read a build without verifiers")
+	}
+	// Nor is a tampered artifact signed.
+	if _, err := SignBuild(dir, pgpSigner, "qemu"); err == nil {
+		t.Error("signed an artifact not matching meta.json")
+	}
+
+	// A missing signature fails too.
+	if err := os.Remove(filepath.Join(dir, "ostree.ociarchive.sig")); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range build.VerifySignatures(dir, pgpVerifier) {
+		if r.Name == "ostree" && r.Status != SignatureMissing {
+			t.Errorf("%s: expected missing, got %s", r.Signature, r.Status)
+		}
+	}
+}
+
+func TestOpenPGPVerifierExpiredKey(t *testing.T) {
+	created := time.Now().Add(-2 * time.Hour)
+	config := &packet.Config{Time: func() time.Time { return created }, KeyLifetimeSecs: 3600}
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, entity, strings.NewReader("qemu"), config); err != nil {
+		t.Fatal(err)
+	}
+	v := NewOpenPGPVerifier(openpgp.EntityList{entity})
+	if _, err := v.Verify(strings.NewReader("qemu"), sig.Bytes()); err == nil {
+		t.Error("verified a signature of an expired key")
+	}
+}
+
+func TestVerifySignaturesAfterCompress(t *testing.T) {
+	top, dir := writeSignBuild(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigstoreSigner(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewSigstoreVerifier(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignBuild(dir, signer, "qemu"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compress the qemu image as cosa compress does, keeping the
+	// signature of the uncompressed file.
+	compressed := gzipBytes(t, "qemu")
+	if err := os.WriteFile(filepath.Join(dir, "disk.qcow2.gz"), compressed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "disk.qcow2")); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(compressed)
+	metaPath := filepath.Join(dir, CosaMetaJSON)
+	if err := UpdateMeta(metaPath, func(b *Build) error {
+		a := b.BuildArtifacts.Qemu
+		a.UncompressedSha256, a.UncompressedSize = a.Sha256, 4
+		a.Path, a.Sha256, a.SizeInBytes = "disk.qcow2.gz", hex.EncodeToString(sum[:]), float64(len(compressed))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	build, _, err := ReadBuild(top, "41.1", "x86_64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := build.VerifySignatures(dir, verifier)
+	if len(results) != 2 || results[1].Name != "qemu" || results[1].Status != SignatureValid {
+		t.Fatalf("expected the compressed qemu image to verify, got %+v", results)
+	}
+
+	// A signature recorded as being of another file isn't checked.
+	signedMeta, err := os.ReadFile(metaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateMeta(metaPath, func(b *Build) error {
+		b.BuildArtifacts.Qemu.Signatures[0].Sha256 = strings.Repeat("c", 64)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if build, _, err = ReadBuild(top, "41.1", "x86_64"); err != nil {
+		t.Fatal(err)
+	}
+	if r := build.VerifySignatures(dir, verifier)[1]; r.Status != SignatureInvalid || !strings.Contains(r.Error, "sha256 "+strings.Repeat("c", 64)) {
+		t.Errorf("expected a signature of another file to be invalid, got %+v", r)
+	}
+
+	// Nor does a swapped compressed file.
+	if err := os.WriteFile(metaPath, signedMeta, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "disk.qcow2.gz"), gzipBytes(t, "evil"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if build, _, err = ReadBuild(top, "41.1", "x86_64"); err != nil {
+		t.Fatal(err)
+	}
+	if r := build.VerifySignatures(dir, verifier)[1]; r.Status != SignatureInvalid {
+		t.Errorf("expected a swapped compressed file to be invalid, got %+v", r)
+	}
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
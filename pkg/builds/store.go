@@ -0,0 +1,342 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// errListUnsupported is returned by object stores which can't list the
+// files of a directory.
+var errListUnsupported = errors.New("listing is not supported")
+
+// BuildStore is a builds directory, either local or a copy of one served
+// over HTTP(S) or from an S3 bucket. Missing files are reported with
+// errors wrapping os.ErrNotExist.
+type BuildStore interface {
+	// GetBuilds reads builds.json.
+	GetBuilds(ctx context.Context) (*BuildsJSON, error)
+	// ReadBuild reads the meta.json of a build, merging in its
+	// meta.*.json files when the build has a delayed meta merge. Stores
+	// which can't list them fail to read such builds. If buildID is
+	// empty, the latest build of arch is read.
+	ReadBuild(ctx context.Context, buildID, arch string) (*Build, error)
+	// OpenArtifact streams a file of the directory of a build, e.g. the
+	// path of one of its artifacts.
+	OpenArtifact(ctx context.Context, buildID, arch, name string) (io.ReadCloser, error)
+}
+
+// objectStore is the storage behind a BuildStore. Keys are relative to
+// the builds directory and use slashes.
+type objectStore interface {
+	get(ctx context.Context, key string) (io.ReadCloser, error)
+	// list returns the names of the files directly under the
+	// directory prefix.
+	list(ctx context.Context, prefix string) ([]string, error)
+	String() string
+}
+
+type buildStore struct {
+	objects objectStore
+}
+
+// NewLocalBuildStore returns the store of a local builds directory.
+func NewLocalBuildStore(dir string) BuildStore {
+	return &buildStore{objects: localObjects(dir)}
+}
+
+// NewHTTPBuildStore returns the store of a builds directory served at
+// baseURL. As HTTP can't list directories, the builds with a delayed meta
+// merge can't be read. If client is nil, http.DefaultClient is used.
+func NewHTTPBuildStore(baseURL string, client *http.Client) BuildStore {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &buildStore{objects: &httpObjects{base: strings.TrimSuffix(baseURL, "/"), client: client}}
+}
+
+// NewS3BuildStore returns the store of a builds directory kept under
+// prefix in an S3 bucket.
+func NewS3BuildStore(client *s3.Client, bucket, prefix string) BuildStore {
+	return &buildStore{objects: &s3Objects{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}}
+}
+
+// OpenBuildStore returns the store at location, which is either an
+// http:// or https:// URL, an s3://bucket/prefix URL or a local
+// directory. S3 uses the default AWS configuration; when it sets an
+// endpoint, e.g. with AWS_ENDPOINT_URL for a MinIO server, path-style
+// addressing is used.
+func OpenBuildStore(ctx context.Context, location string) (BuildStore, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" {
+		return NewLocalBuildStore(location), nil
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return NewHTTPBuildStore(location, nil), nil
+	case "s3":
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("loading AWS configuration: %w", err)
+		}
+		client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.UsePathStyle = o.BaseEndpoint != nil
+		})
+		return NewS3BuildStore(client, u.Host, u.Path), nil
+	case "file":
+		return NewLocalBuildStore(u.Path), nil
+	}
+	return nil, fmt.Errorf("unsupported build store %s", location)
+}
+
+func (s *buildStore) readJSON(ctx context.Context, key string, v interface{}) error {
+	r, err := s.objects.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("parsing %s/%s: %w", s.objects, key, err)
+	}
+	return nil
+}
+
+// checkPathComponent fails unless s is a single path component, so that
+// joining it onto the builds directory can't escape it.
+func checkPathComponent(what, s string) error {
+	if s == "" || s == "." || s == ".." || strings.ContainsAny(s, `/\`) {
+		return fmt.Errorf("invalid %s %q", what, s)
+	}
+	return nil
+}
+
+func (s *buildStore) GetBuilds(ctx context.Context) (*BuildsJSON, error) {
+	b := &BuildsJSON{}
+	if err := s.readJSON(ctx, CosaBuildsJSON, b); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNoBuildsFound
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (s *buildStore) ReadBuild(ctx context.Context, buildID, arch string) (*Build, error) {
+	if arch == "" {
+		arch = BuilderArch()
+	}
+	if buildID == "" {
+		b, err := s.GetBuilds(ctx)
+		if err != nil {
+			return nil, err
+		}
+		latest, ok := b.getLatest(arch)
+		if !ok {
+			return nil, ErrNoBuildsFound
+		}
+		buildID = latest
+	}
+	if err := checkPathComponent("build ID", buildID); err != nil {
+		return nil, err
+	}
+	if err := checkPathComponent("architecture", arch); err != nil {
+		return nil, err
+	}
+
+	dir := path.Join(buildID, arch)
+	r, err := s.objects.get(ctx, path.Join(dir, CosaMetaJSON))
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s/%s: %w", s.objects, dir, err)
+	}
+	b, err := buildParser(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", s.objects, dir, err)
+	}
+	if !b.CosaDelayedMetaMerge {
+		return b, nil
+	}
+
+	// Without its meta.*.json files the build would silently lack the
+	// artifacts and cloud images they add, so fail rather than return it.
+	names, err := s.objects.list(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("listing the meta.json files of %s/%s for its delayed merge: %w", s.objects, dir, err)
+	}
+	var meta map[string]interface{}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("parsing %s/%s/%s: %w", s.objects, dir, CosaMetaJSON, err)
+	}
+	var fragments []metaFragment
+	for _, name := range names {
+		if name == CosaMetaJSON || !IsMetaJSON(name) {
+			continue
+		}
+		log.WithField("extra meta.json", name).Info("found meta")
+		f := metaFragment{name: name}
+		if err := s.readJSON(ctx, path.Join(dir, name), &f.data); err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, f)
+	}
+	b, err = foldBuildJSON(meta, fragments)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", s.objects, dir, err)
+	}
+	return b, nil
+}
+
+func (s *buildStore) OpenArtifact(ctx context.Context, buildID, arch, name string) (io.ReadCloser, error) {
+	for _, c := range []struct{ what, s string }{{"build ID", buildID}, {"architecture", arch}, {"artifact", name}} {
+		if err := checkPathComponent(c.what, c.s); err != nil {
+			return nil, err
+		}
+	}
+	return s.objects.get(ctx, path.Join(buildID, arch, name))
+}
+
+// localObjects is a local builds directory.
+type localObjects string
+
+func (l localObjects) String() string {
+	return string(l)
+}
+
+func (l localObjects) get(_ context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(l), filepath.FromSlash(key)))
+}
+
+func (l localObjects) list(_ context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(string(l), filepath.FromSlash(prefix)))
+	if err != nil {
+		return nil, err
+	}
+	var ret []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			ret = append(ret, e.Name())
+		}
+	}
+	return ret, nil
+}
+
+// httpObjects is a builds directory served over HTTP(S).
+type httpObjects struct {
+	base   string
+	client *http.Client
+}
+
+func (h *httpObjects) String() string {
+	return h.base
+}
+
+func (h *httpObjects) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	u := h.base + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: %w", u, os.ErrNotExist)
+	case res.StatusCode != http.StatusOK:
+		res.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", u, res.Status)
+	}
+	return res.Body, nil
+}
+
+func (h *httpObjects) list(context.Context, string) ([]string, error) {
+	return nil, errListUnsupported
+}
+
+// s3Objects is a builds directory in an S3 bucket.
+type s3Objects struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func (o *s3Objects) String() string {
+	return "s3://" + path.Join(o.bucket, o.prefix)
+}
+
+func (o *s3Objects) key(key string) string {
+	if o.prefix == "" {
+		return key
+	}
+	return o.prefix + "/" + key
+}
+
+func (o *s3Objects) get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := o.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(o.bucket),
+		Key:    aws.String(o.key(key)),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, fmt.Errorf("%s/%s: %w", o, key, os.ErrNotExist)
+		}
+		return nil, fmt.Errorf("fetching %s/%s: %w", o, key, err)
+	}
+	return out.Body, nil
+}
+
+func (o *s3Objects) list(ctx context.Context, prefix string) ([]string, error) {
+	dir := o.key(prefix) + "/"
+	p := s3.NewListObjectsV2Paginator(o.client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(o.bucket),
+		Prefix:    aws.String(dir),
+		Delimiter: aws.String("/"),
+	})
+	var ret []string
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			ret = append(ret, strings.TrimPrefix(aws.ToString(obj.Key), dir))
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,216 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// writeStoreFixture creates a builds directory with a build whose meta
+// merge is delayed, and an older one whose meta.json is complete.
+func writeStoreFixture(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		CosaBuildsJSON: `{"schema-version": "1.0.0", "builds": [` +
+			`{"id": "41.2", "arches": ["x86_64"]}, {"id": "41.1", "arches": ["x86_64"]}]}`,
+		"41.2/x86_64/meta.json": `{"buildid": "41.2", "name": "fedora-coreos", "ostree-commit": "bbbb",
+			"ostree-timestamp": "", "ostree-version": "41.2", "coreos-assembler.delayed-meta-merge": true}`,
+		"41.2/x86_64/meta.gcp.json":   `{"gcp": {"image": "fedora-coreos-41-2", "url": "https://example.com/gcp"}}`,
+		"41.2/x86_64/meta.azure.json": `{"azure": {"image": "fedora-coreos-41.2.vhd", "url": "https://example.com/azure"}}`,
+		"41.1/x86_64/meta.json": `{"buildid": "41.1", "name": "fedora-coreos", "ostree-commit": "aaaa",
+			"ostree-timestamp": "", "ostree-version": "41.1", "images": {"qemu": {"path": "fcos-qemu.qcow2", "sha256": "x"}}}`,
+		"41.1/x86_64/fcos-qemu.qcow2": "disk image",
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// fakeS3 serves dir as the bucket "builds" with path-style addressing,
+// implementing just enough of GetObject and ListObjectsV2.
+func fakeS3(t *testing.T, dir string) *httptest.Server {
+	type object struct {
+		Key string `xml:"Key"`
+	}
+	type listResult struct {
+		XMLName     xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name        string   `xml:"Name"`
+		Prefix      string   `xml:"Prefix"`
+		KeyCount    int      `xml:"KeyCount"`
+		IsTruncated bool     `xml:"IsTruncated"`
+		Contents    []object `xml:"Contents"`
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := strings.CutPrefix(r.URL.Path, "/builds/")
+		if !ok && r.URL.Path != "/builds" {
+			http.Error(w, "no such bucket", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("list-type") == "2" {
+			prefix := r.URL.Query().Get("prefix")
+			res := listResult{Name: "builds", Prefix: prefix}
+			entries, _ := os.ReadDir(filepath.Join(dir, filepath.FromSlash(prefix)))
+			for _, e := range entries {
+				if !e.IsDir() {
+					res.Contents = append(res.Contents, object{Key: prefix + e.Name()})
+				}
+			}
+			res.KeyCount = len(res.Contents)
+			w.Header().Set("Content-Type", "application/xml")
+			if err := xml.NewEncoder(w).Encode(res); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(key)))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+}
+
+func testStore(t *testing.T, store BuildStore, canList bool) {
+	ctx := context.Background()
+	b, err := store.GetBuilds(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Builds) != 2 || b.Builds[0].ID != "41.2" {
+		t.Errorf("unexpected builds %+v", b.Builds)
+	}
+
+	// The latest build has a delayed meta merge.
+	latest, err := store.ReadBuild(ctx, "", "x86_64")
+	if !canList {
+		if !errors.Is(err, errListUnsupported) {
+			t.Errorf("expected a delayed meta merge to be unreadable, got %+v, %v", latest, err)
+		}
+	} else if err != nil {
+		t.Fatal(err)
+	} else if latest.BuildID != "41.2" {
+		t.Errorf("expected the latest build, got %s", latest.BuildID)
+	} else if latest.Gcp == nil || latest.Gcp.ImageName != "fedora-coreos-41-2" || latest.Azure == nil {
+		t.Errorf("meta.*.json not merged into %+v", latest)
+	}
+
+	build, err := store.ReadBuild(ctx, "41.1", "x86_64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	qemu, err := build.GetArtifact("qemu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.OpenArtifact(ctx, "41.1", "x86_64", qemu.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "disk image" {
+		t.Errorf("read artifact %q: %v", data, err)
+	}
+
+	if _, err := store.OpenArtifact(ctx, "41.1", "x86_64", "missing.raw"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing artifact to wrap os.ErrNotExist, got %v", err)
+	}
+	for _, args := range [][3]string{
+		{"41.1", "x86_64", "../../builds.json"},
+		{"41.1", "x86_64", "sub/fcos-qemu.qcow2"},
+		{"41.1", "..", "41.1/x86_64/fcos-qemu.qcow2"},
+		{"..", "41.1", "x86_64"},
+		{"41.1", "x86_64", ""},
+	} {
+		if _, err := store.OpenArtifact(ctx, args[0], args[1], args[2]); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %v to be refused, got %v", args, err)
+		}
+	}
+	for _, args := range [][2]string{{"../41.1", "x86_64"}, {"41.1", "../41.1/x86_64"}, {".", "x86_64"}} {
+		if _, err := store.ReadBuild(ctx, args[0], args[1]); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected build %v to be refused, got %v", args, err)
+		}
+	}
+}
+
+func TestLocalBuildStore(t *testing.T) {
+	testStore(t, NewLocalBuildStore(writeStoreFixture(t)), true)
+}
+
+func TestHTTPBuildStore(t *testing.T) {
+	srv := httptest.NewServer(http.FileServer(http.Dir(writeStoreFixture(t))))
+	defer srv.Close()
+	testStore(t, NewHTTPBuildStore(srv.URL+"/", nil), false)
+}
+
+func TestS3BuildStore(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Rename(writeStoreFixture(t), filepath.Join(dir, "prod")); err != nil {
+		t.Fatal(err)
+	}
+	srv := fakeS3(t, dir)
+	defer srv.Close()
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(srv.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("key", "secret", ""),
+	})
+	testStore(t, NewS3BuildStore(client, "builds", "/prod/"), true)
+}
+
+func TestOpenBuildStore(t *testing.T) {
+	for location, want := range map[string]string{
+		"/srv/builds":             "builds.localObjects",
+		"file:///srv/builds":      "builds.localObjects",
+		"https://example.com/b/":  "*builds.httpObjects",
+		"s3://bucket/prefix/prod": "*builds.s3Objects",
+	} {
+		store, err := OpenBuildStore(context.Background(), location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprintf("%T", store.(*buildStore).objects); got != want {
+			t.Errorf("%s: got %s, want %s", location, got, want)
+		}
+	}
+	if _, err := OpenBuildStore(context.Background(), "ftp://example.com"); err == nil {
+		t.Errorf("expected an unsupported scheme to fail")
+	}
+}
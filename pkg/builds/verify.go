@@ -0,0 +1,281 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ArtifactStatus is the outcome of verifying an artifact.
+type ArtifactStatus string
+
+const (
+	// ArtifactOK means that the artifact matches meta.json.
+	ArtifactOK ArtifactStatus = "ok"
+	// ArtifactMissing means that the artifact is not in the build
+	// directory.
+	ArtifactMissing ArtifactStatus = "missing"
+	// ArtifactCorrupt means that the size or digest of the artifact
+	// doesn't match meta.json.
+	ArtifactCorrupt ArtifactStatus = "corrupt"
+	// ArtifactUnverified means that the artifact couldn't be checked,
+	// e.g. because the tool to decompress it is missing.
+	ArtifactUnverified ArtifactStatus = "unverified"
+)
+
+// compressionSuffixes are the extensions added by cosa compress, which
+// records the size and digest of the uncompressed artifact so that it
+// can still be verified after cosa decompress.
+var compressionSuffixes = []string{".xz", ".gz", ".zst"}
+
+// ArtifactVerification is the result of verifying a single artifact.
+type ArtifactVerification struct {
+	Name   string         `json:"name"`
+	Path   string         `json:"path"`
+	Status ArtifactStatus `json:"status"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// VerifyReport is the result of verifying a build directory.
+type VerifyReport struct {
+	Artifacts []ArtifactVerification `json:"artifacts"`
+	// Extra are the files of the build directory which meta.json
+	// doesn't describe as artifacts, besides the meta.json files.
+	Extra []string `json:"extra,omitempty"`
+	// Signatures are the results of VerifySignatures, if requested.
+	Signatures []SignatureVerification `json:"signatures,omitempty"`
+}
+
+// Failed returns the artifacts which are missing or corrupt.
+func (r *VerifyReport) Failed() []ArtifactVerification {
+	var ret []ArtifactVerification
+	for _, a := range r.Artifacts {
+		if a.Status != ArtifactOK {
+			ret = append(ret, a)
+		}
+	}
+	return ret
+}
+
+// Verify checks the artifacts of the build in dir against the sizes and
+// digests recorded in meta.json. Artifacts are checked in parallel.
+func (build *Build) Verify(dir string) (*VerifyReport, error) {
+	if build.BuildArtifacts == nil {
+		return nil, fmt.Errorf("build has no artifacts")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	artifacts := build.artifacts()
+	for name, a := range artifacts {
+		if a.Path != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	report := &VerifyReport{Artifacts: make([]ArtifactVerification, len(names))}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				report.Artifacts[i] = verifyArtifact(dir, names[i], artifacts[names[i]])
+			}
+		}()
+	}
+	for i := range names {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	known := make(map[string]bool)
+	for _, a := range report.Artifacts {
+		known[a.Path] = true
+		known[artifacts[a.Name].Path] = true
+		for _, sig := range artifacts[a.Name].Signatures {
+			known[sig.Path] = true
+		}
+	}
+	for _, e := range entries {
+		if e.IsDir() || known[e.Name()] || IsMetaJSON(e.Name()) {
+			continue
+		}
+		report.Extra = append(report.Extra, e.Name())
+	}
+	return report, nil
+}
+
+// verifyArtifact checks a single artifact, falling back to its
+// uncompressed form if the compressed one isn't there.
+func verifyArtifact(dir, name string, a *Artifact) ArtifactVerification {
+	ret := ArtifactVerification{Name: name, Path: a.Path}
+	size, digest := int64(a.SizeInBytes), a.Sha256
+	if _, err := os.Stat(filepath.Join(dir, a.Path)); os.IsNotExist(err) && a.UncompressedSha256 != "" {
+		for _, suffix := range compressionSuffixes {
+			uncompressed := strings.TrimSuffix(a.Path, suffix)
+			if uncompressed == a.Path {
+				continue
+			}
+			if _, err := os.Stat(filepath.Join(dir, uncompressed)); err == nil {
+				ret.Path = uncompressed
+				size, digest = int64(a.UncompressedSize), a.UncompressedSha256
+				break
+			}
+		}
+	}
+
+	ret.Status, ret.Error = checkFile(filepath.Join(dir, ret.Path), size, digest)
+	return ret
+}
+
+// checkFile compares the size and SHA-256 digest of a file to the
+// expected ones, either of which may be unset.
+func checkFile(path string, size int64, digest string) (ArtifactStatus, string) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ArtifactMissing, ""
+	} else if err != nil {
+		return ArtifactCorrupt, err.Error()
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return ArtifactCorrupt, err.Error()
+	}
+	// Check the size first, which catches truncated files cheaply.
+	if size != 0 && st.Size() != size {
+		return ArtifactCorrupt, fmt.Sprintf("size is %d, expected %d", st.Size(), size)
+	}
+	if digest == "" {
+		return ArtifactOK, ""
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ArtifactCorrupt, err.Error()
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != digest {
+		return ArtifactCorrupt, fmt.Sprintf("sha256 is %s, expected %s", sum, digest)
+	}
+	return ArtifactOK, ""
+}
+
+// isCompressed reports whether path has the extension of a file
+// compressed by cosa compress.
+func isCompressed(path string) bool {
+	for _, suffix := range compressionSuffixes {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// uncompressedReader reads the output of a decompression tool, and
+// reports its failure on Close.
+type uncompressedReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *uncompressedReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// openUncompressed returns the uncompressed contents of a file which cosa
+// compress compressed, going by its extension. Files compressed with xz
+// and zstd are decompressed with those tools, and a missing tool gives an
+// error wrapping exec.ErrNotFound.
+func openUncompressed(path string) (io.ReadCloser, error) {
+	var tool string
+	switch filepath.Ext(path) {
+	case ".gz":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, f}, nil
+	case ".xz":
+		tool = "xz"
+	case ".zst":
+		tool = "zstd"
+	default:
+		return nil, fmt.Errorf("%s isn't compressed", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(tool, "-dc", path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &uncompressedReader{stdout, cmd}, nil
+}
+
+// checkUncompressed compares the SHA-256 digest of the uncompressed
+// contents of a compressed file to the expected one.
+func checkUncompressed(path, digest string) (ArtifactStatus, string) {
+	r, err := openUncompressed(path)
+	if os.IsNotExist(err) {
+		return ArtifactMissing, ""
+	} else if errors.Is(err, exec.ErrNotFound) {
+		return ArtifactUnverified, err.Error()
+	} else if err != nil {
+		return ArtifactCorrupt, err.Error()
+	}
+	h := sha256.New()
+	_, err = io.Copy(h, r)
+	if closeErr := r.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ArtifactCorrupt, fmt.Sprintf("decompressing: %v", err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != digest {
+		return ArtifactCorrupt, fmt.Sprintf("uncompressed sha256 is %s, expected %s", sum, digest)
+	}
+	return ArtifactOK, ""
+}
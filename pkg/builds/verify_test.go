@@ -0,0 +1,131 @@
+// Copyright 2026 Red Hat
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) *Artifact {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(content))
+		return &Artifact{Path: name, Sha256: hex.EncodeToString(sum[:]), SizeInBytes: float64(len(content))}
+	}
+
+	ostree := write("ostree.ociarchive", "ostree")
+	qemu := write("disk.qcow2", "qemu")
+	metal := write("disk.raw", "metal")
+	aws := write("disk.vmdk", "aws")
+	extensions := write("extensions.tar", "extensions")
+	write("meta.json", "{}")
+	write("commitmeta.json", "{}")
+	// The compressed qemu image was decompressed.
+	qemu = &Artifact{
+		Path:               "disk.qcow2.xz",
+		Sha256:             "0000",
+		UncompressedSha256: qemu.Sha256,
+		UncompressedSize:   int(qemu.SizeInBytes),
+	}
+	// Truncate metal and remove aws.
+	if err := os.WriteFile(filepath.Join(dir, "disk.raw"), []byte("met"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "disk.vmdk")); err != nil {
+		t.Fatal(err)
+	}
+	// Same size, different content.
+	extensions.Sha256 = ostree.Sha256
+
+	build := &Build{
+		BuildArtifacts: &BuildArtifacts{
+			Ostree: *ostree,
+			Qemu:   qemu,
+			Metal:  metal,
+			Aws:    aws,
+		},
+		Extensions: &Extensions{Path: extensions.Path, Sha256: extensions.Sha256},
+	}
+	report, err := build.Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := make(map[string]ArtifactStatus)
+	for _, a := range report.Artifacts {
+		statuses[a.Name] = a.Status
+	}
+	want := map[string]ArtifactStatus{
+		"ostree":     ArtifactOK,
+		"qemu":       ArtifactOK,
+		"metal":      ArtifactCorrupt,
+		"aws":        ArtifactMissing,
+		"extensions": ArtifactCorrupt,
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("got %v, expected %v", statuses, want)
+	}
+	if len(report.Failed()) != 3 {
+		t.Errorf("got failures %v", report.Failed())
+	}
+	if !reflect.DeepEqual(report.Extra, []string{"commitmeta.json"}) {
+		t.Errorf("got extra files %v", report.Extra)
+	}
+}
+
+func TestCheckUncompressed(t *testing.T) {
+	dir := t.TempDir()
+	sum := sha256.Sum256([]byte("qemu"))
+	digest := hex.EncodeToString(sum[:])
+	gz := filepath.Join(dir, "fcos.qcow2.gz")
+	if err := os.WriteFile(gz, gzipBytes(t, "qemu"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status, msg := checkUncompressed(gz, digest); status != ArtifactOK {
+		t.Errorf("expected %s to verify, got %s %s", gz, status, msg)
+	}
+	if status, _ := checkUncompressed(gz, strings.Repeat("0", 64)); status != ArtifactCorrupt {
+		t.Errorf("expected a digest mismatch to be corrupt, got %s", status)
+	}
+	notGzip := filepath.Join(dir, "bad.gz")
+	if err := os.WriteFile(notGzip, []byte("qemu"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := checkUncompressed(notGzip, digest); status != ArtifactCorrupt {
+		t.Errorf("expected an invalid gzip file to be corrupt, got %s", status)
+	}
+	if status, _ := checkUncompressed(filepath.Join(dir, "gone.gz"), digest); status != ArtifactMissing {
+		t.Errorf("expected a missing file, got %s", status)
+	}
+
+	// Without xz, the digest can't be checked.
+	xz := filepath.Join(dir, "fcos.qcow2.xz")
+	if err := os.WriteFile(xz, []byte("qemu"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	if status, _ := checkUncompressed(xz, digest); status != ArtifactUnverified {
+		t.Errorf("expected %s to be unverified, got %s", xz, status)
+	}
+}
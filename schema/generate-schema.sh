@@ -40,6 +40,10 @@ ${schematyper} \
 # can vary depending on local checkout paths.
 sed -e "s|^// generated.*|// generated by 'make schema'\n// source hash: ${digest}|g"  -i ${tdir}/cosa_v1.go
 
+# The package and advisory diff items are positional arrays, which
+# schematyper can't turn into structs; pkg/builds/packages.go defines them.
+sed -e '/^type \(PackageSetDifferencesItems\|AdvisoryDiffItems\) /,/^$/d' -i ${tdir}/cosa_v1.go
+
 cat > "${tdir}/schema_doc.go" <<EOM
 // Generated by ${0}
 // Source hash: ${digest}
@@ -24,6 +24,21 @@ runv() {
     "$@"
 }
 
+# Mark the start and end of a build phase in the build-event log, which
+# `cosa timings` summarizes. The cosa dispatcher and cosash read the
+# markers from the fd in COSA_EVENT_FD; they're dropped otherwise.
+phase_start() {
+    if [ -n "${COSA_EVENT_FD:-}" ]; then
+        { printf '\036phase-start %s\n' "$1" >&"${COSA_EVENT_FD}"; } 2>/dev/null || :
+    fi
+}
+
+phase_end() {
+    if [ -n "${COSA_EVENT_FD:-}" ]; then
+        { printf '\036phase-end %s\n' "$1" >&"${COSA_EVENT_FD}"; } 2>/dev/null || :
+    fi
+}
+
 # Get target base architecture
 basearch=$(python3 -c '
 import gi
@@ -179,6 +194,7 @@ should_build_with_buildah() {
 # have moved away from legacy building (i.e. delete or overwrite cmd-build
 # and delete cmd-fetch)
 prepare_build() {
+    phase_start prepare-build
     preflight
     preflight_kvm
     workdir="$(pwd)"
@@ -306,6 +322,7 @@ prepare_build() {
     export changed_stamp
     overrides_active_stamp=${TMPDIR}/overrides.stamp
     export overrides_active_stamp
+    phase_end prepare-build
 }
 
 commit_overlay() {
@@ -605,6 +622,7 @@ runcompose_tree() {
 
     echo "Running: $*"
 
+    phase_start compose
     # this is the heart of the privs vs no privs dual path
     if has_privileges; then
         set - "$@" --repo "${repo}" --write-composejson-to "${composejson}"
@@ -618,6 +636,7 @@ runcompose_tree() {
     else
         runvm_with_cache -- "$@" --repo "${repo}" --write-composejson-to "${composejson}"
     fi
+    phase_end compose
 }
 
 # Run with cache disk.
@@ -729,6 +748,7 @@ runvm() {
     local runvm_console="${tmp_builddir}/runvm-console.txt"
     local rc_file="${tmp_builddir}/rc"
 
+    phase_start runvm
     mkdir -p "${vmpreparedir}" "${vmbuilddir}"
 
     local rpms
@@ -870,6 +890,7 @@ EOF
         fatal "Couldn't find rc file; failure inside supermin init?"
     fi
     rc="$(cat "${rc_file}")"
+    phase_end runvm
 
     if [ -n "${cleanup_tmpdir:-}" ]; then
         rm -rf "${tmp_builddir}"